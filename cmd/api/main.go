@@ -3,7 +3,8 @@ package main
 import (
 	"krackenservices.com/agentAI/internal/config"
 	"krackenservices.com/agentAI/internal/server"
-	"log"
+	"log/slog"
+	"os"
 
 	_ "krackenservices.com/agentAI/swdocs" // swagger docs generated by swag
 )
@@ -13,15 +14,30 @@ import (
 // @description This is the agentAI API.
 // @host localhost:8080
 // @BasePath /
+// @securityDefinitions.apikey ApiKeyAuth
+// @in header
+// @name X-API-Key
+// @description Static API key from auth.api_keys.
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description "Bearer <token>": an API key, the admin token or a JWT signed by a key of auth.jwt.jwks_file.
 func main() {
+	// Build the tool registry from the manifests of the binaries in the tools directory.
+	if err := server.DiscoverTools(); err != nil {
+		slog.Error("Error discovering tools", "error", err)
+	}
+
 	// Load config (adjust the path as needed)
 	cfg, err := config.LoadConfig("")
 	if err != nil {
-		log.Fatalf("Error loading config: %v", err)
+		slog.Error("Error loading config", "error", err)
+		os.Exit(1)
 	}
 
 	// Start your API server.
 	if err := server.StartServer(cfg); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+		slog.Error("Server failed to start", "error", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+
+	"krackenservices.com/agentAI/internal/batch"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+)
+
+// batchReport is the summary of a batch run by the CLI.
+type batchReport struct {
+	// Total is the number of requests in the input; Resumed how many had a result from an
+	// earlier run.
+	Total   int `json:"total"`
+	Resumed int `json:"resumed"`
+	// Interrupted is set when the run was stopped before every request had a result.
+	Interrupted bool `json:"interrupted,omitempty"`
+	batch.Summary
+}
+
+var batchCommand = &command{
+	name:    "batch",
+	summary: "Run the chat requests of a JSONL file in-process, resuming where an earlier run stopped",
+	setup: func(fs *flag.FlagSet) func([]string) int {
+		configPath := fs.String("config", "", "Path to the config file (defaults to config.yaml next to the binary)")
+		toolsDir := fs.String("tools", "", "Directory to discover tools in (defaults to tools/ next to the binary)")
+		in := fs.String("in", "", "JSONL `file` of requests, one {\"id\", \"model\", \"message\"} per line (required)")
+		out := fs.String("out", "", "JSONL `file` the results are appended to, and resumed from (required)")
+		concurrency := fs.Int("concurrency", batch.DefaultConcurrency, "Number of requests run at a time")
+		retryFailed := fs.Bool("retry-failed", false, "Run the requests that failed in an earlier run again")
+		verbose := fs.Bool("v", false, "Print each result to stderr as it finishes")
+		report := outputFlag(fs, formatTable)
+		return func([]string) int {
+			if *in == "" || *out == "" {
+				fmt.Fprintln(os.Stderr, "Error: -in and -out are required")
+				return exitUsage
+			}
+			if *concurrency < 1 {
+				fmt.Fprintln(os.Stderr, "Error: -concurrency must be at least 1")
+				return exitUsage
+			}
+
+			discoverTools(*toolsDir)
+			cfg, err := config.LoadConfig(*configPath)
+			if err != nil {
+				return fail(err)
+			}
+			r, err := runBatch(cfg, *in, *out, *concurrency, *retryFailed, *verbose)
+			if err != nil {
+				return fail(err)
+			}
+			code := show(*report, r, func(w io.Writer) { printBatchReport(w, r) })
+			if code == exitOK && (r.Interrupted || r.Failed > 0) {
+				return exitError
+			}
+			return code
+		}
+	},
+}
+
+// runBatch runs the requests of the file in that have no result in the file out yet, and
+// appends their results to it. Ctrl-C stops the run; running it again resumes it.
+func runBatch(cfg *config.Config, in, out string, concurrency int, retryFailed, verbose bool) (batchReport, error) {
+	input, err := os.Open(in)
+	if err != nil {
+		return batchReport{}, err
+	}
+	defer input.Close()
+	total, err := batch.CountRequests(input)
+	if err != nil {
+		return batchReport{}, err
+	}
+	if _, err := input.Seek(0, io.SeekStart); err != nil {
+		return batchReport{}, err
+	}
+
+	results, err := batch.ReadResults(out)
+	if err != nil {
+		return batchReport{}, err
+	}
+	done := batch.Done(results, retryFailed)
+	if retryFailed {
+		var kept []batch.Result
+		for _, r := range results {
+			if !r.Failed() {
+				kept = append(kept, r)
+			}
+		}
+		results = kept
+	}
+	w, err := batch.Create(out, retryFailed)
+	if err != nil {
+		return batchReport{}, err
+	}
+	defer w.Close()
+
+	closeLocal, err := openLocal(cfg)
+	if err != nil {
+		return batchReport{}, err
+	}
+	defer closeLocal()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	p := &batch.Processor{
+		Concurrency: concurrency,
+		Exec:        handlers.BatchExecutor(cfg, localPrincipal),
+		Done:        done,
+	}
+	err = p.Process(ctx, input, func(r batch.Result) error {
+		if verbose {
+			status := "ok"
+			if r.Failed() {
+				status = "error: " + r.Error
+			}
+			fmt.Fprintf(os.Stderr, "[line %d %s] %dms %s\n", r.Line, r.ID, r.LatencyMS, status)
+		}
+		results = append(results, r)
+		return w.Write(r)
+	})
+	if err != nil {
+		return batchReport{}, err
+	}
+	return batchReport{
+		Total:       total,
+		Resumed:     len(done),
+		Interrupted: ctx.Err() != nil,
+		Summary:     batch.Summarize(results),
+	}, nil
+}
+
+// printBatchReport prints the summary of a batch, with the failures by error.
+func printBatchReport(w io.Writer, r batchReport) {
+	status := "completed"
+	if r.Interrupted {
+		status = "interrupted: run the same command again to resume"
+	}
+	l := r.Latency
+	fields(w,
+		"Status", status,
+		"Requests", strconv.Itoa(r.Total),
+		"Resumed", strconv.Itoa(r.Resumed),
+		"Succeeded", strconv.Itoa(r.Succeeded),
+		"Failed", strconv.Itoa(r.Failed),
+		"Prompt tokens", strconv.Itoa(r.PromptTokens),
+		"Completion tokens", strconv.Itoa(r.CompletionTokens),
+		"Latency (ms)", fmt.Sprintf("min %d, mean %d, p50 %d, p95 %d, max %d", l.Min, l.Mean, l.P50, l.P95, l.Max),
+	)
+	if len(r.Errors) == 0 {
+		return
+	}
+	errs := make([]string, 0, len(r.Errors))
+	for e := range r.Errors {
+		errs = append(errs, e)
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		if r.Errors[errs[i]] != r.Errors[errs[j]] {
+			return r.Errors[errs[i]] > r.Errors[errs[j]]
+		}
+		return errs[i] < errs[j]
+	})
+	fmt.Fprintln(w)
+	t := newTable(w, "FAILED", "ERROR")
+	for _, e := range errs {
+		t.row(strconv.Itoa(r.Errors[e]), e)
+	}
+	t.flush()
+}
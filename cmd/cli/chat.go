@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"krackenservices.com/agentAI/internal/agent"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+	"krackenservices.com/agentAI/internal/session"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+const chatHelp = `Enter a message to send it. End a line with \ to continue it on the next line, or
+enclose several lines in """ lines. Ctrl-C cancels a reply, Ctrl-D exits.
+
+  /model [id]     show or switch the model of the next messages
+  /tools          list the tools the model may call
+  /reset          start a new session with the current model
+  /save <file>    save the session to a file
+  /load <file>    continue a saved session in a new session
+  /history [n]    show the last n inputs (default 20)
+  /session        show the session ID, to resume it with -session
+  /exit           leave (the session is kept on the server)`
+
+// defaultHistoryPath is where the chat REPL records its input.
+func defaultHistoryPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "agentai", "chat_history")
+}
+
+// chat is an interactive session with the agent on the server.
+type chat struct {
+	client  *client
+	session session.Session
+	model   string
+	in      *bufio.Reader
+	out     io.Writer
+	history string
+}
+
+// setupChat declares the flags of the chat REPL.
+func setupChat(fs *flag.FlagSet) func([]string) int {
+	model := fs.String("model", "", "Model to chat with (defaults to the model of a resumed session)")
+	resume := fs.String("session", "", "ID of a session to resume")
+	history := fs.String("history", defaultHistoryPath(), "File recording the input history (empty to disable)")
+	return func([]string) int {
+		return runChat(*model, *resume, *history)
+	}
+}
+
+// runChat runs the chat REPL and returns the process exit code.
+func runChat(model, resume, history string) int {
+	c, err := newClient()
+	if err != nil {
+		return fail(err)
+	}
+	ch := &chat{client: c, model: model, in: bufio.NewReader(os.Stdin), out: os.Stdout, history: history}
+	ctx := context.Background()
+	switch {
+	case resume != "":
+		if err := ch.client.do(ctx, http.MethodGet, "/api/v1/sessions/"+resume, nil, &ch.session); err != nil {
+			return fail(fmt.Errorf("resuming session %s: %w", resume, err))
+		}
+		if ch.model == "" {
+			ch.model = ch.session.Model
+		}
+		fmt.Fprintf(ch.out, "Resumed session %s (%d messages) with model %s.\n", ch.session.ID, len(ch.session.Messages), ch.model)
+	case ch.model == "":
+		fmt.Fprintln(os.Stderr, "Error: -model is required unless a session is resumed")
+		return exitUsage
+	default:
+		if err := ch.create(ctx, nil); err != nil {
+			return fail(fmt.Errorf("starting a session: %w", err))
+		}
+		fmt.Fprintf(ch.out, "Session %s with model %s.\n", ch.session.ID, ch.model)
+	}
+	fmt.Fprintln(ch.out, "Type /help for commands, Ctrl-D to exit.")
+
+	for {
+		input, err := ch.read()
+		if err != nil {
+			fmt.Fprintln(ch.out)
+			return exitOK
+		}
+		if input == "" {
+			continue
+		}
+		ch.record(input)
+		if strings.HasPrefix(input, "/") {
+			if quit := ch.command(ctx, input); quit {
+				return exitOK
+			}
+			continue
+		}
+		if err := ch.send(input); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+}
+
+// read reads the next input: a line, lines joined by trailing backslashes, or the lines
+// between two """ lines.
+func (ch *chat) read() (string, error) {
+	fmt.Fprint(ch.out, "you> ")
+	line, err := ch.readLine()
+	if err != nil {
+		return "", err
+	}
+	var lines []string
+	if strings.TrimSpace(line) == `"""` {
+		for {
+			fmt.Fprint(ch.out, "...> ")
+			if line, err = ch.readLine(); err != nil || strings.TrimSpace(line) == `"""` {
+				break
+			}
+			lines = append(lines, line)
+		}
+		return strings.TrimSpace(strings.Join(lines, "\n")), nil
+	}
+	for strings.HasSuffix(line, `\`) {
+		lines = append(lines, strings.TrimSuffix(line, `\`))
+		fmt.Fprint(ch.out, "...> ")
+		if line, err = ch.readLine(); err != nil {
+			break
+		}
+	}
+	lines = append(lines, line)
+	return strings.TrimSpace(strings.Join(lines, "\n")), nil
+}
+
+// readLine reads a line without its line ending. A last line without one is returned
+// without error.
+func (ch *chat) readLine() (string, error) {
+	line, err := ch.in.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// record appends input to the history file.
+func (ch *chat) record(input string) {
+	if ch.history == "" {
+		return
+	}
+	os.MkdirAll(filepath.Dir(ch.history), 0700)
+	f, err := os.OpenFile(ch.history, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	// Multi-line inputs are kept on one line.
+	fmt.Fprintln(f, strings.ReplaceAll(input, "\n", `\n`))
+}
+
+// create starts a new session with the current model and messages.
+func (ch *chat) create(ctx context.Context, messages interface{}) error {
+	body := map[string]interface{}{"model": ch.model}
+	if messages != nil {
+		body["messages"] = messages
+	}
+	return ch.client.do(ctx, http.MethodPost, "/api/v1/sessions", body, &ch.session)
+}
+
+// send sends a message and prints the events of the reply as they arrive. Ctrl-C cancels
+// the reply.
+func (ch *chat) send(message string) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	body := handlers.SessionMessageRequest{Message: message, Model: ch.model}
+	err := ch.client.stream(ctx, "/api/v1/sessions/"+ch.session.ID+"/messages", body, func(event string, data []byte) error {
+		switch event {
+		case agent.EventMessage, agent.EventToolCall, agent.EventToolResult:
+			var e agent.Event
+			if err := json.Unmarshal(data, &e); err != nil {
+				return err
+			}
+			ch.printEvent(e)
+		case "done":
+			var reply handlers.SessionReply
+			if err := json.Unmarshal(data, &reply); err != nil {
+				return err
+			}
+			fmt.Fprintf(ch.out, "(%s, %d iterations, %d tokens)\n", reply.Model,
+				reply.Iterations, reply.Usage.PromptTokens+reply.Usage.CompletionTokens)
+		case "error":
+			e := &apiError{}
+			json.Unmarshal(data, &e.Problem)
+			e.StatusCode = e.Status
+			return e
+		}
+		return nil
+	})
+	if errors.Is(err, context.Canceled) {
+		fmt.Fprintln(ch.out, "(cancelled)")
+		return nil
+	}
+	return err
+}
+
+// printEvent prints a model response, or a tool call or result as an indented block.
+func (ch *chat) printEvent(e agent.Event) {
+	switch e.Type {
+	case agent.EventMessage:
+		fmt.Fprintf(ch.out, "assistant> %s\n", e.Content)
+	case agent.EventToolCall, agent.EventToolResult:
+		title := "tool call"
+		if e.Type == agent.EventToolResult {
+			title = "tool result"
+		}
+		fmt.Fprintf(ch.out, "  ┌─ %s\n", title)
+		for _, line := range strings.Split(strings.TrimRight(e.Content, "\n"), "\n") {
+			fmt.Fprintf(ch.out, "  │ %s\n", line)
+		}
+		fmt.Fprintln(ch.out, "  └─")
+	}
+}
+
+// command runs a slash command and reports whether the REPL should exit.
+func (ch *chat) command(ctx context.Context, input string) bool {
+	fields := strings.Fields(input)
+	name, args := fields[0], fields[1:]
+	var err error
+	switch name {
+	case "/exit", "/quit":
+		return true
+	case "/help":
+		fmt.Fprintln(ch.out, chatHelp)
+	case "/session":
+		fmt.Fprintf(ch.out, "Session %s (%s)\n", ch.session.ID, ch.model)
+	case "/model":
+		err = ch.switchModel(ctx, args)
+	case "/tools":
+		err = ch.listTools(ctx)
+	case "/reset":
+		if err = ch.create(ctx, nil); err == nil {
+			fmt.Fprintf(ch.out, "New session %s with model %s.\n", ch.session.ID, ch.model)
+		}
+	case "/save":
+		err = ch.save(ctx, args)
+	case "/load":
+		err = ch.load(ctx, args)
+	case "/history":
+		err = ch.showHistory(args)
+	default:
+		err = fmt.Errorf("unknown command %s (see /help)", name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	return false
+}
+
+func (ch *chat) switchModel(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(ch.out, "Model: %s\n", ch.model)
+		return nil
+	}
+	var model config.ModelConfig
+	if err := ch.client.do(ctx, http.MethodGet, "/api/v1/models/"+args[0], nil, &model); err != nil {
+		return err
+	}
+	ch.model = model.ID
+	fmt.Fprintf(ch.out, "Switched to model %s.\n", ch.model)
+	return nil
+}
+
+// listTools lists the tools the current model is offered.
+func (ch *chat) listTools(ctx context.Context) error {
+	var model config.ModelConfig
+	if err := ch.client.do(ctx, http.MethodGet, "/api/v1/models/"+ch.model, nil, &model); err != nil {
+		return err
+	}
+	var tools []toolmodel.ToolConfig
+	if err := ch.client.do(ctx, http.MethodGet, "/api/v1/tools", nil, &tools); err != nil {
+		return err
+	}
+	descriptions := make(map[string]string)
+	for _, tool := range tools {
+		descriptions[tool.ID] = tool.Description
+	}
+	n := 0
+	for _, id := range model.Tools {
+		if description, ok := descriptions[id]; ok {
+			fmt.Fprintf(ch.out, "  %s - %s\n", id, description)
+			n++
+		}
+	}
+	if n == 0 {
+		fmt.Fprintf(ch.out, "Model %s has no tools.\n", ch.model)
+	}
+	return nil
+}
+
+func (ch *chat) save(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: /save <file>")
+	}
+	var s session.Session
+	if err := ch.client.do(ctx, http.MethodGet, "/api/v1/sessions/"+ch.session.ID, nil, &s); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(args[0], data, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(ch.out, "Saved %d messages to %s.\n", len(s.Messages), args[0])
+	return nil
+}
+
+func (ch *chat) load(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: /load <file>")
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	var saved session.Session
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("%s: %v", args[0], err)
+	}
+	if saved.Model != "" {
+		ch.model = saved.Model
+	}
+	if err := ch.create(ctx, saved.Messages); err != nil {
+		return err
+	}
+	fmt.Fprintf(ch.out, "Loaded %d messages into new session %s with model %s.\n", len(saved.Messages), ch.session.ID, ch.model)
+	return nil
+}
+
+func (ch *chat) showHistory(args []string) error {
+	n := 20
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n <= 0 {
+			return fmt.Errorf("invalid count %q", args[0])
+		}
+	}
+	if ch.history == "" {
+		return errors.New("the history is disabled")
+	}
+	data, err := os.ReadFile(ch.history)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for _, line := range lines {
+		fmt.Fprintf(ch.out, "  %s\n", line)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"krackenservices.com/agentAI/internal/problem"
+)
+
+// defaultServer is the API server the CLI talks to unless another is configured.
+const defaultServer = "http://localhost:8080"
+
+// apiError is an error response of the API.
+type apiError struct {
+	StatusCode int
+	problem.Problem
+}
+
+func (e *apiError) Error() string {
+	if e.Detail != "" {
+		return e.Detail
+	}
+	return fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// client calls the API of a server.
+type client struct {
+	server  string
+	apiKey  string
+	token   string
+	timeout time.Duration
+	http    *http.Client
+}
+
+// newClient returns a client for the server selected by the global flags, the environment
+// and the CLI profile file.
+func newClient() (*client, error) {
+	c, err := resolveContext()
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := c.timeout()
+	if err != nil {
+		return nil, err
+	}
+	transport, err := c.transport(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &client{
+		server:  c.baseURL(),
+		apiKey:  c.APIKey,
+		token:   c.Token,
+		timeout: timeout,
+		http:    &http.Client{Transport: transport},
+	}, nil
+}
+
+// send sends a request to the API path with body, if not nil, encoded as JSON. Error
+// responses are returned as an *apiError.
+func (c *client) send(ctx context.Context, method, path string, body interface{}, accept string) (*http.Response, error) {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", accept)
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		e := &apiError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(data, &e.Problem) != nil {
+			e.Detail = strings.TrimSpace(string(data))
+		}
+		return nil, e
+	}
+	return resp, nil
+}
+
+// do sends a request and decodes the JSON response into out, if not nil. The request and
+// the response are bounded by the timeout of the client.
+func (c *client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	resp, err := c.send(ctx, method, path, body, "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// raw sends a request and returns the response body as is, bounded by the timeout of the
+// client.
+func (c *client) raw(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	resp, err := c.send(ctx, method, path, body, "*/*")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// stream sends a request for a server-sent event stream and calls onEvent with the name and
+// data of each event. Replies can take long, so only connecting is bounded by the timeout.
+func (c *client) stream(ctx context.Context, path string, body interface{}, onEvent func(event string, data []byte) error) error {
+	resp, err := c.send(ctx, http.MethodPost, path, body, "text/event-stream")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var event string
+	var data []byte
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if event != "" || data != nil {
+				if err := onEvent(event, data); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			if data != nil {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+	return scanner.Err()
+}
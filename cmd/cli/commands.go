@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"krackenservices.com/agentAI/internal/problem"
+)
+
+// Exit codes of the CLI.
+const (
+	exitOK       = 0
+	exitError    = 1 // the command failed, e.g. the server returned an error or a config is invalid
+	exitUsage    = 2 // invalid command line
+	exitNotFound = 3 // the model, tool or session does not exist
+	exitDenied   = 4 // missing or invalid credentials, or not allowed
+)
+
+// command is a node of the command tree: either a group of subcommands or a command that runs.
+type command struct {
+	name string
+	// args describes the positional arguments in the usage, e.g. "<id>".
+	args    string
+	summary string
+	// hidden commands are kept for compatibility but not listed or completed.
+	hidden bool
+	// setup declares the flags of the command and returns the function that runs it with the
+	// positional arguments.
+	setup       func(fs *flag.FlagSet) func(args []string) int
+	subcommands []*command
+}
+
+// root is the command tree of the CLI.
+var root = &command{name: "agentAI-cli"}
+
+// The subcommands are set in init, as completion refers back to root.
+func init() {
+	root.subcommands = []*command{
+		modelsCommand,
+		toolsCommand,
+		sessionsCommand,
+		usageCommand,
+		chatCommand,
+		runCommand,
+		batchCommand,
+		configCommand,
+		contextCommand,
+		mcpCommand,
+		completionCommand,
+		{
+			name:    "tool",
+			args:    "<tool_id> [arguments...]",
+			summary: "Run a tool (deprecated: use tools run)",
+			hidden:  true,
+			setup:   setupToolRun,
+		},
+	}
+}
+
+// find returns the subcommand with the name.
+func (c *command) find(name string) *command {
+	for _, sub := range c.subcommands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// flagSet returns the flags of the command, and the function that runs it.
+func (c *command) flagSet(path string) (*flag.FlagSet, func(args []string) int) {
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs, c.setup(fs)
+}
+
+// execute runs the command named by args below c, whose own name is path, and returns the
+// exit code.
+func (c *command) execute(path string, args []string) int {
+	if c.subcommands != nil {
+		if len(args) == 0 {
+			c.printUsage(os.Stderr, path, nil)
+			return exitUsage
+		}
+		if args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+			c.printUsage(os.Stdout, path, nil)
+			return exitOK
+		}
+		sub := c.find(args[0])
+		if sub == nil {
+			fmt.Fprintf(os.Stderr, "Unknown command: %s %s\n\n", path, args[0])
+			c.printUsage(os.Stderr, path, nil)
+			return exitUsage
+		}
+		return sub.execute(path+" "+sub.name, args[1:])
+	}
+
+	fs, run := c.flagSet(path)
+	positional, err := parseInterspersed(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		c.printUsage(os.Stdout, path, fs)
+		return exitOK
+	}
+	if err != nil {
+		return usageError(c, path, fs, err.Error())
+	}
+	min, max := c.argCount()
+	if len(positional) < min || (max >= 0 && len(positional) > max) {
+		msg := fmt.Sprintf("expected %s", c.args)
+		if c.args == "" {
+			msg = fmt.Sprintf("unexpected argument %q", positional[0])
+		}
+		return usageError(c, path, fs, msg)
+	}
+	return run(positional)
+}
+
+// parseInterspersed parses flags given before, between and after the positional arguments,
+// so that "models get local -o json" works like "models get -o json local".
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// printUsage writes the usage of c: its subcommands, or its arguments and flags.
+func (c *command) printUsage(w io.Writer, path string, fs *flag.FlagSet) {
+	if c.subcommands != nil {
+		if c.summary != "" {
+			fmt.Fprintf(w, "%s\n\n", c.summary)
+		}
+		fmt.Fprintf(w, "Usage:\n  %s <command> [flags] [arguments]\n\nCommands:\n", path)
+		for _, sub := range c.subcommands {
+			if !sub.hidden {
+				fmt.Fprintf(w, "  %-12s %s\n", sub.name, sub.summary)
+			}
+		}
+		if c == root {
+			fmt.Fprintln(w, "\nGlobal flags, given before the command, select the server (see context):")
+			flag.CommandLine.SetOutput(w)
+			flag.PrintDefaults()
+			fmt.Fprintf(w, "\nExit codes: %d success, %d failure, %d invalid command line, %d not found, %d not authorized.\n",
+				exitOK, exitError, exitUsage, exitNotFound, exitDenied)
+		}
+		fmt.Fprintf(w, "\nRun '%s <command> -h' for the flags of a command.\n", path)
+		return
+	}
+	fmt.Fprintf(w, "%s\n\nUsage:\n  %s\n", c.summary, strings.TrimSpace(path+" [flags] "+c.args))
+	if fs == nil {
+		fs, _ = c.flagSet(path)
+	}
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintln(w, "\nFlags:")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+		fs.SetOutput(io.Discard)
+	}
+}
+
+// usageError reports an invalid command line and returns exitUsage.
+func usageError(c *command, path string, fs *flag.FlagSet, msg string) int {
+	fmt.Fprintf(os.Stderr, "Error: %s\n\n", msg)
+	c.printUsage(os.Stderr, path, fs)
+	return exitUsage
+}
+
+// argCount returns how many positional arguments the usage of c allows: each <arg> is
+// required, each [arg] optional, and "..." allows any number more.
+func (c *command) argCount() (min, max int) {
+	for _, arg := range strings.Fields(c.args) {
+		switch {
+		case strings.Contains(arg, "..."):
+			max = -1
+		case strings.HasPrefix(arg, "["):
+			if max >= 0 {
+				max++
+			}
+		default:
+			min++
+			if max >= 0 {
+				max++
+			}
+		}
+	}
+	return min, max
+}
+
+// fail reports err and returns the exit code for it: that of its status for an error of the
+// API, or of a problem of a command run in-process.
+func fail(err error) int {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	status := 0
+	var apiErr *apiError
+	var p *problem.Problem
+	switch {
+	case errors.As(err, &apiErr):
+		status = apiErr.StatusCode
+	case errors.As(err, &p):
+		status = p.Status
+	}
+	switch status {
+	case http.StatusNotFound:
+		return exitNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return exitDenied
+	}
+	return exitError
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/session"
+)
+
+// capture runs f with stdout and stderr redirected, and returns what it wrote to them.
+func capture(t *testing.T, f func()) (stdout, stderr string) {
+	t.Helper()
+	read := func(target **os.File) (restore func() string) {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved := *target
+		*target = w
+		var buf bytes.Buffer
+		done := make(chan struct{})
+		go func() {
+			io.Copy(&buf, r)
+			close(done)
+		}()
+		return func() string {
+			w.Close()
+			<-done
+			r.Close()
+			*target = saved
+			return buf.String()
+		}
+	}
+	restoreOut, restoreErr := read(&os.Stdout), read(&os.Stderr)
+	defer func() {
+		stdout, stderr = restoreOut(), restoreErr()
+	}()
+	f()
+	return
+}
+
+// fakeServer serves models, sessions and tools like the API, and points the CLI at it.
+func fakeServer(t *testing.T) {
+	t.Helper()
+	models := []config.ModelConfig{{ID: "local", Name: "mymodel", APIVendor: "ollama", Endpoint: "http://127.0.0.1:8080/", Tools: []string{"fstool"}}}
+	sessions := []session.Session{{ID: "s1", Model: "local", Principal: "ci"}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(models)
+	})
+	mux.HandleFunc("GET /api/v1/models/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("id") != "local" {
+			problem.Error(w, r, http.StatusNotFound, "model not found")
+			return
+		}
+		json.NewEncoder(w).Encode(models[0])
+	})
+	mux.HandleFunc("GET /api/v1/sessions", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(sessions)
+	})
+	mux.HandleFunc("GET /api/v1/tools", func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, http.StatusUnauthorized, "missing credentials")
+	})
+	mux.HandleFunc("GET /api/v1/usage", func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, http.StatusInternalServerError, "boom")
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	t.Setenv("AGENTAI_SERVER", srv.URL)
+	t.Setenv("AGENTAI_CLI_CONFIG", filepath.Join(t.TempDir(), "cli.yml"))
+}
+
+func TestExecute(t *testing.T) {
+	fakeServer(t)
+	tests := []struct {
+		args []string
+		code int
+		// stdout and stderr are expected in the output, if set.
+		stdout, stderr string
+	}{
+		{args: nil, code: exitUsage, stderr: "Commands:"},
+		{args: []string{"help"}, code: exitOK, stdout: "Exit codes:"},
+		{args: []string{"nope"}, code: exitUsage, stderr: "Unknown command: agentAI-cli nope"},
+		{args: []string{"models"}, code: exitUsage, stderr: "Commands:"},
+		{args: []string{"models", "-h"}, code: exitOK, stdout: "List the models you may use"},
+		{args: []string{"models", "get", "-h"}, code: exitOK, stdout: "agentAI-cli models get [flags] <id>"},
+		{args: []string{"models", "get"}, code: exitUsage, stderr: "Error: expected <id>"},
+		{args: []string{"models", "get", "local", "extra"}, code: exitUsage, stderr: "Error: expected <id>"},
+		{args: []string{"models", "list", "extra"}, code: exitUsage, stderr: `unexpected argument "extra"`},
+		{args: []string{"models", "list", "-nope"}, code: exitUsage, stderr: "flag provided but not defined"},
+		{args: []string{"models", "list", "-o", "xml"}, code: exitUsage, stderr: `unknown output format "xml"`},
+		{args: []string{"models", "get", "local"}, code: exitOK, stdout: "mymodel"},
+		{args: []string{"models", "get", "local", "-o", "json"}, code: exitOK, stdout: `"id": "local"`},
+		{args: []string{"models", "get", "missing"}, code: exitNotFound, stderr: "Error: model not found"},
+		{args: []string{"tools", "list"}, code: exitDenied, stderr: "Error: missing credentials"},
+		{args: []string{"usage"}, code: exitError, stderr: "Error: boom"},
+		{args: []string{"completion", "bash"}, code: exitOK, stdout: "complete -o default -F _agentAI_cli agentAI-cli"},
+		{args: []string{"completion", "tcsh"}, code: exitUsage, stderr: `unknown shell "tcsh"`},
+		{args: []string{"config", "validate", filepath.Join(t.TempDir(), "missing.yml")}, code: exitError, stdout: "1 problem(s) found"},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			var code int
+			stdout, stderr := capture(t, func() { code = root.execute(root.name, tt.args) })
+			if code != tt.code {
+				t.Errorf("expected exit code %d, got %d (stderr %q)", tt.code, code, stderr)
+			}
+			if !strings.Contains(stdout, tt.stdout) {
+				t.Errorf("expected %q in stdout, got %q", tt.stdout, stdout)
+			}
+			if !strings.Contains(stderr, tt.stderr) {
+				t.Errorf("expected %q in stderr, got %q", tt.stderr, stderr)
+			}
+		})
+	}
+}
+
+func TestArgCount(t *testing.T) {
+	tests := []struct {
+		args     string
+		min, max int
+	}{
+		{"", 0, 0},
+		{"<id>", 1, 1},
+		{"<id> [arguments...]", 1, -1},
+		{"[id]", 0, 1},
+		{"<tool_id> <key=value>", 2, 2},
+	}
+	for _, tt := range tests {
+		if min, max := (&command{args: tt.args}).argCount(); min != tt.min || max != tt.max {
+			t.Errorf("%q: expected %d..%d arguments, got %d..%d", tt.args, tt.min, tt.max, min, max)
+		}
+	}
+}
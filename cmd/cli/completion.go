@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// completeCommand is the hidden command the completion scripts call with the words of the
+// command line, the last one being the word to complete.
+const completeCommand = "__complete"
+
+// The completion scripts ask the CLI itself for the completions, so they stay in step with
+// the command tree. The CLI is called as typed, so ./bin/agentAI-cli completes too.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for agentAI-cli. Load it with: source <(agentAI-cli completion bash)
+_agentAI_cli() {
+    local IFS=$'\n'
+    COMPREPLY=($("${COMP_WORDS[0]}" ` + completeCommand + ` "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _agentAI_cli agentAI-cli
+`,
+	"zsh": `#compdef agentAI-cli
+# zsh completion for agentAI-cli. Load it with: source <(agentAI-cli completion zsh)
+_agentAI_cli() {
+    local -a completions
+    completions=("${(@f)$("${words[1]}" ` + completeCommand + ` "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if [[ -n ${completions[1]} ]]; then
+        compadd -a completions
+    else
+        _files
+    fi
+}
+compdef _agentAI_cli agentAI-cli
+`,
+	"fish": `# fish completion for agentAI-cli. Load it with: agentAI-cli completion fish | source
+function __agentAI_cli_complete
+    set -l words (commandline -opc) (commandline -ct)
+    $words[1] ` + completeCommand + ` $words[2..-1] 2>/dev/null
+end
+complete -c agentAI-cli -a '(__agentAI_cli_complete)'
+`,
+}
+
+var completionCommand = &command{
+	name:    "completion",
+	args:    "<shell>",
+	summary: "Write the shell completion script for bash, zsh or fish",
+	setup: func(fs *flag.FlagSet) func([]string) int {
+		return func(args []string) int {
+			script, ok := completionScripts[args[0]]
+			if !ok {
+				fmt.Fprintf(os.Stderr, "Error: unknown shell %q: expected bash, zsh or fish\n", args[0])
+				return exitUsage
+			}
+			fmt.Print(script)
+			return exitOK
+		}
+	},
+}
+
+// complete returns the completions of the last of words, the command line after the
+// program name: subcommands, flags, or the formats of -o.
+func complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current, words := words[len(words)-1], words[:len(words)-1]
+
+	cmd := root
+	fs := flag.CommandLine
+	var pending *flag.Flag
+	for _, word := range words {
+		if pending != nil {
+			pending = nil
+			continue
+		}
+		if strings.HasPrefix(word, "-") {
+			pending = valueFlag(fs, word)
+			continue
+		}
+		if cmd.subcommands == nil {
+			continue // a positional argument
+		}
+		if cmd = cmd.find(word); cmd == nil {
+			return nil
+		}
+		fs = flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		if cmd.setup != nil {
+			fs, _ = cmd.flagSet(cmd.name)
+		}
+	}
+
+	var candidates []string
+	switch {
+	case pending != nil:
+		if _, ok := pending.Value.(*format); ok {
+			candidates = []string{formatTable, formatJSON, formatYAML}
+		}
+	case strings.HasPrefix(current, "-"):
+		fs.VisitAll(func(f *flag.Flag) { candidates = append(candidates, "-"+f.Name) })
+	case cmd.subcommands != nil:
+		for _, sub := range cmd.subcommands {
+			if !sub.hidden {
+				candidates = append(candidates, sub.name)
+			}
+		}
+	case cmd == completionCommand:
+		candidates = []string{"bash", "fish", "zsh"}
+	}
+
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, current) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
+
+// valueFlag returns the flag of fs named by word if its value is the next word.
+func valueFlag(fs *flag.FlagSet, word string) *flag.Flag {
+	if strings.Contains(word, "=") {
+		return nil
+	}
+	f := fs.Lookup(strings.TrimLeft(word, "-"))
+	if f == nil {
+		return nil
+	}
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return nil
+	}
+	return f
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		words []string
+		want  []string
+	}{
+		{nil, []string{"models", "tools", "sessions", "usage", "chat", "run", "batch", "config", "context", "mcp", "completion"}},
+		{[]string{"mo"}, []string{"models"}},
+		{[]string{"c"}, []string{"chat", "config", "context", "completion"}},
+		{[]string{"models", ""}, []string{"list", "get"}},
+		{[]string{"models", "list", "-"}, []string{"-o"}},
+		{[]string{"models", "list", "-o", ""}, []string{"table", "json", "yaml"}},
+		{[]string{"models", "list", "-o", "j"}, []string{"json"}},
+		{[]string{"models", "list", "-o=json", ""}, nil},
+		{[]string{"-server", "http://localhost:8080", "se"}, []string{"sessions"}},
+		{[]string{"-insecure-skip-verify", "se"}, []string{"sessions"}},
+		{[]string{"tools", "run", "fstool", "-"}, []string{"-o"}},
+		{[]string{"completion", ""}, []string{"bash", "fish", "zsh"}},
+		{[]string{"tool", ""}, nil},
+		{[]string{"nope", ""}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.words, " "), func(t *testing.T) {
+			if got := complete(tt.words); !slices.Equal(got, tt.want) {
+				t.Errorf("expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	// Global flags are completed before the command.
+	if got := complete([]string{"-ser"}); !slices.Equal(got, []string{"-server"}) {
+		t.Errorf("expected -server, got %q", got)
+	}
+}
+
+func TestCompletionScripts(t *testing.T) {
+	for shell, script := range completionScripts {
+		if !strings.Contains(script, completeCommand) || !strings.Contains(script, "agentAI-cli") {
+			t.Errorf("expected the %s script to call %s, got %q", shell, completeCommand, script)
+		}
+	}
+}
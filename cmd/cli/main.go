@@ -1,122 +1,199 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"log"
-	"net/http"
 	"os"
-	"strings"
 
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+	"krackenservices.com/agentAI/internal/mcp"
+	"krackenservices.com/agentAI/internal/server"
 	"krackenservices.com/agentAI/internal/toolregistry"
 )
 
-// internalToolArgOrder maps internal tool IDs to an ordered list of argument keys.
-var internalToolArgOrder = map[string][]string{
-	"fstool": {"path"},
-	// Add additional internal tools here with their positional argument keys.
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == completeCommand {
+		for _, c := range complete(os.Args[2:]) {
+			fmt.Println(c)
+		}
+		return
+	}
+	flag.Usage = func() { root.printUsage(os.Stderr, root.name, nil) }
+	flag.Parse()
+	os.Exit(root.execute(root.name, flag.Args()))
 }
 
-// printUsage displays CLI usage instructions.
-func printUsage() {
-	fmt.Println("Usage:")
-	fmt.Println("  agentai tool <tool_id> [arguments...]")
-	fmt.Println("")
-	fmt.Println("For internal tools:")
-	fmt.Println("  If a single argument is provided, the default key is assumed based on the tool's argument order.")
-	fmt.Println("  If more than one argument is provided, each argument must be in key=value format.")
-	fmt.Println("")
-	fmt.Println("For external tools, provide arguments as key=value pairs.")
+var chatCommand = &command{
+	name:    "chat",
+	summary: "Chat with the agent on the server; type /help in the chat",
+	setup:   setupChat,
 }
 
-func main() {
-	flag.Parse()
-	args := flag.Args()
+var mcpCommand = &command{
+	name:    "mcp",
+	summary: "Serve the configured tools as an MCP server over stdin/stdout",
+	setup: func(fs *flag.FlagSet) func([]string) int {
+		configPath := fs.String("config", "", "Path to the config file (defaults to config.yaml next to the binary)")
+		return func([]string) int {
+			if err := runMCP(*configPath); err != nil {
+				fmt.Fprintf(os.Stderr, "MCP server failed: %v\n", err)
+				return exitError
+			}
+			return exitOK
+		}
+	},
+}
 
-	// We expect at least two arguments: "tool" and <tool_id>
-	if len(args) < 2 {
-		printUsage()
-		os.Exit(1)
+// runMCP loads the configuration and serves its enabled tools over stdio MCP.
+// Tools are executed in-process, so no API server needs to be running.
+func runMCP(configPath string) error {
+	if err := server.DiscoverTools(); err != nil {
+		log.Printf("Error discovering tools: %v", err)
+	}
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		return err
 	}
+	server.ConnectMCPServers(cfg)
+	defer mcp.DefaultPool.Close()
 
-	// First argument should be "tool".
-	if args[0] != "tool" {
-		fmt.Printf("Unknown command: %s\n", args[0])
-		printUsage()
-		os.Exit(1)
+	// stdout carries the protocol, so diagnostics must go to stderr.
+	log.SetOutput(os.Stderr)
+	return handlers.NewMCPServer(cfg).ServeStdio(context.Background(), os.Stdin, os.Stdout)
+}
+
+var configCommand = &command{
+	name:    "config",
+	summary: "Validate, show and describe configuration files",
+	subcommands: []*command{
+		{
+			name:    "validate",
+			args:    "<file>",
+			summary: "Report every problem in a config file; exits non-zero if there are any",
+			setup:   setupConfigValidate,
+		},
+		{
+			name:    "show",
+			args:    "[file]",
+			summary: "Show the effective configuration of a file, or of the server, with secrets masked",
+			setup:   setupConfigShow,
+		},
+		{
+			name:    "schema",
+			summary: "Write the JSON Schema of the config file, for editor integration",
+			setup:   setupConfigSchema,
+		},
+	},
+}
+
+// discoverTools discovers the tools that tool overrides are checked against, as the server
+// would, in dir or else in tools/ next to the binary.
+func discoverTools(dir string) {
+	log.SetOutput(io.Discard)
+	var err error
+	if dir != "" {
+		err = toolregistry.Discover(dir)
+	} else {
+		err = server.DiscoverTools()
 	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: %v\n", err)
+	}
+}
 
-	toolID := args[1]
-	overrideArgs := make(map[string]interface{})
+func setupConfigValidate(fs *flag.FlagSet) func([]string) int {
+	toolsDir := fs.String("tools", "", "Directory to discover tools in (defaults to tools/ next to the binary)")
+	out := outputFlag(fs, formatTable)
+	return func(args []string) int {
+		path := args[0]
+		discoverTools(*toolsDir)
 
-	// Determine if this is an internal tool.
-	_, isInternal := toolregistry.InternalTools[toolID]
-	if isInternal {
-		argOrder, exists := internalToolArgOrder[toolID]
-		if !exists {
-			fmt.Printf("No argument order defined for internal tool %q\n", toolID)
-			os.Exit(1)
+		cfg, err := config.LoadConfig(path)
+		var problems config.ValidationErrors
+		if err != nil && !errors.As(err, &problems) {
+			problems = config.ValidationErrors{{File: path, Message: err.Error()}}
 		}
-		// For internal tools:
-		// If exactly one parameter is provided (after toolID), assume it's for the first key.
-		if len(args) == 3 {
-			overrideArgs[argOrder[0]] = args[2]
-		} else if len(args) > 3 {
-			// Expect each argument to be in key=value format.
-			for _, arg := range args[2:] {
-				if !strings.Contains(arg, "=") {
-					fmt.Printf("Error: for internal tool %q, when providing more than one argument, use key=value format. Invalid argument: %q\n", toolID, arg)
-					os.Exit(1)
-				}
-				parts := strings.SplitN(arg, "=", 2)
-				overrideArgs[parts[0]] = parts[1]
+		for i := range problems {
+			if problems[i].File == "" {
+				problems[i].File = path
 			}
 		}
-	} else {
-		// External tool: require key=value pairs.
-		if len(args) < 3 {
-			fmt.Printf("For external tools, provide arguments in key=value format.\n")
-			printUsage()
-			os.Exit(1)
+		if problems == nil {
+			problems = config.ValidationErrors{}
 		}
-		for _, arg := range args[2:] {
-			if !strings.Contains(arg, "=") {
-				fmt.Printf("Error: argument '%s' is not in key=value format.\n", arg)
-				os.Exit(1)
+		code := show(*out, problems, func(w io.Writer) {
+			if len(problems) == 0 {
+				fmt.Fprintf(w, "%s: OK (%d models, %d tools, %d MCP servers)\n", path, len(cfg.Models), len(cfg.Tools), len(cfg.MCPServers))
+				return
+			}
+			// file:line: path: message, the format editors and CI annotations understand.
+			for _, p := range problems {
+				fmt.Fprintln(w, p.Error())
 			}
-			parts := strings.SplitN(arg, "=", 2)
-			overrideArgs[parts[0]] = parts[1]
+			fmt.Fprintf(w, "%d problem(s) found\n", len(problems))
+		})
+		if code == exitOK && len(problems) > 0 {
+			return exitError
 		}
+		return code
 	}
+}
 
-	// Build the JSON payload.
-	payload := map[string]interface{}{
-		"args": overrideArgs,
-	}
-	jsonPayload, err := json.Marshal(payload)
-	if err != nil {
-		log.Fatalf("Error marshalling JSON payload: %v", err)
-	}
-
-	// Build the API URL.
-	url := fmt.Sprintf("http://localhost:8080/tool/%s", toolID)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		log.Fatalf("Error making POST request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("Error reading response body: %v", err)
+func setupConfigShow(fs *flag.FlagSet) func([]string) int {
+	toolsDir := fs.String("tools", "", "Directory to discover tools in, for a file (defaults to tools/ next to the binary)")
+	out := outputFlag(fs, formatYAML)
+	return func(args []string) int {
+		var effective handlers.EffectiveConfig
+		if len(args) == 0 {
+			if err := get("/api/v1/config/effective", &effective); err != nil {
+				return fail(err)
+			}
+		} else {
+			discoverTools(*toolsDir)
+			cfg, err := config.LoadConfig(args[0])
+			if err != nil {
+				return fail(err)
+			}
+			if effective, err = handlers.Effective(cfg); err != nil {
+				return fail(err)
+			}
+		}
+		return show(*out, effective, func(w io.Writer) {
+			fields(w, "Path", effective.Path, "Env", effective.Env)
+			for _, file := range effective.Files {
+				fields(w, "File", file)
+			}
+			data, err := toYAML(effective.Config)
+			if err == nil {
+				fmt.Fprintf(w, "\n%s", data)
+			}
+		})
 	}
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Fatalf("Error: received status %s with message: %s", resp.Status, string(body))
+// setupConfigSchema declares the flags of config schema, whose -o names a file rather than
+// a format: the schema is JSON.
+func setupConfigSchema(fs *flag.FlagSet) func([]string) int {
+	out := fs.String("o", "", "File to write the schema to (defaults to stdout)")
+	return func([]string) int {
+		data, err := json.MarshalIndent(config.Schema(), "", "  ")
+		if err != nil {
+			return fail(fmt.Errorf("encoding schema: %w", err))
+		}
+		data = append(data, '\n')
+		if *out == "" {
+			os.Stdout.Write(data)
+			return exitOK
+		}
+		if err := os.WriteFile(*out, data, 0644); err != nil {
+			return fail(fmt.Errorf("writing schema: %w", err))
+		}
+		return exitOK
 	}
-
-	fmt.Printf("Response:\n%s\n", string(body))
 }
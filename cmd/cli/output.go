@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats of the -o flag.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// format is the value of a -o flag.
+type format string
+
+func (f *format) String() string { return string(*f) }
+
+func (f *format) Set(v string) error {
+	switch v {
+	case formatTable, formatJSON, formatYAML:
+		*f = format(v)
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q: expected table, json or yaml", v)
+}
+
+// outputFlag declares the -o flag of a command, defaulting to def.
+func outputFlag(fs *flag.FlagSet, def string) *format {
+	f := format(def)
+	fs.Var(&f, "o", "Output `format`: table, json or yaml")
+	return &f
+}
+
+// configValue marks models and tools, which are written in YAML as in the config file
+// rather than with the keys of the API.
+type configValue struct {
+	v interface{}
+}
+
+// render writes v in the format: as JSON, as YAML with the same keys, or with printTable
+// for the table format.
+func render(w io.Writer, f format, v interface{}, printTable func(w io.Writer)) error {
+	cv, isConfig := v.(configValue)
+	if isConfig {
+		v = cv.v
+	}
+	switch f {
+	case formatTable:
+		printTable(w)
+		return nil
+	case formatYAML:
+		if isConfig {
+			enc := yaml.NewEncoder(w)
+			enc.SetIndent(2)
+			return enc.Encode(v)
+		}
+		data, err := toYAML(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(v)
+}
+
+// toYAML encodes v as YAML with the keys and order of its JSON encoding, which is what the
+// API returns.
+func toYAML(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle turns the JSON flow style of a decoded document into YAML block style.
+func blockStyle(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode || n.Kind == yaml.SequenceNode {
+		n.Style = 0
+	}
+	if n.Kind == yaml.ScalarNode && n.Style == yaml.DoubleQuotedStyle && n.Tag == "!!str" {
+		n.Style = 0
+	}
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// table writes aligned columns under a header.
+type table struct {
+	tw *tabwriter.Writer
+}
+
+func newTable(w io.Writer, header ...string) *table {
+	t := &table{tw: tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)}
+	t.row(header...)
+	return t
+}
+
+func (t *table) row(cells ...string) {
+	for i, cell := range cells {
+		// A cell must stay on its line.
+		cells[i] = strings.ReplaceAll(cell, "\n", " ")
+	}
+	fmt.Fprintln(t.tw, strings.Join(cells, "\t"))
+}
+
+func (t *table) flush() {
+	t.tw.Flush()
+}
+
+// fields writes name: value lines, skipping empty values.
+func fields(w io.Writer, pairs ...string) {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if pairs[i+1] != "" {
+			fmt.Fprintf(tw, "%s:\t%s\n", pairs[i], pairs[i+1])
+		}
+	}
+	tw.Flush()
+}
+
+// show renders v to stdout and returns the exit code.
+func show(f format, v interface{}, printTable func(w io.Writer)) int {
+	if err := render(os.Stdout, f, v, printTable); err != nil {
+		return fail(err)
+	}
+	return exitOK
+}
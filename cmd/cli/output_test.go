@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/session"
+)
+
+func TestOutputFormats(t *testing.T) {
+	fakeServer(t)
+	tests := []struct {
+		args  []string
+		check func(t *testing.T, stdout string)
+	}{
+		{
+			args: []string{"models", "list"},
+			check: func(t *testing.T, stdout string) {
+				lines := strings.Split(strings.TrimSpace(stdout), "\n")
+				if len(lines) != 2 || strings.Fields(lines[0])[0] != "ID" || strings.Join(strings.Fields(lines[1]), " ") != "local ollama http://127.0.0.1:8080/ fstool" {
+					t.Errorf("expected a table of the model, got %q", stdout)
+				}
+			},
+		},
+		{
+			args: []string{"models", "list", "-o", "json"},
+			check: func(t *testing.T, stdout string) {
+				var models []config.ModelConfig
+				if err := json.Unmarshal([]byte(stdout), &models); err != nil || len(models) != 1 || models[0].APIVendor != "ollama" {
+					t.Errorf("expected the models as JSON, got %q, %v", stdout, err)
+				}
+			},
+		},
+		{
+			// Models are written as in the config file.
+			args: []string{"models", "list", "-o", "yaml"},
+			check: func(t *testing.T, stdout string) {
+				var models []config.ModelConfig
+				if err := yaml.Unmarshal([]byte(stdout), &models); err != nil || len(models) != 1 || models[0].APIVendor != "ollama" {
+					t.Errorf("expected the models as YAML, got %q, %v", stdout, err)
+				}
+				if !strings.Contains(stdout, "api_vendor: ollama") {
+					t.Errorf("expected the keys of the config file, got %q", stdout)
+				}
+			},
+		},
+		{
+			args: []string{"models", "get", "local"},
+			check: func(t *testing.T, stdout string) {
+				if !strings.Contains(stdout, "Vendor:   ollama\n") || strings.Contains(stdout, "Pricing:") {
+					t.Errorf("expected the fields of the model without empty ones, got %q", stdout)
+				}
+			},
+		},
+		{
+			// Other values are written with the keys of the API.
+			args: []string{"sessions", "list", "-o", "yaml"},
+			check: func(t *testing.T, stdout string) {
+				var sessions []session.Session
+				if err := yaml.Unmarshal([]byte(stdout), &sessions); err != nil || len(sessions) != 1 || sessions[0].ID != "s1" {
+					t.Errorf("expected the sessions as YAML, got %q, %v", stdout, err)
+				}
+				if !strings.HasPrefix(stdout, "- id: s1\n") || strings.Contains(stdout, "{") {
+					t.Errorf("expected block YAML with the keys of the API, got %q", stdout)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			var code int
+			stdout, stderr := capture(t, func() { code = root.execute(root.name, tt.args) })
+			if code != exitOK {
+				t.Fatalf("expected exit code 0, got %d (stderr %q)", code, stderr)
+			}
+			tt.check(t, stdout)
+		})
+	}
+}
+
+func TestTable(t *testing.T) {
+	var buf bytes.Buffer
+	tbl := newTable(&buf, "ID", "DESCRIPTION")
+	tbl.row("fstool", "Lists\na directory")
+	tbl.flush()
+	if want := "ID      DESCRIPTION\nfstool  Lists a directory\n"; buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+}
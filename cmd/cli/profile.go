@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultTimeout bounds a request to the server unless a timeout is configured.
+const defaultTimeout = 30 * time.Second
+
+// cliConfig is the CLI profile file (~/.config/agentai/cli.yml): named contexts, each a
+// server and how to reach it, and the context used by default.
+type cliConfig struct {
+	CurrentContext string       `yaml:"current_context,omitempty"`
+	Contexts       []cliContext `yaml:"contexts,omitempty"`
+}
+
+// cliContext is a server the CLI can talk to.
+type cliContext struct {
+	Name string `yaml:"name"`
+	// Server is the base URL of the API, or unix:///path for a Unix domain socket.
+	Server string `yaml:"server,omitempty"`
+	// APIKey is sent as X-API-Key, Token as a bearer token. ${VAR} references are expanded.
+	APIKey string `yaml:"api_key,omitempty"`
+	Token  string `yaml:"token,omitempty"`
+	// CAFile verifies the server certificate against these CAs instead of the system ones.
+	CAFile string `yaml:"ca_file,omitempty"`
+	// CertFile and KeyFile are the client certificate for servers that require mutual TLS.
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+	// Timeout bounds each request (default 30s); streamed chat replies only bound connecting.
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+// connection holds the global flags that select the server and override the context.
+var connection struct {
+	configPath string
+	context    string
+	cliContext
+}
+
+func init() {
+	flag.StringVar(&connection.configPath, "cli-config", "", "CLI profile file (default ~/.config/agentai/cli.yml, or $AGENTAI_CLI_CONFIG)")
+	flag.StringVar(&connection.context, "context", "", "Context of the profile file to use (default its current_context, or $AGENTAI_CONTEXT)")
+	flag.StringVar(&connection.Server, "server", "", "API server URL or unix:///path (default "+defaultServer+", or $AGENTAI_SERVER)")
+	flag.StringVar(&connection.APIKey, "api-key", "", "API key to authenticate with (or $AGENTAI_API_KEY)")
+	flag.StringVar(&connection.Token, "token", "", "Bearer token to authenticate with (or $AGENTAI_TOKEN)")
+	flag.StringVar(&connection.CAFile, "ca-file", "", "PEM file of the CAs that sign the server certificate")
+	flag.StringVar(&connection.CertFile, "cert-file", "", "PEM file of the client certificate, for mutual TLS")
+	flag.StringVar(&connection.KeyFile, "key-file", "", "PEM file of the client certificate key")
+	flag.BoolVar(&connection.InsecureSkipVerify, "insecure-skip-verify", false, "Do not verify the server certificate")
+	flag.StringVar(&connection.Timeout, "timeout", "", "Request timeout, e.g. 10s (default 30s)")
+}
+
+// defaultProfilePath is where the CLI looks for its profile file.
+func defaultProfilePath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "agentai", "cli.yml")
+}
+
+// profilePath returns the profile file named by -cli-config, $AGENTAI_CLI_CONFIG or the default.
+func profilePath() string {
+	if connection.configPath != "" {
+		return connection.configPath
+	}
+	if path := os.Getenv("AGENTAI_CLI_CONFIG"); path != "" {
+		return path
+	}
+	return defaultProfilePath()
+}
+
+// loadProfile reads the profile file. A missing file is an empty profile.
+func loadProfile(path string) (*cliConfig, error) {
+	cfg := &cliConfig{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, nil
+}
+
+// find returns the context with the name.
+func (c *cliConfig) find(name string) (cliContext, bool) {
+	for _, ctx := range c.Contexts {
+		if ctx.Name == name {
+			return ctx, true
+		}
+	}
+	return cliContext{}, false
+}
+
+// resolveContext combines, in order of precedence, the global flags, the environment, the
+// selected context of the profile file and the defaults.
+func resolveContext() (cliContext, error) {
+	path := profilePath()
+	profile, err := loadProfile(path)
+	if err != nil {
+		return cliContext{}, err
+	}
+	name := firstOf(connection.context, os.Getenv("AGENTAI_CONTEXT"), profile.CurrentContext)
+	var selected cliContext
+	if name != "" {
+		var ok bool
+		if selected, ok = profile.find(name); !ok {
+			return cliContext{}, fmt.Errorf("context %q not found in %s", name, path)
+		}
+		// Files of a context are relative to the profile file.
+		for _, file := range []*string{&selected.CAFile, &selected.CertFile, &selected.KeyFile} {
+			if *file != "" && !filepath.IsAbs(*file) {
+				*file = filepath.Join(filepath.Dir(path), *file)
+			}
+		}
+		selected.APIKey = os.ExpandEnv(selected.APIKey)
+		selected.Token = os.ExpandEnv(selected.Token)
+	}
+
+	flags := connection.cliContext
+	return cliContext{
+		Name:               name,
+		Server:             firstOf(flags.Server, os.Getenv("AGENTAI_SERVER"), selected.Server, defaultServer),
+		APIKey:             firstOf(flags.APIKey, os.Getenv("AGENTAI_API_KEY"), selected.APIKey),
+		Token:              firstOf(flags.Token, os.Getenv("AGENTAI_TOKEN"), selected.Token),
+		CAFile:             firstOf(flags.CAFile, selected.CAFile),
+		CertFile:           firstOf(flags.CertFile, selected.CertFile),
+		KeyFile:            firstOf(flags.KeyFile, selected.KeyFile),
+		InsecureSkipVerify: flags.InsecureSkipVerify || selected.InsecureSkipVerify,
+		Timeout:            firstOf(flags.Timeout, selected.Timeout),
+	}, nil
+}
+
+// firstOf returns the first non-empty value.
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// timeout parses the timeout of the context.
+func (c cliContext) timeout() (time.Duration, error) {
+	if c.Timeout == "" {
+		return defaultTimeout, nil
+	}
+	d, err := time.ParseDuration(c.Timeout)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", c.Timeout)
+	}
+	return d, nil
+}
+
+// transport returns an HTTP transport for the server of the context: a Unix socket dialer
+// for unix:// servers, and the CAs and client certificate of the context for HTTPS.
+func (c cliContext) transport(connect time.Duration) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	dialer := &net.Dialer{Timeout: connect, KeepAlive: 30 * time.Second}
+	t.DialContext = dialer.DialContext
+	t.TLSHandshakeTimeout = connect
+	if socket, ok := strings.CutPrefix(c.Server, "unix://"); ok {
+		t.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socket)
+		}
+	}
+
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no PEM certificates found", c.CAFile)
+		}
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	t.TLSClientConfig = tlsConfig
+	return t, nil
+}
+
+// baseURL returns the URL API paths are appended to.
+func (c cliContext) baseURL() string {
+	if strings.HasPrefix(c.Server, "unix://") {
+		// The host is only used for the Host header; the transport dials the socket.
+		return "http://unix"
+	}
+	return strings.TrimRight(c.Server, "/")
+}
+
+var contextCommand = &command{
+	name:    "context",
+	summary: "List and switch the contexts of the CLI profile file",
+	subcommands: []*command{
+		{
+			name:    "list",
+			summary: "List the contexts; * marks the current one",
+			setup: func(fs *flag.FlagSet) func([]string) int {
+				return func([]string) int {
+					profile, err := loadProfile(profilePath())
+					if err != nil {
+						return fail(err)
+					}
+					t := newTable(os.Stdout, "CURRENT", "NAME", "SERVER")
+					for _, ctx := range profile.Contexts {
+						marker := ""
+						if ctx.Name == profile.CurrentContext {
+							marker = "*"
+						}
+						t.row(marker, ctx.Name, ctx.Server)
+					}
+					t.flush()
+					return exitOK
+				}
+			},
+		},
+		{
+			name:    "current",
+			summary: "Show the context and server the CLI talks to",
+			setup: func(fs *flag.FlagSet) func([]string) int {
+				return func([]string) int {
+					resolved, err := resolveContext()
+					if err != nil {
+						return fail(err)
+					}
+					fmt.Printf("%s %s\n", firstOf(resolved.Name, "(none)"), resolved.Server)
+					return exitOK
+				}
+			},
+		},
+		{
+			name:    "use",
+			args:    "<name>",
+			summary: "Make a context the current one",
+			setup: func(fs *flag.FlagSet) func([]string) int {
+				return func(args []string) int {
+					path := profilePath()
+					profile, err := loadProfile(path)
+					if err != nil {
+						return fail(err)
+					}
+					if _, ok := profile.find(args[0]); !ok {
+						fmt.Fprintf(os.Stderr, "Error: context %q not found in %s\n", args[0], path)
+						return exitNotFound
+					}
+					if err := setCurrentContext(path, args[0]); err != nil {
+						return fail(err)
+					}
+					fmt.Printf("Switched to context %s.\n", args[0])
+					return exitOK
+				}
+			},
+		},
+	},
+}
+
+// setCurrentContext sets current_context in the profile file, keeping the rest of the file
+// and its comments as they are.
+func setCurrentContext(path, name string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return fmt.Errorf("%s: not a mapping", path)
+	}
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "current_context" {
+			root.Content[i+1].SetString(name)
+			return writeYAML(path, &doc)
+		}
+	}
+	key := &yaml.Node{}
+	key.SetString("current_context")
+	value := &yaml.Node{}
+	value.SetString(name)
+	root.Content = append([]*yaml.Node{key, value}, root.Content...)
+	return writeYAML(path, &doc)
+}
+
+func writeYAML(path string, doc *yaml.Node) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0600)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testProfile = `current_context: prod
+contexts:
+  - name: prod
+    server: https://agent.example.com
+    api_key: ${PROD_KEY}
+    ca_file: certs/ca.pem
+    timeout: 10s
+  - name: dev
+    server: http://localhost:9090
+    token: dev-${USER_NAME}-token
+`
+
+func TestResolveContext(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cli.yml")
+	if err := os.WriteFile(path, []byte(testProfile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		flags map[string]string
+		env   map[string]string
+		want  cliContext
+		err   string
+	}{
+		{
+			name: "current context",
+			env:  map[string]string{"PROD_KEY": "prod-key"},
+			want: cliContext{Name: "prod", Server: "https://agent.example.com", APIKey: "prod-key", CAFile: filepath.Join(dir, "certs", "ca.pem"), Timeout: "10s"},
+		},
+		{
+			name: "unset variable",
+			want: cliContext{Name: "prod", Server: "https://agent.example.com", CAFile: filepath.Join(dir, "certs", "ca.pem"), Timeout: "10s"},
+		},
+		{
+			name: "context from the environment",
+			env:  map[string]string{"AGENTAI_CONTEXT": "dev", "USER_NAME": "ana"},
+			want: cliContext{Name: "dev", Server: "http://localhost:9090", Token: "dev-ana-token"},
+		},
+		{
+			name:  "context flag over the environment",
+			flags: map[string]string{"context": "dev"},
+			env:   map[string]string{"AGENTAI_CONTEXT": "prod"},
+			want:  cliContext{Name: "dev", Server: "http://localhost:9090", Token: "dev--token"},
+		},
+		{
+			name: "environment over the context",
+			env:  map[string]string{"PROD_KEY": "prod-key", "AGENTAI_SERVER": "http://env:8080", "AGENTAI_API_KEY": "env-key", "AGENTAI_TOKEN": "env-token"},
+			want: cliContext{Name: "prod", Server: "http://env:8080", APIKey: "env-key", Token: "env-token", CAFile: filepath.Join(dir, "certs", "ca.pem"), Timeout: "10s"},
+		},
+		{
+			name:  "flags over the environment",
+			flags: map[string]string{"server": "http://flag:8080", "api-key": "flag-key", "ca-file": "/etc/ca.pem", "timeout": "1m"},
+			env:   map[string]string{"AGENTAI_SERVER": "http://env:8080", "AGENTAI_API_KEY": "env-key"},
+			want:  cliContext{Name: "prod", Server: "http://flag:8080", APIKey: "flag-key", CAFile: "/etc/ca.pem", Timeout: "1m"},
+		},
+		{
+			name: "unknown context",
+			env:  map[string]string{"AGENTAI_CONTEXT": "staging"},
+			err:  `context "staging" not found in ` + path,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"AGENTAI_CLI_CONFIG", "AGENTAI_CONTEXT", "AGENTAI_SERVER", "AGENTAI_API_KEY", "AGENTAI_TOKEN", "PROD_KEY", "USER_NAME"} {
+				t.Setenv(name, tt.env[name])
+			}
+			t.Cleanup(func() { connection.configPath, connection.context, connection.cliContext = "", "", cliContext{} })
+			connection.configPath = path
+			connection.context = tt.flags["context"]
+			connection.Server = tt.flags["server"]
+			connection.APIKey = tt.flags["api-key"]
+			connection.CAFile = tt.flags["ca-file"]
+			connection.Timeout = tt.flags["timeout"]
+
+			got, err := resolveContext()
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("expected error %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestResolveContext_Profile(t *testing.T) {
+	for _, name := range []string{"AGENTAI_CONTEXT", "AGENTAI_SERVER", "AGENTAI_API_KEY", "AGENTAI_TOKEN"} {
+		t.Setenv(name, "")
+	}
+
+	// Without a profile file, the default server.
+	t.Setenv("AGENTAI_CLI_CONFIG", filepath.Join(t.TempDir(), "missing.yml"))
+	if got, err := resolveContext(); err != nil || got != (cliContext{Server: defaultServer}) {
+		t.Errorf("expected the default server, got %+v, %v", got, err)
+	}
+
+	// The -cli-config flag is used over $AGENTAI_CLI_CONFIG.
+	path := filepath.Join(t.TempDir(), "cli.yml")
+	if err := os.WriteFile(path, []byte(testProfile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	connection.configPath = path
+	t.Cleanup(func() { connection.configPath = "" })
+	if got, err := resolveContext(); err != nil || got.Server != "https://agent.example.com" {
+		t.Errorf("expected the context of the flag's file, got %+v, %v", got, err)
+	}
+
+	// An invalid file is reported with its path.
+	if err := os.WriteFile(path, []byte("contexts: {"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := resolveContext(); err == nil || !strings.HasPrefix(err.Error(), path+":") {
+		t.Errorf("expected an error naming the file, got %v", err)
+	}
+}
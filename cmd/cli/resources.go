@@ -0,0 +1,380 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"krackenservices.com/agentAI/internal/agent"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+	"krackenservices.com/agentAI/internal/session"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// get fetches the API path from the server into out.
+func get(path string, out interface{}) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	return c.do(context.Background(), http.MethodGet, path, nil, out)
+}
+
+var modelsCommand = &command{
+	name:    "models",
+	summary: "List and inspect models",
+	subcommands: []*command{
+		{
+			name:    "list",
+			summary: "List the models you may use",
+			setup: func(fs *flag.FlagSet) func([]string) int {
+				out := outputFlag(fs, formatTable)
+				return func([]string) int {
+					var models []config.ModelConfig
+					if err := get("/api/v1/models", &models); err != nil {
+						return fail(err)
+					}
+					return show(*out, configValue{models}, func(w io.Writer) {
+						t := newTable(w, "ID", "VENDOR", "ENDPOINT", "TOOLS")
+						for _, m := range models {
+							t.row(m.ID, m.APIVendor, m.Endpoint, strings.Join(m.Tools, ","))
+						}
+						t.flush()
+					})
+				}
+			},
+		},
+		{
+			name:    "get",
+			args:    "<id>",
+			summary: "Show a model",
+			setup: func(fs *flag.FlagSet) func([]string) int {
+				out := outputFlag(fs, formatTable)
+				return func(args []string) int {
+					var m config.ModelConfig
+					if err := get("/api/v1/models/"+url.PathEscape(args[0]), &m); err != nil {
+						return fail(err)
+					}
+					return show(*out, configValue{m}, func(w io.Writer) {
+						fields(w,
+							"ID", m.ID,
+							"Name", m.Name,
+							"Vendor", m.APIVendor,
+							"Endpoint", m.Endpoint,
+							"Tools", strings.Join(m.Tools, ", "),
+							"Tool tags", strings.TrimSpace(m.ToolTagStart+" "+m.ToolTagEnd),
+							"Pricing", pricing(m.Pricing))
+					})
+				}
+			},
+		},
+	},
+}
+
+// pricing describes the prices of a model per million tokens.
+func pricing(p *config.ModelPricing) string {
+	if p == nil {
+		return ""
+	}
+	return fmt.Sprintf("%g input, %g output per million tokens", p.InputPerMillion, p.OutputPerMillion)
+}
+
+var toolsCommand = &command{
+	name:    "tools",
+	summary: "List, inspect and run tools",
+	subcommands: []*command{
+		{
+			name:    "list",
+			summary: "List the tools you may use",
+			setup: func(fs *flag.FlagSet) func([]string) int {
+				out := outputFlag(fs, formatTable)
+				return func([]string) int {
+					var tools []toolmodel.ToolConfig
+					if err := get("/api/v1/tools", &tools); err != nil {
+						return fail(err)
+					}
+					return show(*out, configValue{tools}, func(w io.Writer) {
+						t := newTable(w, "ID", "TYPE", "DESCRIPTION")
+						for _, tool := range tools {
+							t.row(tool.ID, toolType(tool), tool.Description)
+						}
+						t.flush()
+					})
+				}
+			},
+		},
+		{
+			name:    "describe",
+			args:    "<id>",
+			summary: "Show a tool and its arguments",
+			setup: func(fs *flag.FlagSet) func([]string) int {
+				out := outputFlag(fs, formatTable)
+				return func(args []string) int {
+					var tool toolmodel.ToolConfig
+					if err := get("/api/v1/tools/"+url.PathEscape(args[0]), &tool); err != nil {
+						return fail(err)
+					}
+					return show(*out, configValue{tool}, func(w io.Writer) {
+						fields(w,
+							"ID", tool.ID,
+							"Name", tool.Name,
+							"Type", toolType(tool),
+							"Description", tool.Description,
+							"Positional", strings.Join(tool.ArgOrder, " "))
+						fmt.Fprintln(w)
+						describeArgs(w, tool)
+					})
+				}
+			},
+		},
+		{
+			name:    "run",
+			args:    "<id> [arguments...]",
+			summary: "Run a tool with key=value arguments",
+			setup:   setupToolRun,
+		},
+	},
+}
+
+// toolType names how a tool is run.
+func toolType(t toolmodel.ToolConfig) string {
+	if t.Type == "" {
+		return toolmodel.TypeBinary
+	}
+	return t.Type
+}
+
+// describeArgs writes a table of the arguments of the tool, from its argument schema.
+func describeArgs(w io.Writer, tool toolmodel.ToolConfig) {
+	schema := tool.ArgumentSchema()
+	properties, _ := schema["properties"].(map[string]interface{})
+	if len(properties) == 0 {
+		fmt.Fprintln(w, "No arguments.")
+		return
+	}
+	required := make(map[string]bool)
+	list, _ := schema["required"].([]interface{})
+	for _, name := range list {
+		required[fmt.Sprint(name)] = true
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	t := newTable(w, "ARGUMENT", "TYPE", "REQUIRED", "DEFAULT", "DESCRIPTION")
+	for _, name := range names {
+		prop, _ := properties[name].(map[string]interface{})
+		def := ""
+		if v, ok := prop["default"]; ok {
+			def = fmt.Sprint(v)
+		}
+		description, _ := prop["description"].(string)
+		t.row(name, fmt.Sprint(prop["type"]), strconv.FormatBool(required[name]), def, description)
+	}
+	t.flush()
+}
+
+// setupToolRun declares the flags of tools run.
+func setupToolRun(fs *flag.FlagSet) func([]string) int {
+	out := outputFlag(fs, formatTable)
+	return func(args []string) int {
+		c, err := newClient()
+		if err != nil {
+			return fail(err)
+		}
+		ctx := context.Background()
+		toolID := args[0]
+		toolArgs := make(map[string]interface{})
+
+		// Positional arguments fill the tool's declared argument order (from its manifest);
+		// anything else must be given as key=value.
+		var argOrder []string
+		fetched := false
+		positional := 0
+		for _, arg := range args[1:] {
+			if key, value, ok := strings.Cut(arg, "="); ok {
+				toolArgs[key] = value
+				continue
+			}
+			if !fetched {
+				if argOrder, err = fetchArgOrder(ctx, c, toolID); err != nil {
+					return fail(fmt.Errorf("looking up the arguments of tool %s: %w", toolID, err))
+				}
+				fetched = true
+			}
+			if positional >= len(argOrder) {
+				fmt.Fprintf(os.Stderr, "Error: argument '%s' is not in key=value format and tool %q takes no further positional arguments.\n", arg, toolID)
+				return exitUsage
+			}
+			toolArgs[argOrder[positional]] = arg
+			positional++
+		}
+
+		var result struct {
+			Output string `json:"output"`
+		}
+		path := "/api/v1/tools/" + url.PathEscape(toolID) + "/run"
+		if err := c.do(ctx, http.MethodPost, path, map[string]interface{}{"args": toolArgs}, &result); err != nil {
+			return fail(err)
+		}
+		return show(*out, result, func(w io.Writer) {
+			fmt.Fprint(w, result.Output)
+			if !strings.HasSuffix(result.Output, "\n") {
+				fmt.Fprintln(w)
+			}
+		})
+	}
+}
+
+// fetchArgOrder asks the server for the tool and returns the argument order it declares.
+func fetchArgOrder(ctx context.Context, c *client, toolID string) ([]string, error) {
+	var tool toolmodel.ToolConfig
+	if err := c.do(ctx, http.MethodGet, "/api/v1/tools/"+url.PathEscape(toolID), nil, &tool); err != nil {
+		return nil, err
+	}
+	return tool.ArgOrder, nil
+}
+
+var sessionsCommand = &command{
+	name:    "sessions",
+	summary: "List, show and delete chat sessions",
+	subcommands: []*command{
+		{
+			name:    "list",
+			summary: "List your chat sessions, most recently used first",
+			setup: func(fs *flag.FlagSet) func([]string) int {
+				out := outputFlag(fs, formatTable)
+				return func([]string) int {
+					var sessions []session.Session
+					if err := get("/api/v1/sessions", &sessions); err != nil {
+						return fail(err)
+					}
+					return show(*out, sessions, func(w io.Writer) {
+						t := newTable(w, "ID", "MODEL", "PRINCIPAL", "UPDATED", "CREATED")
+						for _, s := range sessions {
+							t.row(s.ID, s.Model, s.Principal, s.Updated.Local().Format(time.DateTime), s.Created.Local().Format(time.DateTime))
+						}
+						t.flush()
+					})
+				}
+			},
+		},
+		{
+			name:    "show",
+			args:    "<id>",
+			summary: "Show a chat session and its messages",
+			setup: func(fs *flag.FlagSet) func([]string) int {
+				out := outputFlag(fs, formatTable)
+				return func(args []string) int {
+					var s session.Session
+					if err := get("/api/v1/sessions/"+url.PathEscape(args[0]), &s); err != nil {
+						return fail(err)
+					}
+					return show(*out, s, func(w io.Writer) {
+						fields(w,
+							"ID", s.ID,
+							"Model", s.Model,
+							"Principal", s.Principal,
+							"Created", s.Created.Local().Format(time.DateTime),
+							"Updated", s.Updated.Local().Format(time.DateTime))
+						if len(s.Messages) > 0 {
+							fmt.Fprintf(w, "\n%s\n", agent.Transcript(s.Messages))
+						}
+					})
+				}
+			},
+		},
+		{
+			name:    "delete",
+			args:    "<id>",
+			summary: "Delete a chat session",
+			setup: func(fs *flag.FlagSet) func([]string) int {
+				return func(args []string) int {
+					c, err := newClient()
+					if err != nil {
+						return fail(err)
+					}
+					if err := c.do(context.Background(), http.MethodDelete, "/api/v1/sessions/"+url.PathEscape(args[0]), nil, nil); err != nil {
+						return fail(err)
+					}
+					fmt.Printf("Deleted session %s.\n", args[0])
+					return exitOK
+				}
+			},
+		},
+	},
+}
+
+var usageCommand = &command{
+	name:    "usage",
+	summary: "Report token usage and cost",
+	setup: func(fs *flag.FlagSet) func([]string) int {
+		out := outputFlag(fs, formatTable)
+		from := fs.String("from", "", "First day, YYYY-MM-DD (default the first of the month)")
+		to := fs.String("to", "", "Last day, YYYY-MM-DD (default today)")
+		principal := fs.String("principal", "", "Only this principal, e.g. api_key:ci, or every principal with an ID")
+		model := fs.String("model", "", "Only this model")
+		groupBy := fs.String("group-by", "", "Comma-separated fields to group by: day, principal, model (default all)")
+		return func([]string) int {
+			q := url.Values{}
+			for name, value := range map[string]string{"from": *from, "to": *to, "principal": *principal, "model": *model, "group_by": *groupBy} {
+				if value != "" {
+					q.Set(name, value)
+				}
+			}
+			var report handlers.UsageReport
+			if err := get("/api/v1/usage?"+q.Encode(), &report); err != nil {
+				return fail(err)
+			}
+			return show(*out, report, func(w io.Writer) {
+				columns := []string{"day", "principal", "model"}
+				if *groupBy != "" {
+					columns = strings.Split(*groupBy, ",")
+				}
+				header := make([]string, 0, len(columns)+5)
+				for _, column := range columns {
+					header = append(header, strings.ToUpper(column))
+				}
+				t := newTable(w, append(header, "REQUESTS", "PROMPT", "COMPLETION", "TOTAL", "COST")...)
+				for _, r := range report.Rows {
+					var cells []string
+					for _, column := range columns {
+						cells = append(cells, map[string]string{"day": r.Day, "principal": r.Principal, "model": r.Model}[column])
+					}
+					t.row(append(cells, totals(r.Requests, r.PromptTokens, r.CompletionTokens, r.TotalTokens, r.Cost)...)...)
+				}
+				cells := make([]string, len(columns))
+				cells[0] = "TOTAL"
+				tot := report.Total
+				t.row(append(cells, totals(tot.Requests, tot.PromptTokens, tot.CompletionTokens, tot.TotalTokens, tot.Cost)...)...)
+				t.flush()
+				fmt.Fprintf(w, "\n%s to %s\n", report.From, report.To)
+				if tot.EstimatedRequests > 0 {
+					fmt.Fprintf(w, "%d of %d requests have approximate tokens and cost: their backend did not report usage.\n", tot.EstimatedRequests, tot.Requests)
+				}
+			})
+		}
+	},
+}
+
+// totals formats the numbers of a usage row.
+func totals(requests, prompt, completion, total int, cost float64) []string {
+	return []string{
+		strconv.Itoa(requests),
+		strconv.Itoa(prompt),
+		strconv.Itoa(completion),
+		strconv.Itoa(total),
+		strconv.FormatFloat(cost, 'f', 4, 64),
+	}
+}
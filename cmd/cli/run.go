@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"krackenservices.com/agentAI/internal/agent"
+	"krackenservices.com/agentAI/internal/auth"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/mcp"
+	"krackenservices.com/agentAI/internal/server"
+	"krackenservices.com/agentAI/internal/usage"
+)
+
+// localPrincipal is charged for the usage of runs in the CLI, so budgets for "*" apply to
+// them as to any API key.
+var localPrincipal = &auth.Principal{ID: "cli", Method: auth.MethodLocal}
+
+var runCommand = &command{
+	name:    "run",
+	args:    "[prompt...]",
+	summary: "Run the agent on a prompt in-process, without a server",
+	setup: func(fs *flag.FlagSet) func([]string) int {
+		configPath := fs.String("config", "", "Path to the config file (defaults to config.yaml next to the binary)")
+		toolsDir := fs.String("tools", "", "Directory to discover tools in (defaults to tools/ next to the binary)")
+		model := fs.String("model", "", "Model to run (required)")
+		maxIterations := fs.Int("max-iterations", agent.DefaultMaxIterations, "Maximum number of model calls")
+		verbose := fs.Bool("v", false, "Print the model responses and tool calls to stderr as they happen")
+		out := outputFlag(fs, formatTable)
+		return func(args []string) int {
+			if *model == "" {
+				fmt.Fprintln(os.Stderr, "Error: -model is required")
+				return exitUsage
+			}
+			prompt := strings.Join(args, " ")
+			if len(args) == 0 || prompt == "-" {
+				// Read the prompt from stdin, e.g. from a pipe.
+				data, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return fail(err)
+				}
+				prompt = string(data)
+			}
+			if strings.TrimSpace(prompt) == "" {
+				fmt.Fprintln(os.Stderr, "Error: the prompt is empty")
+				return exitUsage
+			}
+
+			discoverTools(*toolsDir)
+			cfg, err := config.LoadConfig(*configPath)
+			if err != nil {
+				return fail(err)
+			}
+			result, err := runLocal(cfg, *model, prompt, *maxIterations, *verbose)
+			if err != nil {
+				return fail(err)
+			}
+			return show(*out, result, func(w io.Writer) {
+				fmt.Fprintln(w, strings.TrimRight(result.Output, "\n"))
+			})
+		}
+	},
+}
+
+// runLocal runs the agent loop on the prompt in-process, with the tools of the configuration
+// and the budgets and usage file of the server. Ctrl-C cancels the run.
+func runLocal(cfg *config.Config, model, prompt string, maxIterations int, verbose bool) (agent.Result, error) {
+	closeLocal, err := openLocal(cfg)
+	if err != nil {
+		return agent.Result{}, err
+	}
+	defer closeLocal()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	everything := func(string) bool { return true }
+	run, err := handlers.NewRun(ctx, cfg, localPrincipal.Key(), model, everything, handlers.EnabledTools(cfg))
+	if err != nil {
+		return agent.Result{}, err
+	}
+	if run.Model.ID != model {
+		fmt.Fprintf(os.Stderr, "Budget exceeded: using model %s instead of %s\n", run.Model.ID, model)
+	}
+	run.MaxIterations = maxIterations
+	if verbose {
+		run.OnEvent = func(e agent.Event) {
+			fmt.Fprintf(os.Stderr, "[%d %s] %s\n", e.Iteration, e.Type, e.Content)
+		}
+	}
+	return run.Chat(ctx, []llm.Message{{Role: agent.RoleUser, Content: prompt}})
+}
+
+// openLocal connects the MCP servers and opens the usage file of the configuration, as the
+// server would, and returns the function that closes them.
+func openLocal(cfg *config.Config) (func(), error) {
+	server.ConnectMCPServers(cfg)
+	if cfg.Usage.File != "" {
+		if err := usage.Default.Open(cfg.ResolvePath(cfg.Usage.File)); err != nil {
+			mcp.DefaultPool.Close()
+			return nil, err
+		}
+	}
+	return func() {
+		if cfg.Usage.File != "" {
+			usage.Default.Close()
+		}
+		mcp.DefaultPool.Close()
+	}, nil
+}
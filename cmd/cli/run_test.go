@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/config"
+)
+
+// fixtureTool is a tool binary that describes itself and lists the directory it is given.
+const fixtureTool = `#!/bin/sh
+if [ "$1" = "--describe" ]; then
+	printf 'description: Lists a directory\ncommand_args:\n  path: .\n'
+	exit 0
+fi
+echo "listing $2"
+echo "file1"
+`
+
+const runConfig = `models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+    enabled: true
+    tools_supported: true
+    tool_tag_start: "<tool>"
+    tool_tag_end: "</tool>"
+    tools:
+      - fstool
+tools:
+  - id: fstool
+    enabled: true
+`
+
+func TestRunLocal(t *testing.T) {
+	dir := t.TempDir()
+	toolsDir := filepath.Join(dir, "tools")
+	if err := os.Mkdir(toolsDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(toolsDir, "agentAI-fstool"), []byte(fixtureTool), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "config.yml")
+	if err := os.WriteFile(configPath, []byte(runConfig), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	discoverTools(toolsDir)
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := runLocal(cfg, "local", "list the files", 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Messages) < 2 || !strings.Contains(result.Messages[1].Content, "listing .\nfile1") {
+		t.Errorf("expected the output of the tool in the transcript, got %+v", result.Messages)
+	}
+	if result.Output == "" {
+		t.Error("expected a final answer")
+	}
+}
@@ -0,0 +1,332 @@
+// Package agent runs the agent loop shared by the chat and sessions APIs and the CLI: it
+// sends the conversation to a model, runs the tools the model asks for and feeds their
+// results back until the model answers without a tool call.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/metrics"
+	"krackenservices.com/agentAI/internal/toolmodel"
+	"krackenservices.com/agentAI/internal/tracing"
+	"krackenservices.com/agentAI/internal/usage"
+)
+
+// Step1 Recieve Message from the user
+// Step2 Construct the payload to send to the LLM (Tool context etc)
+// Step3 Send the message to the LLM
+// Step4 Recieve the response from the LLM
+// Step5 Check for tool commands
+// Step6 Call tools, send the response to LLM
+// Step7 Loop 4 - 6 until no tool comamnds found
+// Step8 Send the final response to the user
+
+// DefaultMaxIterations bounds the model calls of a run when Run.MaxIterations is not set.
+const DefaultMaxIterations = 10
+
+// Roles of the messages a run adds to the conversation.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+	RoleTool      = "tool"
+)
+
+// Event types.
+const (
+	// EventMessage carries a response of the model.
+	EventMessage = "message"
+	// EventToolCall carries the tool command the model asked for.
+	EventToolCall = "tool_call"
+	// EventToolResult carries the output of the tool.
+	EventToolResult = "tool_result"
+)
+
+// ErrTooManyIterations is reported, as an llm.UpstreamError, when the model keeps asking for tools.
+var ErrTooManyIterations = errors.New("the model did not answer within the maximum number of iterations")
+
+// Event is one step of a run, reported as it happens.
+type Event struct {
+	Type      string `json:"type" example:"tool_call"`
+	Iteration int    `json:"iteration" example:"1"`
+	Content   string `json:"content"`
+}
+
+// Result is the outcome of a run.
+type Result struct {
+	// Output is the final response of the model.
+	Output     string `json:"output"`
+	Iterations int    `json:"iterations"`
+	// Messages are the messages the run added to the conversation: the responses of the
+	// model and the tool results, ending with the output.
+	Messages []llm.Message `json:"messages"`
+	// Usage sums the tokens of the model calls.
+	Usage llm.Usage `json:"usage"`
+}
+
+// Run is a chat with one model.
+type Run struct {
+	// Principal is charged for the usage of the model.
+	Principal string
+	Model     *config.ModelConfig
+	// Tools are the tools the caller may use; the model is offered those it lists.
+	Tools []toolmodel.ToolConfig
+	// MaxIterations bounds the model calls (default DefaultMaxIterations).
+	MaxIterations int
+	// Mask, if set, returns a tool as the model is told about it, with its secret values
+	// hidden. Tools still run with their real values.
+	Mask func(tool toolmodel.ToolConfig) toolmodel.ToolConfig
+	// Execute runs a tool the model calls with the arguments it gave.
+	Execute func(ctx context.Context, tool toolmodel.ToolConfig, args map[string]interface{}) (string, error)
+	// OnEvent, if set, is called for every event.
+	OnEvent func(Event)
+}
+
+func (run *Run) emit(e Event) {
+	if run.OnEvent != nil {
+		run.OnEvent(e)
+	}
+}
+
+// Chat continues the conversation, whose last message is normally the user's, until the
+// model answers.
+func (run *Run) Chat(ctx context.Context, messages []llm.Message) (Result, error) {
+	model := run.Model
+	maxIterations := run.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = DefaultMaxIterations
+	}
+	metrics.RunsInFlight.Add(1)
+	defer metrics.RunsInFlight.Add(-1)
+	var result Result
+	defer func() { metrics.AgentIterations.Observe(float64(result.Iterations), model.ID) }()
+
+	offered := run.Tools
+	if run.Mask != nil {
+		offered = make([]toolmodel.ToolConfig, len(run.Tools))
+		for i, tool := range run.Tools {
+			offered[i] = run.Mask(tool)
+		}
+	}
+	toolContext := ToolContext(*model, offered)
+	callPattern, err := model.ToolCallPattern()
+	if err != nil {
+		return result, fmt.Errorf("model %q: %w", model.ID, err)
+	}
+	conversation := append([]llm.Message(nil), messages...)
+	for {
+		if result.Iterations == maxIterations {
+			return result, &llm.UpstreamError{Model: model.ID, Err: ErrTooManyIterations}
+		}
+		result.Iterations++
+
+		// Each model call and the tool call it asks for form one iteration of the agent loop.
+		ctx, iteration := tracing.Start(ctx, "agent.iteration", tracing.KindInternal, tracing.Int("agent.iteration", result.Iterations))
+		resp, err := callLLM(ctx, run.Principal, model, toolContext, Transcript(conversation))
+		if err != nil {
+			iteration.RecordError(err)
+			iteration.End()
+			return result, err
+		}
+		result.Usage.PromptTokens += resp.Usage.PromptTokens
+		result.Usage.CompletionTokens += resp.Usage.CompletionTokens
+		reply := llm.Message{Role: RoleAssistant, Content: resp.Output}
+		conversation = append(conversation, reply)
+		result.Messages = append(result.Messages, reply)
+		run.emit(Event{Type: EventMessage, Iteration: result.Iterations, Content: resp.Output})
+
+		command, found := extractToolCommand(callPattern, resp.Output)
+		if !found {
+			iteration.End()
+			result.Output = resp.Output
+			return result, nil
+		}
+		run.emit(Event{Type: EventToolCall, Iteration: result.Iterations, Content: command})
+		toolResult, err := run.callTool(ctx, command)
+		iteration.RecordError(err)
+		iteration.End()
+		if err != nil {
+			return result, err
+		}
+		run.emit(Event{Type: EventToolResult, Iteration: result.Iterations, Content: toolResult})
+
+		// Append the tool result to the conversation and send it back to the model.
+		toolMessage := llm.Message{Role: RoleTool, Content: "Tool result: " + toolResult}
+		conversation = append(conversation, toolMessage)
+		result.Messages = append(result.Messages, toolMessage)
+	}
+}
+
+// Transcript renders a conversation as the text sent to the model: a single message as is,
+// longer conversations with the role of each message.
+func Transcript(messages []llm.Message) string {
+	if len(messages) == 1 {
+		return messages[0].Content
+	}
+	var sb strings.Builder
+	for i, m := range messages {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(m.Role + ": " + m.Content)
+	}
+	return sb.String()
+}
+
+// callLLM sends the message to the model and records the usage of the call for principal,
+// estimating it when the backend reports none.
+func callLLM(ctx context.Context, principal string, model *config.ModelConfig, toolContext, message string) (llm.Response, error) {
+	prompt := toolContext + "\n" + message
+
+	slog.DebugContext(ctx, "Sending message to model", "model", model.ID, "message", prompt)
+
+	start := time.Now()
+	_, span := tracing.Start(ctx, "chat "+model.ID, tracing.KindClient,
+		tracing.String("gen_ai.operation.name", "chat"),
+		tracing.String("gen_ai.system", model.APIVendor),
+		tracing.String("gen_ai.request.model", model.ID))
+	defer span.End()
+	_, err := json.Marshal(prompt)
+	if err != nil {
+		metrics.LLMCalls.Inc(model.ID, model.APIVendor, "error")
+		span.RecordError(err)
+		return llm.Response{}, &llm.UpstreamError{Model: model.ID, Err: fmt.Errorf("failed to marshal payload: %w", err)}
+	}
+	//model.Endpoint
+	var sb strings.Builder
+
+	if !strings.Contains(message, "<tool>") {
+		sb.WriteString("I need the listing of the current directory")
+		sb.WriteString("<tool>{ \"tool\": \"fstool\", \"args\": { \"path\": \".\" } }</tool>")
+	} else {
+		sb.WriteString("I have the listing of the current directory")
+		sb.WriteString("{ \"output\": \"Listing contents of directory: .\\nfile1\\ndir1\\ndir1/subdir1\\n\"}")
+	}
+	resp := llm.Response{Output: sb.String()}
+	metrics.LLMDuration.Observe(metrics.Since(start), model.ID, model.APIVendor)
+	metrics.LLMCalls.Inc(model.ID, model.APIVendor, "ok")
+
+	if resp.Usage == nil {
+		u := llm.EstimateUsage(prompt, resp.Output)
+		resp.Usage = &u
+	}
+	metrics.LLMTokens.Add(float64(resp.Usage.PromptTokens), model.ID, model.APIVendor, "prompt")
+	metrics.LLMTokens.Add(float64(resp.Usage.CompletionTokens), model.ID, model.APIVendor, "completion")
+	span.SetAttributes(tracing.Int("gen_ai.usage.input_tokens", resp.Usage.PromptTokens),
+		tracing.Int("gen_ai.usage.output_tokens", resp.Usage.CompletionTokens))
+	if _, err := usage.Default.Record(principal, *model, *resp.Usage); err != nil {
+		slog.ErrorContext(ctx, "Error recording usage", "error", err)
+	}
+	return resp, nil
+}
+
+// ToolContext describes the tools the model is offered, those of tools that it lists, and
+// how to call them.
+func ToolContext(model config.ModelConfig, tools []toolmodel.ToolConfig) string {
+	available := make(map[string]toolmodel.ToolConfig)
+	for _, tool := range tools {
+		available[tool.ID] = tool
+	}
+
+	var sb strings.Builder
+	var example map[string]interface{}
+	sb.WriteString("You are an assistant that can call external tools when needed.\n")
+	sb.WriteString("Available Tools:\n")
+	for _, toolID := range model.Tools {
+		tool, ok := available[toolID]
+		if !ok {
+			// Unknown, globally disabled or not allowed tools are not offered to the model.
+			continue
+		}
+		// Tools discovered over MCP describe their arguments by schema instead of defaults.
+		var args interface{} = tool.CommandArgs
+		if tool.CommandArgs == nil && tool.InputSchema != nil {
+			args = tool.InputSchema
+		}
+		argsJSON, _ := json.Marshal(args)
+		sb.WriteString(fmt.Sprintf("- %s: %s\n%v\n", tool.ID, tool.Description, string(argsJSON)))
+		if example == nil {
+			example = tool.Example
+		}
+	}
+	sb.WriteString("If you need to fetch external data or perform a task, return a tool call using the following format:\n")
+	sb.WriteString(fmt.Sprintf("%s\n\"{\"name\": \"<tool_name>\", \"arguments\": {\"arg1\": \"value1\"}}\"\n%s\n", model.ToolTagStart, model.ToolTagEnd))
+
+	// Show the example of the first offered tool that has one.
+	if example != nil {
+		cmdExample, _ := json.Marshal(example)
+		sb.WriteString(fmt.Sprintf("For example %s\n", string(cmdExample)))
+	}
+	return sb.String()
+}
+
+// extractToolCommand searches for a tool command pattern in the response.
+// We assume tool commands are enclosed in the tool tags of the model, e.g. <tool>...</tool>,
+// which re finds (see config.ModelConfig.ToolCallPattern). Models without tool tags, whose re
+// is nil, never call tools.
+func extractToolCommand(re *regexp.Regexp, response string) (string, bool) {
+	if re == nil {
+		return "", false
+	}
+	matches := re.FindStringSubmatch(response)
+	if len(matches) > 1 {
+		return matches[1], true
+	}
+	return "", false
+}
+
+// toolCall is a tool call of the model in the {"name", "arguments"} format ToolContext asks
+// for, or in the {"tool", "args"} format of the tool examples.
+type toolCall struct {
+	Name      string                 `json:"name"`
+	Arguments map[string]interface{} `json:"arguments"`
+	Tool      string                 `json:"tool"`
+	Args      map[string]interface{} `json:"args"`
+}
+
+// callTool runs the tool the model called with command, which must be one the model is
+// offered. Calls the model gets wrong are upstream errors of the model.
+func (run *Run) callTool(ctx context.Context, command string) (string, error) {
+	var call toolCall
+	text := strings.Trim(strings.TrimSpace(command), `"`)
+	if err := json.Unmarshal([]byte(text), &call); err != nil {
+		return "", &llm.UpstreamError{Model: run.Model.ID, Err: fmt.Errorf("invalid tool call %q: %w", command, err)}
+	}
+	if call.Name == "" {
+		call.Name, call.Arguments = call.Tool, call.Args
+	}
+	tool, ok := run.offered(call.Name)
+	if !ok {
+		return "", &llm.UpstreamError{Model: run.Model.ID, Err: fmt.Errorf("unknown tool %q", call.Name)}
+	}
+	if run.Execute == nil {
+		return "", fmt.Errorf("tool %q cannot be run: no tool executor", tool.ID)
+	}
+	return run.Execute(ctx, tool, call.Arguments)
+}
+
+// offered returns the tool with the ID if the model is offered it: the model lists it and
+// it is one of the tools of the run.
+func (run *Run) offered(id string) (toolmodel.ToolConfig, bool) {
+	listed := false
+	for _, t := range run.Model.Tools {
+		listed = listed || t == id
+	}
+	if !listed {
+		return toolmodel.ToolConfig{}, false
+	}
+	for _, tool := range run.Tools {
+		if tool.ID == id {
+			return tool, true
+		}
+	}
+	return toolmodel.ToolConfig{}, false
+}
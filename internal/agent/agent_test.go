@@ -0,0 +1,134 @@
+package agent_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/agent"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+func TestRun_Chat(t *testing.T) {
+	model := &config.ModelConfig{ID: "local", ToolsSupported: true, ToolTagStart: "<tool>", ToolTagEnd: "</tool>", Tools: []string{"fstool"}}
+	tools := []toolmodel.ToolConfig{{ID: "fstool", CommandArgs: map[string]interface{}{"path": "."}}}
+	var called []string
+	execute := func(ctx context.Context, tool toolmodel.ToolConfig, args map[string]interface{}) (string, error) {
+		called = append(called, fmt.Sprintf("%s %v", tool.ID, args))
+		return "file1\ndir1", nil
+	}
+	var events []string
+	run := &agent.Run{Principal: "ci", Model: model, Tools: tools, Execute: execute, OnEvent: func(e agent.Event) { events = append(events, e.Type) }}
+
+	result, err := run.Chat(context.Background(), []llm.Message{{Role: agent.RoleUser, Content: "list the directory"}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	want := []string{agent.EventMessage, agent.EventToolCall, agent.EventToolResult, agent.EventMessage}
+	if strings.Join(events, ",") != strings.Join(want, ",") {
+		t.Errorf("expected events %v, got %v", want, events)
+	}
+	if result.Iterations != 2 || len(result.Messages) != 3 || result.Messages[1].Role != agent.RoleTool {
+		t.Errorf("expected two iterations adding a reply, a tool result and the output, got %+v", result)
+	}
+	if len(called) != 1 || called[0] != "fstool map[path:.]" {
+		t.Errorf("expected fstool to run with the arguments of the model, got %v", called)
+	}
+	if result.Messages[1].Content != "Tool result: file1\ndir1" {
+		t.Errorf("expected the output of the tool in the transcript, got %q", result.Messages[1].Content)
+	}
+	if !strings.HasPrefix(result.Output, "I have the listing") || result.Output != result.Messages[2].Content {
+		t.Errorf("unexpected output %q", result.Output)
+	}
+	if result.Usage.PromptTokens == 0 || result.Usage.CompletionTokens == 0 {
+		t.Errorf("expected the usage of both calls, got %+v", result.Usage)
+	}
+
+	// Without tool tags the first response is the answer.
+	run = &agent.Run{Model: &config.ModelConfig{ID: "plain"}}
+	if result, err := run.Chat(context.Background(), []llm.Message{{Role: agent.RoleUser, Content: "hi"}}); err != nil || result.Iterations != 1 {
+		t.Errorf("expected one iteration, got %+v, %v", result, err)
+	}
+
+	// Tools the model is not offered are not run.
+	var upstream *llm.UpstreamError
+	for _, run := range []*agent.Run{
+		{Model: model, Execute: execute},
+		{Model: &config.ModelConfig{ID: "local", ToolTagStart: "<tool>", ToolTagEnd: "</tool>"}, Tools: tools, Execute: execute},
+	} {
+		called = nil
+		_, err = run.Chat(context.Background(), []llm.Message{{Role: agent.RoleUser, Content: "hi"}})
+		if !errors.As(err, &upstream) || !strings.Contains(err.Error(), `unknown tool "fstool"`) || called != nil {
+			t.Errorf("expected an unknown tool error, got %v after %v", err, called)
+		}
+	}
+
+	// Errors of the tool end the run.
+	failing := func(ctx context.Context, tool toolmodel.ToolConfig, args map[string]interface{}) (string, error) {
+		return "", &toolmodel.ExecError{Tool: tool.ID, Err: errors.New("exit status 1")}
+	}
+	run = &agent.Run{Model: model, Tools: tools, Execute: failing}
+	var execErr *toolmodel.ExecError
+	if _, err := run.Chat(context.Background(), []llm.Message{{Role: agent.RoleUser, Content: "hi"}}); !errors.As(err, &execErr) {
+		t.Errorf("expected the error of the tool, got %v", err)
+	}
+
+	// A model that keeps calling tools is stopped.
+	run = &agent.Run{Model: model, Tools: tools, Execute: execute, MaxIterations: 1}
+	_, err = run.Chat(context.Background(), []llm.Message{{Role: agent.RoleUser, Content: "hi"}})
+	if !errors.Is(err, agent.ErrTooManyIterations) || !errors.As(err, &upstream) {
+		t.Errorf("expected an upstream error for too many iterations, got %v", err)
+	}
+}
+
+func TestRun_InvalidToolTags(t *testing.T) {
+	model := &config.ModelConfig{ID: "local", ToolTagStart: "[tool", ToolTagEnd: "[/tool"}
+	run := &agent.Run{Model: model}
+	if _, err := run.Chat(context.Background(), []llm.Message{{Role: agent.RoleUser, Content: "hi"}}); err == nil || !strings.Contains(err.Error(), "regular expression") {
+		t.Errorf("expected an error for tags that are not a regular expression, got %v", err)
+	}
+}
+
+func TestRun_MasksToolsInPrompt(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	model := &config.ModelConfig{ID: "local", ToolTagStart: "<tool>", ToolTagEnd: "</tool>", Tools: []string{"fstool"}}
+	tools := []toolmodel.ToolConfig{{ID: "fstool", CommandArgs: map[string]interface{}{"path": ".", "token": "sk-live"}}}
+	mask := func(tool toolmodel.ToolConfig) toolmodel.ToolConfig {
+		tool.CommandArgs = map[string]interface{}{"path": tool.CommandArgs["path"], "token": config.Masked}
+		return tool
+	}
+	var token interface{}
+	execute := func(ctx context.Context, tool toolmodel.ToolConfig, args map[string]interface{}) (string, error) {
+		token = tool.CommandArgs["token"]
+		return "file1", nil
+	}
+	run := &agent.Run{Model: model, Tools: tools, Mask: mask, Execute: execute}
+	if _, err := run.Chat(context.Background(), []llm.Message{{Role: agent.RoleUser, Content: "list"}}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(logs.String(), "sk-live") || !strings.Contains(logs.String(), "token") {
+		t.Errorf("expected the prompt to describe the masked tool, got %s", logs.String())
+	}
+	if token != "sk-live" {
+		t.Errorf("expected the tool to run with its real defaults, got %v", token)
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	if got := agent.Transcript([]llm.Message{{Role: agent.RoleUser, Content: "hi"}}); got != "hi" {
+		t.Errorf("expected a single message as is, got %q", got)
+	}
+	got := agent.Transcript([]llm.Message{{Role: agent.RoleUser, Content: "hi"}, {Role: agent.RoleAssistant, Content: "hello"}})
+	if got != "user: hi\nassistant: hello" {
+		t.Errorf("unexpected transcript %q", got)
+	}
+}
@@ -0,0 +1,262 @@
+// Package auth authenticates API callers with static API keys or JWTs and checks the
+// scopes and allow-lists configured for them.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/problem"
+)
+
+// Authentication methods reported in Principal.Method.
+const (
+	MethodAPIKey    = "api_key"
+	MethodJWT       = "jwt"
+	MethodAnonymous = "anonymous"
+	// MethodLocal is the principal of runs in the CLI, outside the API.
+	MethodLocal = "local"
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	// ID is the API key id or the JWT subject.
+	ID     string
+	Method string
+	Scopes []string
+	// Models and Tools are allow-lists of ID patterns; empty allows all.
+	Models []string
+	Tools  []string
+}
+
+// Key identifies the principal as method:id, e.g. api_key:ci or jwt:alice, so that an API key
+// and a JWT subject with the same ID are different principals. Usage, sessions and batches
+// are recorded under it.
+func (p *Principal) Key() string {
+	return p.Method + ":" + p.ID
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsModel reports whether the principal may use the model. A nil principal (an
+// in-process caller such as the stdio MCP server) may use everything.
+func (p *Principal) AllowsModel(id string) bool {
+	return p == nil || allowed(p.Models, id)
+}
+
+// AllowsTool reports whether the principal may use the tool.
+func (p *Principal) AllowsTool(id string) bool {
+	return p == nil || allowed(p.Tools, id)
+}
+
+func allowed(patterns []string, id string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, id); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of the request, or nil if there is none.
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(contextKey{}).(*Principal)
+	return p
+}
+
+// Authenticator checks the credentials of a request against one configuration.
+type Authenticator struct {
+	enabled bool
+	// keys maps the SHA-256 of each API key to its principal, so lookups do not compare secrets directly.
+	keys map[[sha256.Size]byte]*Principal
+	jwt  *jwtVerifier
+}
+
+// New builds the authenticator for cfg, loading the JWKS file if JWT authentication is configured.
+// The admin token (server.admin_token) is accepted as a key with the admin scope.
+func New(cfg *config.Config) (*Authenticator, error) {
+	a := &Authenticator{
+		enabled: cfg.Auth.Enabled(),
+		keys:    make(map[[sha256.Size]byte]*Principal),
+	}
+	for _, k := range cfg.Auth.APIKeys {
+		a.keys[sha256.Sum256([]byte(k.Key))] = &Principal{
+			ID:     k.ID,
+			Method: MethodAPIKey,
+			Scopes: k.Scopes,
+			Models: k.Models,
+			Tools:  k.Tools,
+		}
+	}
+	if token := cfg.Server.AdminToken; token != "" {
+		if _, exists := a.keys[sha256.Sum256([]byte(token))]; !exists {
+			a.keys[sha256.Sum256([]byte(token))] = &Principal{ID: "admin_token", Method: MethodAPIKey, Scopes: []string{config.ScopeAdmin}}
+		}
+	}
+	if cfg.Auth.JWT != nil {
+		v, err := newJWTVerifier(cfg.Auth.JWT, cfg.ResolvePath(cfg.Auth.JWT.JWKSFile))
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = v
+	}
+	return a, nil
+}
+
+var (
+	cacheMu   sync.Mutex
+	cachedCfg *config.Config
+	cached    *Authenticator
+)
+
+// ForConfig returns the authenticator of cfg, building it on first use. The configuration
+// is replaced as a whole on reload, so one authenticator is kept for the live configuration.
+func ForConfig(cfg *config.Config) (*Authenticator, error) {
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if cfg == cachedCfg {
+		return cached, nil
+	}
+	a, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	cachedCfg, cached = cfg, a
+	return a, nil
+}
+
+// Authenticate returns the principal for the credentials of r. Requests without credentials
+// are anonymous: when authentication is disabled they may chat and execute tools, otherwise
+// they are granted no scopes. Invalid credentials are an error.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := r.Header.Get("X-API-Key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = strings.TrimSpace(bearer)
+	}
+	if token != "" {
+		if p, ok := a.keys[sha256.Sum256([]byte(token))]; ok {
+			return p, nil
+		}
+		if a.jwt != nil && strings.Count(token, ".") == 2 {
+			return a.jwt.verify(token)
+		}
+		if a.enabled {
+			return nil, fmt.Errorf("invalid API key")
+		}
+		// Without configured credentials, unknown ones (e.g. a wrong admin token) are ignored.
+	}
+	anonymous := &Principal{ID: "anonymous", Method: MethodAnonymous}
+	if !a.enabled {
+		anonymous.Scopes = []string{config.ScopeChat, config.ScopeToolsExecute}
+	}
+	return anonymous, nil
+}
+
+// Lookup returns the principal with the key (see Principal.Key), with its scopes and
+// allow-lists in the configuration, for work that runs on its behalf after its request, such
+// as a resumed batch. It reports false if the principal no longer exists: the API key was
+// removed, JWT or anonymous access is no longer configured. JWT subjects are returned
+// without scopes, as their tokens are not kept.
+func (a *Authenticator) Lookup(key string) (*Principal, bool) {
+	method, id, _ := strings.Cut(key, ":")
+	switch method {
+	case MethodAPIKey:
+		for _, p := range a.keys {
+			if p.ID == id {
+				return p, true
+			}
+		}
+	case MethodJWT:
+		if a.jwt != nil {
+			return &Principal{ID: id, Method: MethodJWT}, true
+		}
+	case MethodAnonymous:
+		if !a.enabled {
+			return &Principal{ID: id, Method: MethodAnonymous, Scopes: []string{config.ScopeChat, config.ScopeToolsExecute}}, true
+		}
+	}
+	return nil, false
+}
+
+// Middleware authenticates every request and stores the principal in its context.
+// Requests with invalid credentials are rejected with 401.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.Authenticate(r)
+		if err != nil {
+			slog.WarnContext(r.Context(), "Authentication failed", "method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr, "error", err)
+			Unauthorized(w, r, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+	})
+}
+
+// Require only lets requests through whose principal has scope. Requests that were not
+// authenticated at all get 401, authenticated ones without the scope 403.
+func Require(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := FromContext(r.Context())
+		if p == nil || (p.Method == MethodAnonymous && !p.HasScope(scope)) {
+			Unauthorized(w, r, "authentication required")
+			return
+		}
+		if !p.HasScope(scope) {
+			Forbidden(w, r, fmt.Sprintf("the %s scope is required", scope))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Authenticated only lets requests through from callers that presented valid credentials,
+// or from anyone when authentication is disabled.
+func Authenticated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := FromContext(r.Context())
+		if p == nil || (p.Method == MethodAnonymous && len(p.Scopes) == 0) {
+			Unauthorized(w, r, "authentication required")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Unauthorized writes a 401 problem asking for credentials.
+func Unauthorized(w http.ResponseWriter, r *http.Request, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="agentAI"`)
+	problem.Error(w, r, http.StatusUnauthorized, msg)
+}
+
+// Forbidden writes a 403 problem.
+func Forbidden(w http.ResponseWriter, r *http.Request, msg string) {
+	problem.Error(w, r, http.StatusForbidden, msg)
+}
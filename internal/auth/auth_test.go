@@ -0,0 +1,259 @@
+package auth_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"krackenservices.com/agentAI/internal/auth"
+	"krackenservices.com/agentAI/internal/config"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signToken returns a JWT with the given claims, signed with key (RS256 or ES256).
+func signToken(t *testing.T, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+	return signed + "." + b64(sig)
+}
+
+// newAuthenticator loads a config with two API keys and JWT authentication against a JWKS
+// file holding an RSA and an EC key.
+func newAuthenticator(t *testing.T) (*auth.Authenticator, *rsa.PrivateKey, *ecdsa.PrivateKey) {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64(ecKey.X.Bytes()), "y": b64(ecKey.Y.Bytes())},
+	}})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "jwks.json"), jwks, 0644)
+	os.WriteFile(filepath.Join(dir, "config.yml"), []byte(`models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+  - id: premium
+    name: bigmodel
+    endpoint: http://127.0.0.1:8080/
+auth:
+  api_keys:
+    - id: ci
+      key: ci-key
+      scopes: [chat]
+      models: [local]
+      tools: ["fs*"]
+    - id: ops
+      key: ops-key
+      scopes: [admin, tools:execute]
+  jwt:
+    jwks_file: jwks.json
+    issuer: https://issuer.example
+    audience: agentai
+`), 0644)
+	cfg, err := config.LoadConfig(filepath.Join(dir, "config.yml"))
+	if err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+	a, err := auth.New(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return a, rsaKey, ecKey
+}
+
+func request(header, value string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/models", nil)
+	if header != "" {
+		r.Header.Set(header, value)
+	}
+	return r
+}
+
+func TestAuthenticate_APIKeys(t *testing.T) {
+	a, _, _ := newAuthenticator(t)
+
+	p, err := a.Authenticate(request("X-API-Key", "ci-key"))
+	if err != nil || p.ID != "ci" || p.Method != auth.MethodAPIKey {
+		t.Fatalf("expected the ci key, got %+v, %v", p, err)
+	}
+	if !p.HasScope(config.ScopeChat) || p.HasScope(config.ScopeAdmin) {
+		t.Errorf("unexpected scopes %v", p.Scopes)
+	}
+	if !p.AllowsModel("local") || p.AllowsModel("premium") {
+		t.Errorf("expected the model allow-list to apply, got %v", p.Models)
+	}
+	if !p.AllowsTool("fstool") || p.AllowsTool("webtool") {
+		t.Errorf("expected the tool allow-list to apply, got %v", p.Tools)
+	}
+
+	p, err = a.Authenticate(request("Authorization", "Bearer ops-key"))
+	if err != nil || p.ID != "ops" || !p.HasScope(config.ScopeAdmin) || !p.AllowsModel("premium") {
+		t.Fatalf("expected the ops key with no allow-lists, got %+v, %v", p, err)
+	}
+
+	if _, err := a.Authenticate(request("X-API-Key", "wrong")); err == nil {
+		t.Error("expected an unknown key to be rejected")
+	}
+	p, err = a.Authenticate(request("", ""))
+	if err != nil || p.Method != auth.MethodAnonymous || len(p.Scopes) != 0 {
+		t.Errorf("expected an anonymous principal without scopes, got %+v, %v", p, err)
+	}
+}
+
+func TestAuthenticate_JWT(t *testing.T) {
+	a, rsaKey, ecKey := newAuthenticator(t)
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub":   "alice",
+			"iss":   "https://issuer.example",
+			"aud":   []string{"other", "agentai"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"scope": "chat tools:execute",
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	for _, tc := range []struct {
+		name string
+		kid  string
+		key  crypto.Signer
+	}{
+		{"RS256", "rsa1", rsaKey},
+		{"ES256", "ec1", ecKey},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			token := signToken(t, tc.kid, tc.key, claims(nil))
+			p, err := a.Authenticate(request("Authorization", "Bearer "+token))
+			if err != nil {
+				t.Fatalf("expected a valid token, got %v", err)
+			}
+			if p.ID != "alice" || p.Key() != "jwt:alice" || p.Method != auth.MethodJWT || !p.HasScope(config.ScopeToolsExecute) || p.HasScope(config.ScopeAdmin) {
+				t.Errorf("unexpected principal %+v", p)
+			}
+		})
+	}
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	for name, token := range map[string]string{
+		"expired":        signToken(t, "rsa1", rsaKey, claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"wrong audience": signToken(t, "rsa1", rsaKey, claims(map[string]interface{}{"aud": "someone-else"})),
+		"wrong issuer":   signToken(t, "ec1", ecKey, claims(map[string]interface{}{"iss": "https://evil.example"})),
+		"wrong key":      signToken(t, "ec1", otherKey, claims(nil)),
+		"unknown kid":    signToken(t, "nope", rsaKey, claims(nil)),
+		"no subject":     signToken(t, "rsa1", rsaKey, claims(map[string]interface{}{"sub": ""})),
+	} {
+		if _, err := a.Authenticate(request("Authorization", "Bearer "+token)); err == nil {
+			t.Errorf("%s: expected the token to be rejected", name)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	a, _, _ := newAuthenticator(t)
+	h := a.Middleware(auth.Require(config.ScopeAdmin, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tc := range []struct {
+		header, value string
+		want          int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"X-API-Key", "wrong", http.StatusUnauthorized},
+		{"X-API-Key", "ci-key", http.StatusForbidden},
+		{"X-API-Key", "ops-key", http.StatusNoContent},
+	} {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, request(tc.header, tc.value))
+		if rr.Code != tc.want {
+			t.Errorf("%s %q: expected %d, got %d", tc.header, tc.value, tc.want, rr.Code)
+		}
+		if rr.Code >= 400 && rr.Header().Get("Content-Type") != "application/problem+json" {
+			t.Errorf("expected a problem, got %q", rr.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestAuthenticate_Disabled(t *testing.T) {
+	a, err := auth.New(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := a.Authenticate(request("", ""))
+	if err != nil || !p.HasScope(config.ScopeChat) || !p.HasScope(config.ScopeToolsExecute) || p.HasScope(config.ScopeAdmin) {
+		t.Errorf("expected anonymous callers to chat and execute tools, got %+v, %v", p, err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	a, _, _ := newAuthenticator(t)
+	if p, ok := a.Lookup("api_key:ci"); !ok || !p.AllowsModel("local") || p.AllowsModel("premium") {
+		t.Errorf("expected the ci key with its allow-lists, got %+v, %v", p, ok)
+	}
+	if p, ok := a.Lookup("jwt:alice"); !ok || p.ID != "alice" || len(p.Scopes) != 0 {
+		t.Errorf("expected a JWT subject without scopes, got %+v, %v", p, ok)
+	}
+	// The ID of a key is not a JWT subject or a key of its own.
+	for _, key := range []string{"api_key:gone", "anonymous:anonymous", "ci", ":ci", "local:ci"} {
+		if p, ok := a.Lookup(key); ok {
+			t.Errorf("expected no principal %q, got %+v", key, p)
+		}
+	}
+
+	disabled, _ := auth.New(&config.Config{})
+	if p, ok := disabled.Lookup("anonymous:anonymous"); !ok || !p.HasScope(config.ScopeChat) {
+		t.Errorf("expected anonymous callers while authentication is disabled, got %+v, %v", p, ok)
+	}
+	if _, ok := disabled.Lookup("jwt:alice"); ok {
+		t.Error("expected no JWT subjects without JWT authentication")
+	}
+}
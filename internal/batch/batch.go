@@ -0,0 +1,379 @@
+// Package batch runs many chat requests from a JSONL file with bounded concurrency, for the
+// batches API and the CLI. Every finished line is appended to a results file at once, which
+// is the checkpoint: a batch that is interrupted resumes with the lines that have no result.
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"krackenservices.com/agentAI/internal/agent"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/problem"
+)
+
+// DefaultConcurrency is how many lines run at a time unless configured otherwise.
+const DefaultConcurrency = 4
+
+// DefaultMaxInput bounds the input of a batch submitted to the API unless configured otherwise.
+const DefaultMaxInput = 64 << 20
+
+// maxLine bounds the length of a line of the input.
+const maxLine = 16 * 1024 * 1024
+
+// Request is a line of the input: a message to a model.
+type Request struct {
+	// ID is copied to the result, to match results with requests (default the line number).
+	ID      string `json:"id,omitempty" example:"q-17"`
+	Model   string `json:"model" example:"local"`
+	Message string `json:"message" example:"Summarise the README"`
+}
+
+// Result is a line of the results: the reply to a request, or why it failed.
+// swagger:model BatchResult
+type Result struct {
+	// Line is the line of the request in the input, from 1.
+	Line int    `json:"line" example:"17"`
+	ID   string `json:"id" example:"q-17"`
+	// Model is the model that answered, which differs from the requested one after a budget
+	// downgrade.
+	Model      string    `json:"model,omitempty" example:"local"`
+	Output     string    `json:"output,omitempty"`
+	Iterations int       `json:"iterations,omitempty" example:"2"`
+	Usage      llm.Usage `json:"usage"`
+	LatencyMS  int64     `json:"latency_ms" example:"1250"`
+	// Error and Status describe a failed line: the problem detail and its HTTP status.
+	Error  string `json:"error,omitempty" example:"model \"gpt\" not found"`
+	Status int    `json:"status,omitempty" example:"400"`
+}
+
+// Failed reports whether the line failed.
+func (r Result) Failed() bool {
+	return r.Error != ""
+}
+
+// Executor runs a request and returns the model that answered and the run.
+type Executor func(ctx context.Context, req Request) (model string, result agent.Result, err error)
+
+// Processor runs the lines of an input.
+type Processor struct {
+	// Concurrency bounds the lines running at a time (default DefaultConcurrency).
+	Concurrency int
+	Exec        Executor
+	// Done holds the lines that already have a result, which are skipped.
+	Done map[int]bool
+}
+
+// Process runs the requests of in and passes the result of each line to write as it
+// finishes, one at a time and in the order they finish. Lines interrupted by the
+// cancellation of ctx have no result, so that they run again when the batch resumes. The
+// error is that of reading in or of write; failed lines are results.
+func (p *Processor) Process(ctx context.Context, in io.Reader, write func(Result) error) error {
+	concurrency := p.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		writeErr error
+		wg       sync.WaitGroup
+	)
+	slots := make(chan struct{}, concurrency)
+	finish := func(r Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if writeErr != nil {
+			return
+		}
+		if writeErr = write(r); writeErr != nil {
+			cancel()
+		}
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if p.Done[line] || len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		var req Request
+		err := json.Unmarshal(scanner.Bytes(), &req)
+		wg.Add(1)
+		go func(line int, req Request, parseErr error) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			if req.ID == "" {
+				req.ID = strconv.Itoa(line)
+			}
+			if parseErr != nil {
+				finish(failure(Result{Line: line, ID: req.ID}, problem.New(http.StatusBadRequest, fmt.Sprintf("invalid request: %v", parseErr))))
+				return
+			}
+			r, canceled := p.run(ctx, line, req)
+			if !canceled {
+				finish(r)
+			}
+		}(line, req, err)
+	}
+	wg.Wait()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return writeErr
+}
+
+// run runs a request and reports whether the run was interrupted by ctx rather than finished.
+func (p *Processor) run(ctx context.Context, line int, req Request) (Result, bool) {
+	r := Result{Line: line, ID: req.ID, Model: req.Model}
+	if req.Model == "" || req.Message == "" {
+		return failure(r, problem.New(http.StatusBadRequest, "invalid request: model and message are required")), false
+	}
+	start := time.Now()
+	model, result, err := p.Exec(ctx, req)
+	r.LatencyMS = time.Since(start).Milliseconds()
+	if err != nil {
+		if ctx.Err() != nil {
+			return r, true
+		}
+		return failure(r, err), false
+	}
+	r.Model = model
+	r.Output = result.Output
+	r.Iterations = result.Iterations
+	r.Usage = result.Usage
+	return r, false
+}
+
+// failure records err on the result of a failed line.
+func failure(r Result, err error) Result {
+	p := problem.FromError(err)
+	r.Error = err.Error()
+	r.Status = p.Status
+	return r
+}
+
+// CountRequests returns the number of requests in an input, its lines that are not blank.
+func CountRequests(in io.Reader) (int, error) {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+	total := 0
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) > 0 {
+			total++
+		}
+	}
+	return total, scanner.Err()
+}
+
+// ReadResults reads a results file. A missing file has no results; a last line cut short by
+// an interruption is ignored.
+func ReadResults(path string) ([]Result, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var results []Result
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxLine)
+	for scanner.Scan() {
+		var r Result
+		if json.Unmarshal(scanner.Bytes(), &r) == nil && r.Line > 0 {
+			results = append(results, r)
+		}
+	}
+	return results, scanner.Err()
+}
+
+// Done returns the lines that have a result. With retryFailed, failed lines are left out so
+// that they run again.
+func Done(results []Result, retryFailed bool) map[int]bool {
+	done := make(map[int]bool, len(results))
+	for _, r := range results {
+		if !retryFailed || !r.Failed() {
+			done[r.Line] = true
+		}
+	}
+	return done
+}
+
+// Writer appends results to a results file, one JSON line each, written through so that
+// an interruption loses no finished line.
+type Writer struct {
+	f *os.File
+}
+
+// Create opens the results file at path for appending, creating it if needed. A last line
+// cut short by an interruption is removed first, so that the next result starts a line of
+// its own. With retryFailed, the results of failed lines are also removed.
+func Create(path string, retryFailed bool) (*Writer, error) {
+	if retryFailed {
+		if err := dropFailed(path); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := truncatePartial(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Writer{f: f}, nil
+}
+
+// truncatePartial truncates f after its last newline and moves to its end.
+func truncatePartial(f *os.File) error {
+	end, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 4096)
+	size := int64(0)
+	for pos := end; pos > 0 && size == 0; {
+		n := min(int64(len(buf)), pos)
+		pos -= n
+		if _, err := f.ReadAt(buf[:n], pos); err != nil {
+			return err
+		}
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i >= 0 {
+			size = pos + int64(i) + 1
+		}
+	}
+	if size == end {
+		return nil
+	}
+	if err := f.Truncate(size); err != nil {
+		return err
+	}
+	_, err = f.Seek(size, io.SeekStart)
+	return err
+}
+
+// dropFailed rewrites the results file without its failed lines.
+func dropFailed(path string) error {
+	results, err := ReadResults(path)
+	if err != nil || results == nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for _, r := range results {
+		if !r.Failed() {
+			if err := enc.Encode(r); err != nil {
+				f.Close()
+				return err
+			}
+		}
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Write appends a result.
+func (w *Writer) Write(r Result) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.f.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the results file.
+func (w *Writer) Close() error {
+	return w.f.Close()
+}
+
+// Summary reports on the results of a batch.
+// swagger:model BatchSummary
+type Summary struct {
+	Succeeded        int `json:"succeeded" example:"98"`
+	Failed           int `json:"failed" example:"2"`
+	PromptTokens     int `json:"prompt_tokens" example:"51234"`
+	CompletionTokens int `json:"completion_tokens" example:"20480"`
+	// Latency describes the time the lines took, in milliseconds.
+	Latency Latency `json:"latency_ms"`
+	// Errors counts the failed lines by error.
+	Errors map[string]int `json:"errors,omitempty"`
+}
+
+// Latency summarises durations in milliseconds.
+type Latency struct {
+	Min  int64 `json:"min"`
+	Mean int64 `json:"mean"`
+	P50  int64 `json:"p50"`
+	P95  int64 `json:"p95"`
+	Max  int64 `json:"max"`
+}
+
+// Summarize reports on results.
+func Summarize(results []Result) Summary {
+	var s Summary
+	latencies := make([]int64, 0, len(results))
+	var total int64
+	for _, r := range results {
+		if r.Failed() {
+			s.Failed++
+			if s.Errors == nil {
+				s.Errors = make(map[string]int)
+			}
+			s.Errors[r.Error]++
+		} else {
+			s.Succeeded++
+		}
+		s.PromptTokens += r.Usage.PromptTokens
+		s.CompletionTokens += r.Usage.CompletionTokens
+		latencies = append(latencies, r.LatencyMS)
+		total += r.LatencyMS
+	}
+	if len(latencies) == 0 {
+		return s
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	percentile := func(p float64) int64 {
+		return latencies[int(math.Ceil(p*float64(len(latencies))))-1]
+	}
+	s.Latency = Latency{
+		Min:  latencies[0],
+		Mean: total / int64(len(latencies)),
+		P50:  percentile(0.5),
+		P95:  percentile(0.95),
+		Max:  latencies[len(latencies)-1],
+	}
+	return s
+}
@@ -0,0 +1,271 @@
+package batch_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/agent"
+	"krackenservices.com/agentAI/internal/batch"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/problem"
+)
+
+// echo answers every request with its message, and rejects the model "forbidden".
+func echo(ctx context.Context, req batch.Request) (string, agent.Result, error) {
+	if req.Model == "forbidden" {
+		return "", agent.Result{}, problem.New(http.StatusForbidden, `not allowed to use model "forbidden"`)
+	}
+	return req.Model, agent.Result{Output: req.Message, Iterations: 1, Usage: llm.Usage{PromptTokens: 3, CompletionTokens: 2}}, nil
+}
+
+func TestProcess(t *testing.T) {
+	input := strings.Join([]string{
+		`{"id": "done", "model": "local", "message": "skipped"}`,
+		`{"id": "a", "model": "local", "message": "hello"}`,
+		``,
+		`{"model": "local", "message": "no id"}`,
+		`not json`,
+		`{"id": "b", "model": "local"}`,
+		`{"id": "c", "model": "forbidden", "message": "hi"}`,
+		`{"id": "d", "model": "local", "message": "last"}`,
+	}, "\n")
+
+	var running, most int32
+	exec := func(ctx context.Context, req batch.Request) (string, agent.Result, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&most)
+			if n <= m || atomic.CompareAndSwapInt32(&most, m, n) {
+				break
+			}
+		}
+		return echo(ctx, req)
+	}
+	p := &batch.Processor{Concurrency: 2, Exec: exec, Done: map[int]bool{1: true}}
+	results := map[int]batch.Result{}
+	err := p.Process(context.Background(), strings.NewReader(input), func(r batch.Result) error {
+		results[r.Line] = r
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if most > 2 {
+		t.Errorf("expected at most 2 requests at a time, got %d", most)
+	}
+	if len(results) != 6 {
+		t.Fatalf("expected a result for every line but the done and blank ones, got %+v", results)
+	}
+	if r := results[2]; r.ID != "a" || r.Output != "hello" || r.Usage.PromptTokens != 3 || r.Failed() {
+		t.Errorf("expected the reply to a, got %+v", r)
+	}
+	if r := results[4]; r.ID != "4" || r.Failed() {
+		t.Errorf("expected the line number as the default id, got %+v", r)
+	}
+	for line, status := range map[int]int{5: http.StatusBadRequest, 6: http.StatusBadRequest, 7: http.StatusForbidden} {
+		if r := results[line]; !r.Failed() || r.Status != status {
+			t.Errorf("expected line %d to fail with %d, got %+v", line, status, r)
+		}
+	}
+	if r := results[5]; !strings.HasPrefix(r.Error, "invalid request") {
+		t.Errorf("expected an invalid request, got %q", r.Error)
+	}
+}
+
+func TestProcessInterrupted(t *testing.T) {
+	input := `{"id": "a", "model": "local", "message": "1"}
+{"id": "b", "model": "local", "message": "2"}
+{"id": "c", "model": "local", "message": "3"}`
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exec := func(ctx context.Context, req batch.Request) (string, agent.Result, error) {
+		if req.ID == "a" {
+			return echo(ctx, req)
+		}
+		// Interrupted while running: the line gets no result, so that it runs again.
+		cancel()
+		<-ctx.Done()
+		return "", agent.Result{}, ctx.Err()
+	}
+	var results []batch.Result
+	p := &batch.Processor{Concurrency: 1, Exec: exec}
+	err := p.Process(ctx, strings.NewReader(input), func(r batch.Result) error {
+		results = append(results, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].ID != "a" {
+		t.Errorf("expected only the result of a, got %+v", results)
+	}
+}
+
+func TestResultsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	if results, err := batch.ReadResults(path); results != nil || err != nil {
+		t.Fatalf("expected no results for a missing file, got %+v, %v", results, err)
+	}
+	w, err := batch.Create(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(batch.Result{Line: 1, ID: "a", Output: "ok"})
+	w.Write(batch.Result{Line: 2, ID: "b", Error: "boom", Status: 500})
+	w.Close()
+	// A line cut short by an interruption is ignored.
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	f.WriteString(`{"line": 3, "id": "c", "outp`)
+	f.Close()
+
+	results, err := batch.ReadResults(path)
+	if err != nil || len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v, %v", results, err)
+	}
+	if done := batch.Done(results, false); !done[1] || !done[2] || done[3] {
+		t.Errorf("expected lines 1 and 2 done, got %v", done)
+	}
+	if done := batch.Done(results, true); !done[1] || done[2] {
+		t.Errorf("expected only line 1 done when retrying failures, got %v", done)
+	}
+
+	// The next result replaces the partial line instead of being appended to it.
+	w, err = batch.Create(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(batch.Result{Line: 3, ID: "c", Output: "ok"})
+	w.Close()
+	if results, _ := batch.ReadResults(path); len(results) != 3 || results[2].ID != "c" {
+		t.Fatalf("expected the resumed result of c, got %+v", results)
+	}
+
+	// Retrying failures removes them from the file.
+	w, err = batch.Create(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if results, _ := batch.ReadResults(path); len(results) != 2 || results[0].ID != "a" || results[1].ID != "c" {
+		t.Errorf("expected only the results of a and c, got %+v", results)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var results []batch.Result
+	for i := 1; i <= 20; i++ {
+		r := batch.Result{Line: i, LatencyMS: int64(i * 10), Usage: llm.Usage{PromptTokens: 10, CompletionTokens: 5}}
+		if i%10 == 0 {
+			r.Error = "boom"
+		}
+		results = append(results, r)
+	}
+	s := batch.Summarize(results)
+	if s.Succeeded != 18 || s.Failed != 2 || s.Errors["boom"] != 2 {
+		t.Errorf("expected 18 successes and 2 failures, got %+v", s)
+	}
+	if s.PromptTokens != 200 || s.CompletionTokens != 100 {
+		t.Errorf("expected the tokens of every line, got %+v", s)
+	}
+	if want := (batch.Latency{Min: 10, Mean: 105, P50: 100, P95: 190, Max: 200}); s.Latency != want {
+		t.Errorf("expected latency %+v, got %+v", want, s.Latency)
+	}
+	if s := batch.Summarize(nil); s.Succeeded != 0 || s.Latency != (batch.Latency{}) {
+		t.Errorf("expected an empty summary, got %+v", s)
+	}
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	store := batch.NewStore()
+	if err := store.Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	input := `{"id": "a", "model": "local", "message": "1"}
+
+{"id": "b", "model": "local", "message": "2"}
+{"id": "c", "model": "forbidden", "message": "3"}
+`
+	job, err := store.Create("api_key:ci", 1, strings.NewReader(input))
+	if err != nil || job.Total != 3 || job.Status != batch.StatusRunning || job.Principal != "api_key:ci" {
+		t.Fatalf("expected a running job of 3 requests, got %+v, %v", job, err)
+	}
+	other, _ := store.Create("api_key:ops", 1, strings.NewReader(input))
+
+	// The first run is interrupted after a line.
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var callers []string
+	exec := func(principal string) (batch.Executor, error) {
+		if principal != "api_key:ci" {
+			return nil, fmt.Errorf("principal %q no longer exists", principal)
+		}
+		return func(ctx context.Context, req batch.Request) (string, agent.Result, error) {
+			mu.Lock()
+			callers = append(callers, principal)
+			mu.Unlock()
+			if req.ID == "b" && ctx.Err() == nil && cancel != nil {
+				cancel()
+				return "", agent.Result{}, ctx.Err()
+			}
+			return echo(ctx, req)
+		}, nil
+	}
+	if err := store.Run(ctx, job.ID, exec); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := store.Get(job.ID); got.Status != batch.StatusRunning || got.Done != 1 {
+		t.Fatalf("expected the interrupted job to be running with 1 result, got %+v", got)
+	}
+
+	// After a restart it resumes with the lines that have no result.
+	reopened := batch.NewStore()
+	if err := reopened.Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	if running := reopened.Running(); len(running) != 2 {
+		t.Fatalf("expected both jobs to be running, got %v", running)
+	}
+	cancel = nil
+	callers = nil
+	if err := reopened.Run(context.Background(), job.ID, exec); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := reopened.Get(job.ID)
+	if got.Status != batch.StatusCompleted || got.Done != 3 || got.Summary.Succeeded != 2 || got.Summary.Failed != 1 {
+		t.Errorf("expected a completed job with 2 successes and a failure, got %+v", got)
+	}
+	if len(callers) != 2 || callers[0] != "api_key:ci" {
+		t.Errorf("expected the 2 remaining lines to run as ci, got %v", callers)
+	}
+	path, _ := reopened.Results(job.ID)
+	if results, _ := batch.ReadResults(path); len(results) != 3 {
+		t.Errorf("expected 3 results in the file, got %+v", results)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, job.ID, "job.json")); strings.Contains(string(data), "scopes") {
+		t.Errorf("expected only the identity of the principal to be saved, got %s", data)
+	}
+
+	// A job whose principal no longer exists fails.
+	if err := reopened.Run(context.Background(), other.ID, exec); err == nil {
+		t.Error("expected the job of a removed principal to fail")
+	}
+	if list := reopened.List("api_key:ops"); len(list) != 1 || list[0].ID != other.ID || list[0].Status != batch.StatusFailed || list[0].Error != `principal "api_key:ops" no longer exists` {
+		t.Errorf("expected the failed job of ops, got %+v", list)
+	}
+	if deleted, err := reopened.Delete(other.ID); !deleted || err != nil {
+		t.Errorf("expected the job to be deleted, got %v, %v", deleted, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, other.ID)); !os.IsNotExist(err) {
+		t.Errorf("expected the directory of the job to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,343 @@
+package batch
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default is the batch store of the server.
+var Default = NewStore()
+
+// Statuses of a job.
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	// StatusFailed is a job that stopped on an error of its own, such as a full disk, rather
+	// than of its lines.
+	StatusFailed = "failed"
+)
+
+// Files of a job in its directory.
+const (
+	jobFile     = "job.json"
+	inputFile   = "input.jsonl"
+	resultsFile = "results.jsonl"
+)
+
+// Job is a batch submitted to the batches API.
+// swagger:model Batch
+type Job struct {
+	ID string `json:"id" example:"4c1d9e2b7a6f3e5d8c0b1a2f3e4d5c6b"`
+	// Principal is the key of the principal that submitted the batch (see auth.Principal.Key).
+	// Only its identity is kept: the lines run with its permissions at the time they run.
+	Principal string `json:"principal" example:"api_key:ci"`
+	// Status is running, completed, or failed with Error.
+	Status string `json:"status" example:"running"`
+	Error  string `json:"error,omitempty"`
+	// Total is the number of requests; Done how many have a result so far.
+	Total       int       `json:"total" example:"100"`
+	Done        int       `json:"done" example:"42"`
+	Concurrency int       `json:"concurrency" example:"4"`
+	Created     time.Time `json:"created"`
+	Updated     time.Time `json:"updated"`
+	// Summary reports on the results so far.
+	Summary Summary `json:"summary"`
+}
+
+// entry is a job of the store.
+type entry struct {
+	Job
+	results []Result
+	cancel  context.CancelFunc
+}
+
+// job returns the job of e with its progress.
+func (e *entry) job() Job {
+	j := e.Job
+	j.Done = len(e.results)
+	j.Summary = Summarize(e.results)
+	return j
+}
+
+// Store holds jobs by ID, each in a directory of its own.
+type Store struct {
+	mu   sync.Mutex
+	jobs map[string]*entry
+	dir  string
+}
+
+// NewStore returns a store that keeps jobs in a temporary directory until Open is called.
+func NewStore() *Store {
+	return &Store{jobs: make(map[string]*entry)}
+}
+
+// Open loads the jobs saved in dir and keeps new ones in it. A missing directory is created.
+func (s *Store) Open(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*", jobFile))
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return &os.PathError{Op: "load batch", Path: file, Err: err}
+		}
+		results, err := ReadResults(filepath.Join(filepath.Dir(file), resultsFile))
+		if err != nil {
+			return err
+		}
+		s.jobs[job.ID] = &entry{Job: job, results: results}
+	}
+	s.dir = dir
+	return nil
+}
+
+// root returns the directory of the store, creating a temporary one on first use.
+// The caller holds s.mu.
+func (s *Store) root() (string, error) {
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "agentai-batches-")
+		if err != nil {
+			return "", err
+		}
+		s.dir = dir
+	}
+	return s.dir, nil
+}
+
+// save writes the job of e to its directory. The caller holds s.mu.
+func (s *Store) save(e *entry) error {
+	data, err := json.MarshalIndent(e.job(), "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, e.ID, jobFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Create saves the requests read from input as a running job of the principal with the key.
+// Lines that are not valid requests are kept, to be reported in the results. The input is
+// copied without holding the lock of the store, so that a slow upload does not hold up
+// other jobs; the job is only added to the store once its input is saved.
+func (s *Store) Create(principal string, concurrency int, input io.Reader) (Job, error) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	now := time.Now().UTC()
+	e := &entry{Job: Job{
+		ID:          hex.EncodeToString(id),
+		Principal:   principal,
+		Status:      StatusRunning,
+		Concurrency: concurrency,
+		Created:     now,
+		Updated:     now,
+	}}
+
+	s.mu.Lock()
+	root, err := s.root()
+	s.mu.Unlock()
+	if err != nil {
+		return Job{}, err
+	}
+	// Until it has a job file, the directory is not loaded by Open.
+	dir := filepath.Join(root, e.ID)
+	if err := os.Mkdir(dir, 0700); err != nil {
+		return Job{}, err
+	}
+	total, err := writeInput(filepath.Join(dir, inputFile), input)
+	if err != nil {
+		os.RemoveAll(dir)
+		return Job{}, err
+	}
+	e.Total = total
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.save(e); err != nil {
+		os.RemoveAll(dir)
+		return Job{}, err
+	}
+	s.jobs[e.ID] = e
+	return e.job(), nil
+}
+
+// writeInput copies input to path and counts its requests.
+func writeInput(path string, input io.Reader) (int, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	total, err := CountRequests(io.TeeReader(input, w))
+	if err != nil {
+		return 0, err
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return total, f.Close()
+}
+
+// Get returns the job with the ID.
+func (s *Store) Get(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return e.job(), true
+}
+
+// List returns the jobs of principal, or of everyone if principal is empty, most recently
+// created first.
+func (s *Store) List(principal string) []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []Job{}
+	for _, e := range s.jobs {
+		if principal == "" || e.Principal == principal {
+			list = append(list, e.job())
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Created.Equal(list[j].Created) {
+			return list[i].Created.After(list[j].Created)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Running returns the IDs of the jobs that have not finished, such as those interrupted by
+// a restart.
+func (s *Store) Running() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for id, e := range s.jobs {
+		if e.Status == StatusRunning && e.cancel == nil {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Results returns the path of the results file of the job, which is appended to while the
+// job runs.
+func (s *Store) Results(id string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.jobs[id]; !ok {
+		return "", false
+	}
+	return filepath.Join(s.dir, id, resultsFile), true
+}
+
+// Run processes the lines of the job that have no result yet, with the executor exec returns
+// for the principal that submitted it. An error of exec, such as a principal that no longer
+// exists, fails the job. Run returns once the job has completed or failed, or has been
+// stopped by ctx or Delete; a stopped job stays running, to be resumed by running it again.
+func (s *Store) Run(ctx context.Context, id string, exec func(principal string) (Executor, error)) error {
+	s.mu.Lock()
+	e, ok := s.jobs[id]
+	if !ok || e.Status != StatusRunning || e.cancel != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	e.cancel = cancel
+	dir := filepath.Join(s.dir, id)
+	p := &Processor{Concurrency: e.Concurrency, Done: Done(e.results, false)}
+	principal := e.Principal
+	s.mu.Unlock()
+
+	var err error
+	if p.Exec, err = exec(principal); err == nil {
+		err = s.process(ctx, dir, p, e)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.cancel = nil
+	if s.jobs[id] != e {
+		return nil // deleted
+	}
+	switch {
+	case err != nil:
+		e.Status = StatusFailed
+		e.Error = err.Error()
+	case ctx.Err() != nil:
+		return nil
+	default:
+		e.Status = StatusCompleted
+	}
+	e.Updated = time.Now().UTC()
+	if saveErr := s.save(e); err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+// process runs p on the input of the job in dir and appends the results to its results file.
+func (s *Store) process(ctx context.Context, dir string, p *Processor, e *entry) error {
+	in, err := os.Open(filepath.Join(dir, inputFile))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	w, err := Create(filepath.Join(dir, resultsFile), false)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return p.Process(ctx, in, func(r Result) error {
+		if err := w.Write(r); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		e.results = append(e.results, r)
+		e.Updated = time.Now().UTC()
+		return nil
+	})
+}
+
+// Delete stops the job if it is running and removes it, and reports whether it existed.
+func (s *Store) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.jobs[id]
+	if !ok {
+		return false, nil
+	}
+	if e.cancel != nil {
+		e.cancel()
+	}
+	delete(s.jobs, id)
+	return true, os.RemoveAll(filepath.Join(s.dir, id))
+}
@@ -1,54 +1,364 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 	"krackenservices.com/agentAI/internal/toolmodel"
 	"krackenservices.com/agentAI/internal/toolregistry"
 )
 
 // Config represents the entire configuration file.
 type Config struct {
-	Version string                 `yaml:"version"`
-	Server  ServerConfig           `yaml:"server,omitempty"`
-	Models  []ModelConfig          `yaml:"models"`
-	Tools   []toolmodel.ToolConfig `yaml:"tools,omitempty"`
+	Version string                 `yaml:"version" json:"version"`
+	Server  ServerConfig           `yaml:"server,omitempty" json:"server,omitempty"`
+	Models  []ModelConfig          `yaml:"models" json:"models"`
+	Tools   []toolmodel.ToolConfig `yaml:"tools,omitempty" json:"tools,omitempty"`
+	// MCPServers lists external MCP servers whose tools are discovered at startup.
+	MCPServers []toolmodel.MCPServerConfig `yaml:"mcp_servers,omitempty" json:"mcp_servers,omitempty"`
+	// Auth configures who may call the API. Without API keys or JWT the API is open.
+	Auth AuthConfig `yaml:"auth,omitempty" json:"auth,omitempty"`
+	// Usage configures where token usage is recorded and the budgets enforced on it.
+	Usage UsageConfig `yaml:"usage,omitempty" json:"usage,omitempty"`
+	// Sessions configures where the conversations of the sessions API are kept.
+	Sessions SessionsConfig `yaml:"sessions,omitempty" json:"sessions,omitempty"`
+	// Batches configures the batches API.
+	Batches BatchesConfig `yaml:"batches,omitempty" json:"batches,omitempty"`
+
+	// Include lists files merged beneath this one, relative to it. It is resolved while loading.
+	Include []string `yaml:"include,omitempty" json:"include,omitempty"`
+
+	// Path is the file the configuration was loaded from.
+	Path string `yaml:"-" json:"path,omitempty"`
+	// Files lists every file merged into the configuration (includes, conf.d fragments,
+	// the environment overlay), in the order they were applied.
+	Files []string `yaml:"-" json:"files,omitempty"`
+
+	// secrets holds the values resolved from secret references, for masking.
+	secrets []string
+	// doc is the merged document the configuration was decoded from.
+	doc *document
+	// registry holds the internal tools the configuration was validated against.
+	registry *toolregistry.Registry
+}
+
+// Registry returns the internal tools of the configuration: those it was loaded with, or
+// the installed registry for a configuration that was not loaded from a file.
+func (c *Config) Registry() *toolregistry.Registry {
+	if c.registry != nil {
+		return c.registry
+	}
+	return toolregistry.Installed()
 }
 
 // ServerConfig holds server-related configuration.
 type ServerConfig struct {
-	Port      string `yaml:"port,omitempty"`
-	Env       string `yaml:"env,omitempty"`
-	Interface string `yaml:"interface,omitempty"`
+	Port string `yaml:"port,omitempty" json:"port,omitempty"`
+	// Env selects the config.<env>.yml overlay; the AGENTAI_ENV environment variable takes precedence.
+	Env string `yaml:"env,omitempty" json:"env,omitempty"`
+	// Interface is the address the server binds to (default 0.0.0.0, every interface).
+	Interface string `yaml:"interface,omitempty" json:"interface,omitempty"`
+	// Socket is the path of a Unix domain socket to listen on instead of Interface and Port.
+	Socket string `yaml:"socket,omitempty" json:"socket,omitempty" example:"/run/agentai/agentai.sock"`
+	// TLS serves HTTPS, and requires client certificates when a client CA is set.
+	TLS *TLSConfig `yaml:"tls,omitempty" json:"tls,omitempty"`
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout bound the phases of a
+	// connection (defaults 10s, 1m, 10m and 2m). WriteTimeout also bounds a whole chat.
+	ReadHeaderTimeout string `yaml:"read_header_timeout,omitempty" json:"read_header_timeout,omitempty"`
+	ReadTimeout       string `yaml:"read_timeout,omitempty" json:"read_timeout,omitempty"`
+	WriteTimeout      string `yaml:"write_timeout,omitempty" json:"write_timeout,omitempty"`
+	IdleTimeout       string `yaml:"idle_timeout,omitempty" json:"idle_timeout,omitempty"`
+	// ShutdownTimeout is how long a stopping server waits for requests in progress before
+	// killing the tool processes they run (default 30s).
+	ShutdownTimeout string `yaml:"shutdown_timeout,omitempty" json:"shutdown_timeout,omitempty"`
+	// WatchConfig reloads the configuration when the config file changes.
+	WatchConfig bool `yaml:"watch_config,omitempty" json:"watch_config,omitempty"`
+	// WatchInterval is how often the config file is checked for changes (default 5s).
+	WatchInterval string `yaml:"watch_interval,omitempty" json:"watch_interval,omitempty"`
+	// StateFile stores the models and tools changed through the admin API (default state.yml next to the config file).
+	StateFile string `yaml:"state_file,omitempty" json:"state_file,omitempty"`
+	// AdminToken is the bearer token required by the admin API; the admin API is disabled when it is empty.
+	AdminToken string `yaml:"admin_token,omitempty" json:"admin_token,omitempty"`
+	// RateLimit limits how much of the server each client and model may use.
+	RateLimit RateLimitConfig `yaml:"rate_limit,omitempty" json:"rate_limit,omitempty"`
+	// Tracing exports OpenTelemetry traces of requests, model calls and tool executions.
+	Tracing TracingConfig `yaml:"tracing,omitempty" json:"tracing,omitempty"`
+	// Log configures the server log.
+	Log LogConfig `yaml:"log,omitempty" json:"log,omitempty"`
+	// Health configures the readiness probe.
+	Health HealthConfig `yaml:"health,omitempty" json:"health,omitempty"`
+}
+
+// HealthConfig configures /readyz and the dependency checks of /api/v1/status.
+type HealthConfig struct {
+	// CheckModels makes readiness also require every enabled model endpoint to respond.
+	CheckModels bool `yaml:"check_models,omitempty" json:"check_models,omitempty"`
+	// Timeout bounds each model endpoint check (default 2s).
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+}
+
+// TLSConfig names the PEM files of the server certificate. The files are reloaded when they
+// change, so renewed certificates are picked up without a restart.
+type TLSConfig struct {
+	// CertFile and KeyFile are relative to the config file.
+	CertFile string `yaml:"cert_file" json:"cert_file" example:"tls/server.crt"`
+	KeyFile  string `yaml:"key_file" json:"key_file" example:"tls/server.key"`
+	// ClientCAFile enables mutual TLS: clients must present a certificate signed by one of its CAs.
+	ClientCAFile string `yaml:"client_ca_file,omitempty" json:"client_ca_file,omitempty" example:"tls/clients-ca.crt"`
+}
+
+// Log levels and formats.
+const (
+	LogLevelDebug = "debug"
+	LogLevelInfo  = "info"
+	LogLevelWarn  = "warn"
+	LogLevelError = "error"
+
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// LogConfig configures the level and format of the server log and what is masked in it.
+type LogConfig struct {
+	// Level is the minimum level logged: debug, info (default), warn or error. Prompts and
+	// model responses are only logged at debug.
+	Level string `yaml:"level,omitempty" json:"level,omitempty" example:"info"`
+	// Format is text (default) or json, one object per line.
+	Format string `yaml:"format,omitempty" json:"format,omitempty" example:"json"`
+	// Redact lists regular expressions of values, such as customer data, masked in every log
+	// line. Secrets of the configuration and common API key formats are always masked.
+	Redact []string `yaml:"redact,omitempty" json:"redact,omitempty"`
+}
+
+// Trace exporters.
+const (
+	TraceExporterOTLP = "otlp"
+	TraceExporterFile = "file"
+)
+
+// TracingConfig configures trace export in the OTLP/JSON encoding. Tracing is off when
+// Exporter is empty.
+type TracingConfig struct {
+	// Exporter is otlp (OTLP over HTTP to Endpoint) or file (one export request per line, as
+	// written by the collector's file exporter).
+	Exporter string `yaml:"exporter,omitempty" json:"exporter,omitempty" example:"otlp"`
+	// Endpoint is the traces URL of the collector (default http://localhost:4318/v1/traces).
+	Endpoint string `yaml:"endpoint,omitempty" json:"endpoint,omitempty" example:"http://otel-collector:4318/v1/traces"`
+	// Headers are sent with every export, e.g. to authenticate with the collector.
+	Headers map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// File is written by the file exporter, relative to the config file.
+	File string `yaml:"file,omitempty" json:"file,omitempty" example:"traces.jsonl"`
+	// ServiceName is the service.name resource attribute (default agentAI).
+	ServiceName string `yaml:"service_name,omitempty" json:"service_name,omitempty"`
+	// SampleRatio is the fraction of new traces that are recorded (default 1). Traces started
+	// by a caller follow the caller's sampling decision.
+	SampleRatio *float64 `yaml:"sample_ratio,omitempty" json:"sample_ratio,omitempty"`
+}
+
+// RateLimitConfig limits clients, identified by API key or JWT subject and otherwise by IP
+// address, and the concurrency of individual models. Zero values mean no limit.
+type RateLimitConfig struct {
+	// RequestsPerMinute is the sustained request rate allowed per client.
+	RequestsPerMinute float64 `yaml:"requests_per_minute,omitempty" json:"requests_per_minute,omitempty"`
+	// Burst is how many requests a client may make at once (default: requests_per_minute, at least 1).
+	Burst int `yaml:"burst,omitempty" json:"burst,omitempty"`
+	// MaxConcurrentRuns limits the chats and tool executions a client may have in progress.
+	MaxConcurrentRuns int `yaml:"max_concurrent_runs,omitempty" json:"max_concurrent_runs,omitempty"`
+	// Models limits the concurrent calls to a model across all clients.
+	Models []ModelLimitConfig `yaml:"models,omitempty" json:"models,omitempty"`
+}
+
+// ModelLimitConfig limits the concurrent calls to one model. Calls beyond MaxConcurrent wait
+// in a queue of at most MaxQueue calls for up to QueueTimeout.
+type ModelLimitConfig struct {
+	ID            string `yaml:"id" json:"id"`
+	MaxConcurrent int    `yaml:"max_concurrent" json:"max_concurrent"`
+	MaxQueue      int    `yaml:"max_queue,omitempty" json:"max_queue,omitempty"`
+	// QueueTimeout is how long a call may wait for a free slot (default 30s).
+	QueueTimeout string `yaml:"queue_timeout,omitempty" json:"queue_timeout,omitempty"`
+}
+
+// ModelLimit returns the concurrency limit of the model, or nil if it has none.
+func (r *RateLimitConfig) ModelLimit(id string) *ModelLimitConfig {
+	for i := range r.Models {
+		if r.Models[i].ID == id {
+			return &r.Models[i]
+		}
+	}
+	return nil
+}
+
+// Scopes granted to API callers.
+const (
+	ScopeChat         = "chat"
+	ScopeToolsExecute = "tools:execute"
+	ScopeAdmin        = "admin"
+)
+
+// AuthConfig holds the credentials accepted by the API.
+type AuthConfig struct {
+	APIKeys []APIKeyConfig `yaml:"api_keys,omitempty" json:"api_keys,omitempty"`
+	JWT     *JWTConfig     `yaml:"jwt,omitempty" json:"jwt,omitempty"`
+}
+
+// Enabled reports whether any credentials are configured.
+func (a AuthConfig) Enabled() bool {
+	return len(a.APIKeys) > 0 || a.JWT != nil
+}
+
+// APIKeyConfig is a static API key. Keys are sent as "Authorization: Bearer <key>" or "X-API-Key: <key>".
+type APIKeyConfig struct {
+	// ID names the key in logs and usage reports; the key itself is never shown.
+	ID  string `yaml:"id" json:"id" example:"ci"`
+	Key string `yaml:"key" json:"key" example:"file:/run/secrets/ci_api_key"`
+	// Scopes granted to the key: chat, tools:execute, admin.
+	Scopes []string `yaml:"scopes" json:"scopes" example:"[chat]"`
+	// Models and Tools restrict the key to the listed IDs (glob patterns such as "github.*"); empty allows all.
+	Models []string `yaml:"models,omitempty" json:"models,omitempty"`
+	Tools  []string `yaml:"tools,omitempty" json:"tools,omitempty"`
+}
+
+// JWTConfig validates bearer JWTs (RS256 or ES256) against a local JWKS file, e.g. one
+// exported from the OIDC provider.
+type JWTConfig struct {
+	JWKSFile string `yaml:"jwks_file" json:"jwks_file" example:"/etc/agentAI/jwks.json"`
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string `yaml:"issuer,omitempty" json:"issuer,omitempty" example:"https://login.example.com/"`
+	Audience string `yaml:"audience,omitempty" json:"audience,omitempty" example:"agentAI"`
+	// ScopeClaim names the claim holding the granted scopes, as a space-separated string or a list (default "scope").
+	ScopeClaim string `yaml:"scope_claim,omitempty" json:"scope_claim,omitempty" example:"scope"`
 }
 
 // ModelConfig defines the configuration for a model.
 // swagger:model ModelConfig
 type ModelConfig struct {
-	ID                        string                 `yaml:"id" example:"local"`
-	Name                      string                 `yaml:"name" example:"mymodel"`
-	Endpoint                  string                 `yaml:"endpoint" example:"http://127.0.0.1:8080/"`
-	Enabled                   bool                   `yaml:"enabled,omitempty" example:"true"`
-	APIKey                    string                 `yaml:"api_key,omitempty" example:""`
-	APIVendor                 string                 `yaml:"api_vendor" example:"ollama"`
-	Headers                   map[string]string      `yaml:"headers,omitempty" example:"{'Content-Type':'application/json'}"`
-	AdditionalSystemPrompt    string                 `yaml:"additional_system_prompt,omitempty" example:""`
-	AdditionalUserPrompt      string                 `yaml:"additional_user_prompt,omitempty" example:""`
-	AdditionalAssistantPrompt string                 `yaml:"additional_assistant_prompt,omitempty" example:""`
-	Parameters                map[string]interface{} `yaml:"parameters,omitempty"`
-	ToolsSupported            bool                   `yaml:"tools_supported,omitempty" example:"true"`
-	ToolTagStart              string                 `yaml:"tool_tag_start,omitempty" example:"<tool>"`
-	ToolTagEnd                string                 `yaml:"tool_tag_end,omitempty" example:"</tool>"`
-	Tools                     []string               `yaml:"tools,omitempty" example:"[fstool]"`
-}
-
-// LoadConfig loads the configuration from the given YAML file path,
-// applies sensible defaults, and validates required fields.
+	ID                        string                 `yaml:"id" json:"id" example:"local"`
+	Name                      string                 `yaml:"name,omitempty" json:"name,omitempty" example:"mymodel"`
+	Endpoint                  string                 `yaml:"endpoint" json:"endpoint" example:"http://127.0.0.1:8080/"`
+	Enabled                   bool                   `yaml:"enabled,omitempty" json:"enabled,omitempty" example:"true"`
+	APIKey                    string                 `yaml:"api_key,omitempty" json:"api_key,omitempty" example:""`
+	APIVendor                 string                 `yaml:"api_vendor,omitempty" json:"api_vendor,omitempty" example:"ollama"`
+	Headers                   map[string]string      `yaml:"headers,omitempty" json:"headers,omitempty" example:"{'Content-Type':'application/json'}"`
+	AdditionalSystemPrompt    string                 `yaml:"additional_system_prompt,omitempty" json:"additional_system_prompt,omitempty" example:""`
+	AdditionalUserPrompt      string                 `yaml:"additional_user_prompt,omitempty" json:"additional_user_prompt,omitempty" example:""`
+	AdditionalAssistantPrompt string                 `yaml:"additional_assistant_prompt,omitempty" json:"additional_assistant_prompt,omitempty" example:""`
+	Parameters                map[string]interface{} `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+	ToolsSupported            bool                   `yaml:"tools_supported,omitempty" json:"tools_supported,omitempty" example:"true"`
+	ToolTagStart              string                 `yaml:"tool_tag_start,omitempty" json:"tool_tag_start,omitempty" example:"<tool>"`
+	ToolTagEnd                string                 `yaml:"tool_tag_end,omitempty" json:"tool_tag_end,omitempty" example:"</tool>"`
+	Tools                     []string               `yaml:"tools,omitempty" json:"tools,omitempty" example:"[fstool]"`
+	// Pricing is used to compute the cost of the tokens used with the model.
+	Pricing *ModelPricing `yaml:"pricing,omitempty" json:"pricing,omitempty"`
+}
+
+// ToolCallPattern returns the regular expression that finds a tool call in a reply of the
+// model: the text between its tool tags. It is nil for models without both tags, which never
+// call tools.
+func (m *ModelConfig) ToolCallPattern() (*regexp.Regexp, error) {
+	if m.ToolTagStart == "" || m.ToolTagEnd == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(m.ToolTagStart + `(.*?)` + m.ToolTagEnd)
+	if err != nil {
+		return nil, fmt.Errorf("tool tags do not form a valid regular expression: %w", err)
+	}
+	return re, nil
+}
+
+// ModelPricing is the price of a model per million tokens, in any currency as long as it is
+// the one budgets are written in.
+type ModelPricing struct {
+	InputPerMillion  float64 `yaml:"input_per_million" json:"input_per_million" example:"0.15"`
+	OutputPerMillion float64 `yaml:"output_per_million" json:"output_per_million" example:"0.6"`
+}
+
+// Budget actions.
+const (
+	BudgetReject    = "reject"
+	BudgetDowngrade = "downgrade"
+)
+
+// UsageConfig configures usage accounting.
+type UsageConfig struct {
+	// File records the usage of every chat, so that reports and budgets survive restarts.
+	// Relative to the config file; usage is only kept in memory when empty.
+	File    string         `yaml:"file,omitempty" json:"file,omitempty" example:"usage.jsonl"`
+	Budgets []BudgetConfig `yaml:"budgets,omitempty" json:"budgets,omitempty"`
+}
+
+// SessionsConfig configures the sessions API.
+type SessionsConfig struct {
+	// Dir keeps each session as a JSON file, so that sessions survive restarts. Relative to
+	// the config file; sessions are only kept in memory when empty.
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty" example:"sessions"`
+}
+
+// BatchesConfig configures the batches API.
+type BatchesConfig struct {
+	// Dir keeps the input, results and state of each batch, so that batches resume after a
+	// restart. Relative to the config file; a temporary directory is used when empty.
+	Dir string `yaml:"dir,omitempty" json:"dir,omitempty" example:"batches"`
+	// Concurrency is how many lines of a batch run at a time unless the request asks for
+	// fewer (default 4).
+	Concurrency int `yaml:"concurrency,omitempty" json:"concurrency,omitempty" example:"4"`
+	// MaxInputBytes bounds the body of a submitted batch; larger ones are rejected with a 413
+	// (default 64 MiB).
+	MaxInputBytes int64 `yaml:"max_input_bytes,omitempty" json:"max_input_bytes,omitempty" example:"67108864"`
+}
+
+// BudgetConfig caps the cost or tokens of the usage it matches per UTC day or calendar month.
+type BudgetConfig struct {
+	ID string `yaml:"id" json:"id" example:"team-daily"`
+	// Principal limits the budget to a caller, as method:id (e.g. api_key:ci or jwt:alice) or
+	// as an ID, which applies it to each caller with that ID separately; "*" applies it to
+	// each caller separately and empty to all callers together.
+	Principal string `yaml:"principal,omitempty" json:"principal,omitempty" example:"*"`
+	// Model limits the budget to one model; empty applies it to all models.
+	Model         string  `yaml:"model,omitempty" json:"model,omitempty"`
+	DailyCost     float64 `yaml:"daily_cost,omitempty" json:"daily_cost,omitempty" example:"5"`
+	MonthlyCost   float64 `yaml:"monthly_cost,omitempty" json:"monthly_cost,omitempty"`
+	DailyTokens   int     `yaml:"daily_tokens,omitempty" json:"daily_tokens,omitempty"`
+	MonthlyTokens int     `yaml:"monthly_tokens,omitempty" json:"monthly_tokens,omitempty"`
+	// Action is what happens to requests once the budget is spent: reject (default) or
+	// downgrade to the DowngradeTo model.
+	Action      string `yaml:"action,omitempty" json:"action,omitempty" example:"reject"`
+	DowngradeTo string `yaml:"downgrade_to,omitempty" json:"downgrade_to,omitempty"`
+}
+
+// configExtensions are the file formats LoadConfig looks for, in order of preference.
+var configExtensions = []string{".yaml", ".yml", ".json"}
+
+// LoadConfig loads the configuration from the given YAML (or JSON) file path together
+// with its includes, conf.d/ fragments and environment overlay (see loadDocument),
+// applies sensible defaults, and validates it. If the configuration is invalid
+// the returned error is a ValidationErrors listing every problem found.
 func LoadConfig(path string) (*Config, error) {
-	// If no path is provided, look for config.yaml or config.yml in the executable's directory.
+	return load(path, nil, toolregistry.Installed())
+}
+
+// LoadConfigWithState loads the configuration like LoadConfig, but applies the given admin
+// API state instead of the state file. It is used to validate changes before saving them.
+func LoadConfigWithState(path string, state *State) (*Config, error) {
+	return load(path, state, toolregistry.Installed())
+}
+
+// LoadConfigWithTools loads the configuration like LoadConfig, with the internal tools of
+// registry instead of the installed ones. It is used to validate a reload before its tools
+// are installed.
+func LoadConfigWithTools(path string, registry *toolregistry.Registry) (*Config, error) {
+	return load(path, nil, registry)
+}
+
+// load loads the configuration at path with the admin API state, or the state file if
+// state is nil, and the internal tools of registry.
+func load(path string, state *State, registry *toolregistry.Registry) (*Config, error) {
+	// If no path is provided, look for config.yaml, config.yml or config.json in the executable's directory.
 	if path == "" {
 		binaryPath, err := os.Executable()
 		if err != nil {
@@ -56,9 +366,8 @@ func LoadConfig(path string) (*Config, error) {
 		}
 		baseDir := filepath.Dir(binaryPath)
 		path = filepath.Join(baseDir, "config")
-		validExtensions := []string{".yaml", ".yml"}
 		found := false
-		for _, ext := range validExtensions {
+		for _, ext := range configExtensions {
 			if _, err := os.Stat(path + ext); err == nil {
 				path = path + ext
 				found = true
@@ -66,7 +375,7 @@ func LoadConfig(path string) (*Config, error) {
 			}
 		}
 		if !found {
-			return nil, fmt.Errorf("no config file found in %s with extensions: %v", baseDir, validExtensions)
+			return nil, fmt.Errorf("no config file found in %s with extensions: %v", baseDir, configExtensions)
 		}
 	}
 
@@ -74,47 +383,54 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("config file does not exist: %s", path)
 	}
 
-	data, err := os.ReadFile(path)
+	doc, env, err := loadDocument(path, state)
 	if err != nil {
-		return nil, fmt.Errorf("error reading config file: %w", err)
+		return nil, err
 	}
-
 	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("error unmarshalling config file: %w", err)
+	var errs ValidationErrors
+	if err := doc.root.Decode(&cfg); err != nil {
+		// Values of the wrong type are reported with the other problems; anything else is fatal.
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("error unmarshalling config file: %w", err)
+		}
+		for _, msg := range typeErr.Errors {
+			errs = append(errs, decodeError(msg))
+		}
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	cfg.Path = path
+	cfg.Files = doc.files
+	cfg.Server.Env = env
+	cfg.doc = doc
+	cfg.registry = registry
+
+	// Collect every problem before failing, so a single run reports the whole list.
+	for _, e := range resolveSecrets(&cfg) {
+		errs = append(errs, doc.locate(e))
 	}
 
 	// Set defaults for Server fields.
 	if cfg.Server.Port == "" {
 		cfg.Server.Port = "8080"
 	}
-	if cfg.Server.Env == "" {
-		cfg.Server.Env = "development"
-	}
 	if cfg.Server.Interface == "" {
 		cfg.Server.Interface = "0.0.0.0"
 	}
 	if cfg.Version == "" {
 		cfg.Version = "1.0"
 	}
-
-	// Validate that at least one model is provided.
-	if len(cfg.Models) == 0 {
-		return nil, fmt.Errorf("config must define at least one model")
+	if cfg.Server.WatchInterval == "" {
+		cfg.Server.WatchInterval = "5s"
 	}
 
-	// Validate tool configurations.
-	// For tools that are internal, allow a minimal config (e.g. only 'id' and 'enabled').
-	// For external tools, require complete configuration.
-	for _, tool := range cfg.Tools {
-		if _, isInternal := toolregistry.InternalTools[tool.ID]; isInternal {
-			// Internal tool override: allow minimal configuration.
-			continue
-		}
-		// External tool: require all fields.
-		if tool.ID == "" || tool.Name == "" || tool.Description == "" || tool.CommandKey == "" {
-			return nil, fmt.Errorf("incomplete tool configuration for tool with id '%s'", tool.ID)
-		}
+	errs = append(errs, Validate(&cfg)...)
+	if len(errs) > 0 {
+		sortErrors(errs)
+		return nil, errs
 	}
 
 	// Default the Enabled flag to true for all tools if not provided.
@@ -127,3 +443,47 @@ func LoadConfig(path string) (*Config, error) {
 
 	return &cfg, nil
 }
+
+// lineMessage splits the "line N: " prefix from yaml decoding errors.
+var lineMessage = regexp.MustCompile(`^line (\d+): (.*)$`)
+
+// decodeError converts a yaml decoding error message into a ValidationError.
+func decodeError(msg string) ValidationError {
+	if m := lineMessage.FindStringSubmatch(msg); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return ValidationError{Line: line, Message: m[2]}
+	}
+	return ValidationError{Message: msg}
+}
+
+// isMCPTool reports whether id names a tool of a declared MCP server ("<server id>.<tool>").
+func (c *Config) isMCPTool(id string) bool {
+	for _, srv := range c.MCPServers {
+		if strings.HasPrefix(id, srv.ID+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeTools adds tools discovered at runtime (e.g. from MCP servers) to the configuration.
+// A configured entry with the same ID acts as an override: only its Enabled flag is kept.
+func (c *Config) MergeTools(discovered []toolmodel.ToolConfig) {
+	for _, tool := range discovered {
+		replaced := false
+		for i, cfgTool := range c.Tools {
+			if cfgTool.ID != tool.ID {
+				continue
+			}
+			if cfgTool.Enabled != nil {
+				tool.Enabled = cfgTool.Enabled
+			}
+			c.Tools[i] = tool
+			replaced = true
+			break
+		}
+		if !replaced {
+			c.Tools = append(c.Tools, tool)
+		}
+	}
+}
@@ -1,13 +1,30 @@
 package config_test
 
 import (
+	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/toolmodel"
+	"krackenservices.com/agentAI/internal/toolregistry"
 )
 
+// TestMain registers fstool as the server would after discovering its binary.
+func TestMain(m *testing.M) {
+	toolregistry.Register(toolmodel.ToolConfig{
+		ID:          "fstool",
+		Name:        "fstool",
+		Description: "Internal tool to list files on the local filesystem",
+		CommandKey:  "fstool",
+		CommandArgs: map[string]interface{}{"path": "."},
+	})
+	os.Exit(m.Run())
+}
+
 // writeTempConfig creates a temporary config file with the given content.
 func writeTempConfig(t *testing.T, dir, filename, content string) string {
 	t.Helper()
@@ -21,7 +38,7 @@ func writeTempConfig(t *testing.T, dir, filename, content string) string {
 // TestLoadConfig_ValidConfig_InternalToolMinimal verifies that minimal configuration for an internal tool is allowed.
 func TestLoadConfig_ValidConfig_InternalToolMinimal(t *testing.T) {
 	tmpDir := t.TempDir()
-	// Minimal config for internal tool "fstool" (which is defined in toolregistry.InternalTools)
+	// Minimal config for internal tool "fstool" (registered in TestMain)
 	yamlContent := `
 version: "1.0"
 server:
@@ -102,6 +119,8 @@ models:
     endpoint: http://127.0.0.1:8080/
     api_vendor: ollama
     tools_supported: true
+    tool_tag_start: "<tool>"
+    tool_tag_end: "</tool>"
 tools:
   - id: externaltool
     enabled: true
@@ -113,6 +132,38 @@ tools:
 	}
 }
 
+// TestLoadConfig_UndiscoveredTool verifies that an override of a tool whose binary is missing
+// reports the missing tool rather than an incomplete external tool.
+func TestLoadConfig_UndiscoveredTool(t *testing.T) {
+	tmpDir := t.TempDir()
+	yamlContent := `
+version: "1.0"
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+tools:
+  - id: fstool
+    enabled: true
+    command_args:
+      path: /tmp
+`
+	configPath := writeTempConfig(t, tmpDir, "config.yaml", yamlContent)
+	toolsDir := filepath.Join(tmpDir, "tools")
+	registry, err := toolregistry.Scan(toolsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = config.LoadConfigWithTools(configPath, registry)
+	var errs config.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	if len(errs) != 1 || errs[0].Path != "tools[0].id" || errs[0].Message != "tool 'fstool' was not discovered in "+toolsDir {
+		t.Errorf("expected a single problem for the missing tool, got %v", errs)
+	}
+}
+
 // TestLoadConfig_FileDoesNotExist verifies that a non-existent file returns an error.
 func TestLoadConfig_FileDoesNotExist(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -135,6 +186,8 @@ models:
     endpoint: http://127.0.0.1:8080/
     api_vendor: ollama
     tools_supported: true
+    tool_tag_start: "<tool>"
+    tool_tag_end: "</tool>"
 tools:
   - id: fstool
 `
@@ -161,6 +214,8 @@ models:
     endpoint: http://127.0.0.1:8080/
     api_vendor: ollama
     tools_supported: true
+    tool_tag_start: "<tool>"
+    tool_tag_end: "</tool>"
 tools:
   - id: fstool
     enabled: false
@@ -178,3 +233,560 @@ tools:
 		}
 	}
 }
+
+// TestLoadConfig_HTTPTool verifies that webhook tools require a URL instead of a command key.
+func TestLoadConfig_HTTPTool(t *testing.T) {
+	tmpDir := t.TempDir()
+	yamlContent := `
+version: "1.0"
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+    api_vendor: ollama
+tools:
+  - id: tickets
+    name: Tickets
+    description: Look up a ticket
+    type: http
+    command_args: { "id": "" }
+    http:
+      method: GET
+      url: http://tickets.internal/api/issues/{{.id}}
+      response: data.summary
+`
+	configPath := writeTempConfig(t, tmpDir, "config.yaml", yamlContent)
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("expected valid config, got error: %v", err)
+	}
+	if !cfg.Tools[0].IsHTTP() || cfg.Tools[0].HTTP.Response != "data.summary" {
+		t.Errorf("expected http tool settings to be loaded, got %+v", cfg.Tools[0])
+	}
+
+	missingURL := `
+version: "1.0"
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+tools:
+  - id: tickets
+    name: Tickets
+    description: Look up a ticket
+    type: http
+`
+	configPath = writeTempConfig(t, tmpDir, "missing.yaml", missingURL)
+	if _, err := config.LoadConfig(configPath); err == nil {
+		t.Fatal("expected error due to http tool without url, got nil")
+	}
+
+	relativeURL := missingURL + `    http:
+      url: tickets.internal/api/issues/{{.id}}
+`
+	configPath = writeTempConfig(t, tmpDir, "relative.yaml", relativeURL)
+	if _, err := config.LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "absolute http(s) URL") {
+		t.Fatalf("expected error due to http tool with a relative url, got %v", err)
+	}
+}
+
+// TestLoadConfig_MCPServers verifies MCP server declarations and overrides of their discovered tools.
+func TestLoadConfig_MCPServers(t *testing.T) {
+	tmpDir := t.TempDir()
+	yamlContent := `
+version: "1.0"
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+    tools:
+      - github.create_issue
+mcp_servers:
+  - id: github
+    transport: stdio
+    command: github-mcp-server
+tools:
+  - id: github.delete_repo
+    enabled: false
+`
+	configPath := writeTempConfig(t, tmpDir, "config.yaml", yamlContent)
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("expected valid config, got error: %v", err)
+	}
+
+	enabled := true
+	cfg.MergeTools([]toolmodel.ToolConfig{
+		{ID: "github.create_issue", Type: toolmodel.TypeMCP, Enabled: &enabled},
+		{ID: "github.delete_repo", Type: toolmodel.TypeMCP, Enabled: &enabled},
+	})
+	if len(cfg.Tools) != 2 {
+		t.Fatalf("expected 2 tools after merge, got %d", len(cfg.Tools))
+	}
+	for _, tool := range cfg.Tools {
+		if !tool.IsMCP() {
+			t.Errorf("expected %s to be an mcp tool", tool.ID)
+		}
+		if tool.ID == "github.delete_repo" && *tool.Enabled {
+			t.Errorf("expected config override to keep github.delete_repo disabled")
+		}
+	}
+
+	badTransport := `
+version: "1.0"
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+mcp_servers:
+  - id: github
+    transport: carrier-pigeon
+`
+	configPath = writeTempConfig(t, tmpDir, "bad.yaml", badTransport)
+	if _, err := config.LoadConfig(configPath); err == nil {
+		t.Fatal("expected error due to unknown mcp transport, got nil")
+	}
+}
+
+// TestLoadConfig_Secrets verifies environment expansion, file references and custom secret providers.
+func TestLoadConfig_Secrets(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("AGENTAI_TEST_HOST", "llm.internal")
+	t.Setenv("AGENTAI_TEST_KEY", "sk-from-env")
+	secretFile := filepath.Join(tmpDir, "token")
+	if err := os.WriteFile(secretFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config.RegisterSecretProvider("test", config.SecretProviderFunc(func(ref string) (string, error) {
+		return "provided-" + ref, nil
+	}))
+
+	yamlContent := `
+version: "1.0"
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://${AGENTAI_TEST_HOST}:${AGENTAI_TEST_PORT:-11434}/
+    api_key: ${AGENTAI_TEST_KEY}
+    headers:
+      X-Org: test:org
+tools:
+  - id: tickets
+    name: Tickets
+    description: Look up a ticket
+    type: http
+    http:
+      url: http://tickets.internal/
+      auth:
+        type: bearer
+        token: file:` + secretFile + `
+`
+	configPath := writeTempConfig(t, tmpDir, "config.yaml", yamlContent)
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("expected valid config, got error: %v", err)
+	}
+	model := cfg.Models[0]
+	if model.Endpoint != "http://llm.internal:11434/" {
+		t.Errorf("expected expanded endpoint with default port, got %q", model.Endpoint)
+	}
+	if model.APIKey != "sk-from-env" {
+		t.Errorf("expected api key from environment, got %q", model.APIKey)
+	}
+	if model.Headers["X-Org"] != "provided-org" {
+		t.Errorf("expected header from custom provider, got %q", model.Headers["X-Org"])
+	}
+	if token := cfg.Tools[0].HTTP.Auth.Token; token != "file-token" {
+		t.Errorf("expected token read from file, got %q", token)
+	}
+	for _, secret := range []string{"sk-from-env", "provided-org", "file-token"} {
+		if !cfg.IsSecret(secret) {
+			t.Errorf("expected %q to be recorded as a secret", secret)
+		}
+	}
+	if masked := cfg.MaskHeaders(model.Headers); masked["X-Org"] != config.Masked {
+		t.Errorf("expected secret header value to be masked, got %q", masked["X-Org"])
+	}
+
+	missing := `
+version: "1.0"
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+    api_key: ${AGENTAI_TEST_UNSET_VARIABLE}
+`
+	configPath = writeTempConfig(t, tmpDir, "missing.yaml", missing)
+	_, err = config.LoadConfig(configPath)
+	if err == nil || !strings.Contains(err.Error(), "models[0].api_key") {
+		t.Fatalf("expected error naming the unresolved field, got %v", err)
+	}
+}
+
+// TestLoadConfig_InvalidToolTags verifies that tool tags are checked even for a model that is not
+// declared to support tools, as its replies are still searched for tool calls.
+func TestLoadConfig_InvalidToolTags(t *testing.T) {
+	tmpDir := t.TempDir()
+	yamlContent := `version: "1.0"
+models:
+  - id: local
+    endpoint: http://127.0.0.1:8080/
+    tool_tag_start: "[tool"
+    tool_tag_end: "[/tool"
+`
+	configPath := writeTempConfig(t, tmpDir, "config.yaml", yamlContent)
+	_, err := config.LoadConfig(configPath)
+	var errs config.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	if len(errs) != 1 || errs[0].Path != "models[0].tool_tag_start" || !strings.Contains(errs[0].Message, "regular expression") {
+		t.Errorf("expected a problem with the tool tags, got %v", errs)
+	}
+}
+
+// TestLoadConfig_ReportsAllProblems verifies that every problem is reported with its path and line.
+func TestLoadConfig_ReportsAllProblems(t *testing.T) {
+	tmpDir := t.TempDir()
+	yamlContent := `version: "1.0"
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+    api_vendor: acme
+  - id: local
+    name: other
+    endpoint: 127.0.0.1:8080
+    tools_supported: true
+    tool_tag_start: "<tool>"
+    tools:
+      - nosuchtool
+tools:
+  - id: tickets
+    name: Tickets
+    description: Look up a ticket
+    type: http
+    http:
+      url: http://tickets.internal/
+      timeout: soon
+`
+	configPath := writeTempConfig(t, tmpDir, "config.yaml", yamlContent)
+	_, err := config.LoadConfig(configPath)
+	var errs config.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+
+	want := []config.ValidationError{
+		{Path: "models[0].api_vendor", Line: 6},
+		{Path: "models[1].id", Line: 7},
+		{Path: "models[1].endpoint", Line: 9},
+		{Path: "models[1].tool_tag_end", Line: 7},
+		{Path: "models[1].tools[0]", Line: 13},
+		{Path: "tools[0].http.timeout", Line: 21},
+	}
+	for _, w := range want {
+		found := false
+		for _, e := range errs {
+			if e.Path == w.Path {
+				found = true
+				if e.Line != w.Line {
+					t.Errorf("expected %s at line %d, got %d", w.Path, w.Line, e.Line)
+				}
+			}
+		}
+		if !found {
+			t.Errorf("expected a problem at %s, got:\n%v", w.Path, errs)
+		}
+	}
+	if len(errs) != len(want) {
+		t.Errorf("expected %d problems, got %d:\n%v", len(want), len(errs), errs)
+	}
+}
+
+// TestLoadConfig_Auth verifies that API keys and JWT settings are checked.
+func TestLoadConfig_Auth(t *testing.T) {
+	tmpDir := t.TempDir()
+	yamlContent := `models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+auth:
+  api_keys:
+    - id: ci
+      key: same
+      scopes: [chat, deploy]
+    - id: ci
+      key: same
+    - id: ops
+  jwt:
+    jwks_file: missing.json
+`
+	configPath := writeTempConfig(t, tmpDir, "config.yaml", yamlContent)
+	_, err := config.LoadConfig(configPath)
+	var errs config.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	want := []string{
+		"auth.api_keys[0].scopes[1]",
+		"auth.api_keys[1].id",
+		"auth.api_keys[1].key",
+		"auth.api_keys[2].key",
+		"auth.jwt.jwks_file",
+	}
+	for _, w := range want {
+		found := false
+		for _, e := range errs {
+			found = found || e.Path == w
+		}
+		if !found {
+			t.Errorf("expected a problem at %s, got:\n%v", w, errs)
+		}
+	}
+	if len(errs) != len(want) {
+		t.Errorf("expected %d problems, got %d:\n%v", len(want), len(errs), errs)
+	}
+}
+
+// TestLoadConfig_Budgets verifies that budgets reference configured models.
+func TestLoadConfig_Budgets(t *testing.T) {
+	tmpDir := t.TempDir()
+	yamlContent := `models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+    pricing:
+      input_per_million: -1
+      output_per_million: 2
+usage:
+  budgets:
+    - id: daily
+      model: remote
+      daily_cost: 5
+    - id: fallback
+      daily_tokens: 1000
+      action: downgrade
+    - id: nothing
+`
+	configPath := writeTempConfig(t, tmpDir, "config.yaml", yamlContent)
+	_, err := config.LoadConfig(configPath)
+	var errs config.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	want := []string{"models[0].pricing", "usage.budgets[0].model", "usage.budgets[1].downgrade_to", "usage.budgets[2]"}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d problems, got %d:\n%v", len(want), len(errs), errs)
+	}
+	for i, w := range want {
+		if errs[i].Path != w {
+			t.Errorf("expected a problem at %s, got %+v", w, errs[i])
+		}
+	}
+}
+
+func TestLoadConfig_ServerSettings(t *testing.T) {
+	tmpDir := t.TempDir()
+	yamlContent := `models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+server:
+  tracing:
+    exporter: otlp
+    endpoint: localhost:4318
+    sample_ratio: 2
+  log:
+    level: verbose
+    redact: ["("]
+  read_timeout: soon
+  tls:
+    cert_file: missing.crt
+`
+	configPath := writeTempConfig(t, tmpDir, "config.yaml", yamlContent)
+	_, err := config.LoadConfig(configPath)
+	var errs config.ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected validation errors, got %v", err)
+	}
+	want := []string{"server.tracing.endpoint", "server.tracing.sample_ratio", "server.log.level", "server.log.redact[0]", "server.read_timeout", "server.tls.cert_file", "server.tls.key_file"}
+	if len(errs) != len(want) {
+		t.Fatalf("expected %d problems, got %d:\n%v", len(want), len(errs), errs)
+	}
+	for i, w := range want {
+		if errs[i].Path != w {
+			t.Errorf("expected a problem at %s, got %+v", w, errs[i])
+		}
+	}
+}
+
+// TestLoadConfig_UnknownKeys verifies that mistyped keys are rejected instead of being ignored.
+func TestLoadConfig_UnknownKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+	yamlContent := `version: "1.0"
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+    tool_tag_strat: "<tool>"
+servr:
+  port: "8080"
+`
+	configPath := writeTempConfig(t, tmpDir, "config.yaml", yamlContent)
+	_, err := config.LoadConfig(configPath)
+	var errs config.ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected two unknown key errors, got %v", err)
+	}
+	if errs[0].Path != "models[0].tool_tag_strat" || errs[0].Line != 6 || !strings.Contains(errs[0].Message, "tool_tag_start") {
+		t.Errorf("expected unknown model key with a suggestion, got %+v", errs[0])
+	}
+	if errs[1].Path != "servr" || errs[1].Line != 7 {
+		t.Errorf("expected unknown top-level key, got %+v", errs[1])
+	}
+}
+
+// TestLoadConfig_JSON verifies that JSON config files are accepted and strictly checked.
+func TestLoadConfig_JSON(t *testing.T) {
+	tmpDir := t.TempDir()
+	jsonContent := `{
+	"version": "1.0",
+	"models": [
+		{"id": "local", "name": "mymodel", "endpoint": "http://127.0.0.1:8080/"}
+	],
+	"tools": [{"id": "fstool", "enabled": false}]
+}`
+	configPath := writeTempConfig(t, tmpDir, "config.json", jsonContent)
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("expected valid config, got error: %v", err)
+	}
+	if cfg.Models[0].ID != "local" || *cfg.Tools[0].Enabled {
+		t.Errorf("unexpected config loaded from JSON: %+v", cfg)
+	}
+
+	configPath = writeTempConfig(t, tmpDir, "bad.json", `{"models": [{"id": "local", "endpoint": "http://127.0.0.1:8080/", "apikey": "x"}]}`)
+	if _, err := config.LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "models[0].apikey") {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+
+	configPath = writeTempConfig(t, tmpDir, "broken.json", `{"models": [}`)
+	if _, err := config.LoadConfig(configPath); err == nil {
+		t.Fatal("expected JSON syntax error, got nil")
+	}
+}
+
+// TestSchema verifies that the schema is generated from the config types.
+func TestSchema(t *testing.T) {
+	schema := config.Schema()
+	props := schema["properties"].(map[string]interface{})
+	models := props["models"].(map[string]interface{})["items"].(map[string]interface{})
+	modelProps := models["properties"].(map[string]interface{})
+	if _, ok := modelProps["tool_tag_start"]; !ok {
+		t.Errorf("expected model properties to include tool_tag_start, got %v", modelProps)
+	}
+	if models["additionalProperties"] != false {
+		t.Error("expected unknown model keys to be disallowed")
+	}
+	if _, ok := props["Path"]; ok {
+		t.Error("expected fields not read from the file to be left out")
+	}
+	if _, err := json.Marshal(schema); err != nil {
+		t.Fatalf("expected schema to encode as JSON, got %v", err)
+	}
+}
+
+// TestLoadConfig_Layers verifies includes, conf.d fragments and environment overlays.
+func TestLoadConfig_Layers(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := writeTempConfig(t, tmpDir, "config.yml", `version: "1.0"
+include:
+  - shared/models.yml
+server:
+  env: production
+  port: "8080"
+`)
+	os.MkdirAll(filepath.Join(tmpDir, "shared"), 0755)
+	writeTempConfig(t, tmpDir, "shared/models.yml", `models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+`)
+	os.MkdirAll(filepath.Join(tmpDir, "conf.d"), 0755)
+	writeTempConfig(t, tmpDir, "conf.d/20-tools.yml", `tools:
+  - id: fstool
+    enabled: false
+`)
+	writeTempConfig(t, tmpDir, "conf.d/10-models.yml", `models:
+  - id: remote
+    name: remote
+    endpoint: http://llm.internal/
+`)
+	writeTempConfig(t, tmpDir, "config.production.yml", `server:
+  port: "9090"
+models:
+  - id: local
+    endpoint: http://llm.prod/
+`)
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("expected valid config, got error: %v", err)
+	}
+	if cfg.Server.Port != "9090" || cfg.Server.Env != "production" {
+		t.Errorf("expected production overlay to set the port, got %+v", cfg.Server)
+	}
+	if len(cfg.Models) != 2 || cfg.Models[0].ID != "local" || cfg.Models[1].ID != "remote" {
+		t.Fatalf("expected models merged by id, got %+v", cfg.Models)
+	}
+	if cfg.Models[0].Endpoint != "http://llm.prod/" || cfg.Models[0].Name != "mymodel" {
+		t.Errorf("expected overlay to change only the endpoint, got %+v", cfg.Models[0])
+	}
+	if len(cfg.Tools) != 1 || *cfg.Tools[0].Enabled {
+		t.Errorf("expected fragment to disable fstool, got %+v", cfg.Tools)
+	}
+	if len(cfg.Files) != 5 {
+		t.Errorf("expected 5 merged files, got %v", cfg.Files)
+	}
+
+	sources := cfg.Sources()
+	if src := sources["models[0].endpoint"]; !strings.HasSuffix(src, "config.production.yml:5") {
+		t.Errorf("expected endpoint to come from the overlay, got %q", src)
+	}
+	if src := sources["models[0].name"]; !strings.HasSuffix(src, filepath.Join("shared", "models.yml")+":3") {
+		t.Errorf("expected name to come from the include, got %q", src)
+	}
+
+	// AGENTAI_ENV selects a different overlay; there is none for staging.
+	t.Setenv(config.EnvVar, "staging")
+	cfg, err = config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("expected valid config, got error: %v", err)
+	}
+	if cfg.Server.Port != "8080" || cfg.Server.Env != "staging" {
+		t.Errorf("expected base port without an overlay, got %+v", cfg.Server)
+	}
+
+	// Problems are reported against the file that contains them.
+	writeTempConfig(t, tmpDir, "conf.d/10-models.yml", `models:
+  - id: remote
+    name: remote
+    endpoint: llm.internal
+`)
+	_, err = config.LoadConfig(configPath)
+	var errs config.ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || !strings.HasSuffix(errs[0].File, "10-models.yml") || errs[0].Line != 4 {
+		t.Fatalf("expected endpoint error located in the fragment, got %v", err)
+	}
+}
+
+// TestLoadConfig_IncludeCycle verifies that files including each other are rejected.
+func TestLoadConfig_IncludeCycle(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := writeTempConfig(t, tmpDir, "config.yml", "include: [other.yml]\n")
+	writeTempConfig(t, tmpDir, "other.yml", "include: [config.yml]\n")
+	if _, err := config.LoadConfig(configPath); err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Fatalf("expected include cycle error, got %v", err)
+	}
+}
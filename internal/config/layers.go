@@ -0,0 +1,353 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvVar selects the environment overlay, taking precedence over server.env.
+const EnvVar = "AGENTAI_ENV"
+
+// fragmentDir is the directory of fragments merged on top of the base config file.
+const fragmentDir = "conf.d"
+
+// document is the merged YAML tree of every file that makes up a configuration.
+type document struct {
+	root *yaml.Node
+	// origin records the file each node was read from.
+	origin map[*yaml.Node]string
+	// files lists the files that were merged, in order.
+	files []string
+}
+
+// loadDocument reads the base file and merges, in increasing precedence, the files it
+// includes, the fragments in conf.d/ (lexical order) and the overlay for the environment
+// (config.<env>.yml), then applies the admin API state (see State). If state is nil it is
+// read from the state file. It returns the merged document and the selected environment.
+//
+// Mappings are merged key by key. Lists of entries with an id (models, tools, mcp_servers)
+// are merged by id, so a fragment or overlay only needs the keys it changes; any other
+// value is replaced.
+func loadDocument(path string, state *State) (*document, string, error) {
+	d := &document{origin: make(map[*yaml.Node]string)}
+	root, err := d.loadFile(path, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dir := filepath.Dir(path)
+	fragments, err := fragmentFiles(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, f := range fragments {
+		node, err := d.loadFile(f, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		root = merge(root, node)
+	}
+
+	env := os.Getenv(EnvVar)
+	if env == "" {
+		env = scalarAt(root, "server", "env")
+	}
+	if env == "" {
+		env = "development"
+	}
+	if overlay := overlayFile(path, env); overlay != "" {
+		node, err := d.loadFile(overlay, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		root = merge(root, node)
+	}
+
+	stateNode, err := d.loadState(statePath(path, root), state)
+	if err != nil {
+		return nil, "", err
+	}
+	if stateNode != nil {
+		applyState(root, stateNode)
+	}
+
+	if _, ok := d.origin[root]; !ok {
+		d.origin[root] = path
+	}
+	d.root = root
+	return d, env, nil
+}
+
+// loadFile parses one file, merging the files it includes beneath it. stack holds the
+// files currently being included, to detect cycles.
+func (d *document) loadFile(path string, stack []string) (*yaml.Node, error) {
+	for _, p := range stack {
+		if p == path {
+			return nil, fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), path)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+	if filepath.Ext(path) == ".json" {
+		// YAML is a superset of JSON, but JSON files should get JSON syntax errors.
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("error parsing JSON config file %s: %w", path, err)
+		}
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error unmarshalling config file %s: %w", path, err)
+	}
+	d.files = append(d.files, path)
+
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map", Line: 1}
+	if len(doc.Content) > 0 {
+		node = doc.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file %s: expected a mapping at the top level", path)
+	}
+	d.record(node, path)
+
+	// Pull out the include directive and merge the included files beneath this one.
+	var includes []string
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value != "include" {
+			continue
+		}
+		if err := node.Content[i+1].Decode(&includes); err != nil {
+			return nil, fmt.Errorf("config file %s: line %d: include must be a list of files", path, node.Content[i].Line)
+		}
+		node.Content = append(node.Content[:i:i], node.Content[i+2:]...)
+		break
+	}
+	if len(includes) == 0 {
+		return node, nil
+	}
+	var base *yaml.Node
+	for _, inc := range includes {
+		if !filepath.IsAbs(inc) {
+			inc = filepath.Join(filepath.Dir(path), inc)
+		}
+		included, err := d.loadFile(inc, append(stack, path))
+		if err != nil {
+			return nil, err
+		}
+		base = merge(base, included)
+	}
+	return merge(base, node), nil
+}
+
+// loadState returns the state document, from state if given or else from the state file.
+// It returns nil if there is no state.
+func (d *document) loadState(path string, state *State) (*yaml.Node, error) {
+	var data []byte
+	if state != nil {
+		var err error
+		if data, err = yaml.Marshal(state); err != nil {
+			return nil, fmt.Errorf("error marshalling state: %w", err)
+		}
+	} else {
+		var err error
+		data, err = os.ReadFile(path)
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading state file: %w", err)
+		}
+		d.files = append(d.files, path)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("error unmarshalling state file %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	d.record(doc.Content[0], path)
+	return doc.Content[0], nil
+}
+
+// record remembers that node and everything below it came from file.
+func (d *document) record(node *yaml.Node, file string) {
+	d.origin[node] = file
+	for _, c := range node.Content {
+		d.record(c, file)
+	}
+}
+
+// fragmentFiles returns the config files in dir/conf.d in lexical order.
+func fragmentFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, fragmentDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", fragmentDir, err)
+	}
+	var files []string
+	for _, e := range entries {
+		if !e.IsDir() && contains(configExtensions, filepath.Ext(e.Name())) {
+			files = append(files, filepath.Join(dir, fragmentDir, e.Name()))
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// overlayFile returns the overlay for env next to the base file (config.<env>.yml for
+// config.yml), or "" if there is none.
+func overlayFile(path, env string) string {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for _, e := range append([]string{ext}, configExtensions...) {
+		candidate := stem + "." + env + e
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// merge merges src on top of dst and returns the result, reusing dst's nodes where possible.
+func merge(dst, src *yaml.Node) *yaml.Node {
+	if dst == nil {
+		return src
+	}
+	if src == nil {
+		return dst
+	}
+	switch {
+	case dst.Kind == yaml.MappingNode && src.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(src.Content); i += 2 {
+			key, value := src.Content[i], src.Content[i+1]
+			if j := mappingIndex(dst, key.Value); j >= 0 {
+				dst.Content[j+1] = merge(dst.Content[j+1], value)
+			} else {
+				dst.Content = append(dst.Content, key, value)
+			}
+		}
+		return dst
+	case dst.Kind == yaml.SequenceNode && src.Kind == yaml.SequenceNode && hasIDs(dst) && hasIDs(src):
+		for _, item := range src.Content {
+			id := scalarAt(item, "id")
+			merged := false
+			for j, existing := range dst.Content {
+				if scalarAt(existing, "id") == id {
+					dst.Content[j] = merge(existing, item)
+					merged = true
+					break
+				}
+			}
+			if !merged {
+				dst.Content = append(dst.Content, item)
+			}
+		}
+		return dst
+	default:
+		return src
+	}
+}
+
+// hasIDs reports whether every entry of the sequence is a mapping with an id.
+func hasIDs(seq *yaml.Node) bool {
+	for _, item := range seq.Content {
+		if scalarAt(item, "id") == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func mappingIndex(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// scalarAt returns the scalar value at the given keys below node, or "".
+func scalarAt(node *yaml.Node, keys ...string) string {
+	for _, key := range keys {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return ""
+		}
+		i := mappingIndex(node, key)
+		if i < 0 {
+			return ""
+		}
+		node = node.Content[i+1]
+	}
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// sources maps the path of every value in the document to the "file:line" it was read from.
+func (d *document) sources() map[string]string {
+	sources := make(map[string]string)
+	var walk func(node *yaml.Node, path string)
+	walk = func(node *yaml.Node, path string) {
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				walk(node.Content[i+1], joinPath(path, node.Content[i].Value))
+			}
+		case yaml.SequenceNode:
+			for i, item := range node.Content {
+				walk(item, fmt.Sprintf("%s[%d]", path, i))
+			}
+		case yaml.AliasNode:
+			walk(node.Alias, path)
+		default:
+			sources[path] = fmt.Sprintf("%s:%d", d.origin[node], node.Line)
+		}
+	}
+	walk(d.root, "")
+	return sources
+}
+
+// Sources maps the path of every value read from a file (e.g. "models[0].endpoint") to
+// the "file:line" it came from. Defaults and discovered tools have no entry.
+func (c *Config) Sources() map[string]string {
+	if c.doc == nil {
+		return nil
+	}
+	return c.doc.sources()
+}
+
+// Fingerprint hashes the files that make up the configuration, together with the files
+// that could be added to it (conf.d fragments, the environment overlay, the state file), so that a watcher
+// can tell when a reload is needed.
+func (c *Config) Fingerprint() [sha256.Size]byte {
+	h := sha256.New()
+	files := append([]string(nil), c.Files...)
+	fragments, _ := fragmentFiles(filepath.Dir(c.Path))
+	files = append(files, fragments...)
+	files = append(files, c.StatePath())
+	if overlay := overlayFile(c.Path, c.Server.Env); overlay != "" {
+		files = append(files, overlay)
+	}
+	for _, f := range files {
+		data, _ := os.ReadFile(f)
+		fmt.Fprintf(h, "%s\x00%d\x00", f, len(data))
+		h.Write(data)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
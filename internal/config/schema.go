@@ -0,0 +1,233 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// schemaEnums restricts string fields to known values, keyed by "<Go type>.<yaml key>".
+var schemaEnums = map[string][]string{
+	"ModelConfig.api_vendor":    knownVendors,
+	"ToolConfig.type":           {toolmodel.TypeBinary, toolmodel.TypeHTTP},
+	"MCPServerConfig.transport": {"stdio", "http"},
+	"HTTPAuth.type":             {"basic", "bearer", "header"},
+	"BudgetConfig.action":       {BudgetReject, BudgetDowngrade},
+	"TracingConfig.exporter":    {TraceExporterOTLP, TraceExporterFile},
+	"LogConfig.level":           {LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError},
+	"LogConfig.format":          {LogFormatText, LogFormatJSON},
+}
+
+// schemaRequired lists the keys that must be present, keyed by Go type.
+var schemaRequired = map[string][]string{
+	"Config":           {"models"},
+	"ModelConfig":      {"id", "endpoint"},
+	"ToolConfig":       {"id"},
+	"MCPServerConfig":  {"id", "transport"},
+	"HTTPConfig":       {"url"},
+	"MCPToolRef":       {"server", "tool"},
+	"ModelLimitConfig": {"id", "max_concurrent"},
+	"BudgetConfig":     {"id"},
+	"TLSConfig":        {"cert_file", "key_file"},
+}
+
+// yamlField is a struct field as it appears in the configuration file.
+type yamlField struct {
+	key   string
+	field reflect.StructField
+}
+
+// yamlFields returns the fields of struct type t that are read from YAML, in declaration order.
+func yamlFields(t reflect.Type) []yamlField {
+	var fields []yamlField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if key == "-" {
+			continue
+		}
+		if key == "" {
+			key = strings.ToLower(f.Name)
+		}
+		fields = append(fields, yamlField{key: key, field: f})
+	}
+	return fields
+}
+
+// Schema returns a JSON Schema (draft 2020-12) describing the configuration file, generated
+// from the Config type so it always matches what LoadConfig accepts. Editors such as VS Code
+// use it for completion and to flag mistyped keys.
+func Schema() map[string]interface{} {
+	s := typeSchema(reflect.TypeOf(Config{}))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["title"] = "agentAI configuration"
+	return s
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		s := map[string]interface{}{"type": "object"}
+		if t.Elem().Kind() != reflect.Interface {
+			s["additionalProperties"] = typeSchema(t.Elem())
+		}
+		return s
+	case reflect.Struct:
+		props := make(map[string]interface{})
+		for _, f := range yamlFields(t) {
+			p := typeSchema(f.field.Type)
+			if enum, ok := schemaEnums[t.Name()+"."+f.key]; ok {
+				p["enum"] = enum
+			}
+			// An empty YAML value ("port:") is null and means "use the default".
+			if typ, ok := p["type"].(string); ok && typ != "object" && typ != "array" {
+				p["type"] = []string{typ, "null"}
+				if enum, ok := p["enum"].([]string); ok {
+					values := make([]interface{}, 0, len(enum)+1)
+					for _, e := range enum {
+						values = append(values, e)
+					}
+					p["enum"] = append(values, nil)
+				}
+			}
+			props[f.key] = p
+		}
+		s := map[string]interface{}{
+			"type":                 "object",
+			"properties":           props,
+			"additionalProperties": false,
+		}
+		if required, ok := schemaRequired[t.Name()]; ok {
+			s["required"] = required
+		}
+		return s
+	default:
+		// interface{} values (tool arguments, model parameters) accept anything.
+		return map[string]interface{}{}
+	}
+}
+
+// checkKnownFields reports every mapping key under node that does not correspond to a field
+// of t, so that mistyped keys are errors instead of being silently ignored.
+func (v *validator) checkKnownFields(node *yaml.Node, t reflect.Type, path string) {
+	if node == nil {
+		return
+	}
+	if node.Kind == yaml.DocumentNode {
+		for _, c := range node.Content {
+			v.checkKnownFields(c, t, path)
+		}
+		return
+	}
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		var keys []string
+		for _, f := range yamlFields(t) {
+			fields[f.key] = f.field.Type
+			keys = append(keys, f.key)
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			ft, ok := fields[key]
+			if !ok {
+				msg := fmt.Sprintf("unknown key '%s'", key)
+				if s := suggest(key, keys); s != "" {
+					msg += fmt.Sprintf(" (did you mean '%s'?)", s)
+				}
+				v.errs = append(v.errs, ValidationError{
+					File:    v.doc.origin[node.Content[i]],
+					Path:    joinPath(path, key),
+					Line:    node.Content[i].Line,
+					Message: msg,
+				})
+				continue
+			}
+			v.checkKnownFields(node.Content[i+1], ft, joinPath(path, key))
+		}
+	case reflect.Slice, reflect.Array:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			v.checkKnownFields(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			v.checkKnownFields(node.Content[i+1], t.Elem(), joinPath(path, node.Content[i].Value))
+		}
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// suggest returns the candidate closest to key if it is within two edits, for typo hints.
+func suggest(key string, candidates []string) string {
+	sort.Strings(candidates)
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if d := editDistance(key, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,249 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// SecretProvider resolves secret references. A config value of the form "<scheme>:<ref>"
+// whose scheme has a registered provider is replaced with Resolve(ref).
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+// SecretProviderFunc adapts a function to the SecretProvider interface.
+type SecretProviderFunc func(ref string) (string, error)
+
+// Resolve calls f(ref).
+func (f SecretProviderFunc) Resolve(ref string) (string, error) {
+	return f(ref)
+}
+
+var (
+	providersMu     sync.RWMutex
+	secretProviders = map[string]SecretProvider{
+		"file": SecretProviderFunc(readSecretFile),
+		"env":  SecretProviderFunc(lookupEnv),
+	}
+)
+
+// RegisterSecretProvider makes a provider available for "<scheme>:<ref>" references,
+// e.g. a vault client registered as "vault". Registering an existing scheme replaces it.
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	secretProviders[scheme] = p
+}
+
+// readSecretFile reads a mounted secret (Docker/Kubernetes), dropping the trailing newline.
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func lookupEnv(name string) (string, error) {
+	v, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return v, nil
+}
+
+// envPattern matches ${VAR} and ${VAR:-default}.
+var envPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// refPattern matches a provider reference such as "file:/run/secrets/api_key".
+var refPattern = regexp.MustCompile(`^([a-z][a-z0-9_-]*):(.+)$`)
+
+// secretResolver expands values and remembers which ones were secrets so they can be masked.
+type secretResolver struct {
+	secrets []string
+	errs    ValidationErrors
+}
+
+// expand resolves a single value at the given config path. Provider references replace the
+// whole value; ${VAR} references are expanded in place. When secret is true, every resolved
+// value is recorded for masking.
+func (r *secretResolver) expand(path, value string, secret bool) string {
+	if m := refPattern.FindStringSubmatch(value); m != nil {
+		providersMu.RLock()
+		p, ok := secretProviders[m[1]]
+		providersMu.RUnlock()
+		if ok {
+			resolved, err := p.Resolve(m[2])
+			if err != nil {
+				r.errs = append(r.errs, ValidationError{Path: path, Message: err.Error()})
+				return ""
+			}
+			r.remember(resolved)
+			return resolved
+		}
+	}
+
+	return envPattern.ReplaceAllStringFunc(value, func(ref string) string {
+		m := envPattern.FindStringSubmatch(ref)
+		v, ok := os.LookupEnv(m[1])
+		if !ok {
+			if strings.Contains(ref, ":-") {
+				return m[2]
+			}
+			r.errs = append(r.errs, ValidationError{Path: path, Message: fmt.Sprintf("environment variable %s is not set", m[1])})
+			return ""
+		}
+		if secret {
+			r.remember(v)
+		}
+		return v
+	})
+}
+
+func (r *secretResolver) remember(v string) {
+	if v != "" {
+		r.secrets = append(r.secrets, v)
+	}
+}
+
+// expandWhole expands a value and, if it held a reference, records the resolved value as
+// a secret along with the values of its references.
+func (r *secretResolver) expandWhole(path, value string) string {
+	resolved := r.expand(path, value, true)
+	if resolved != value {
+		r.remember(resolved)
+	}
+	return resolved
+}
+
+func (r *secretResolver) expandMap(path string, m map[string]string, secret bool) {
+	for k, v := range m {
+		m[k] = r.expand(path+"."+k, v, secret)
+	}
+}
+
+// resolveSecrets expands environment variables and secret references in API keys,
+// endpoints, headers and tool settings, returning a problem for each reference that
+// cannot be resolved. Values are never included in errors.
+func resolveSecrets(cfg *Config) ValidationErrors {
+	r := &secretResolver{}
+	cfg.Server.AdminToken = r.expand("server.admin_token", cfg.Server.AdminToken, true)
+	r.remember(cfg.Server.AdminToken)
+	for i := range cfg.Auth.APIKeys {
+		k := &cfg.Auth.APIKeys[i]
+		k.Key = r.expand(fmt.Sprintf("auth.api_keys[%d].key", i), k.Key, true)
+		r.remember(k.Key)
+	}
+	cfg.Server.Tracing.Endpoint = r.expand("server.tracing.endpoint", cfg.Server.Tracing.Endpoint, false)
+	r.expandMap("server.tracing.headers", cfg.Server.Tracing.Headers, true)
+	for i := range cfg.Models {
+		m := &cfg.Models[i]
+		path := fmt.Sprintf("models[%d]", i)
+		m.Endpoint = r.expand(path+".endpoint", m.Endpoint, false)
+		m.APIKey = r.expand(path+".api_key", m.APIKey, true)
+		r.remember(m.APIKey)
+		r.expandMap(path+".headers", m.Headers, true)
+	}
+	for i := range cfg.Tools {
+		t := &cfg.Tools[i]
+		path := fmt.Sprintf("tools[%d]", i)
+		// Argument defaults and webhook URLs are shown to callers and models, so the values
+		// resolved from a reference are masked like credentials.
+		for k, v := range t.CommandArgs {
+			if s, ok := v.(string); ok {
+				t.CommandArgs[k] = r.expandWhole(path+".command_args."+k, s)
+			}
+		}
+		if t.HTTP != nil {
+			t.HTTP.URL = r.expandWhole(path+".http.url", t.HTTP.URL)
+			r.expandMap(path+".http.headers", t.HTTP.Headers, true)
+			if a := t.HTTP.Auth; a != nil {
+				a.Username = r.expand(path+".http.auth.username", a.Username, false)
+				a.Password = r.expand(path+".http.auth.password", a.Password, true)
+				a.Token = r.expand(path+".http.auth.token", a.Token, true)
+				r.remember(a.Password)
+				r.remember(a.Token)
+			}
+		}
+	}
+	for i := range cfg.MCPServers {
+		s := &cfg.MCPServers[i]
+		path := fmt.Sprintf("mcp_servers[%d]", i)
+		// Like webhook URLs, server URLs and arguments such as --token=${GH_TOKEN} often
+		// carry credentials.
+		s.URL = r.expandWhole(path+".url", s.URL)
+		for j, arg := range s.Args {
+			s.Args[j] = r.expandWhole(fmt.Sprintf("%s.args[%d]", path, j), arg)
+		}
+		r.expandMap(path+".env", s.Env, true)
+		r.expandMap(path+".headers", s.Headers, true)
+	}
+
+	cfg.secrets = r.secrets
+	return r.errs
+}
+
+// Secrets returns the secret values resolved while loading the configuration
+// (API keys, credentials and values expanded into headers).
+func (c *Config) Secrets() []string {
+	return c.secrets
+}
+
+// IsSecret reports whether v is one of the configuration's secret values.
+func (c *Config) IsSecret(v string) bool {
+	if v == "" {
+		return false
+	}
+	for _, s := range c.secrets {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// sensitiveHeaderWords mark header names whose values are always masked.
+var sensitiveHeaderWords = []string{"authorization", "cookie", "token", "secret", "key", "password"}
+
+// MaskHeaders returns a copy of headers with credential values replaced by "<masked>".
+func (c *Config) MaskHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	masked := make(map[string]string, len(headers))
+	for k, v := range headers {
+		masked[k] = v
+		lower := strings.ToLower(k)
+		for _, word := range sensitiveHeaderWords {
+			if strings.Contains(lower, word) {
+				masked[k] = Masked
+				break
+			}
+		}
+		if c.IsSecret(v) {
+			masked[k] = Masked
+		}
+	}
+	return masked
+}
+
+// MaskArgs returns a copy of tool arguments with secret values replaced by "<masked>".
+func (c *Config) MaskArgs(args map[string]interface{}) map[string]interface{} {
+	if args == nil {
+		return nil
+	}
+	masked := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		masked[k] = v
+		if s, ok := v.(string); ok && c.IsSecret(s) {
+			masked[k] = Masked
+		}
+	}
+	return masked
+}
+
+// Masked replaces secret values in API responses.
+const Masked = "<masked>"
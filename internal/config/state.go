@@ -0,0 +1,253 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// DefaultStateFile is the state store used when server.state_file is not set, relative to the config file.
+const DefaultStateFile = "state.yml"
+
+// State holds the models and tools changed through the admin API. It is stored in its own
+// file so hand-edited config files are never rewritten, and is applied on top of every other
+// layer: an entry replaces the configured entry with the same id, and deleted ids are removed.
+type State struct {
+	Models  []ModelConfig          `yaml:"models,omitempty" json:"models,omitempty"`
+	Tools   []toolmodel.ToolConfig `yaml:"tools,omitempty" json:"tools,omitempty"`
+	Deleted StateDeleted           `yaml:"deleted,omitempty" json:"deleted,omitempty"`
+}
+
+// StateDeleted lists the ids removed through the admin API.
+type StateDeleted struct {
+	Models []string `yaml:"models,omitempty" json:"models,omitempty"`
+	Tools  []string `yaml:"tools,omitempty" json:"tools,omitempty"`
+}
+
+// statePath returns the state file for the config file at path, given the merged document.
+func statePath(path string, root *yaml.Node) string {
+	file := scalarAt(root, "server", "state_file")
+	if file == "" {
+		file = DefaultStateFile
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(filepath.Dir(path), file)
+	}
+	return file
+}
+
+// StatePath returns the file the admin API stores its changes in.
+func (c *Config) StatePath() string {
+	if c.doc == nil {
+		return statePath(c.Path, nil)
+	}
+	return statePath(c.Path, c.doc.root)
+}
+
+// LoadState reads the state store of the configuration. A missing file is an empty state.
+func (c *Config) LoadState() (*State, error) {
+	var s State
+	data, err := os.ReadFile(c.StatePath())
+	if os.IsNotExist(err) {
+		return &s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading state file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("error unmarshalling state file: %w", err)
+	}
+	return &s, nil
+}
+
+// SaveState writes s to the state store, replacing the file atomically.
+func (c *Config) SaveState(s *State) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("error marshalling state: %w", err)
+	}
+	path := c.StatePath()
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".state-*.yml")
+	if err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing state file: %w", err)
+	}
+	return nil
+}
+
+// Clone returns a copy of s that changes to s do not affect.
+func (s *State) Clone() *State {
+	return &State{
+		Models:  slices.Clone(s.Models),
+		Tools:   slices.Clone(s.Tools),
+		Deleted: StateDeleted{Models: slices.Clone(s.Deleted.Models), Tools: slices.Clone(s.Deleted.Tools)},
+	}
+}
+
+// PutModel adds or replaces the model with m.ID.
+func (s *State) PutModel(m ModelConfig) {
+	s.Deleted.Models = remove(s.Deleted.Models, m.ID)
+	for i := range s.Models {
+		if s.Models[i].ID == m.ID {
+			s.Models[i] = m
+			return
+		}
+	}
+	s.Models = append(s.Models, m)
+}
+
+// DeleteModel removes the model with the given id.
+func (s *State) DeleteModel(id string) {
+	for i := range s.Models {
+		if s.Models[i].ID == id {
+			s.Models = append(s.Models[:i], s.Models[i+1:]...)
+			break
+		}
+	}
+	s.Deleted.Models = append(remove(s.Deleted.Models, id), id)
+}
+
+// PutTool adds or replaces the tool entry with t.ID.
+func (s *State) PutTool(t toolmodel.ToolConfig) {
+	s.Deleted.Tools = remove(s.Deleted.Tools, t.ID)
+	for i := range s.Tools {
+		if s.Tools[i].ID == t.ID {
+			s.Tools[i] = t
+			return
+		}
+	}
+	s.Tools = append(s.Tools, t)
+}
+
+// DeleteTool removes the tool entry with the given id.
+func (s *State) DeleteTool(id string) {
+	for i := range s.Tools {
+		if s.Tools[i].ID == id {
+			s.Tools = append(s.Tools[:i], s.Tools[i+1:]...)
+			break
+		}
+	}
+	s.Deleted.Tools = append(remove(s.Deleted.Tools, id), id)
+}
+
+func remove(list []string, s string) []string {
+	out := list[:0]
+	for _, item := range list {
+		if item != s {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// applyState applies the state document on top of root: entries replace the entry with
+// the same id as a whole (rather than being merged), and deleted ids are removed.
+func applyState(root, state *yaml.Node) {
+	var deleted *yaml.Node
+	if i := mappingIndex(state, "deleted"); i >= 0 {
+		deleted = state.Content[i+1]
+	}
+	for _, key := range []string{"models", "tools"} {
+		var ids []string
+		if deleted != nil {
+			if i := mappingIndex(deleted, key); i >= 0 {
+				deleted.Content[i+1].Decode(&ids)
+			}
+		}
+		var entries []*yaml.Node
+		if i := mappingIndex(state, key); i >= 0 && state.Content[i+1].Kind == yaml.SequenceNode {
+			entries = state.Content[i+1].Content
+		}
+		if len(ids) == 0 && len(entries) == 0 {
+			continue
+		}
+
+		i := mappingIndex(root, key)
+		if i < 0 {
+			root.Content = append(root.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+				&yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"})
+			i = len(root.Content) - 2
+		}
+		seq := root.Content[i+1]
+		if seq.Kind != yaml.SequenceNode {
+			seq = &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			root.Content[i+1] = seq
+		}
+
+		kept := seq.Content[:0]
+		for _, item := range seq.Content {
+			if !contains(ids, scalarAt(item, "id")) {
+				kept = append(kept, item)
+			}
+		}
+		seq.Content = kept
+		for _, entry := range entries {
+			id := scalarAt(entry, "id")
+			replaced := false
+			for j, item := range seq.Content {
+				if scalarAt(item, "id") == id {
+					seq.Content[j] = entry
+					replaced = true
+					break
+				}
+			}
+			if !replaced {
+				seq.Content = append(seq.Content, entry)
+			}
+		}
+	}
+}
+
+// RawModel returns the model with the given id as written in the config files, before
+// environment variables and secret references are resolved.
+func (c *Config) RawModel(id string) (ModelConfig, bool) {
+	var m ModelConfig
+	return m, c.rawEntry("models", id, &m)
+}
+
+// RawTool returns the tool entry with the given id as written in the config files.
+func (c *Config) RawTool(id string) (toolmodel.ToolConfig, bool) {
+	var t toolmodel.ToolConfig
+	return t, c.rawEntry("tools", id, &t)
+}
+
+func (c *Config) rawEntry(key, id string, out interface{}) bool {
+	if c.doc == nil {
+		return false
+	}
+	i := mappingIndex(c.doc.root, key)
+	if i < 0 {
+		return false
+	}
+	for _, item := range c.doc.root.Content[i+1].Content {
+		if scalarAt(item, "id") == id {
+			return item.Decode(out) == nil
+		}
+	}
+	return false
+}
+
+// ETag returns a strong entity tag for v, used for optimistic concurrency in the admin API.
+func ETag(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
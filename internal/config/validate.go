@@ -0,0 +1,535 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// knownVendors are the values accepted for ModelConfig.APIVendor.
+var knownVendors = []string{"ollama", "openai", "custom"}
+
+// ValidationError is a single problem found in a configuration file.
+type ValidationError struct {
+	// File is the file the offending value was read from, if known.
+	File string `json:"file,omitempty"`
+	// Path locates the offending value, e.g. "models[1].endpoint". It is empty for syntax problems.
+	Path string `json:"path"`
+	// Line is the line of the value (or of its closest enclosing entry) in the file, 0 if unknown.
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	msg := e.Message
+	if e.Path != "" {
+		msg = e.Path + ": " + msg
+	}
+	switch {
+	case e.File != "" && e.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, msg)
+	case e.File != "":
+		return fmt.Sprintf("%s: %s", e.File, msg)
+	case e.Line > 0:
+		return fmt.Sprintf("line %d: %s", e.Line, msg)
+	}
+	return msg
+}
+
+// ValidationErrors collects every problem found in a configuration.
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("invalid config (%d problems):\n  %s", len(e), strings.Join(msgs, "\n  "))
+}
+
+// validator accumulates problems, locating each in the document the configuration was read from.
+type validator struct {
+	doc  *document
+	errs ValidationErrors
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, v.doc.locate(ValidationError{Path: path, Message: fmt.Sprintf(format, args...)}))
+}
+
+// sorted returns the problems ordered by line, or nil if there are none.
+func (v *validator) sorted() ValidationErrors {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	sortErrors(v.errs)
+	return v.errs
+}
+
+// sortErrors orders problems by file, then line.
+func sortErrors(errs ValidationErrors) {
+	sort.SliceStable(errs, func(i, j int) bool {
+		if errs[i].File != errs[j].File {
+			return errs[i].File < errs[j].File
+		}
+		return errs[i].Line < errs[j].Line
+	})
+}
+
+// pathToken matches one element of a path such as "models[1].headers.Authorization".
+var pathToken = regexp.MustCompile(`[^.\[\]]+|\[\d+\]`)
+
+// locate fills in the file and line of e from its path. The line is that of the value at
+// the path or, if it is missing, of the deepest entry on the path that exists.
+func (d *document) locate(e ValidationError) ValidationError {
+	if d == nil || d.root == nil {
+		return e
+	}
+	node := d.root
+	for _, tok := range pathToken.FindAllString(e.Path, -1) {
+		var next *yaml.Node
+		if strings.HasPrefix(tok, "[") {
+			idx, _ := strconv.Atoi(strings.Trim(tok, "[]"))
+			if node.Kind == yaml.SequenceNode && idx < len(node.Content) {
+				next = node.Content[idx]
+			}
+		} else if node.Kind == yaml.MappingNode {
+			if i := mappingIndex(node, tok); i >= 0 {
+				next = node.Content[i+1]
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	e.File, e.Line = d.origin[node], node.Line
+	return e
+}
+
+// Validate checks the whole configuration and returns every problem found. Problems in a
+// configuration read by LoadConfig carry the file and line of the offending value.
+func Validate(cfg *Config) ValidationErrors {
+	v := &validator{doc: cfg.doc}
+	if cfg.doc != nil {
+		v.checkKnownFields(cfg.doc.root, reflect.TypeOf(Config{}), "")
+	}
+
+	for _, d := range []struct{ key, value string }{
+		{"watch_interval", cfg.Server.WatchInterval},
+		{"read_header_timeout", cfg.Server.ReadHeaderTimeout},
+		{"read_timeout", cfg.Server.ReadTimeout},
+		{"write_timeout", cfg.Server.WriteTimeout},
+		{"idle_timeout", cfg.Server.IdleTimeout},
+		{"shutdown_timeout", cfg.Server.ShutdownTimeout},
+		{"health.timeout", cfg.Server.Health.Timeout},
+	} {
+		if _, err := time.ParseDuration(d.value); d.value != "" && err != nil {
+			v.add("server."+d.key, "invalid duration %q", d.value)
+		}
+	}
+	v.validateTLS(cfg)
+
+	v.validateMCPServers(cfg)
+	v.validateTools(cfg)
+	v.validateModels(cfg)
+	v.validateAuth(cfg)
+	v.validateRateLimit(cfg)
+	v.validateUsage(cfg)
+	if cfg.Batches.Concurrency < 0 {
+		v.add("batches.concurrency", "concurrency must not be negative")
+	}
+	if cfg.Batches.MaxInputBytes < 0 {
+		v.add("batches.max_input_bytes", "max_input_bytes must not be negative")
+	}
+	v.validateTracing(cfg)
+	v.validateLog(cfg)
+	return v.sorted()
+}
+
+func (v *validator) validateUsage(cfg *Config) {
+	for i, m := range cfg.Models {
+		if p := m.Pricing; p != nil && (p.InputPerMillion < 0 || p.OutputPerMillion < 0) {
+			v.add(fmt.Sprintf("models[%d].pricing", i), "prices must not be negative")
+		}
+	}
+	seen := make(map[string]int)
+	for i, b := range cfg.Usage.Budgets {
+		path := fmt.Sprintf("usage.budgets[%d]", i)
+		if b.ID == "" {
+			v.add(path+".id", "budget must have an id")
+		} else if first, dup := seen[b.ID]; dup {
+			v.add(path+".id", "duplicate budget id '%s' (first defined at usage.budgets[%d])", b.ID, first)
+		} else {
+			seen[b.ID] = i
+		}
+		if b.Model != "" && !cfg.hasModel(b.Model) {
+			v.add(path+".model", "budget references unknown model '%s'", b.Model)
+		}
+		if b.DailyCost < 0 || b.MonthlyCost < 0 || b.DailyTokens < 0 || b.MonthlyTokens < 0 {
+			v.add(path, "budget limits must not be negative")
+		} else if b.DailyCost == 0 && b.MonthlyCost == 0 && b.DailyTokens == 0 && b.MonthlyTokens == 0 {
+			v.add(path, "budget '%s' sets no limit (daily_cost, monthly_cost, daily_tokens or monthly_tokens)", b.ID)
+		}
+		switch b.Action {
+		case "", BudgetReject:
+			if b.DowngradeTo != "" {
+				v.add(path+".downgrade_to", "downgrade_to requires action 'downgrade'")
+			}
+		case BudgetDowngrade:
+			if b.DowngradeTo == "" {
+				v.add(path+".downgrade_to", "downgrade_to is required when action is 'downgrade'")
+			} else if !cfg.hasModel(b.DowngradeTo) {
+				v.add(path+".downgrade_to", "budget references unknown model '%s'", b.DowngradeTo)
+			} else if b.DowngradeTo == b.Model {
+				v.add(path+".downgrade_to", "cannot downgrade to the model the budget applies to")
+			}
+		default:
+			v.add(path+".action", "unknown action '%s' (expected reject or downgrade)", b.Action)
+		}
+	}
+}
+
+func (v *validator) validateTracing(cfg *Config) {
+	t := cfg.Server.Tracing
+	switch t.Exporter {
+	case "":
+	case TraceExporterOTLP:
+		if u, err := url.Parse(t.Endpoint); t.Endpoint != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			v.add("server.tracing.endpoint", "invalid endpoint URL %q: must be an absolute http(s) URL", t.Endpoint)
+		}
+	case TraceExporterFile:
+		if t.File == "" {
+			v.add("server.tracing.file", "file is required for the file exporter")
+		}
+	default:
+		v.add("server.tracing.exporter", "unknown exporter '%s' (expected otlp or file)", t.Exporter)
+	}
+	if r := t.SampleRatio; r != nil && (*r < 0 || *r > 1) {
+		v.add("server.tracing.sample_ratio", "sample_ratio must be between 0 and 1")
+	}
+}
+
+func (v *validator) validateTLS(cfg *Config) {
+	t := cfg.Server.TLS
+	if t == nil {
+		return
+	}
+	for _, f := range []struct{ key, path string }{{"cert_file", t.CertFile}, {"key_file", t.KeyFile}, {"client_ca_file", t.ClientCAFile}} {
+		if f.path == "" {
+			if f.key != "client_ca_file" {
+				v.add("server.tls."+f.key, "%s is required for TLS", f.key)
+			}
+		} else if _, err := os.Stat(cfg.ResolvePath(f.path)); err != nil {
+			v.add("server.tls."+f.key, "cannot read %s: %v", f.key, err)
+		}
+	}
+}
+
+func (v *validator) validateLog(cfg *Config) {
+	l := cfg.Server.Log
+	switch l.Level {
+	case "", LogLevelDebug, LogLevelInfo, LogLevelWarn, LogLevelError:
+	default:
+		v.add("server.log.level", "unknown level '%s' (expected debug, info, warn or error)", l.Level)
+	}
+	switch l.Format {
+	case "", LogFormatText, LogFormatJSON:
+	default:
+		v.add("server.log.format", "unknown format '%s' (expected text or json)", l.Format)
+	}
+	for i, pattern := range l.Redact {
+		if _, err := regexp.Compile(pattern); err != nil {
+			v.add(fmt.Sprintf("server.log.redact[%d]", i), "invalid pattern: %v", err)
+		}
+	}
+}
+
+func (v *validator) validateRateLimit(cfg *Config) {
+	rl := cfg.Server.RateLimit
+	if rl.RequestsPerMinute < 0 {
+		v.add("server.rate_limit.requests_per_minute", "requests_per_minute must not be negative")
+	}
+	if rl.Burst < 0 {
+		v.add("server.rate_limit.burst", "burst must not be negative")
+	}
+	if rl.MaxConcurrentRuns < 0 {
+		v.add("server.rate_limit.max_concurrent_runs", "max_concurrent_runs must not be negative")
+	}
+	seen := make(map[string]int)
+	for i, m := range rl.Models {
+		path := fmt.Sprintf("server.rate_limit.models[%d]", i)
+		if first, dup := seen[m.ID]; dup {
+			v.add(path+".id", "duplicate model limit '%s' (first defined at server.rate_limit.models[%d])", m.ID, first)
+		} else {
+			seen[m.ID] = i
+		}
+		if !cfg.hasModel(m.ID) {
+			v.add(path+".id", "limit references unknown model '%s'", m.ID)
+		}
+		if m.MaxConcurrent < 1 {
+			v.add(path+".max_concurrent", "max_concurrent must be at least 1")
+		}
+		if m.MaxQueue < 0 {
+			v.add(path+".max_queue", "max_queue must not be negative")
+		}
+		if _, err := time.ParseDuration(m.QueueTimeout); m.QueueTimeout != "" && err != nil {
+			v.add(path+".queue_timeout", "invalid duration %q", m.QueueTimeout)
+		}
+	}
+}
+
+func (v *validator) validateModels(cfg *Config) {
+	if len(cfg.Models) == 0 {
+		v.add("models", "config must define at least one model")
+		return
+	}
+
+	seen := make(map[string]int)
+	for i, m := range cfg.Models {
+		path := fmt.Sprintf("models[%d]", i)
+		if m.ID == "" {
+			v.add(path+".id", "model must have an id")
+		} else if first, dup := seen[m.ID]; dup {
+			v.add(path+".id", "duplicate model id '%s' (first defined at models[%d])", m.ID, first)
+		} else {
+			seen[m.ID] = i
+		}
+
+		if m.Endpoint == "" {
+			v.add(path+".endpoint", "endpoint is required")
+		} else if u, err := url.Parse(m.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add(path+".endpoint", "invalid endpoint URL %q: must be an absolute http(s) URL", m.Endpoint)
+		}
+
+		if m.APIVendor != "" && !contains(knownVendors, m.APIVendor) {
+			v.add(path+".api_vendor", "unknown api_vendor '%s' (expected one of %s)", m.APIVendor, strings.Join(knownVendors, ", "))
+		}
+
+		if m.ToolsSupported {
+			if m.ToolTagStart == "" {
+				v.add(path+".tool_tag_start", "tool_tag_start is required when tools_supported is true")
+			}
+			if m.ToolTagEnd == "" {
+				v.add(path+".tool_tag_end", "tool_tag_end is required when tools_supported is true")
+			}
+		}
+		// Tool calls are found with the tags whenever both are set, whether or not the model
+		// is declared to support tools.
+		if _, err := m.ToolCallPattern(); err != nil {
+			v.add(path+".tool_tag_start", "%v", err)
+		}
+
+		for j, toolID := range m.Tools {
+			if !cfg.hasTool(toolID) {
+				v.add(fmt.Sprintf("%s.tools[%d]", path, j), "model references unknown tool '%s'", toolID)
+			}
+		}
+	}
+}
+
+func (v *validator) validateTools(cfg *Config) {
+	seen := make(map[string]int)
+	for i, tool := range cfg.Tools {
+		path := fmt.Sprintf("tools[%d]", i)
+		if tool.ID == "" {
+			v.add(path+".id", "tool must have an id")
+			continue
+		}
+		if first, dup := seen[tool.ID]; dup {
+			v.add(path+".id", "duplicate tool id '%s' (first defined at tools[%d])", tool.ID, first)
+			continue
+		}
+		seen[tool.ID] = i
+
+		// For tools that are internal, allow a minimal config (e.g. only 'id' and 'enabled').
+		// The same applies to overrides of tools discovered from MCP servers.
+		if _, isInternal := cfg.Registry().Lookup(tool.ID); isInternal || cfg.isMCPTool(tool.ID) {
+			continue
+		}
+		// An entry that only overrides settings was meant for an internal tool that is
+		// missing, rather than an incomplete external one.
+		if tool.Name == "" && tool.Description == "" && tool.CommandKey == "" && tool.Type == "" && tool.HTTP == nil {
+			dir, err := cfg.Registry().Dir()
+			if err != nil {
+				dir = "the tools directory"
+			}
+			v.add(path+".id", "tool '%s' was not discovered in %s", tool.ID, dir)
+			continue
+		}
+
+		// External tool: require complete configuration.
+		if tool.Name == "" {
+			v.add(path+".name", "incomplete tool configuration for tool with id '%s': name is required", tool.ID)
+		}
+		if tool.Description == "" {
+			v.add(path+".description", "incomplete tool configuration for tool with id '%s': description is required", tool.ID)
+		}
+		switch tool.Type {
+		case "", toolmodel.TypeBinary:
+			if tool.CommandKey == "" {
+				v.add(path+".command_key", "incomplete tool configuration for tool with id '%s': command_key is required", tool.ID)
+			}
+		case toolmodel.TypeHTTP:
+			v.validateHTTPTool(path+".http", tool)
+		case toolmodel.TypeMCP:
+			v.add(path+".type", "mcp tools are discovered from mcp_servers and cannot be declared directly")
+		default:
+			v.add(path+".type", "unknown type '%s' for tool with id '%s'", tool.Type, tool.ID)
+		}
+	}
+}
+
+func (v *validator) validateHTTPTool(path string, tool toolmodel.ToolConfig) {
+	h := tool.HTTP
+	if h == nil || h.URL == "" {
+		v.add(path+".url", "http tool '%s' must define http.url", tool.ID)
+		return
+	}
+	if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.add(path+".url", "invalid url %q: must be an absolute http(s) URL", h.URL)
+	}
+	if h.Method != "" {
+		switch strings.ToUpper(h.Method) {
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete, http.MethodHead:
+		default:
+			v.add(path+".method", "unsupported method '%s'", h.Method)
+		}
+	}
+	if h.Timeout != "" {
+		if _, err := time.ParseDuration(h.Timeout); err != nil {
+			v.add(path+".timeout", "invalid duration %q", h.Timeout)
+		}
+	}
+	if h.MaxResponseBytes < 0 {
+		v.add(path+".max_response_bytes", "max_response_bytes must not be negative")
+	}
+	if h.Auth != nil {
+		switch strings.ToLower(h.Auth.Type) {
+		case "basic", "bearer":
+		case "header":
+			if h.Auth.Header == "" {
+				v.add(path+".auth.header", "auth type 'header' requires a header name")
+			}
+		default:
+			v.add(path+".auth.type", "unsupported auth type '%s' (expected basic, bearer or header)", h.Auth.Type)
+		}
+	}
+}
+
+func (v *validator) validateMCPServers(cfg *Config) {
+	seen := make(map[string]int)
+	for i, srv := range cfg.MCPServers {
+		path := fmt.Sprintf("mcp_servers[%d]", i)
+		if srv.ID == "" {
+			v.add(path+".id", "mcp server must have an id")
+		} else if first, dup := seen[srv.ID]; dup {
+			v.add(path+".id", "duplicate mcp server id '%s' (first defined at mcp_servers[%d])", srv.ID, first)
+		} else {
+			seen[srv.ID] = i
+		}
+		switch srv.Transport {
+		case "stdio":
+			if srv.Command == "" {
+				v.add(path+".command", "mcp server '%s' uses stdio transport but has no command", srv.ID)
+			}
+		case "http":
+			if srv.URL == "" {
+				v.add(path+".url", "mcp server '%s' uses http transport but has no url", srv.ID)
+			}
+		default:
+			v.add(path+".transport", "unknown transport '%s' for mcp server '%s' (expected stdio or http)", srv.Transport, srv.ID)
+		}
+		if srv.Timeout != "" {
+			if _, err := time.ParseDuration(srv.Timeout); err != nil {
+				v.add(path+".timeout", "invalid duration %q", srv.Timeout)
+			}
+		}
+	}
+}
+
+func (v *validator) validateAuth(cfg *Config) {
+	scopes := []string{ScopeChat, ScopeToolsExecute, ScopeAdmin}
+	seen := make(map[string]int)
+	keys := make(map[string]int)
+	for i, k := range cfg.Auth.APIKeys {
+		path := fmt.Sprintf("auth.api_keys[%d]", i)
+		if k.ID == "" {
+			v.add(path+".id", "api key must have an id")
+		} else if first, dup := seen[k.ID]; dup {
+			v.add(path+".id", "duplicate api key id '%s' (first defined at auth.api_keys[%d])", k.ID, first)
+		} else {
+			seen[k.ID] = i
+		}
+		if k.Key == "" {
+			v.add(path+".key", "api key '%s' has no key", k.ID)
+		} else if first, dup := keys[k.Key]; dup {
+			v.add(path+".key", "api key '%s' reuses the key of auth.api_keys[%d]", k.ID, first)
+		} else {
+			keys[k.Key] = i
+		}
+		for j, scope := range k.Scopes {
+			if !contains(scopes, scope) {
+				v.add(fmt.Sprintf("%s.scopes[%d]", path, j), "unknown scope '%s' (expected one of %s)", scope, strings.Join(scopes, ", "))
+			}
+		}
+	}
+	if jwt := cfg.Auth.JWT; jwt != nil {
+		if jwt.JWKSFile == "" {
+			v.add("auth.jwt.jwks_file", "jwks_file is required for JWT authentication")
+		} else if _, err := os.Stat(cfg.ResolvePath(jwt.JWKSFile)); err != nil {
+			v.add("auth.jwt.jwks_file", "cannot read JWKS file: %v", err)
+		}
+	}
+}
+
+// ResolvePath returns path relative to the directory of the config file, unless it is absolute.
+func (c *Config) ResolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) || c.Path == "" {
+		return path
+	}
+	return filepath.Join(filepath.Dir(c.Path), path)
+}
+
+// hasModel reports whether id names a configured model.
+func (c *Config) hasModel(id string) bool {
+	for _, m := range c.Models {
+		if m.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTool reports whether id names a registered tool, a configured tool or a tool of a declared MCP server.
+func (c *Config) hasTool(id string) bool {
+	if _, ok := c.Registry().Lookup(id); ok {
+		return true
+	}
+	for _, tool := range c.Tools {
+		if tool.ID == id {
+			return true
+		}
+	}
+	return c.isMCPTool(id)
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,449 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"krackenservices.com/agentAI/internal/auth"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// ConfigStore is implemented by the component that owns the live configuration and can
+// swap in a new one after the admin API changes it.
+type ConfigStore interface {
+	ConfigReloader
+	// Config returns the live configuration.
+	Config() *config.Config
+}
+
+// adminMu serialises changes made through the admin API, so that each one is validated
+// against the state it replaces.
+var adminMu sync.Mutex
+
+// RequireAdmin only lets requests through whose credentials have the admin scope: an API
+// key or JWT granting it, or the admin token (server.admin_token). The admin API is disabled
+// when neither authentication nor an admin token is configured.
+func RequireAdmin(store ConfigStore, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := store.Config()
+		if !cfg.Auth.Enabled() && cfg.Server.AdminToken == "" {
+			problem.Error(w, r, http.StatusForbidden, "admin API is disabled: set server.admin_token or configure auth")
+			return
+		}
+		authorizeAdmin(cfg, next)(w, r)
+	}
+}
+
+// RequireAdminIfSecured requires the admin scope like RequireAdmin once authentication or an
+// admin token is configured, and lets every request through otherwise.
+func RequireAdminIfSecured(store ConfigStore, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := store.Config()
+		if !cfg.Auth.Enabled() && cfg.Server.AdminToken == "" {
+			next(w, r)
+			return
+		}
+		authorizeAdmin(cfg, next)(w, r)
+	}
+}
+
+// authorizeAdmin authenticates the request against cfg and requires the admin scope. The
+// admin routes are served outside the router of the live configuration, so they
+// authenticate for themselves.
+func authorizeAdmin(cfg *config.Config, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authn, err := auth.ForConfig(cfg)
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+		authn.Middleware(auth.Require(config.ScopeAdmin, next)).ServeHTTP(w, r)
+	}
+}
+
+// checkPreconditions enforces optimistic concurrency: changing or deleting an existing entry
+// requires If-Match with its current ETag, and If-None-Match: * only allows creating.
+// It writes the error response and returns false if the request must not proceed.
+func checkPreconditions(w http.ResponseWriter, r *http.Request, exists bool, etag string) bool {
+	ifMatch := r.Header.Get("If-Match")
+	if exists && ifMatch == "" && r.Method != http.MethodPost {
+		problem.Error(w, r, http.StatusPreconditionRequired, "If-Match with the current ETag is required")
+		return false
+	}
+	if ifMatch != "" && (!exists || (ifMatch != "*" && ifMatch != etag)) {
+		problem.Error(w, r, http.StatusPreconditionFailed, "the entry was changed by another request; fetch it again")
+		return false
+	}
+	if r.Header.Get("If-None-Match") == "*" && exists {
+		problem.Error(w, r, http.StatusPreconditionFailed, "the entry already exists")
+		return false
+	}
+	return true
+}
+
+// applyState validates the configuration that results from changing the admin state,
+// persists the new state and swaps the configuration in. It writes the error response and
+// returns false on failure.
+func applyState(w http.ResponseWriter, r *http.Request, store ConfigStore, change func(*config.State)) bool {
+	cfg := store.Config()
+	state, err := cfg.LoadState()
+	if err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	previous := state.Clone()
+	change(state)
+
+	// Validate with the same rules as LoadConfig before anything is written.
+	if _, err := config.LoadConfigWithState(cfg.Path, state); err != nil {
+		var problems config.ValidationErrors
+		if errors.As(err, &problems) {
+			problem.Write(w, r, problem.Invalid("the change would make the configuration invalid", problems))
+			return false
+		}
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if err := cfg.SaveState(state); err != nil {
+		problem.Error(w, r, http.StatusInternalServerError, err.Error())
+		return false
+	}
+	if err := store.Reload("admin"); err != nil {
+		// The config files changed underneath us; put the previous state back.
+		if rbErr := cfg.SaveState(previous); rbErr != nil {
+			slog.Error("Error restoring admin state", "error", rbErr)
+		}
+		problem.Error(w, r, http.StatusConflict, fmt.Sprintf("error applying change: %v", err))
+		return false
+	}
+	return true
+}
+
+// decodeEntry decodes a request body into out, rejecting unknown fields.
+func decodeEntry(r *http.Request, out interface{}) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	return dec.Decode(out)
+}
+
+// patchEntry applies a JSON merge patch (RFC 7386) from the request body to entry.
+// Field names match case-insensitively, as they do when decoding. The patched entry is
+// decoded into a zeroed entry, so that the maps it shared with the original are unchanged.
+func patchEntry(r *http.Request, entry interface{}) error {
+	var patch map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	var target map[string]interface{}
+	if err := json.Unmarshal(data, &target); err != nil {
+		return err
+	}
+	mergePatch(target, patch)
+	if data, err = json.Marshal(target); err != nil {
+		return err
+	}
+	reflect.ValueOf(entry).Elem().SetZero()
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	return dec.Decode(entry)
+}
+
+func mergePatch(target, patch map[string]interface{}) {
+	for k, v := range patch {
+		for existing := range target {
+			if strings.EqualFold(existing, k) && existing != k {
+				target[k] = target[existing]
+				delete(target, existing)
+			}
+		}
+		if v == nil {
+			delete(target, k)
+			continue
+		}
+		if pv, ok := v.(map[string]interface{}); ok {
+			if tv, ok := target[k].(map[string]interface{}); ok {
+				mergePatch(tv, pv)
+				continue
+			}
+		}
+		target[k] = v
+	}
+}
+
+// unmaskHeaders replaces "<masked>" values (as returned by GET) with the current values.
+func unmaskHeaders(headers, current map[string]string) {
+	for k, v := range headers {
+		if v == config.Masked {
+			headers[k] = current[k]
+		}
+	}
+}
+
+// unmaskArgs replaces "<masked>" argument defaults (as returned by GET) with the current
+// values. Defaults without a current value come from the discovered tool, and are dropped
+// so that it applies again.
+func unmaskArgs(args, current map[string]interface{}) {
+	for k, v := range args {
+		if v != config.Masked {
+			continue
+		}
+		if c, ok := current[k]; ok {
+			args[k] = c
+		} else {
+			delete(args, k)
+		}
+	}
+}
+
+// AdminModelHandler godoc
+// @Summary Create, replace, update or delete a model
+// @Description Changes are validated with the same rules as the config file, applied live and persisted to the state file (server.state_file). PUT, PATCH (JSON merge patch) and DELETE of an existing model require If-Match with the ETag from GET /api/v1/models/{id}. Masked values sent back unchanged keep their current value. Requires the admin scope.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Model ID"
+// @Param model body config.ModelConfig false "Model (POST, PUT) or merge patch (PATCH)"
+// @Param If-Match header string false "Current ETag of the model"
+// @Success 200 {object} config.ModelConfig
+// @Success 201 {object} config.ModelConfig
+// @Success 204 "Deleted"
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 412 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 428 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/models/{id} [post]
+// @Router /api/v1/models/{id} [put]
+// @Router /api/v1/models/{id} [patch]
+// @Router /api/v1/models/{id} [delete]
+func AdminModelHandler(store ConfigStore) http.HandlerFunc {
+	return RequireAdmin(store, func(w http.ResponseWriter, r *http.Request) {
+		adminMu.Lock()
+		defer adminMu.Unlock()
+
+		id := r.PathValue("id")
+		cfg := store.Config()
+		current, exists := cfg.RawModel(id)
+		if r.Method == http.MethodPost && exists {
+			problem.Error(w, r, http.StatusConflict, fmt.Sprintf("model '%s' already exists", id))
+			return
+		}
+		if !exists && (r.Method == http.MethodPatch || r.Method == http.MethodDelete) {
+			problem.Error(w, r, http.StatusNotFound, fmt.Sprintf("model %q not found", id))
+			return
+		}
+		if !checkPreconditions(w, r, exists, config.ETag(current)) {
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			if applyState(w, r, store, func(s *config.State) { s.DeleteModel(id) }) {
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+
+		var model config.ModelConfig
+		var err error
+		if r.Method == http.MethodPatch {
+			model = current
+			err = patchEntry(r, &model)
+		} else {
+			err = decodeEntry(r, &model)
+		}
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, fmt.Sprintf("invalid model: %v", err))
+			return
+		}
+		if model.ID != "" && model.ID != id {
+			problem.Error(w, r, http.StatusBadRequest, "the model id cannot be changed")
+			return
+		}
+		model.ID = id
+		if model.APIKey == config.Masked {
+			model.APIKey = current.APIKey
+		}
+		unmaskHeaders(model.Headers, current.Headers)
+
+		if !applyState(w, r, store, func(s *config.State) { s.PutModel(model) }) {
+			return
+		}
+		status := http.StatusOK
+		if !exists {
+			status = http.StatusCreated
+		}
+		writeModel(w, r, store.Config(), id, status)
+	})
+}
+
+// writeModel writes the live model with its ETag.
+func writeModel(w http.ResponseWriter, r *http.Request, cfg *config.Config, id string, status int) {
+	for _, model := range cfg.Models {
+		if model.ID == id {
+			raw, _ := cfg.RawModel(id)
+			w.Header().Set("ETag", config.ETag(raw))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(maskModel(cfg, model))
+			return
+		}
+	}
+	problem.Error(w, r, http.StatusNotFound, fmt.Sprintf("model %q not found", id))
+}
+
+// AdminToolHandler godoc
+// @Summary Create, replace, update or delete a tool entry
+// @Description Manages the config entry of a tool: a complete definition for external tools, or an override (e.g. enabled) for discovered tools. Changes are validated, applied live and persisted to the state file. PUT, PATCH (JSON merge patch) and DELETE of an existing entry require If-Match with the ETag from GET /api/v1/tools/{id}. Requires the admin scope.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Param id path string true "Tool ID"
+// @Param tool body toolmodel.ToolConfig false "Tool entry (POST, PUT) or merge patch (PATCH)"
+// @Param If-Match header string false "Current ETag of the tool entry"
+// @Success 200 {object} toolmodel.ToolConfig
+// @Success 201 {object} toolmodel.ToolConfig
+// @Success 204 "Deleted"
+// @Failure 400 {object} problem.Problem
+// @Failure 401 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem
+// @Failure 412 {object} problem.Problem
+// @Failure 422 {object} problem.Problem
+// @Failure 428 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/tools/{id} [post]
+// @Router /api/v1/tools/{id} [put]
+// @Router /api/v1/tools/{id} [patch]
+// @Router /api/v1/tools/{id} [delete]
+func AdminToolHandler(store ConfigStore) http.HandlerFunc {
+	return RequireAdmin(store, func(w http.ResponseWriter, r *http.Request) {
+		adminMu.Lock()
+		defer adminMu.Unlock()
+
+		id := r.PathValue("id")
+		cfg := store.Config()
+		current, exists := cfg.RawTool(id)
+		if r.Method == http.MethodPost && exists {
+			problem.Error(w, r, http.StatusConflict, fmt.Sprintf("tool '%s' already exists", id))
+			return
+		}
+		if !exists && (r.Method == http.MethodPatch || r.Method == http.MethodDelete) {
+			problem.Error(w, r, http.StatusNotFound, fmt.Sprintf("tool %q not found", id))
+			return
+		}
+		if !checkPreconditions(w, r, exists, toolETag(cfg, id)) {
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			if applyState(w, r, store, func(s *config.State) { s.DeleteTool(id) }) {
+				w.WriteHeader(http.StatusNoContent)
+			}
+			return
+		}
+
+		var tool toolmodel.ToolConfig
+		var err error
+		if r.Method == http.MethodPatch {
+			tool = current
+			err = patchEntry(r, &tool)
+		} else {
+			err = decodeEntry(r, &tool)
+		}
+		if err != nil {
+			problem.Error(w, r, http.StatusBadRequest, fmt.Sprintf("invalid tool: %v", err))
+			return
+		}
+		if tool.ID != "" && tool.ID != id {
+			problem.Error(w, r, http.StatusBadRequest, "the tool id cannot be changed")
+			return
+		}
+		tool.ID = id
+		unmaskArgs(tool.CommandArgs, current.CommandArgs)
+		if tool.HTTP != nil && current.HTTP != nil {
+			if tool.HTTP.URL == config.Masked {
+				tool.HTTP.URL = current.HTTP.URL
+			}
+			unmaskHeaders(tool.HTTP.Headers, current.HTTP.Headers)
+			if a, c := tool.HTTP.Auth, current.HTTP.Auth; a != nil && c != nil {
+				if a.Password == config.Masked {
+					a.Password = c.Password
+				}
+				if a.Token == config.Masked {
+					a.Token = c.Token
+				}
+			}
+		}
+
+		if !applyState(w, r, store, func(s *config.State) { s.PutTool(tool) }) {
+			return
+		}
+		status := http.StatusOK
+		if !exists {
+			status = http.StatusCreated
+		}
+		writeTool(w, r, store.Config(), id, status)
+	})
+}
+
+// toolETag returns the ETag of the config entry of a tool; tools without an entry share
+// the ETag of an empty entry.
+func toolETag(cfg *config.Config, id string) string {
+	raw, _ := cfg.RawTool(id)
+	return config.ETag(raw)
+}
+
+// writeTool writes the tool as offered by the catalogue, with the ETag of its config entry.
+func writeTool(w http.ResponseWriter, r *http.Request, cfg *config.Config, id string, status int) {
+	for _, tool := range AvailableTools(cfg) {
+		if tool.ID == id {
+			w.Header().Set("ETag", toolETag(cfg, id))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(maskTool(cfg, tool))
+			return
+		}
+	}
+	problem.Error(w, r, http.StatusNotFound, fmt.Sprintf("tool %q not found", id))
+}
+
+// GetTool godoc
+// @Summary Get tool details
+// @Description Returns a tool of the catalogue with webhook credentials masked. The ETag identifies its config entry for the admin API.
+// @Tags tools
+// @Produce json
+// @Param id path string true "Tool ID"
+// @Success 200 {object} toolmodel.ToolConfig
+// @Failure 404 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/tools/{id} [get]
+func GetTool(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if !auth.FromContext(r.Context()).AllowsTool(id) {
+			problem.Error(w, r, http.StatusNotFound, fmt.Sprintf("tool %q not found", id))
+			return
+		}
+		writeTool(w, r, cfg, id, http.StatusOK)
+	}
+}
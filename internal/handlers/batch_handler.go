@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync/atomic"
+
+	"krackenservices.com/agentAI/internal/agent"
+	"krackenservices.com/agentAI/internal/auth"
+	"krackenservices.com/agentAI/internal/batch"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/ratelimit"
+	"krackenservices.com/agentAI/internal/usage"
+)
+
+// NDJSON is the media type of batch inputs and results, one JSON object per line.
+const NDJSON = "application/x-ndjson"
+
+// BatchExecutor returns the executor of the lines of a batch of caller: each line is a chat
+// with the models and tools caller may use, charged to caller's budgets and holding a slot
+// of its model like any chat. Lines rejected by a budget or a busy model fail with a 429.
+func BatchExecutor(cfg *config.Config, caller *auth.Principal) batch.Executor {
+	return func(ctx context.Context, req batch.Request) (string, agent.Result, error) {
+		ctx = auth.NewContext(ctx, caller)
+		run, err := NewRun(ctx, cfg, caller.Key(), req.Model, caller.AllowsModel, AllowedTools(ctx, EnabledTools(cfg)))
+		var budgetErr *usage.BudgetError
+		if errors.As(err, &budgetErr) {
+			return "", agent.Result{}, problem.New(http.StatusTooManyRequests, err.Error())
+		}
+		if err != nil {
+			return "", agent.Result{}, err
+		}
+		release, err := ratelimit.Default.AcquireModel(ctx, &cfg.Server.RateLimit, run.Model.ID)
+		if err != nil {
+			return "", agent.Result{}, problem.New(http.StatusTooManyRequests, fmt.Sprintf("model %q: %v", run.Model.ID, err))
+		}
+		defer release()
+		result, err := run.Chat(ctx, []llm.Message{{Role: agent.RoleUser, Content: req.Message}})
+		return run.Model.ID, result, err
+	}
+}
+
+// liveConfig is the configuration the lines of batches run with, as installed by
+// SetLiveConfig. Until the server installs one, batches run with the configuration they
+// were submitted or resumed with.
+var liveConfig atomic.Pointer[config.Config]
+
+// SetLiveConfig makes cfg the configuration the next lines of every batch run with. The
+// server calls it at startup and on every reload, so that running batches pick up changes
+// to models, tools, keys and budgets.
+func SetLiveConfig(cfg *config.Config) {
+	liveConfig.Store(cfg)
+}
+
+// lookupPrincipal returns the principal with the key in cfg.
+func lookupPrincipal(cfg *config.Config, principal string) (*auth.Principal, error) {
+	authn, err := auth.ForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	caller, ok := authn.Lookup(principal)
+	if !ok {
+		return nil, fmt.Errorf("principal %q no longer exists", principal)
+	}
+	return caller, nil
+}
+
+// runBatch runs the batch with the ID in the background until it finishes. Each line runs
+// with the live configuration and the permissions the principal that submitted it has
+// then. The batch fails if the principal no longer exists when it starts; lines started
+// after it is removed fail with a 403.
+func runBatch(cfg *config.Config, id string) {
+	current := func() *config.Config {
+		if live := liveConfig.Load(); live != nil {
+			return live
+		}
+		return cfg
+	}
+	go func() {
+		exec := func(principal string) (batch.Executor, error) {
+			if _, err := lookupPrincipal(current(), principal); err != nil {
+				return nil, err
+			}
+			return func(ctx context.Context, req batch.Request) (string, agent.Result, error) {
+				cfg := current()
+				caller, err := lookupPrincipal(cfg, principal)
+				if err != nil {
+					return "", agent.Result{}, problem.New(http.StatusForbidden, err.Error())
+				}
+				return BatchExecutor(cfg, caller)(ctx, req)
+			}, nil
+		}
+		if err := batch.Default.Run(context.Background(), id, exec); err != nil {
+			slog.Error("Batch failed", "batch", id, "error", err)
+		}
+	}()
+}
+
+// ResumeBatches resumes the batches that were running when the server stopped.
+func ResumeBatches(cfg *config.Config) {
+	ids := batch.Default.Running()
+	for _, id := range ids {
+		runBatch(cfg, id)
+	}
+	if len(ids) > 0 {
+		slog.Info("Resuming batches", "count", len(ids))
+	}
+}
+
+// ownBatch returns the batch of the path if the caller submitted it or sees everything,
+// and writes a 404 problem otherwise.
+func ownBatch(w http.ResponseWriter, r *http.Request) (batch.Job, bool) {
+	id := r.PathValue("id")
+	job, ok := batch.Default.Get(id)
+	if !ok || (job.Principal != principalID(r) && !seesEverything(r)) {
+		problem.Error(w, r, http.StatusNotFound, fmt.Sprintf("batch %q not found", id))
+		return batch.Job{}, false
+	}
+	return job, true
+}
+
+// CreateBatch godoc
+// @Summary Submit a batch of chats
+// @Description Runs a chat for every line of the body, a JSON object {"id", "model", "message"}, in the background with bounded concurrency. Each line is a chat of the caller, subject to the same permissions, budgets and model limits. Progress and a summary of latency, tokens and failures are at the returned Location; the results, one JSON line per request in the order they finish, at Location/results. Batches resume after a restart.
+// @Tags batches
+// @Accept application/x-ndjson
+// @Produce json
+// @Param requests body string true "One request per line"
+// @Param concurrency query int false "Lines run at a time, at most the configured batches.concurrency"
+// @Success 202 {object} batch.Job
+// @Failure 400 {object} problem.Problem
+// @Failure 413 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/batches [post]
+func CreateBatch(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		concurrency := cfg.Batches.Concurrency
+		if concurrency == 0 {
+			concurrency = batch.DefaultConcurrency
+		}
+		if v := r.URL.Query().Get("concurrency"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				problem.Error(w, r, http.StatusBadRequest, fmt.Sprintf("invalid concurrency %q: must be a positive integer", v))
+				return
+			}
+			concurrency = min(n, concurrency)
+		}
+		limit := cfg.Batches.MaxInputBytes
+		if limit == 0 {
+			limit = batch.DefaultMaxInput
+		}
+		job, err := batch.Default.Create(principalID(r), concurrency, http.MaxBytesReader(w, r.Body, limit))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			problem.Error(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("the batch is larger than %d bytes", tooLarge.Limit))
+			return
+		}
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		if job.Total == 0 {
+			batch.Default.Delete(job.ID)
+			problem.Error(w, r, http.StatusBadRequest, "the batch has no requests")
+			return
+		}
+		runBatch(cfg, job.ID)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", r.URL.Path+"/"+job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(job)
+	}
+}
+
+// ListBatches godoc
+// @Summary List batches
+// @Description Returns the caller's batches (every batch with the admin scope), most recently submitted first.
+// @Tags batches
+// @Produce json
+// @Success 200 {array} batch.Job
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/batches [get]
+func ListBatches(w http.ResponseWriter, r *http.Request) {
+	principal := principalID(r)
+	if seesEverything(r) {
+		principal = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(batch.Default.List(principal))
+}
+
+// GetBatch godoc
+// @Summary Get a batch
+// @Description Returns the status and progress of a batch, with a summary of the results so far.
+// @Tags batches
+// @Produce json
+// @Param id path string true "Batch ID"
+// @Success 200 {object} batch.Job
+// @Failure 404 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/batches/{id} [get]
+func GetBatch(w http.ResponseWriter, r *http.Request) {
+	job, ok := ownBatch(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// BatchResults godoc
+// @Summary Get the results of a batch
+// @Description Returns a JSON line per finished request, in the order they finished, with the reply or the error of the line.
+// @Tags batches
+// @Produce application/x-ndjson
+// @Param id path string true "Batch ID"
+// @Success 200 {array} batch.Result
+// @Failure 404 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/batches/{id}/results [get]
+func BatchResults(w http.ResponseWriter, r *http.Request) {
+	job, ok := ownBatch(w, r)
+	if !ok {
+		return
+	}
+	path, _ := batch.Default.Results(job.ID)
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		problem.WriteError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", NDJSON)
+	if f != nil {
+		defer f.Close()
+		io.Copy(w, f)
+	}
+}
+
+// DeleteBatch godoc
+// @Summary Delete a batch
+// @Description Stops the batch if it is running and deletes it with its results.
+// @Tags batches
+// @Param id path string true "Batch ID"
+// @Success 204
+// @Failure 404 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/batches/{id} [delete]
+func DeleteBatch(w http.ResponseWriter, r *http.Request) {
+	job, ok := ownBatch(w, r)
+	if !ok {
+		return
+	}
+	if _, err := batch.Default.Delete(job.ID); err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,154 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"krackenservices.com/agentAI/internal/auth"
+	"krackenservices.com/agentAI/internal/batch"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+)
+
+func TestBatches(t *testing.T) {
+	if err := batch.Default.Open(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{
+		Models: []config.ModelConfig{{ID: "local", Endpoint: "http://127.0.0.1:8080/"}, {ID: "other", Endpoint: "http://127.0.0.1:8080/"}},
+		Auth: config.AuthConfig{APIKeys: []config.APIKeyConfig{
+			{ID: "ci", Key: "ci-key", Scopes: []string{config.ScopeChat}, Models: []string{"local"}},
+			{ID: "ops", Key: "ops-key", Scopes: []string{config.ScopeChat}},
+		}},
+		Batches: config.BatchesConfig{MaxInputBytes: 1024},
+	}
+	authn, err := auth.ForConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/batches", handlers.CreateBatch(cfg))
+	mux.HandleFunc("GET /api/v1/batches", handlers.ListBatches)
+	mux.HandleFunc("GET /api/v1/batches/{id}", handlers.GetBatch)
+	mux.HandleFunc("DELETE /api/v1/batches/{id}", handlers.DeleteBatch)
+	mux.HandleFunc("GET /api/v1/batches/{id}/results", handlers.BatchResults)
+	h := authn.Middleware(mux)
+	serve := func(method, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve(http.MethodPost, "/api/v1/batches", "ci-key", "\n\n"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a batch without requests, got %d", rr.Code)
+	}
+	if rr := serve(http.MethodPost, "/api/v1/batches?concurrency=0", "ci-key", `{"model": "local", "message": "hi"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid concurrency, got %d", rr.Code)
+	}
+	large := strings.Repeat(`{"model": "local", "message": "hi"}`+"\n", 100)
+	if rr := serve(http.MethodPost, "/api/v1/batches", "ops-key", large); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a batch over batches.max_input_bytes, got %d", rr.Code)
+	}
+	if list := batch.Default.List(""); len(list) != 0 {
+		t.Errorf("expected the batch over the limit not to be kept, got %+v", list)
+	}
+
+	input := `{"id": "a", "model": "local", "message": "hello"}
+{"id": "b", "model": "other", "message": "hello"}
+not json
+`
+	rr := serve(http.MethodPost, "/api/v1/batches?concurrency=2", "ci-key", input)
+	var job batch.Job
+	json.NewDecoder(rr.Body).Decode(&job)
+	if rr.Code != http.StatusAccepted || job.Principal != "api_key:ci" || job.Total != 3 || job.Concurrency != 2 {
+		t.Fatalf("expected an accepted batch of 3 requests, got %d %+v", rr.Code, job)
+	}
+	if loc := rr.Header().Get("Location"); loc != "/api/v1/batches/"+job.ID {
+		t.Errorf("expected the location of the batch, got %q", loc)
+	}
+	path := "/api/v1/batches/" + job.ID
+
+	for deadline := time.Now().Add(5 * time.Second); job.Status == batch.StatusRunning && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		json.NewDecoder(serve(http.MethodGet, path, "ci-key", "").Body).Decode(&job)
+	}
+	if job.Status != batch.StatusCompleted || job.Done != 3 || job.Summary.Succeeded != 1 || job.Summary.Failed != 2 {
+		t.Fatalf("expected a completed batch with a success and 2 failures, got %+v", job)
+	}
+
+	rr = serve(http.MethodGet, path+"/results", "ci-key", "")
+	if rr.Header().Get("Content-Type") != handlers.NDJSON {
+		t.Errorf("expected NDJSON, got %q", rr.Header().Get("Content-Type"))
+	}
+	results := map[string]batch.Result{}
+	for _, line := range strings.Split(strings.TrimSpace(rr.Body.String()), "\n") {
+		var r batch.Result
+		json.Unmarshal([]byte(line), &r)
+		results[r.ID] = r
+	}
+	if r := results["a"]; r.Failed() || r.Output == "" || r.Model != "local" {
+		t.Errorf("expected a reply to a, got %+v", r)
+	}
+	// The model of b is not allowed to ci; line 3 is not a request.
+	if r := results["b"]; r.Status != http.StatusForbidden {
+		t.Errorf("expected b to be forbidden, got %+v", r)
+	}
+	if r := results["3"]; r.Status != http.StatusBadRequest {
+		t.Errorf("expected line 3 to be invalid, got %+v", r)
+	}
+
+	// Other principals cannot see it.
+	if rr := serve(http.MethodGet, path, "ops-key", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another principal, got %d", rr.Code)
+	}
+	var list []batch.Job
+	json.NewDecoder(serve(http.MethodGet, "/api/v1/batches", "ops-key", "").Body).Decode(&list)
+	if len(list) != 0 {
+		t.Errorf("expected no batches for ops, got %+v", list)
+	}
+
+	// A batch resumed after its key was removed fails instead of running with the old key.
+	gone, err := batch.Default.Create("api_key:gone", 1, strings.NewReader(`{"model": "local", "message": "hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers.ResumeBatches(cfg)
+	for deadline := time.Now().Add(5 * time.Second); gone.Status == batch.StatusRunning && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		gone, _ = batch.Default.Get(gone.ID)
+	}
+	if gone.Status != batch.StatusFailed || gone.Done != 0 || !strings.Contains(gone.Error, "no longer exists") {
+		t.Errorf("expected the batch of a removed key to fail, got %+v", gone)
+	}
+
+	// Lines run with the live configuration rather than the one the batch was submitted with.
+	reloaded := *cfg
+	reloaded.Models = cfg.Models[1:]
+	handlers.SetLiveConfig(&reloaded)
+	t.Cleanup(func() { handlers.SetLiveConfig(nil) })
+	stale, err := batch.Default.Create("api_key:ops", 1, strings.NewReader(`{"id": "a", "model": "local", "message": "hi"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	handlers.ResumeBatches(cfg)
+	for deadline := time.Now().Add(5 * time.Second); stale.Status == batch.StatusRunning && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		stale, _ = batch.Default.Get(stale.ID)
+	}
+	if stale.Status != batch.StatusCompleted || stale.Summary.Failed != 1 {
+		t.Errorf("expected the line to fail with the model removed by the reload, got %+v", stale)
+	}
+
+	if rr := serve(http.MethodDelete, path, "ci-key", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rr.Code)
+	}
+	if rr := serve(http.MethodGet, path+"/results", "ci-key", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected the batch to be deleted, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"gopkg.in/yaml.v3"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// EffectiveConfig is the merged configuration the server is running with.
+// swagger:model EffectiveConfig
+type EffectiveConfig struct {
+	Path string `json:"path" example:"/opt/agentAI/config.yml"`
+	Env  string `json:"env" example:"production"`
+	// Files lists the merged files in the order they were applied.
+	Files []string `json:"files"`
+	// Config is the merged configuration, with defaults applied and secrets masked.
+	Config map[string]interface{} `json:"config"`
+	// Sources maps each value read from a file to its "file:line"; defaults and discovered tools have no entry.
+	Sources map[string]string `json:"sources" example:"models[0].endpoint:/opt/agentAI/conf.d/10-models.yml:4"`
+}
+
+// ConfigSchemaHandler godoc
+// @Summary Configuration JSON Schema
+// @Description Returns the JSON Schema of the configuration file, for editor completion and validation of config.yml/config.json.
+// @Tags config
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Router /api/v1/config/schema [get]
+func ConfigSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(config.Schema())
+}
+
+// EffectiveConfigHandler godoc
+// @Summary Effective configuration
+// @Description Returns the configuration after merging includes, conf.d fragments and the environment overlay, with the file and line each value came from. Secrets are masked.
+// @Tags config
+// @Produce json
+// @Success 200 {object} EffectiveConfig
+// @Failure 500 {object} problem.Problem "Error encoding configuration"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/config/effective [get]
+func EffectiveConfigHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		effective, err := Effective(cfg)
+		if err != nil {
+			problem.Error(w, r, http.StatusInternalServerError, fmt.Sprintf("encoding the configuration: %v", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(effective)
+	}
+}
+
+// Effective returns the merged configuration of cfg with secrets masked, as served by
+// /api/v1/config/effective.
+func Effective(cfg *config.Config) (EffectiveConfig, error) {
+	masked, err := maskConfig(cfg)
+	if err != nil {
+		return EffectiveConfig{}, err
+	}
+	return EffectiveConfig{
+		Path:    cfg.Path,
+		Env:     cfg.Server.Env,
+		Files:   cfg.Files,
+		Config:  masked,
+		Sources: cfg.Sources(),
+	}, nil
+}
+
+// maskConfig returns the configuration with secrets masked, keyed as in the config file.
+func maskConfig(cfg *config.Config) (map[string]interface{}, error) {
+	c := config.Config{
+		Version:  cfg.Version,
+		Server:   cfg.Server,
+		Tools:    maskTools(cfg, cfg.Tools),
+		Auth:     config.AuthConfig{JWT: cfg.Auth.JWT},
+		Usage:    cfg.Usage,
+		Sessions: cfg.Sessions,
+		Batches:  cfg.Batches,
+	}
+	if c.Server.AdminToken != "" {
+		c.Server.AdminToken = config.Masked
+	}
+	c.Server.Tracing.Headers = cfg.MaskHeaders(cfg.Server.Tracing.Headers)
+	for _, k := range cfg.Auth.APIKeys {
+		k.Key = config.Masked
+		c.Auth.APIKeys = append(c.Auth.APIKeys, k)
+	}
+	for _, m := range cfg.Models {
+		c.Models = append(c.Models, maskModel(cfg, m))
+	}
+	for _, s := range cfg.MCPServers {
+		c.MCPServers = append(c.MCPServers, maskMCPServer(cfg, s))
+	}
+
+	// Round-trip through YAML so the keys match the file rather than the Go field names.
+	data, err := yaml.Marshal(&c)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]interface{}
+	if err := yaml.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// maskMCPServer returns a copy of the server declaration with credentials masked.
+func maskMCPServer(cfg *config.Config, s toolmodel.MCPServerConfig) toolmodel.MCPServerConfig {
+	s.Env = cfg.MaskHeaders(s.Env)
+	s.Headers = cfg.MaskHeaders(s.Headers)
+	if cfg.IsSecret(s.URL) {
+		s.URL = config.Masked
+	}
+	if s.Args != nil {
+		args := make([]string, len(s.Args))
+		for i, arg := range s.Args {
+			args[i] = arg
+			if cfg.IsSecret(arg) {
+				args[i] = config.Masked
+			}
+		}
+		s.Args = args
+	}
+	return s
+}
@@ -0,0 +1,73 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+)
+
+// TestEffectiveConfigHandler verifies that the merged config is returned masked, with sources.
+func TestEffectiveConfigHandler(t *testing.T) {
+	t.Setenv("AGENTAI_TEST_MCP_TOKEN", "mcp-live")
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yml")
+	os.WriteFile(path, []byte(`models:
+  - id: local
+    endpoint: http://127.0.0.1:8080/
+    api_key: sk-live
+sessions:
+  dir: sessions
+batches:
+  concurrency: 2
+mcp_servers:
+  - id: github
+    transport: stdio
+    command: github-mcp-server
+    args: ["--token=${AGENTAI_TEST_MCP_TOKEN}"]
+    env:
+      GITHUB_TOKEN: ghp-live
+`), 0644)
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+	if !cfg.IsSecret("mcp-live") {
+		t.Error("expected the variable in the MCP server arguments to be a secret, for the log redactor")
+	}
+
+	rr := httptest.NewRecorder()
+	handlers.EffectiveConfigHandler(cfg)(rr, httptest.NewRequest(http.MethodGet, "/api/v1/config/effective", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rr.Code)
+	}
+	for _, secret := range []string{"sk-live", "ghp-live", "mcp-live"} {
+		if strings.Contains(rr.Body.String(), secret) {
+			t.Errorf("expected %q to be masked in %s", secret, rr.Body.String())
+		}
+	}
+
+	var effective handlers.EffectiveConfig
+	if err := json.Unmarshal(rr.Body.Bytes(), &effective); err != nil {
+		t.Fatalf("error decoding response: %v", err)
+	}
+	server := effective.Config["server"].(map[string]interface{})
+	if server["port"] != "8080" || effective.Env != "development" {
+		t.Errorf("expected defaults in the effective config, got %v", effective.Config)
+	}
+	if sessions, _ := effective.Config["sessions"].(map[string]interface{}); sessions["dir"] != "sessions" {
+		t.Errorf("expected the sessions section in the effective config, got %v", effective.Config)
+	}
+	if batches, _ := effective.Config["batches"].(map[string]interface{}); batches["concurrency"] != 2.0 {
+		t.Errorf("expected the batches section in the effective config, got %v", effective.Config)
+	}
+	if src := effective.Sources["models[0].endpoint"]; src != path+":3" {
+		t.Errorf("expected endpoint source %s:3, got %q", path, src)
+	}
+}
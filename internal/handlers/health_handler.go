@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"krackenservices.com/agentAI/internal/auth"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/toolmodel"
+	"krackenservices.com/agentAI/internal/version"
+)
+
+// started is when the server process started.
+var started = time.Now()
+
+// Check is the outcome of one readiness check.
+type Check struct {
+	Name  string `json:"name" example:"tool:fstool"`
+	OK    bool   `json:"ok" example:"true"`
+	Error string `json:"error,omitempty" example:""`
+}
+
+// Readiness is the body of /readyz.
+// swagger:model Readiness
+type Readiness struct {
+	// Status is ready or not ready.
+	Status string  `json:"status" example:"ready"`
+	Checks []Check `json:"checks"`
+}
+
+// ModelStatus reports whether a model endpoint responds. Disabled models are not checked.
+type ModelStatus struct {
+	ID        string `json:"id" example:"local"`
+	Vendor    string `json:"vendor,omitempty" example:"ollama"`
+	Enabled   bool   `json:"enabled" example:"true"`
+	Reachable *bool  `json:"reachable,omitempty" example:"true"`
+	LatencyMS int64  `json:"latency_ms,omitempty" example:"12"`
+	Error     string `json:"error,omitempty" example:""`
+}
+
+// ToolStatus reports whether an enabled tool can be run.
+type ToolStatus struct {
+	ID        string `json:"id" example:"fstool"`
+	Type      string `json:"type" example:"binary"`
+	Available bool   `json:"available" example:"true"`
+	Error     string `json:"error,omitempty" example:""`
+}
+
+// Status is the body of /api/v1/status.
+// swagger:model Status
+type Status struct {
+	// Status is ok, or degraded when an enabled model or tool is unavailable.
+	Status    string        `json:"status" example:"ok"`
+	Version   string        `json:"version" example:"v1.2.0"`
+	Commit    string        `json:"commit,omitempty" example:"3f9a2c1"`
+	GoVersion string        `json:"go_version" example:"go1.23.3"`
+	Started   time.Time     `json:"started"`
+	Models    []ModelStatus `json:"models"`
+	Tools     []ToolStatus  `json:"tools"`
+}
+
+// healthTimeout is how long a model endpoint may take to respond to a check.
+func healthTimeout(cfg *config.Config) time.Duration {
+	if d, err := time.ParseDuration(cfg.Server.Health.Timeout); err == nil {
+		return d
+	}
+	return 2 * time.Second
+}
+
+// probeModel reports whether the endpoint of m answers HTTP requests. Any response, whatever
+// its status, shows the backend is up.
+func probeModel(ctx context.Context, m config.ModelConfig, timeout time.Duration) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.Endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return time.Since(start), nil
+}
+
+// probeModels checks the enabled models concurrently.
+func probeModels(ctx context.Context, models []config.ModelConfig, timeout time.Duration) []ModelStatus {
+	statuses := make([]ModelStatus, len(models))
+	var wg sync.WaitGroup
+	for i, m := range models {
+		statuses[i] = ModelStatus{ID: m.ID, Vendor: m.APIVendor, Enabled: m.Enabled}
+		if !m.Enabled {
+			continue
+		}
+		wg.Add(1)
+		go func(s *ModelStatus, m config.ModelConfig) {
+			defer wg.Done()
+			latency, err := probeModel(ctx, m, timeout)
+			reachable := err == nil
+			s.Reachable, s.LatencyMS = &reachable, latency.Milliseconds()
+			if err != nil {
+				s.Error = err.Error()
+			}
+		}(&statuses[i], m)
+	}
+	wg.Wait()
+	return statuses
+}
+
+// toolType names the kind of a tool in status reports.
+func toolType(tool toolmodel.ToolConfig) string {
+	switch {
+	case tool.IsMCP():
+		return "mcp"
+	case tool.IsHTTP():
+		return toolmodel.TypeHTTP
+	}
+	return toolmodel.TypeBinary
+}
+
+// checkTool reports why a tool cannot be run. Binary tools need an executable file in the
+// tools directory; webhook and MCP tools are checked when they are called.
+func checkTool(cfg *config.Config, tool toolmodel.ToolConfig) error {
+	if toolType(tool) != toolmodel.TypeBinary {
+		return nil
+	}
+	path, err := cfg.Registry().BinaryPath(tool.ID)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() || fi.Mode().Perm()&0o111 == 0 {
+		return fmt.Errorf("%s is not an executable file", path)
+	}
+	return nil
+}
+
+// HealthzHandler godoc
+// @Summary Liveness probe
+// @Description Returns 200 while the process is serving requests.
+// @Tags health
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Router /healthz [get]
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ReadyzHandler godoc
+// @Summary Readiness probe
+// @Description Returns 200 when a configuration is loaded and the binaries of the enabled tools are executable, and, with server.health.check_models, every enabled model endpoint responds. Otherwise returns 503 listing the failed checks.
+// @Tags health
+// @Produce json
+// @Success 200 {object} Readiness
+// @Failure 503 {object} Readiness
+// @Router /readyz [get]
+func ReadyzHandler(store ConfigStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ready := Readiness{Status: "ready", Checks: []Check{}}
+		add := func(name string, err error) {
+			c := Check{Name: name, OK: err == nil}
+			if err != nil {
+				c.Error = err.Error()
+				ready.Status = "not ready"
+			}
+			ready.Checks = append(ready.Checks, c)
+		}
+
+		cfg := store.Config()
+		if cfg == nil {
+			add("config", errors.New("no configuration loaded"))
+		} else {
+			add("config", nil)
+			for _, tool := range EnabledTools(cfg) {
+				add("tool:"+tool.ID, checkTool(cfg, tool))
+			}
+			if cfg.Server.Health.CheckModels {
+				for _, m := range probeModels(r.Context(), cfg.Models, healthTimeout(cfg)) {
+					if m.Enabled {
+						var err error
+						if m.Error != "" {
+							err = errors.New(m.Error)
+						}
+						add("model:"+m.ID, err)
+					}
+				}
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if ready.Status != "ready" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(ready)
+	}
+}
+
+// StatusHandler godoc
+// @Summary Server status
+// @Description Returns the build version, whether each enabled model endpoint responds and whether each enabled tool can be run. Only the models and tools the caller may use are listed.
+// @Tags health
+// @Produce json
+// @Success 200 {object} Status
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/status [get]
+func StatusHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p := auth.FromContext(r.Context())
+		var models []config.ModelConfig
+		for _, m := range cfg.Models {
+			if p.AllowsModel(m.ID) {
+				models = append(models, m)
+			}
+		}
+		status := Status{
+			Status:    "ok",
+			Version:   version.Version,
+			Commit:    version.Commit(),
+			GoVersion: runtime.Version(),
+			Started:   started,
+			Models:    probeModels(r.Context(), models, healthTimeout(cfg)),
+			Tools:     []ToolStatus{},
+		}
+		for _, m := range status.Models {
+			if m.Reachable != nil && !*m.Reachable {
+				status.Status = "degraded"
+			}
+		}
+		for _, tool := range AllowedTools(r.Context(), EnabledTools(cfg)) {
+			ts := ToolStatus{ID: tool.ID, Type: toolType(tool), Available: true}
+			if err := checkTool(cfg, tool); err != nil {
+				ts.Available, ts.Error = false, err.Error()
+				status.Status = "degraded"
+			}
+			status.Tools = append(status.Tools, ts)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// staticStore serves a fixed configuration.
+type staticStore struct{ cfg *config.Config }
+
+func (s staticStore) Config() *config.Config        { return s.cfg }
+func (s staticStore) Reload(string) error           { return nil }
+func (s staticStore) Status() handlers.ReloadStatus { return handlers.ReloadStatus{Generation: 1} }
+
+func readiness(t *testing.T, cfg *config.Config) (int, handlers.Readiness) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handlers.ReadyzHandler(staticStore{cfg})(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body handlers.Readiness
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	return rr.Code, body
+}
+
+func TestReadyzHandler(t *testing.T) {
+	backend := httptest.NewServer(http.NotFoundHandler())
+	defer backend.Close()
+	cfg := &config.Config{
+		Models: []config.ModelConfig{{ID: "up", Endpoint: backend.URL, Enabled: true}, {ID: "off", Endpoint: "http://127.0.0.1:1/"}},
+		Tools:  []toolmodel.ToolConfig{{ID: "hook", Type: toolmodel.TypeHTTP, HTTP: &toolmodel.HTTPConfig{URL: backend.URL}}},
+		Server: config.ServerConfig{Health: config.HealthConfig{CheckModels: true}},
+	}
+	if code, body := readiness(t, cfg); code != http.StatusOK || body.Status != "ready" || len(body.Checks) != 3 {
+		t.Errorf("expected ready with config, tool and model checks, got %d %+v", code, body)
+	}
+
+	// A binary tool without an executable in the tools directory is not ready.
+	cfg.Tools = append(cfg.Tools, toolmodel.ToolConfig{ID: "missing"})
+	code, body := readiness(t, cfg)
+	if code != http.StatusServiceUnavailable || body.Status != "not ready" {
+		t.Fatalf("expected 503, got %d %+v", code, body)
+	}
+	for _, c := range body.Checks {
+		if c.OK != (c.Name != "tool:missing") {
+			t.Errorf("unexpected check %+v", c)
+		}
+	}
+
+	// An enabled model that does not respond fails readiness when models are checked.
+	cfg.Tools = cfg.Tools[:1]
+	backend.Close()
+	if code, _ := readiness(t, cfg); code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 with an unreachable model, got %d", code)
+	}
+	cfg.Server.Health.CheckModels = false
+	if code, _ := readiness(t, cfg); code != http.StatusOK {
+		t.Errorf("expected models to be ignored without check_models, got %d", code)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	cfg := &config.Config{
+		Models: []config.ModelConfig{{ID: "down", Endpoint: "http://127.0.0.1:1/", Enabled: true}},
+		Tools:  []toolmodel.ToolConfig{{ID: "missing"}},
+	}
+	rr := httptest.NewRecorder()
+	handlers.StatusHandler(cfg)(rr, httptest.NewRequest(http.MethodGet, "/api/v1/status", nil))
+	var status handlers.Status
+	if err := json.NewDecoder(rr.Body).Decode(&status); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if status.Status != "degraded" || status.Version == "" || status.GoVersion == "" {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if len(status.Models) != 1 || status.Models[0].Reachable == nil || *status.Models[0].Reachable {
+		t.Errorf("expected the model to be unreachable, got %+v", status.Models)
+	}
+	if len(status.Tools) != 1 || status.Tools[0].Available || status.Tools[0].Type != "binary" {
+		t.Errorf("expected the tool to be unavailable, got %+v", status.Tools)
+	}
+}
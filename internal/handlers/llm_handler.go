@@ -1,25 +1,24 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"krackenservices.com/agentAI/internal/agent"
+	"krackenservices.com/agentAI/internal/auth"
 	"krackenservices.com/agentAI/internal/config"
-	"krackenservices.com/agentAI/internal/toolregistry"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/ratelimit"
+	"krackenservices.com/agentAI/internal/toolmodel"
+	"krackenservices.com/agentAI/internal/usage"
+	"log/slog"
 	"net/http"
-	"regexp"
-	"strings"
+	"time"
 )
 
-// Step1 Recieve Message from the user
-// Step2 Construct the payload to send to the LLM (Tool context etc)
-// Step3 Send the message to the LLM
-// Step4 Recieve the response from the LLM
-// Step5 Check for tool commands
-// Step6 Call tools, send the response to LLM
-// Step7 Loop 4 - 6 until no tool comamnds found
-// Step8 Send the final response to the user
-
 // ChatRequest defines the payload to send to the LLM.
 type ChatRequest struct {
 	Model   string                 `json:"model"`
@@ -29,136 +28,106 @@ type ChatRequest struct {
 
 func ChatHandler(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			fmt.Fprintln(w, "Only POST requests are allowed")
-			return
-		}
-
 		var payload ChatRequest
 		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-			http.Error(w, fmt.Sprintf("Error parsing JSON: %v", err), http.StatusBadRequest)
+			problem.Error(w, r, http.StatusBadRequest, fmt.Sprintf("invalid JSON: %v", err))
 			return
 		}
 		defer r.Body.Close()
 
-		// Step 2: Construct the payload to send to the LLM.
-		// 1. Determine Model from payload
-		var selectedModel *config.ModelConfig
-		for i, m := range cfg.Models {
-			if m.ID == payload.Model {
-				selectedModel = &cfg.Models[i]
-				break
-			}
-		}
-		if selectedModel == nil {
-			http.Error(w, fmt.Sprintf("Model %q not found", payload.Model), http.StatusBadRequest)
+		run, release, ok := startRun(w, r, cfg, payload.Model)
+		if !ok {
 			return
 		}
-		toolContext := buildToolContext(*selectedModel)
-		//fmt.Printf("Tool Context: %s\n", toolContext)
+		defer release()
 
-		llmResponse, err := callLLM(selectedModel, payload, toolContext)
+		result, err := run.Chat(r.Context(), []llm.Message{{Role: agent.RoleUser, Content: payload.Message}})
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Error calling LLM: %v", err), http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 
-		// Loop until no tool commands are found.
-		for {
-			command, found := extractToolCommand(selectedModel, llmResponse)
-			if !found {
-				break
-			}
-
-			toolResult, err := callTool(command)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Error calling tool: %v", err), http.StatusInternalServerError)
-				return
-			}
-
-			// Step 7: Append the tool result to the conversation and send it back to the LLM.
-			// For demonstration, we simply append the tool result to the current message.
-			payload.Message = llmResponse + "\nTool result: " + toolResult
-			llmResponse, err = callLLM(selectedModel, payload, toolContext)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Error calling LLM after tool execution: %v", err), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		// Step 8: Send the final LLM response to the user.
+		// Send the final LLM response to the user.
 		w.Header().Set("Content-Type", "application/json")
-		io.WriteString(w, llmResponse)
+		io.WriteString(w, result.Output)
 	}
 }
 
-func callLLM(model *config.ModelConfig, payload ChatRequest, context string) (string, error) {
-	message := context + "\n" + payload.Message
+// principalID returns the key of the caller of r (see auth.Principal.Key), under which its
+// usage, sessions and batches are recorded.
+func principalID(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p.Key()
+	}
+	return auth.MethodAnonymous + ":anonymous"
+}
 
-	fmt.Println("Sending message:\n\n" + message)
+// NewRun prepares a run of the agent loop for principal with the model modelID, offering it
+// tools. The model must exist and be allowed by allows. Budgets may reject the run with a
+// *usage.BudgetError or move it to a cheaper model, which must be allowed too. Other errors
+// are problems.
+func NewRun(ctx context.Context, cfg *config.Config, principal, modelID string, allows func(model string) bool, tools []toolmodel.ToolConfig) (*agent.Run, error) {
+	selectedModel := findModel(cfg, modelID)
+	if selectedModel == nil {
+		return nil, problem.New(http.StatusBadRequest, fmt.Sprintf("model %q not found", modelID))
+	}
+	if !allows(selectedModel.ID) {
+		return nil, problem.New(http.StatusForbidden, fmt.Sprintf("not allowed to use model %q", selectedModel.ID))
+	}
 
-	_, err := json.Marshal(message)
+	// Budgets may reject the chat or move it to a cheaper model.
+	modelID, err := usage.Default.Check(cfg, principal, selectedModel.ID)
 	if err != nil {
-		return "", fmt.Errorf("failed to marshal payload: %w", err)
+		return nil, err
 	}
-	//model.Endpoint
-	var sb strings.Builder
-
-	if !strings.Contains(payload.Message, "<tool>") {
-		sb.WriteString("I need the listing of the current directory")
-		sb.WriteString("<tool>{ \"tool\": \"fstool\", \"args\": { \"path\": \".\" } }</tool>")
-	} else {
-		sb.WriteString("I have the listing of the current directory")
-		sb.WriteString("{ \"output\": \"Listing contents of directory: .\\nfile1\\ndir1\\ndir1/subdir1\\n\"}")
+	if modelID != selectedModel.ID {
+		if !allows(modelID) {
+			return nil, problem.New(http.StatusForbidden, fmt.Sprintf("budget exceeded and not allowed to use model %q instead", modelID))
+		}
+		slog.InfoContext(ctx, "Budget exceeded: downgrading chat", "principal", principal, "from", selectedModel.ID, "to", modelID)
+		selectedModel = findModel(cfg, modelID)
 	}
-	return sb.String(), nil
+	return &agent.Run{
+		Principal: principal,
+		Model:     selectedModel,
+		Tools:     tools,
+		Mask:      func(tool toolmodel.ToolConfig) toolmodel.ToolConfig { return maskTool(cfg, tool) },
+		Execute:   ExecuteTool,
+	}, nil
 }
 
-func buildToolContext(model config.ModelConfig) string {
-	var sb strings.Builder
-	sb.WriteString("You are an assistant that can call external tools when needed.\n")
-	sb.WriteString("Available Tools:\n")
-	for _, toolID := range model.Tools {
-		if tool, ok := toolregistry.InternalTools[toolID]; ok {
-			// You can format this context as needed. For example, include ID and description.
-			cmdArgs, _ := json.Marshal(tool.CommandArgs)
-			sb.WriteString(fmt.Sprintf("- %s: %s\n%v", tool.ID, tool.Description, string(cmdArgs)))
-		} else {
-			// Optionally, you can add external tools if available.
-			sb.WriteString(fmt.Sprintf("- %s: (external tool)\n", toolID))
+// findModel returns the model with the ID, or nil.
+func findModel(cfg *config.Config, id string) *config.ModelConfig {
+	for i := range cfg.Models {
+		if cfg.Models[i].ID == id {
+			return &cfg.Models[i]
 		}
 	}
-	sb.WriteString("If you need to fetch external data or perform a task, return a tool call using the following format:\n")
-	sb.WriteString(fmt.Sprintf("%s\n\"{\"name\": \"<tool_name>\", \"arguments\": {\"arg1\": \"value1\"}}\"\n%s\n", model.ToolTagStart, model.ToolTagEnd))
-
-	// Just get the 1st internal tool for demonstration.
-	var key string
-	for k := range toolregistry.InternalTools {
-		key = k
-		break
-	}
-
-	cmdExample, _ := json.Marshal(toolregistry.InternalTools[key].Example)
-	sb.WriteString(fmt.Sprintf("For example %s\n", string(cmdExample)))
-	return sb.String()
+	return nil
 }
 
-// extractToolCommand searches for a tool command pattern in the response.
-// We assume tool commands are enclosed in <tool>...</tool>.
-func extractToolCommand(model *config.ModelConfig, response string) (string, bool) {
-	re := regexp.MustCompile(model.ToolTagStart + `(.*?)` + model.ToolTagEnd)
-	matches := re.FindStringSubmatch(response)
-	if len(matches) > 1 {
-		fmt.Println("**** MATCH *****")
-		return matches[1], true
+// startRun prepares a run of the agent loop with the model modelID for the caller of r, as
+// NewRun does, and holds a slot of the model until release is called. It writes the error
+// response itself and returns false when the run cannot start.
+func startRun(w http.ResponseWriter, r *http.Request, cfg *config.Config, modelID string) (run *agent.Run, release func(), ok bool) {
+	run, err := NewRun(r.Context(), cfg, principalID(r), modelID, auth.FromContext(r.Context()).AllowsModel, AllowedTools(r.Context(), EnabledTools(cfg)))
+	var budgetErr *usage.BudgetError
+	if errors.As(err, &budgetErr) {
+		ratelimit.TooManyRequests(w, r, time.Until(budgetErr.Reset), err.Error())
+		return nil, nil, false
 	}
-	return "", false
-}
+	if err != nil {
+		problem.WriteError(w, r, err)
+		return nil, nil, false
+	}
+	w.Header().Set("X-Model", run.Model.ID)
 
-// callTool simulates calling a tool given a command.
-// Replace this stub with your actual tool-calling logic.
-func callTool(command string) (string, error) {
-	// For demonstration, simply return a string that echoes the command.
-	return "Tool response for command: " + command, nil
+	// Hold a slot of the model for the whole run, so a busy model queues new chats
+	// instead of interleaving them.
+	release, err = ratelimit.Default.AcquireModel(r.Context(), &cfg.Server.RateLimit, run.Model.ID)
+	if err != nil {
+		ratelimit.TooManyRequests(w, r, time.Second, fmt.Sprintf("model %q: %v", run.Model.ID, err))
+		return nil, nil, false
+	}
+	return run, release, true
 }
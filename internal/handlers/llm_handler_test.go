@@ -0,0 +1,51 @@
+package handlers_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/usage"
+)
+
+func TestNewRun(t *testing.T) {
+	cfg := &config.Config{
+		Models: []config.ModelConfig{{ID: "local"}, {ID: "premium"}},
+		Usage: config.UsageConfig{Budgets: []config.BudgetConfig{
+			{ID: "premium-daily", Principal: "*", Model: "premium", DailyTokens: 10, Action: config.BudgetDowngrade, DowngradeTo: "local"},
+		}},
+	}
+	everything := func(string) bool { return true }
+	onlyPremium := func(id string) bool { return id == "premium" }
+	ctx := context.Background()
+
+	run, err := handlers.NewRun(ctx, cfg, "newrun-fresh", "premium", everything, nil)
+	if err != nil || run.Model.ID != "premium" || run.Principal != "newrun-fresh" {
+		t.Fatalf("expected a run with premium, got %+v, %v", run, err)
+	}
+
+	var p *problem.Problem
+	if _, err := handlers.NewRun(ctx, cfg, "newrun-fresh", "missing", everything, nil); !errors.As(err, &p) || p.Status != http.StatusBadRequest {
+		t.Errorf("expected a 400 problem for an unknown model, got %v", err)
+	}
+	if _, err := handlers.NewRun(ctx, cfg, "newrun-fresh", "local", onlyPremium, nil); !errors.As(err, &p) || p.Status != http.StatusForbidden {
+		t.Errorf("expected a 403 problem for a model that is not allowed, got %v", err)
+	}
+
+	// Once the budget is spent, runs move to the cheaper model if it is allowed.
+	if _, err := usage.Default.Record("newrun-spent", cfg.Models[1], llm.Usage{PromptTokens: 20}); err != nil {
+		t.Fatal(err)
+	}
+	run, err = handlers.NewRun(ctx, cfg, "newrun-spent", "premium", everything, nil)
+	if err != nil || run.Model.ID != "local" {
+		t.Errorf("expected a downgrade to local, got %+v, %v", run, err)
+	}
+	if _, err := handlers.NewRun(ctx, cfg, "newrun-spent", "premium", onlyPremium, nil); !errors.As(err, &p) || p.Status != http.StatusForbidden {
+		t.Errorf("expected a 403 problem when the cheaper model is not allowed, got %v", err)
+	}
+}
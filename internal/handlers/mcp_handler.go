@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/mcp"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// NewMCPServer returns an MCP server advertising the enabled tools of the catalogue that the
+// caller may use; other tools are unknown to it. Calls are executed through ExecuteTool, the
+// same path used by DynamicToolHandler.
+//
+// @Summary MCP endpoint
+// @Description Model Context Protocol endpoint (streamable HTTP transport) exposing every enabled tool via tools/list and tools/call.
+// @Tags mcp
+// @Accept json
+// @Produce json
+// @Param message body mcp.Message true "JSON-RPC message"
+// @Success 200 {object} mcp.Message
+// @Success 202 "Notification accepted"
+// @Failure 429 {object} problem.Problem "Rate limit exceeded"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/mcp [post]
+func NewMCPServer(cfg *config.Config) *mcp.Server {
+	return &mcp.Server{
+		Info:  mcp.Implementation{Name: "agentAI", Version: cfg.Version},
+		Tools: func(ctx context.Context) []toolmodel.ToolConfig { return AllowedTools(ctx, EnabledTools(cfg)) },
+		Mask:  func(tool toolmodel.ToolConfig) toolmodel.ToolConfig { return maskTool(cfg, tool) },
+		Call:  ExecuteTool,
+	}
+}
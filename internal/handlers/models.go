@@ -2,34 +2,36 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"krackenservices.com/agentAI/internal/auth"
 	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/toolmodel"
 	"net/http"
-	"strings"
 )
 
-func maskModel(m config.ModelConfig) config.ModelConfig {
+// maskModel returns a copy of the model that is safe to return from the API:
+// the API key and credential headers are masked.
+func maskModel(cfg *config.Config, m config.ModelConfig) config.ModelConfig {
 	// Create a new instance with simple fields copied.
 	mCopy := config.ModelConfig{
 		ID:                        m.ID,
 		Name:                      m.Name,
 		Endpoint:                  m.Endpoint,
 		Enabled:                   m.Enabled,
-		APIKey:                    "<masked>", // Will be set below
+		APIKey:                    config.Masked,
+		APIVendor:                 m.APIVendor,
 		AdditionalSystemPrompt:    m.AdditionalSystemPrompt,
 		AdditionalUserPrompt:      m.AdditionalUserPrompt,
 		AdditionalAssistantPrompt: m.AdditionalAssistantPrompt,
 		ToolsSupported:            m.ToolsSupported,
 		ToolTagStart:              m.ToolTagStart,
 		ToolTagEnd:                m.ToolTagEnd,
+		Pricing:                   m.Pricing,
 	}
 
-	// Deep copy Headers.
-	if m.Headers != nil {
-		mCopy.Headers = make(map[string]string)
-		for k, v := range m.Headers {
-			mCopy.Headers[k] = v
-		}
-	}
+	// Copy Headers, masking credentials.
+	mCopy.Headers = cfg.MaskHeaders(m.Headers)
 
 	// Deep copy Parameters.
 	if m.Parameters != nil {
@@ -55,12 +57,17 @@ func maskModel(m config.ModelConfig) config.ModelConfig {
 // @Accept json
 // @Produce json
 // @Success 200 {array} config.ModelConfig
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /api/v1/models [get]
 func ListModels(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		maskedModels := make([]config.ModelConfig, len(cfg.Models))
-		for i, m := range cfg.Models {
-			maskedModels[i] = maskModel(m)
+		p := auth.FromContext(r.Context())
+		maskedModels := make([]config.ModelConfig, 0, len(cfg.Models))
+		for _, m := range cfg.Models {
+			if p.AllowsModel(m.ID) {
+				maskedModels = append(maskedModels, maskModel(cfg, m))
+			}
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -70,31 +77,70 @@ func ListModels(cfg *config.Config) http.HandlerFunc {
 
 // GetModel godoc
 // @Summary Get model details
-// @Description Returns the details of a model by its ID (API key is masked).
+// @Description Returns the details of a model by its ID (API key is masked). The ETag is required by the admin API to change the model.
 // @Tags models
 // @Accept json
 // @Produce json
 // @Param modelID path string true "Model ID"
 // @Success 200 {object} config.ModelConfig
-// @Failure 400 {object} map[string]string "Bad Request"
-// @Failure 404 {object} map[string]string "Not Found"
+// @Failure 400 {object} problem.Problem "Bad Request"
+// @Failure 404 {object} problem.Problem "Not Found"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/models/{modelID} [get]
 // @Router /api/v1/model/{modelID} [get]
 func GetModel(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Expect URL: /model/<modelID>
-		parts := strings.Split(r.URL.Path, "/")
-		if len(parts) < 3 || parts[2] == "" {
-			http.Error(w, "Model ID not provided", http.StatusBadRequest)
+		modelID := r.PathValue("id")
+		if modelID == "" {
+			problem.Error(w, r, http.StatusBadRequest, "model ID not provided")
 			return
 		}
-		modelID := parts[2]
 		for _, model := range cfg.Models {
-			if model.ID == modelID {
+			if model.ID == modelID && auth.FromContext(r.Context()).AllowsModel(modelID) {
+				if raw, ok := cfg.RawModel(modelID); ok {
+					w.Header().Set("ETag", config.ETag(raw))
+				}
 				w.Header().Set("Content-Type", "application/json")
-				json.NewEncoder(w).Encode(maskModel(model))
+				json.NewEncoder(w).Encode(maskModel(cfg, model))
 				return
 			}
 		}
-		http.Error(w, "Model not found", http.StatusNotFound)
+		problem.Error(w, r, http.StatusNotFound, fmt.Sprintf("model %q not found", modelID))
+	}
+}
+
+// maskTool returns a copy of the tool with secret argument defaults, webhook URLs and
+// webhook credentials masked.
+func maskTool(cfg *config.Config, t toolmodel.ToolConfig) toolmodel.ToolConfig {
+	t.CommandArgs = cfg.MaskArgs(t.CommandArgs)
+	if t.HTTP == nil {
+		return t
+	}
+	httpCopy := *t.HTTP
+	if cfg.IsSecret(httpCopy.URL) {
+		httpCopy.URL = config.Masked
+	}
+	httpCopy.Headers = cfg.MaskHeaders(t.HTTP.Headers)
+	if t.HTTP.Auth != nil {
+		authCopy := *t.HTTP.Auth
+		if authCopy.Password != "" {
+			authCopy.Password = config.Masked
+		}
+		if authCopy.Token != "" {
+			authCopy.Token = config.Masked
+		}
+		httpCopy.Auth = &authCopy
+	}
+	t.HTTP = &httpCopy
+	return t
+}
+
+// maskTools applies maskTool to every tool.
+func maskTools(cfg *config.Config, tools []toolmodel.ToolConfig) []toolmodel.ToolConfig {
+	masked := make([]toolmodel.ToolConfig, len(tools))
+	for i, t := range tools {
+		masked[i] = maskTool(cfg, t)
 	}
+	return masked
 }
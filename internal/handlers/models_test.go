@@ -0,0 +1,130 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+	"krackenservices.com/agentAI/internal/mcp"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// TestListModelsAndTools_MaskSecrets verifies that credentials never leave the API unmasked.
+func TestListModelsAndTools_MaskSecrets(t *testing.T) {
+	cfg := &config.Config{
+		Models: []config.ModelConfig{{
+			ID:      "local",
+			APIKey:  "sk-live",
+			Headers: map[string]string{"Authorization": "Bearer sk-live", "Content-Type": "application/json"},
+		}},
+		Tools: []toolmodel.ToolConfig{{
+			ID:   "tickets",
+			Type: toolmodel.TypeHTTP,
+			HTTP: &toolmodel.HTTPConfig{
+				URL:     "http://tickets.internal/",
+				Headers: map[string]string{"X-API-Key": "tk-live"},
+				Auth:    &toolmodel.HTTPAuth{Type: "basic", Username: "bot", Password: "pw-live"},
+			},
+		}},
+	}
+
+	rr := httptest.NewRecorder()
+	handlers.ListModels(cfg)(rr, httptest.NewRequest(http.MethodGet, "/api/v1/models", nil))
+	var models []config.ModelConfig
+	json.Unmarshal(rr.Body.Bytes(), &models)
+	if models[0].APIKey != config.Masked || models[0].Headers["Authorization"] != config.Masked {
+		t.Errorf("expected api key and authorization header to be masked, got %+v", models[0])
+	}
+	if models[0].Headers["Content-Type"] != "application/json" {
+		t.Errorf("expected non-sensitive header to be kept, got %q", models[0].Headers["Content-Type"])
+	}
+
+	rr = httptest.NewRecorder()
+	handlers.ListTools(cfg)(rr, httptest.NewRequest(http.MethodGet, "/api/v1/tools", nil))
+	for _, secret := range []string{"tk-live", "pw-live"} {
+		if strings.Contains(rr.Body.String(), secret) {
+			t.Errorf("expected %q to be masked in %s", secret, rr.Body.String())
+		}
+	}
+	if cfg.Tools[0].HTTP.Auth.Password != "pw-live" {
+		t.Error("masking must not modify the live configuration")
+	}
+}
+
+// TestTools_MaskResolvedValues verifies that argument defaults and webhook URLs resolved from
+// secret references are masked in the tools API and the MCP catalogue, and still used by calls.
+func TestTools_MaskResolvedValues(t *testing.T) {
+	var received string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = r.URL.Path + " " + string(body)
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	t.Setenv("AGENTAI_TEST_HOOK", srv.URL+"/hook-secret")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "token"), []byte("arg-secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	yamlContent := `models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+tools:
+  - id: tickets
+    name: Tickets
+    description: Look up a ticket
+    type: http
+    command_args:
+      token: file:` + filepath.Join(dir, "token") + `
+      ticket: "1"
+    http:
+      url: ${AGENTAI_TEST_HOOK}
+      method: POST
+      body:
+        token: "{{.token}}"
+        ticket: "{{.ticket}}"
+`
+	if err := os.WriteFile(path, []byte(yamlContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	handlers.ListTools(cfg)(rr, httptest.NewRequest(http.MethodGet, "/api/v1/tools", nil))
+	var tools []toolmodel.ToolConfig
+	json.Unmarshal(rr.Body.Bytes(), &tools)
+	if len(tools) != 1 || tools[0].CommandArgs["token"] != config.Masked || tools[0].HTTP.URL != config.Masked || tools[0].CommandArgs["ticket"] != "1" {
+		t.Errorf("expected the resolved argument and URL to be masked, got %s", rr.Body.String())
+	}
+
+	resp := handlers.NewMCPServer(cfg).Handle(context.Background(), &mcp.Message{ID: json.RawMessage("1"), Method: "tools/list"})
+	var list mcp.ListToolsResult
+	json.Unmarshal(resp.Result, &list)
+	if resp.Error != nil || strings.Contains(string(resp.Result), "arg-secret") || len(list.Tools) != 1 {
+		t.Fatalf("expected the default of the argument to be masked in tools/list, got %s, %v", resp.Result, resp.Error)
+	}
+	if token, _ := list.Tools[0].InputSchema["properties"].(map[string]interface{})["token"].(map[string]interface{}); token["default"] != config.Masked {
+		t.Errorf("expected the default of the argument to be masked in tools/list, got %v", token)
+	}
+
+	// A masked value sent back keeps the secret default.
+	if _, err := handlers.ExecuteTool(context.Background(), cfg.Tools[0], map[string]interface{}{"token": config.Masked, "ticket": "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if received != `/hook-secret {"ticket":"2","token":"arg-secret"}` {
+		t.Errorf("expected the call to use the real values, got %q", received)
+	}
+}
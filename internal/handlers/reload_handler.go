@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/problem"
+)
+
+// ReloadStatus reports the outcome of the most recent configuration reload.
+// swagger:model ReloadStatus
+type ReloadStatus struct {
+	// Generation is incremented each time a new configuration is swapped in (1 at startup).
+	Generation  int       `json:"generation" example:"3"`
+	Success     bool      `json:"success" example:"true"`
+	Error       string    `json:"error,omitempty" example:""`
+	Trigger     string    `json:"trigger" example:"file"`
+	LastAttempt time.Time `json:"last_attempt"`
+	LastSuccess time.Time `json:"last_success"`
+	ConfigPath  string    `json:"config_path" example:"/opt/agentAI/config.yml"`
+}
+
+// ConfigReloader is implemented by the component that owns the live configuration.
+type ConfigReloader interface {
+	// Reload loads and validates the config file and swaps it in for new requests.
+	Reload(trigger string) error
+	Status() ReloadStatus
+}
+
+// ReloadHandler godoc
+// @Summary Reload configuration
+// @Description GET returns the status of the last configuration reload. POST reloads the config file, swapping it in for new requests if it is valid, and returns the new status; in-flight requests finish with the previous configuration. A rejected configuration is a problem listing every validation error, and the previous configuration stays live.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Success 200 {object} ReloadStatus
+// @Failure 422 {object} problem.Problem "The new configuration was rejected"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/admin/reload [get]
+// @Router /api/v1/admin/reload [post]
+func ReloadHandler(reloader ConfigReloader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			if err := reloader.Reload("api"); err != nil {
+				var problems config.ValidationErrors
+				errors.As(err, &problems)
+				problem.Write(w, r, problem.Invalid(err.Error(), problems))
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reloader.Status())
+	}
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"krackenservices.com/agentAI/internal/agent"
+	"krackenservices.com/agentAI/internal/auth"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/session"
+)
+
+// EventStream is the media type of streamed session replies.
+const EventStream = "text/event-stream"
+
+// NewSessionRequest is the body of POST /api/v1/sessions.
+type NewSessionRequest struct {
+	Model string `json:"model" example:"local"`
+	// Messages continue a saved conversation.
+	Messages []llm.Message `json:"messages,omitempty"`
+}
+
+// SessionMessageRequest is the body of POST /api/v1/sessions/{id}/messages.
+type SessionMessageRequest struct {
+	Message string `json:"message" example:"What is in the current directory?"`
+	// Model switches the session to another model, from this message on.
+	Model string `json:"model,omitempty" example:"local"`
+}
+
+// SessionReply is the response to a message: the run, and its events unless they were streamed.
+// swagger:model SessionReply
+type SessionReply struct {
+	SessionID string `json:"session_id" example:"9b2f6c1e0d4a7f3e5c8b1a2d3e4f5a6b"`
+	// Model is the model that answered, which differs from the requested one after a budget
+	// downgrade.
+	Model string `json:"model" example:"local"`
+	agent.Result
+	Events []agent.Event `json:"events,omitempty"`
+}
+
+// seesEverything reports whether the caller of r may see the usage and sessions of every
+// principal: with the admin scope, or when authentication is disabled.
+func seesEverything(r *http.Request) bool {
+	p := auth.FromContext(r.Context())
+	return p == nil || p.HasScope(config.ScopeAdmin) || p.Method == auth.MethodAnonymous
+}
+
+// ownSession returns the session of the path if the caller owns it or sees everything, and
+// writes a 404 problem otherwise.
+func ownSession(w http.ResponseWriter, r *http.Request) (session.Session, bool) {
+	id := r.PathValue("id")
+	s, ok := session.Default.Get(id)
+	if !ok || (s.Principal != principalID(r) && !seesEverything(r)) {
+		problem.Error(w, r, http.StatusNotFound, fmt.Sprintf("session %q not found", id))
+		return session.Session{}, false
+	}
+	return s, true
+}
+
+// CreateSession godoc
+// @Summary Start a chat session
+// @Description Starts a conversation with a model, optionally continuing saved messages. Messages are then sent to /api/v1/sessions/{id}/messages.
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Param session body NewSessionRequest true "Model and optional messages"
+// @Success 201 {object} session.Session
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/sessions [post]
+func CreateSession(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req NewSessionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, fmt.Sprintf("invalid JSON: %v", err))
+			return
+		}
+		known := false
+		for _, m := range cfg.Models {
+			known = known || m.ID == req.Model
+		}
+		if !known {
+			problem.Error(w, r, http.StatusBadRequest, fmt.Sprintf("model %q not found", req.Model))
+			return
+		}
+		if !auth.FromContext(r.Context()).AllowsModel(req.Model) {
+			auth.Forbidden(w, r, fmt.Sprintf("not allowed to use model %q", req.Model))
+			return
+		}
+		s, err := session.Default.Create(principalID(r), req.Model, req.Messages)
+		if err != nil {
+			problem.WriteError(w, r, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", r.URL.Path+"/"+s.ID)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(s)
+	}
+}
+
+// ListSessions godoc
+// @Summary List chat sessions
+// @Description Returns the caller's sessions (every session with the admin scope), most recently used first, without their messages.
+// @Tags sessions
+// @Produce json
+// @Success 200 {array} session.Session
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/sessions [get]
+func ListSessions(w http.ResponseWriter, r *http.Request) {
+	principal := principalID(r)
+	if seesEverything(r) {
+		principal = ""
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session.Default.List(principal))
+}
+
+// GetSession godoc
+// @Summary Get a chat session
+// @Description Returns a session with its messages.
+// @Tags sessions
+// @Produce json
+// @Param id path string true "Session ID"
+// @Success 200 {object} session.Session
+// @Failure 404 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/sessions/{id} [get]
+func GetSession(w http.ResponseWriter, r *http.Request) {
+	s, ok := ownSession(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// DeleteSession godoc
+// @Summary Delete a chat session
+// @Tags sessions
+// @Param id path string true "Session ID"
+// @Success 204
+// @Failure 404 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/sessions/{id} [delete]
+func DeleteSession(w http.ResponseWriter, r *http.Request) {
+	s, ok := ownSession(w, r)
+	if !ok {
+		return
+	}
+	if _, err := session.Default.Delete(s.ID); err != nil {
+		problem.WriteError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeEvent writes a server-sent event and flushes it to the client.
+func writeEvent(w http.ResponseWriter, event string, v interface{}) {
+	data, _ := json.Marshal(v)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	http.NewResponseController(w).Flush()
+}
+
+// SessionMessage godoc
+// @Summary Send a message to a chat session
+// @Description Runs the agent loop on the conversation of the session followed by the message, and adds the message and the replies to the session. A session answers one message at a time; another message meanwhile gets a 409. With Accept: text/event-stream the events of the run are streamed as they happen (message, tool_call, tool_result), followed by a done event with the reply or an error event with a problem.
+// @Tags sessions
+// @Accept json
+// @Produce json
+// @Produce text/event-stream
+// @Param id path string true "Session ID"
+// @Param message body SessionMessageRequest true "Message"
+// @Success 200 {object} SessionReply
+// @Failure 400 {object} problem.Problem
+// @Failure 403 {object} problem.Problem
+// @Failure 404 {object} problem.Problem
+// @Failure 409 {object} problem.Problem "The session is answering another message"
+// @Failure 429 {object} problem.Problem
+// @Failure 502 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/sessions/{id}/messages [post]
+func SessionMessage(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s, ok := ownSession(w, r)
+		if !ok {
+			return
+		}
+		var req SessionMessageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, fmt.Sprintf("invalid JSON: %v", err))
+			return
+		}
+		if strings.TrimSpace(req.Message) == "" {
+			problem.Error(w, r, http.StatusBadRequest, "message is required")
+			return
+		}
+		// Hold the session for the whole run, so that a message sees the replies to the
+		// previous one.
+		s, done, err := session.Default.Begin(s.ID)
+		if errors.Is(err, session.ErrBusy) {
+			problem.Error(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			problem.Error(w, r, http.StatusNotFound, fmt.Sprintf("session %q not found", r.PathValue("id")))
+			return
+		}
+		defer done()
+		if req.Model == "" {
+			req.Model = s.Model
+		}
+
+		run, release, ok := startRun(w, r, cfg, req.Model)
+		if !ok {
+			return
+		}
+		defer release()
+
+		reply := SessionReply{SessionID: s.ID, Model: run.Model.ID}
+		stream := strings.Contains(r.Header.Get("Accept"), EventStream)
+		if stream {
+			w.Header().Set("Content-Type", EventStream)
+			w.Header().Set("Cache-Control", "no-cache")
+			run.OnEvent = func(e agent.Event) { writeEvent(w, e.Type, e) }
+		} else {
+			run.OnEvent = func(e agent.Event) { reply.Events = append(reply.Events, e) }
+		}
+
+		message := llm.Message{Role: agent.RoleUser, Content: req.Message}
+		result, err := run.Chat(r.Context(), append(s.Messages, message))
+		if err == nil {
+			_, err = session.Default.Append(s.ID, req.Model, append([]llm.Message{message}, result.Messages...)...)
+		}
+		if err != nil {
+			if stream {
+				writeEvent(w, "error", problem.ForRequest(r, err))
+			} else {
+				problem.WriteError(w, r, err)
+			}
+			return
+		}
+
+		reply.Result = result
+		if stream {
+			writeEvent(w, "done", reply)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reply)
+	}
+}
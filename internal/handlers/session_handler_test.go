@@ -0,0 +1,131 @@
+package handlers_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/auth"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+	"krackenservices.com/agentAI/internal/session"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+func TestSessions(t *testing.T) {
+	// The model lists the directory with fstool, here a webhook.
+	fstool := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("file1\ndir1"))
+	}))
+	defer fstool.Close()
+	cfg := &config.Config{
+		Models: []config.ModelConfig{{ID: "local", Endpoint: "http://127.0.0.1:8080/", ToolsSupported: true, ToolTagStart: "<tool>", ToolTagEnd: "</tool>", Tools: []string{"fstool"}}},
+		Tools:  []toolmodel.ToolConfig{{ID: "fstool", Type: toolmodel.TypeHTTP, CommandArgs: map[string]interface{}{"path": "."}, HTTP: &toolmodel.HTTPConfig{URL: fstool.URL}}},
+		Auth: config.AuthConfig{APIKeys: []config.APIKeyConfig{
+			{ID: "ci", Key: "ci-key", Scopes: []string{config.ScopeChat}},
+			{ID: "ops", Key: "ops-key", Scopes: []string{config.ScopeChat}},
+		}},
+	}
+	authn, err := auth.ForConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/sessions", handlers.CreateSession(cfg))
+	mux.HandleFunc("GET /api/v1/sessions", handlers.ListSessions)
+	mux.HandleFunc("GET /api/v1/sessions/{id}", handlers.GetSession)
+	mux.HandleFunc("DELETE /api/v1/sessions/{id}", handlers.DeleteSession)
+	mux.HandleFunc("POST /api/v1/sessions/{id}/messages", handlers.SessionMessage(cfg))
+	h := authn.Middleware(mux)
+	serve := func(method, path, key, body string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := serve(http.MethodPost, "/api/v1/sessions", "ci-key", `{"model": "missing"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown model, got %d", rr.Code)
+	}
+	rr := serve(http.MethodPost, "/api/v1/sessions", "ci-key", `{"model": "local"}`)
+	var s session.Session
+	json.NewDecoder(rr.Body).Decode(&s)
+	if rr.Code != http.StatusCreated || s.ID == "" || s.Principal != "api_key:ci" {
+		t.Fatalf("expected a session of ci, got %d %+v", rr.Code, s)
+	}
+	defer session.Default.Delete(s.ID)
+	messages := "/api/v1/sessions/" + s.ID + "/messages"
+
+	// A reply with its events.
+	rr = serve(http.MethodPost, messages, "ci-key", `{"message": "list the directory"}`)
+	var reply handlers.SessionReply
+	json.NewDecoder(rr.Body).Decode(&reply)
+	if rr.Code != http.StatusOK || reply.Iterations != 2 || len(reply.Events) != 4 || reply.Output == "" {
+		t.Fatalf("expected a reply after a tool call, got %d %+v", rr.Code, reply)
+	}
+	if reply.Events[2].Content != "file1\ndir1" {
+		t.Errorf("expected the output of fstool, got %+v", reply.Events[2])
+	}
+
+	// A streamed reply ends with a done event.
+	rr = serve(http.MethodPost, messages, "ci-key", `{"message": "again"}`, "Accept", handlers.EventStream)
+	if rr.Header().Get("Content-Type") != handlers.EventStream {
+		t.Fatalf("expected an event stream, got %q", rr.Header().Get("Content-Type"))
+	}
+	var events []string
+	for scanner := bufio.NewScanner(rr.Body); scanner.Scan(); {
+		if event, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			events = append(events, event)
+		}
+	}
+	if len(events) == 0 || events[0] != "message" || events[len(events)-1] != "done" {
+		t.Errorf("expected message events then done, got %v", events)
+	}
+
+	if rr := serve(http.MethodPost, messages, "ci-key", `{"message": " "}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an empty message, got %d", rr.Code)
+	}
+	// A message while the session answers another is rejected.
+	_, done, err := session.Default.Begin(s.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rr := serve(http.MethodPost, messages, "ci-key", `{"message": "meanwhile"}`); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a busy session, got %d", rr.Code)
+	}
+	done()
+
+	// The session keeps both exchanges.
+	rr = serve(http.MethodGet, "/api/v1/sessions/"+s.ID, "ci-key", "")
+	json.NewDecoder(rr.Body).Decode(&s)
+	if rr.Code != http.StatusOK || len(s.Messages) < 6 || s.Messages[0].Content != "list the directory" {
+		t.Errorf("expected the conversation, got %d %+v", rr.Code, s.Messages)
+	}
+
+	// Other principals cannot see or use it.
+	if rr := serve(http.MethodGet, "/api/v1/sessions/"+s.ID, "ops-key", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another principal, got %d", rr.Code)
+	}
+	if rr := serve(http.MethodPost, messages, "ops-key", `{"message": "hi"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another principal, got %d", rr.Code)
+	}
+	var list []session.Session
+	json.NewDecoder(serve(http.MethodGet, "/api/v1/sessions", "ops-key", "").Body).Decode(&list)
+	if len(list) != 0 {
+		t.Errorf("expected no sessions for ops, got %+v", list)
+	}
+
+	if rr := serve(http.MethodDelete, "/api/v1/sessions/"+s.ID, "ci-key", ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", rr.Code)
+	}
+	if rr := serve(http.MethodGet, "/api/v1/sessions/"+s.ID, "ci-key", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected the session to be deleted, got %d", rr.Code)
+	}
+}
@@ -1,14 +1,25 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"krackenservices.com/agentAI/internal/auth"
 	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/mcp"
+	"krackenservices.com/agentAI/internal/metrics"
+	"krackenservices.com/agentAI/internal/problem"
 	"krackenservices.com/agentAI/internal/toolregistry"
+	"krackenservices.com/agentAI/internal/tracing"
+	"krackenservices.com/agentAI/internal/webhook"
 	"net/http"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
 	"krackenservices.com/agentAI/internal/toolmodel"
 )
@@ -16,6 +27,39 @@ import (
 // ExecCommand allows overriding exec.Command in tests.
 var ExecCommand = exec.Command
 
+// running holds the tool processes in progress, so that a stopping server can kill them.
+var running = struct {
+	sync.Mutex
+	procs map[*os.Process]struct{}
+}{procs: make(map[*os.Process]struct{})}
+
+// runTool runs cmd like CombinedOutput while tracking its process.
+func runTool(cmd *exec.Cmd) ([]byte, error) {
+	var out bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	running.Lock()
+	running.procs[cmd.Process] = struct{}{}
+	running.Unlock()
+	err := cmd.Wait()
+	running.Lock()
+	delete(running.procs, cmd.Process)
+	running.Unlock()
+	return out.Bytes(), err
+}
+
+// KillTools kills the tool processes in progress and returns how many there were.
+func KillTools() int {
+	running.Lock()
+	defer running.Unlock()
+	for p := range running.procs {
+		p.Kill()
+	}
+	return len(running.procs)
+}
+
 // ToolRequest represents the expected JSON request body for dynamic tools.
 type ToolRequest struct {
 	// Args represents key-value pairs that override the default command arguments.
@@ -23,11 +67,12 @@ type ToolRequest struct {
 }
 
 // mergeArgsOnlyExisting returns a new map containing only keys from defaultArgs,
-// replacing values with those provided in requestArgs. Extra keys are ignored.
+// replacing values with those provided in requestArgs. Extra keys are ignored, and so are
+// masked values sent back, which keep the (secret) default.
 func mergeArgsOnlyExisting(defaultArgs, requestArgs map[string]interface{}) map[string]interface{} {
 	merged := make(map[string]interface{})
 	for key, defaultValue := range defaultArgs {
-		if newVal, ok := requestArgs[key]; ok {
+		if newVal, ok := requestArgs[key]; ok && newVal != config.Masked {
 			merged[key] = newVal
 		} else {
 			merged[key] = defaultValue
@@ -45,6 +90,70 @@ func buildCommandArgs(args map[string]interface{}) []string {
 	return cmdArgs
 }
 
+// ExecuteTool runs a tool with its default arguments overridden by args and returns its output.
+// Local tools are run as binaries from the tools directory, HTTP tools call their webhook
+// and MCP tools are dispatched to the server that advertised them.
+func ExecuteTool(ctx context.Context, toolConfig toolmodel.ToolConfig, args map[string]interface{}) (output string, err error) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "tool "+toolConfig.ID, tracing.KindInternal, tracing.String("tool.id", toolConfig.ID))
+	defer func() {
+		code := exitCode(err)
+		metrics.ToolExecutions.Inc(toolConfig.ID, code)
+		metrics.ToolDuration.Observe(metrics.Since(start), toolConfig.ID)
+		span.SetAttributes(tracing.String("tool.exit_code", code))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	if err := toolConfig.ValidateArgs(args); err != nil {
+		return "", err
+	}
+	output, err = runToolConfig(ctx, toolConfig, args)
+	if err != nil {
+		return "", &toolmodel.ExecError{Tool: toolConfig.ID, Err: err}
+	}
+	return output, nil
+}
+
+// runToolConfig dispatches a call with validated arguments to the tool.
+func runToolConfig(ctx context.Context, toolConfig toolmodel.ToolConfig, args map[string]interface{}) (string, error) {
+	// MCP tools also validate their arguments against the schema they advertised.
+	if toolConfig.IsMCP() {
+		return mcp.DefaultPool.CallTool(ctx, toolConfig.MCP, args)
+	}
+
+	argsMap := mergeArgsOnlyExisting(toolConfig.CommandArgs, args)
+
+	if toolConfig.IsHTTP() {
+		return webhook.Call(ctx, toolConfig.HTTP, argsMap)
+	}
+
+	cmdArgs := buildCommandArgs(argsMap)
+	toolBinary, err := toolregistry.BinaryPath(toolConfig.ID)
+	if err != nil {
+		return "", err
+	}
+
+	cmd := ExecCommand(toolBinary, cmdArgs...)
+	out, err := runTool(cmd)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// exitCode labels the outcome of a tool execution in the metrics and traces.
+func exitCode(err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return "0"
+	case errors.As(err, &exitErr):
+		return strconv.Itoa(exitErr.ExitCode())
+	}
+	return "error"
+}
+
 // DynamicToolHandler godoc
 // @Summary Executes a dynamic tool
 // @Description Executes the specified tool using default command arguments overridden by provided values.
@@ -53,80 +162,110 @@ func buildCommandArgs(args map[string]interface{}) []string {
 // @Produce json
 // @Param tool body ToolRequest true "Tool Request"
 // @Success 200 {object} map[string]string "Output of the tool"
-// @Failure 400 {object} map[string]string "Bad Request"
-// @Failure 500 {object} map[string]string "Internal Error"
+// @Failure 400 {object} problem.Problem "Bad Request"
+// @Failure 401 {object} problem.Problem "Unauthorized"
+// @Failure 403 {object} problem.Problem "Forbidden"
+// @Failure 422 {object} problem.Problem "Invalid tool arguments"
+// @Failure 429 {object} problem.Problem "Rate limit exceeded"
+// @Failure 502 {object} problem.Problem "Tool execution failed"
+// @Failure 504 {object} problem.Problem "Tool timed out"
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/tools/{tool_id}/run [post]
 // @Router /api/v1/tool/{tool_id} [post]
 func DynamicToolHandler(toolConfig toolmodel.ToolConfig) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		if !auth.FromContext(r.Context()).AllowsTool(toolConfig.ID) {
+			auth.Forbidden(w, r, fmt.Sprintf("not allowed to use tool %q", toolConfig.ID))
 			return
 		}
 
 		var req ToolRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err.Error() != "EOF" {
-			http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest)
-			return
-		}
-
-		argsMap := mergeArgsOnlyExisting(toolConfig.CommandArgs, req.Args)
-		cmdArgs := buildCommandArgs(argsMap)
-
-		exePath, err := os.Executable()
-		if err != nil {
-			http.Error(w, "Error determining executable path: "+err.Error(), http.StatusInternalServerError)
+			problem.Error(w, r, http.StatusBadRequest, fmt.Sprintf("invalid JSON: %v", err))
 			return
 		}
-		baseDir := filepath.Dir(exePath)
-		toolBinary := filepath.Join(baseDir, "tools", "agentAI-"+toolConfig.ID)
 
-		cmd := ExecCommand(toolBinary, cmdArgs...)
-		output, err := cmd.CombinedOutput()
+		output, err := ExecuteTool(r.Context(), toolConfig, req.Args)
 		if err != nil {
-			http.Error(w, "Error executing tool: "+err.Error(), http.StatusInternalServerError)
+			problem.WriteError(w, r, err)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"output": string(output)})
+		json.NewEncoder(w).Encode(map[string]string{"output": output})
 	}
 }
 
 // ListTools godoc
 // @Summary List all tools
-// @Description Returns a list of all tools (both internal and external) including details from the configuration.
+// @Description Returns a list of all tools (both internal and external) including details from the configuration (credentials masked).
 // @Tags tools
 // @Accept json
 // @Produce json
 // @Success 200 {array} interface{}
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /api/v1/tools [get]
 func ListTools(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var toolsList []interface{}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(maskTools(cfg, AllowedTools(r.Context(), AvailableTools(cfg))))
+	}
+}
 
-		// Add internal tools from registry; merge any override from config.
-		for id, tool := range toolregistry.InternalTools {
-			// Look for a config override.
-			for _, cfgTool := range cfg.Tools {
-				if cfgTool.ID == id {
-					tool.Enabled = cfgTool.Enabled // Only overriding the Enabled flag.
-					break
-				}
-			}
-			toolsList = append(toolsList, tool)
+// AvailableTools returns the tool catalogue: internal tools from the registry with any
+// config override applied, followed by external tools from the configuration.
+func AvailableTools(cfg *config.Config) []toolmodel.ToolConfig {
+	toolsList := internalTools(cfg)
+
+	// Add external tools (those not in internal registry).
+	for _, tool := range cfg.Tools {
+		if _, exists := cfg.Registry().Lookup(tool.ID); exists {
+			continue
 		}
+		toolsList = append(toolsList, tool)
+	}
+	return toolsList
+}
 
-		// Add external tools (those not in internal registry).
-		for _, tool := range cfg.Tools {
-			if _, exists := toolregistry.InternalTools[tool.ID]; exists {
-				continue
+// internalTools returns the registered tools with the fields set by any config entry applied.
+func internalTools(cfg *config.Config) []toolmodel.ToolConfig {
+	var toolsList []toolmodel.ToolConfig
+	for _, tool := range cfg.Registry().All() {
+		for _, cfgTool := range cfg.Tools {
+			if cfgTool.ID == tool.ID {
+				tool = tool.WithOverride(cfgTool)
+				break
 			}
-			toolsList = append(toolsList, tool)
 		}
+		toolsList = append(toolsList, tool)
+	}
+	return toolsList
+}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(toolsList)
+// EnabledTools returns the tools of the catalogue that are not disabled.
+func EnabledTools(cfg *config.Config) []toolmodel.ToolConfig {
+	var enabled []toolmodel.ToolConfig
+	for _, tool := range AvailableTools(cfg) {
+		if tool.Enabled != nil && !*tool.Enabled {
+			continue
+		}
+		enabled = append(enabled, tool)
 	}
+	return enabled
+}
+
+// AllowedTools returns the tools the caller of ctx may use, according to its tool allow-list.
+func AllowedTools(ctx context.Context, tools []toolmodel.ToolConfig) []toolmodel.ToolConfig {
+	p := auth.FromContext(ctx)
+	var allowed []toolmodel.ToolConfig
+	for _, tool := range tools {
+		if p.AllowsTool(tool.ID) {
+			allowed = append(allowed, tool)
+		}
+	}
+	return allowed
 }
 
 // ListInternalTools godoc
@@ -136,22 +275,13 @@ func ListTools(cfg *config.Config) http.HandlerFunc {
 // @Accept json
 // @Produce json
 // @Success 200 {array} interface{}
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /api/v1/tools/internal [get]
 func ListInternalTools(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		var toolsList []interface{}
-		for id, tool := range toolregistry.InternalTools {
-			// Merge any override.
-			for _, cfgTool := range cfg.Tools {
-				if cfgTool.ID == id {
-					tool.Enabled = cfgTool.Enabled
-					break
-				}
-			}
-			toolsList = append(toolsList, tool)
-		}
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(toolsList)
+		json.NewEncoder(w).Encode(maskTools(cfg, AllowedTools(r.Context(), internalTools(cfg))))
 	}
 }
 
@@ -162,15 +292,17 @@ func ListInternalTools(cfg *config.Config) http.HandlerFunc {
 // @Accept json
 // @Produce json
 // @Success 200 {array} interface{}
+// @Security ApiKeyAuth
+// @Security BearerAuth
 // @Router /api/v1/tools/external [get]
 func ListExternalTools(cfg *config.Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var toolsList []interface{}
-		for _, tool := range cfg.Tools {
-			if _, exists := toolregistry.InternalTools[tool.ID]; exists {
+		for _, tool := range AllowedTools(r.Context(), cfg.Tools) {
+			if _, exists := cfg.Registry().Lookup(tool.ID); exists {
 				continue
 			}
-			toolsList = append(toolsList, tool)
+			toolsList = append(toolsList, maskTool(cfg, tool))
 		}
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(toolsList)
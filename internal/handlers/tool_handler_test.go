@@ -129,3 +129,27 @@ func TestDynamicToolHandler_OverrideArgs(t *testing.T) {
 		t.Errorf("expected output %q; got %q", expected, output)
 	}
 }
+
+func TestDynamicToolHandler_InvalidArgs(t *testing.T) {
+	toolCfg := toolmodel.ToolConfig{
+		ID: "search",
+		InputSchema: map[string]interface{}{
+			"required":   []interface{}{"query"},
+			"properties": map[string]interface{}{"limit": map[string]interface{}{"type": "integer"}},
+		},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/tool/search", strings.NewReader(`{"args": {"limit": "ten"}}`))
+	rr := httptest.NewRecorder()
+	handlers.DynamicToolHandler(toolCfg)(rr, req)
+
+	if rr.Code != http.StatusUnprocessableEntity || rr.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("expected a 422 problem, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var p struct {
+		Errors []struct{ Field, Message string }
+	}
+	json.NewDecoder(rr.Body).Decode(&p)
+	if len(p.Errors) != 2 || p.Errors[0].Field != "query" || p.Errors[1].Field != "limit" {
+		t.Errorf("expected errors for query and limit, got %+v", p.Errors)
+	}
+}
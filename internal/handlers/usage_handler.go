@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/usage"
+)
+
+// UsageReport is the body of GET /api/v1/usage.
+// swagger:model UsageReport
+type UsageReport struct {
+	From  string       `json:"from" example:"2025-01-01"`
+	To    string       `json:"to" example:"2025-01-31"`
+	Rows  []usage.Row  `json:"rows"`
+	Total usage.Totals `json:"total"`
+}
+
+// UsageHandler godoc
+// @Summary Token usage report
+// @Description Returns the tokens and cost of chats between two days (UTC, inclusive; default the current month), grouped by day, principal (method:id, e.g. api_key:ci or jwt:alice) and model. Callers without the admin scope only see their own usage. Tokens are those reported by the backend; for backends that do not report usage they are approximated from the length of the text rather than counted with the model's tokenizer, and estimated_requests counts the requests concerned.
+// @Tags usage
+// @Produce json
+// @Param from query string false "First day (YYYY-MM-DD)"
+// @Param to query string false "Last day (YYYY-MM-DD)"
+// @Param principal query string false "Only this principal (method:id), or the principals with this API key id or JWT subject"
+// @Param model query string false "Only this model"
+// @Param group_by query string false "Comma-separated fields to group by: day, principal, model (default all)"
+// @Success 200 {object} UsageReport
+// @Failure 400 {object} problem.Problem
+// @Security ApiKeyAuth
+// @Security BearerAuth
+// @Router /api/v1/usage [get]
+func UsageHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	now := time.Now().UTC()
+	f := usage.Filter{
+		From:      q.Get("from"),
+		To:        q.Get("to"),
+		Principal: q.Get("principal"),
+		Model:     q.Get("model"),
+	}
+	if f.From == "" {
+		f.From = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Format(usage.DayFormat)
+	}
+	if f.To == "" {
+		f.To = now.Format(usage.DayFormat)
+	}
+	for _, day := range []string{f.From, f.To} {
+		if _, err := time.Parse(usage.DayFormat, day); err != nil {
+			problem.Error(w, r, http.StatusBadRequest, fmt.Sprintf("invalid day %q: expected YYYY-MM-DD", day))
+			return
+		}
+	}
+
+	groupBy := []string{"day", "principal", "model"}
+	if g := q.Get("group_by"); g != "" {
+		groupBy = strings.Split(g, ",")
+		for _, field := range groupBy {
+			if field != "day" && field != "principal" && field != "model" {
+				problem.Error(w, r, http.StatusBadRequest, fmt.Sprintf("cannot group by %q: expected day, principal or model", field))
+				return
+			}
+		}
+	}
+
+	// Callers only see their own usage unless they may administer the server.
+	if !seesEverything(r) {
+		f.Principal = principalID(r)
+	}
+
+	rows, total := usage.Default.Report(f, groupBy)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(UsageReport{From: f.From, To: f.To, Rows: rows, Total: total})
+}
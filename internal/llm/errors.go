@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// UpstreamError reports that a model backend failed or returned an unusable response.
+type UpstreamError struct {
+	Model string
+	// StatusCode is the HTTP status returned by the backend, 0 if it did not answer.
+	StatusCode int
+	Err        error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("model %q returned status %d: %v", e.Model, e.StatusCode, e.Err)
+	}
+	return fmt.Sprintf("model %q: %v", e.Model, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the backend did not answer in time.
+func (e *UpstreamError) Timeout() bool {
+	return IsTimeout(e.Err)
+}
+
+// IsTimeout reports whether err is a deadline or network timeout.
+func IsTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -21,4 +21,14 @@ type Message struct {
 // Response represents a generic response from an LLM.
 type Response struct {
 	Output string `json:"output"`
+	// Usage is the token usage reported by the provider, nil if it reported none.
+	Usage *Usage `json:"usage,omitempty"`
+}
+
+// Usage counts the tokens of one call.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	// Estimated is set when the counts were estimated with EstimateTokens instead of reported.
+	Estimated bool `json:"estimated,omitempty"`
 }
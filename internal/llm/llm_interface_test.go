@@ -45,3 +45,18 @@ func TestOllamaCall(t *testing.T) {
 		t.Errorf("expected %q, got %q", expected, resp.Output)
 	}
 }
+
+// TestEstimateTokens verifies the token estimate for backends that report no usage.
+func TestEstimateTokens(t *testing.T) {
+	for text, want := range map[string]int{
+		"":                     0,
+		"hello":                2,
+		"Hi, how are you?":     6,
+		`{"tool": "fstool"}`:   10,
+		"internationalization": 5,
+	} {
+		if got := EstimateTokens(text); got != want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", text, got, want)
+		}
+	}
+}
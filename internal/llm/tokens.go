@@ -0,0 +1,39 @@
+package llm
+
+import "unicode"
+
+// charsPerToken is the average length of a token in English text for BPE tokenizers.
+const charsPerToken = 4
+
+// EstimateTokens approximates the number of tokens of text for backends that do not report
+// usage: words count one token per charsPerToken characters (at least one), and every other
+// non-space character counts as a token of its own. It is a heuristic, not the tokenizer of
+// the model, so the count may be off, notably for code and for languages other than English;
+// usage counted this way is marked as estimated.
+func EstimateTokens(text string) int {
+	tokens, word := 0, 0
+	flush := func() {
+		if word > 0 {
+			tokens += (word + charsPerToken - 1) / charsPerToken
+			word = 0
+		}
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			word++
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
+
+// EstimateUsage returns the estimated usage of a call with the given prompt and completion.
+func EstimateUsage(prompt, completion string) Usage {
+	return Usage{PromptTokens: EstimateTokens(prompt), CompletionTokens: EstimateTokens(completion), Estimated: true}
+}
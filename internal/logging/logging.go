@@ -0,0 +1,156 @@
+// Package logging sets up the structured server log: its level and format, the request ID
+// every line of a request is tagged with, and the masking of secrets and personal data.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/tracing"
+)
+
+// Configure makes the log described by cfg the default of slog (and of the log package),
+// writing to stderr.
+func Configure(cfg *config.Config) {
+	slog.SetDefault(slog.New(NewHandler(os.Stderr, cfg.Server.Log)))
+	SetRedaction(cfg)
+}
+
+// SetRedaction masks the secrets of cfg and its redact patterns in the default redactor.
+// It is called again when the configuration is reloaded.
+func SetRedaction(cfg *config.Config) {
+	Default.Update(cfg.Secrets(), cfg.Server.Log.Redact)
+}
+
+// NewHandler returns a handler writing the records of at least the configured level to w in
+// the configured format, tagged with the request and trace of their context and masked by
+// the default redactor.
+func NewHandler(w io.Writer, lc config.LogConfig) slog.Handler {
+	opts := &slog.HandlerOptions{Level: ParseLevel(lc.Level)}
+	var h slog.Handler
+	if lc.Format == config.LogFormatJSON {
+		h = slog.NewJSONHandler(w, opts)
+	} else {
+		h = slog.NewTextHandler(w, opts)
+	}
+	return &contextHandler{redactHandler{h, Default}}
+}
+
+// ParseLevel returns the slog level of a configured level name (info if empty or unknown).
+func ParseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case config.LogLevelDebug:
+		return slog.LevelDebug
+	case config.LogLevelWarn:
+		return slog.LevelWarn
+	case config.LogLevelError:
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// contextHandler adds the request ID and trace ID of the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if span := tracing.FromContext(ctx); span != nil && span.Sampled {
+		r.AddAttrs(slog.String("trace_id", hex.EncodeToString(span.TraceID[:])))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
+
+// redactHandler masks the message and the attribute values of every record.
+type redactHandler struct {
+	slog.Handler
+	r *Redactor
+}
+
+func (h redactHandler) Handle(ctx context.Context, r slog.Record) error {
+	out := slog.NewRecord(r.Time, r.Level, h.r.Redact(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(h.attr(a))
+		return true
+	})
+	return h.Handler.Handle(ctx, out)
+}
+
+func (h redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.attr(a)
+	}
+	return redactHandler{h.Handler.WithAttrs(redacted), h.r}
+}
+
+func (h redactHandler) WithGroup(name string) slog.Handler {
+	return redactHandler{h.Handler.WithGroup(name), h.r}
+}
+
+func (h redactHandler) attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, h.r.Redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		attrs := make([]any, len(group))
+		for i, g := range group {
+			attrs[i] = h.attr(g)
+		}
+		return slog.Group(a.Key, attrs...)
+	case slog.KindAny:
+		// Errors and other values are logged by their text, which may contain secrets.
+		if err, ok := v.Any().(error); ok {
+			return slog.String(a.Key, h.r.Redact(err.Error()))
+		}
+		if redacted, ok := h.redactAny(v.Any()); ok {
+			return slog.Any(a.Key, redacted)
+		}
+	}
+	return slog.Attr{Key: a.Key, Value: v}
+}
+
+// redactAny masks a value such as a map of tool arguments or headers, and reports whether
+// it had anything to mask. Values are masked in their JSON form, so that they stay
+// structured in JSON logs, and otherwise replaced by their masked text.
+func (h redactHandler) redactAny(x any) (any, bool) {
+	text := fmt.Sprintf("%+v", x)
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(x); err == nil {
+		data := strings.TrimSuffix(buf.String(), "\n")
+		if redacted := h.r.Redact(data); redacted != data {
+			var out any
+			if json.Unmarshal([]byte(redacted), &out) == nil {
+				return out, true
+			}
+			return redacted, true
+		}
+	}
+	if redacted := h.r.Redact(text); redacted != text {
+		return redacted, true
+	}
+	return nil, false
+}
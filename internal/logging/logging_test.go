@@ -0,0 +1,83 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/logging"
+)
+
+func TestRedactor(t *testing.T) {
+	r := logging.NewRedactor()
+	r.Update([]string{"hunter2-secret", "abc"}, []string{`\b\d{3}-\d{2}-\d{4}\b`})
+
+	in := "key hunter2-secret, ssn 123-45-6789, openai sk-abcdefghijklmnopqrstuvwx, abc stays"
+	want := "key <masked>, ssn <masked>, openai <masked>, abc stays"
+	if got := r.Redact(in); got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got := r.Redact("Authorization: Bearer eyJhbGciOi.payload"); strings.Contains(got, "eyJhbGciOi") {
+		t.Errorf("expected the bearer token to be masked, got %q", got)
+	}
+}
+
+func TestHandler_RequestIDAndRedaction(t *testing.T) {
+	var buf bytes.Buffer
+	logging.Default.Update([]string{"top-secret-key"}, nil)
+	defer logging.Default.Update(nil, nil)
+	logger := slog.New(logging.NewHandler(&buf, config.LogConfig{Level: "debug", Format: "json"}))
+
+	h := logging.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger.DebugContext(r.Context(), "Sending message to model", "message", "my key is top-secret-key",
+			"args", map[string]interface{}{"token": "top-secret-key", "count": 2}, "tags", []string{"top-secret-key"})
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/hello", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-ID"); got != "abc-123" {
+		t.Errorf("expected the caller's request ID to be returned, got %q", got)
+	}
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("expected one JSON line, got %q: %v", buf.String(), err)
+	}
+	if line["request_id"] != "abc-123" || line["message"] != "my key is <masked>" || line["level"] != "DEBUG" {
+		t.Errorf("unexpected log line %v", line)
+	}
+	// Maps and slices are masked and stay structured.
+	args, _ := line["args"].(map[string]interface{})
+	if args["token"] != "<masked>" || args["count"] != 2.0 || strings.Contains(buf.String(), "top-secret-key") {
+		t.Errorf("expected the values of attributes to be masked, got %s", buf.String())
+	}
+}
+
+func TestRequestID_Generated(t *testing.T) {
+	h := logging.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if logging.RequestIDFromContext(r.Context()) == "" {
+			t.Error("expected a request ID in the context")
+		}
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "has spaces\n")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if id := rec.Header().Get("X-Request-ID"); len(id) != 32 {
+		t.Errorf("expected a generated ID instead of an invalid one, got %q", id)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for level, want := range map[string]slog.Level{"": slog.LevelInfo, "debug": slog.LevelDebug, "warn": slog.LevelWarn, "error": slog.LevelError} {
+		if got := logging.ParseLevel(level); got != want {
+			t.Errorf("ParseLevel(%q) = %v, want %v", level, got, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"krackenservices.com/agentAI/internal/config"
+)
+
+// Default masks the lines of the server log.
+var Default = NewRedactor()
+
+// minSecretLength keeps very short secrets from masking ordinary words.
+const minSecretLength = 6
+
+// builtinPatterns match common credential formats, which are masked even if they are not
+// part of the configuration, e.g. when a user pastes a key into a prompt.
+var builtinPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`),                                // OpenAI and Anthropic API keys
+	regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),                                   // AWS access key IDs
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),                         // GitHub tokens
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), // JWTs
+	regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/=-]{8,}`),                  // Authorization header values
+}
+
+// Redactor replaces secrets and values matching patterns with config.Masked.
+type Redactor struct {
+	mu       sync.RWMutex
+	secrets  *strings.Replacer
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor returns a redactor that masks the built-in credential formats.
+func NewRedactor() *Redactor {
+	return &Redactor{patterns: builtinPatterns}
+}
+
+// Update replaces the secrets and the extra patterns masked by r. Patterns that do not
+// compile are ignored; the configuration validates them.
+func (r *Redactor) Update(secrets []string, patterns []string) {
+	sorted := make([]string, 0, len(secrets))
+	for _, s := range secrets {
+		if len(s) >= minSecretLength {
+			sorted = append(sorted, s)
+		}
+	}
+	// Longer secrets first, so a secret containing another is masked whole.
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	var replacer *strings.Replacer
+	if len(sorted) > 0 {
+		pairs := make([]string, 0, 2*len(sorted))
+		for _, s := range sorted {
+			pairs = append(pairs, s, config.Masked)
+		}
+		replacer = strings.NewReplacer(pairs...)
+	}
+	compiled := append([]*regexp.Regexp(nil), builtinPatterns...)
+	for _, p := range patterns {
+		if re, err := regexp.Compile(p); err == nil {
+			compiled = append(compiled, re)
+		}
+	}
+
+	r.mu.Lock()
+	r.secrets, r.patterns = replacer, compiled
+	r.mu.Unlock()
+}
+
+// Redact returns s with secrets and matches of the patterns masked.
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.secrets != nil {
+		s = r.secrets.Replace(s)
+	}
+	for _, re := range r.patterns {
+		s = re.ReplaceAllString(s, config.Masked)
+	}
+	return s
+}
@@ -0,0 +1,148 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// DefaultTimeout bounds each request to an MCP server unless the server config sets its own.
+const DefaultTimeout = 30 * time.Second
+
+// ClientInfo identifies agentAI to the MCP servers it connects to.
+var ClientInfo = Implementation{Name: "agentAI", Version: "1.0"}
+
+// transport moves JSON-RPC messages between the client and a server.
+type transport interface {
+	// send delivers msg. For requests it blocks until the matching response arrives;
+	// for notifications it returns a nil message.
+	send(ctx context.Context, msg *Message) (*Message, error)
+	close() error
+}
+
+// Client is a connection to a single MCP server.
+type Client struct {
+	ID         string
+	ServerInfo Implementation
+
+	t       transport
+	timeout time.Duration
+	nextID  atomic.Int64
+}
+
+// Connect starts the transport described by cfg and performs the MCP initialize handshake.
+func Connect(ctx context.Context, cfg toolmodel.MCPServerConfig) (*Client, error) {
+	timeout := DefaultTimeout
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout %q for mcp server '%s': %w", cfg.Timeout, cfg.ID, err)
+		}
+		timeout = d
+	}
+
+	var (
+		t   transport
+		err error
+	)
+	switch cfg.Transport {
+	case "stdio":
+		t, err = newStdioTransport(cfg)
+	case "http":
+		t, err = newHTTPTransport(cfg)
+	default:
+		return nil, fmt.Errorf("unknown transport '%s' for mcp server '%s'", cfg.Transport, cfg.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{ID: cfg.ID, t: t, timeout: timeout}
+	var init InitializeResult
+	err = c.call(ctx, "initialize", InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]interface{}{},
+		ClientInfo:      ClientInfo,
+	}, &init)
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf("mcp server '%s' initialize failed: %w", cfg.ID, err)
+	}
+	c.ServerInfo = init.ServerInfo
+
+	if err := c.notify(ctx, "notifications/initialized"); err != nil {
+		t.close()
+		return nil, fmt.Errorf("mcp server '%s' initialized notification failed: %w", cfg.ID, err)
+	}
+	return c, nil
+}
+
+// ListTools returns every tool the server advertises, following pagination cursors.
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var tools []Tool
+	params := ListToolsParams{}
+	for {
+		var res ListToolsResult
+		if err := c.call(ctx, "tools/list", params, &res); err != nil {
+			return nil, err
+		}
+		tools = append(tools, res.Tools...)
+		if res.NextCursor == "" {
+			return tools, nil
+		}
+		params.Cursor = res.NextCursor
+	}
+}
+
+// CallTool invokes a tool on the server.
+func (c *Client) CallTool(ctx context.Context, name string, args map[string]interface{}) (*CallToolResult, error) {
+	var res CallToolResult
+	if err := c.call(ctx, "tools/call", CallToolParams{Name: name, Arguments: args}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Close shuts down the connection (and subprocess, for stdio servers).
+func (c *Client) Close() error {
+	return c.t.close()
+}
+
+// call sends a request and decodes its result into out.
+func (c *Client) call(ctx context.Context, method string, params, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s params: %w", method, err)
+	}
+	id := strconv.FormatInt(c.nextID.Add(1), 10)
+	resp, err := c.t.send(ctx, &Message{JSONRPC: "2.0", ID: json.RawMessage(id), Method: method, Params: raw})
+	if err != nil {
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if out == nil || len(resp.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, out); err != nil {
+		return fmt.Errorf("invalid %s result: %w", method, err)
+	}
+	return nil
+}
+
+// notify sends a notification, which has no response.
+func (c *Client) notify(ctx context.Context, method string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	_, err := c.t.send(ctx, &Message{JSONRPC: "2.0", Method: method})
+	return err
+}
@@ -0,0 +1,99 @@
+package mcp_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/mcp"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// checkPool verifies discovery and dispatch against a pool connected to the fixture as server "fx".
+func checkPool(t *testing.T, pool *mcp.Pool, tools []toolmodel.ToolConfig) {
+	t.Helper()
+	if len(tools) != 2 {
+		t.Fatalf("expected 2 tools across both pages, got %d", len(tools))
+	}
+	echo := tools[0]
+	if echo.ID != "fx.echo" || !echo.IsMCP() || echo.MCP.Tool != "echo" {
+		t.Errorf("unexpected tool config %+v", echo)
+	}
+	if echo.InputSchema["type"] != "object" {
+		t.Errorf("expected input schema to be kept, got %v", echo.InputSchema)
+	}
+
+	out, err := pool.CallTool(context.Background(), echo.MCP, map[string]interface{}{"text": "hi"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if out != "echo: hi" {
+		t.Errorf("expected %q, got %q", "echo: hi", out)
+	}
+
+	_, err = pool.CallTool(context.Background(), tools[1].MCP, nil)
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected tool error result to be returned as error, got %v", err)
+	}
+}
+
+func TestPool_Stdio(t *testing.T) {
+	pool := mcp.NewPool()
+	defer pool.Close()
+
+	tools, err := pool.Connect(context.Background(), []toolmodel.MCPServerConfig{{
+		ID:        "fx",
+		Transport: "stdio",
+		Command:   os.Args[0],
+		Args:      []string{"-test.run=TestFixtureServer"},
+		Env:       map[string]string{"GO_WANT_MCP_FIXTURE": "1"},
+	}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	checkPool(t, pool, tools)
+}
+
+func TestPool_HTTP(t *testing.T) {
+	for _, sse := range []bool{false, true} {
+		srv := httptest.NewServer(fixtureHTTPHandler(sse))
+		pool := mcp.NewPool()
+
+		tools, err := pool.Connect(context.Background(), []toolmodel.MCPServerConfig{{
+			ID:        "fx",
+			Transport: "http",
+			URL:       srv.URL,
+		}})
+		if err != nil {
+			t.Fatalf("sse=%v: expected no error, got %v", sse, err)
+		}
+		checkPool(t, pool, tools)
+
+		pool.Close()
+		srv.Close()
+	}
+}
+
+// TestPool_UnreachableServer verifies that a failing server is reported without blocking the others.
+func TestPool_UnreachableServer(t *testing.T) {
+	srv := httptest.NewServer(fixtureHTTPHandler(false))
+	defer srv.Close()
+	pool := mcp.NewPool()
+	defer pool.Close()
+
+	tools, err := pool.Connect(context.Background(), []toolmodel.MCPServerConfig{
+		{ID: "broken", Transport: "stdio", Command: "/nonexistent/mcp-server"},
+		{ID: "fx", Transport: "http", URL: srv.URL},
+	})
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("expected error for broken server, got %v", err)
+	}
+	if len(tools) != 2 {
+		t.Errorf("expected tools from the working server, got %d", len(tools))
+	}
+	if _, err := pool.CallTool(context.Background(), &toolmodel.MCPToolRef{Server: "broken", Tool: "x"}, nil); err == nil {
+		t.Error("expected error calling a tool on an unconnected server")
+	}
+}
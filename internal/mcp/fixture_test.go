@@ -0,0 +1,122 @@
+package mcp_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/mcp"
+)
+
+// fixtureHandle is a minimal MCP server used by the tests. It advertises two tools over
+// two pages of tools/list: "echo" returns its "text" argument and "fail" reports an error.
+func fixtureHandle(msg *mcp.Message) *mcp.Message {
+	if len(msg.ID) == 0 {
+		return nil
+	}
+	resp := &mcp.Message{JSONRPC: "2.0", ID: msg.ID}
+	var result interface{}
+	switch msg.Method {
+	case "initialize":
+		result = mcp.InitializeResult{
+			ProtocolVersion: mcp.ProtocolVersion,
+			Capabilities:    map[string]interface{}{"tools": map[string]interface{}{}},
+			ServerInfo:      mcp.Implementation{Name: "fixture", Version: "0.1"},
+		}
+	case "tools/list":
+		var params mcp.ListToolsParams
+		json.Unmarshal(msg.Params, &params)
+		if params.Cursor == "" {
+			result = mcp.ListToolsResult{
+				Tools: []mcp.Tool{{
+					Name:        "echo",
+					Description: "Echo the text argument",
+					InputSchema: map[string]interface{}{
+						"type":       "object",
+						"properties": map[string]interface{}{"text": map[string]interface{}{"type": "string"}},
+					},
+				}},
+				NextCursor: "page2",
+			}
+		} else {
+			result = mcp.ListToolsResult{Tools: []mcp.Tool{{Name: "fail", InputSchema: map[string]interface{}{"type": "object"}}}}
+		}
+	case "tools/call":
+		var params mcp.CallToolParams
+		json.Unmarshal(msg.Params, &params)
+		switch params.Name {
+		case "echo":
+			result = mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: fmt.Sprintf("echo: %v", params.Arguments["text"])}}}
+		default:
+			result = mcp.CallToolResult{Content: []mcp.Content{{Type: "text", Text: "boom"}}, IsError: true}
+		}
+	default:
+		resp.Error = &mcp.RPCError{Code: mcp.CodeMethodNotFound, Message: msg.Method}
+		return resp
+	}
+	resp.Result, _ = json.Marshal(result)
+	return resp
+}
+
+// serveFixture runs the fixture over newline-delimited JSON, as a stdio MCP server does.
+func serveFixture(in io.Reader, out io.Writer) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		var msg mcp.Message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if resp := fixtureHandle(&msg); resp != nil {
+			data, _ := json.Marshal(resp)
+			out.Write(append(data, '\n'))
+		}
+	}
+}
+
+// fixtureHTTPHandler serves the fixture over streamable HTTP. With sse set, responses
+// are sent as a server-sent event stream preceded by an unrelated notification.
+func fixtureHTTPHandler(sse bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			return
+		}
+		var msg mcp.Message
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if msg.Method != "initialize" && r.Header.Get("Mcp-Session-Id") != "session-1" {
+			http.Error(w, "missing session", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Mcp-Session-Id", "session-1")
+		resp := fixtureHandle(&msg)
+		if resp == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data, _ := json.Marshal(resp)
+		if !sse {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(data)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+	}
+}
+
+// TestFixtureServer runs the fixture as a stdio MCP server when invoked as a subprocess.
+// It is not a real test.
+func TestFixtureServer(t *testing.T) {
+	if os.Getenv("GO_WANT_MCP_FIXTURE") != "1" {
+		return
+	}
+	serveFixture(os.Stdin, os.Stdout)
+	os.Exit(0)
+}
@@ -0,0 +1,154 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"krackenservices.com/agentAI/internal/toolmodel"
+	"krackenservices.com/agentAI/internal/tracing"
+)
+
+// sessionHeader carries the session ID assigned by a streamable HTTP server.
+const sessionHeader = "Mcp-Session-Id"
+
+// HTTPClient is used by the streamable HTTP transport. Tests may replace it.
+var HTTPClient = &http.Client{}
+
+// httpTransport implements the MCP streamable HTTP transport: each message is POSTed
+// to the endpoint and the response arrives either as JSON or as a server-sent event stream.
+type httpTransport struct {
+	id      string
+	url     string
+	headers map[string]string
+
+	mu      sync.Mutex
+	session string
+}
+
+func newHTTPTransport(cfg toolmodel.MCPServerConfig) (*httpTransport, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("mcp server '%s' uses http transport but has no url", cfg.ID)
+	}
+	return &httpTransport{id: cfg.ID, url: cfg.URL, headers: cfg.Headers}, nil
+}
+
+func (t *httpTransport) newRequest(ctx context.Context, method string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, body)
+	if err != nil {
+		return nil, fmt.Errorf("mcp server '%s': %w", t.id, err)
+	}
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.session != "" {
+		req.Header.Set(sessionHeader, t.session)
+	}
+	t.mu.Unlock()
+	tracing.Inject(ctx, req.Header)
+	return req, nil
+}
+
+func (t *httpTransport) send(ctx context.Context, msg *Message) (*Message, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, err := t.newRequest(ctx, http.MethodPost, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("mcp server '%s': %w", t.id, err)
+	}
+	defer resp.Body.Close()
+
+	if session := resp.Header.Get(sessionHeader); session != "" {
+		t.mu.Lock()
+		t.session = session
+		t.mu.Unlock()
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("mcp server '%s' returned status %d: %s", t.id, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if len(msg.ID) == 0 {
+		// Notifications are acknowledged with 202 Accepted and no body.
+		return nil, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return t.readEventStream(resp.Body, msg.ID)
+	}
+
+	var out Message
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("mcp server '%s': invalid response: %w", t.id, err)
+	}
+	return &out, nil
+}
+
+// readEventStream reads SSE events until the response to the request with the given ID arrives.
+func (t *httpTransport) readEventStream(body io.Reader, id json.RawMessage) (*Message, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+		// A blank line terminates the event.
+		var msg Message
+		err := json.Unmarshal([]byte(data.String()), &msg)
+		data.Reset()
+		if err != nil {
+			continue
+		}
+		if msg.IsResponse() && bytes.Equal(msg.ID, id) {
+			return &msg, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("mcp server '%s': %w", t.id, err)
+	}
+	return nil, fmt.Errorf("mcp server '%s' closed the event stream without a response", t.id)
+}
+
+// close terminates the session, if the server assigned one.
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	session := t.session
+	t.mu.Unlock()
+	if session == "" {
+		return nil
+	}
+	req, err := t.newRequest(context.Background(), http.MethodDelete, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
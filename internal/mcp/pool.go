@@ -0,0 +1,133 @@
+package mcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// Pool holds the connected MCP servers and dispatches tool calls to them.
+type Pool struct {
+	mu      sync.RWMutex
+	clients map[string]*Client
+}
+
+// DefaultPool is the pool used by the API server and tool handlers.
+var DefaultPool = NewPool()
+
+// NewPool returns an empty pool.
+func NewPool() *Pool {
+	return &Pool{clients: make(map[string]*Client)}
+}
+
+// Connect connects to every enabled server, discovers its tools and returns them as
+// tool configurations with IDs of the form "<server id>.<tool name>". A server that
+// fails is skipped and reported in the returned error; the others remain usable.
+func (p *Pool) Connect(ctx context.Context, servers []toolmodel.MCPServerConfig) ([]toolmodel.ToolConfig, error) {
+	var (
+		tools []toolmodel.ToolConfig
+		errs  []error
+	)
+	for _, srv := range servers {
+		if srv.Enabled != nil && !*srv.Enabled {
+			continue
+		}
+		client, err := Connect(ctx, srv)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		discovered, err := client.ListTools(ctx)
+		if err != nil {
+			client.Close()
+			errs = append(errs, fmt.Errorf("mcp server '%s' tools/list failed: %w", srv.ID, err))
+			continue
+		}
+
+		p.mu.Lock()
+		if old, ok := p.clients[srv.ID]; ok {
+			old.Close()
+		}
+		p.clients[srv.ID] = client
+		p.mu.Unlock()
+
+		for _, t := range discovered {
+			tools = append(tools, ToolConfig(srv.ID, t))
+		}
+	}
+	return tools, errors.Join(errs...)
+}
+
+// ToolConfig converts a tool advertised by an MCP server into agentAI's tool configuration.
+func ToolConfig(serverID string, t Tool) toolmodel.ToolConfig {
+	enabled := true
+	return toolmodel.ToolConfig{
+		ID:          serverID + "." + t.Name,
+		Name:        t.Name,
+		Description: t.Description,
+		Type:        toolmodel.TypeMCP,
+		MCP:         &toolmodel.MCPToolRef{Server: serverID, Tool: t.Name},
+		InputSchema: t.InputSchema,
+		Enabled:     &enabled,
+	}
+}
+
+// CallTool invokes a tool on a connected server and returns its text output.
+// A result flagged as an error by the server is returned as an error.
+func (p *Pool) CallTool(ctx context.Context, ref *toolmodel.MCPToolRef, args map[string]interface{}) (string, error) {
+	if ref == nil {
+		return "", fmt.Errorf("mcp tool has no server reference")
+	}
+	p.mu.RLock()
+	client, ok := p.clients[ref.Server]
+	p.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("mcp server '%s' is not connected", ref.Server)
+	}
+	res, err := client.CallTool(ctx, ref.Tool, args)
+	if err != nil {
+		return "", err
+	}
+	if res.IsError {
+		return "", fmt.Errorf("mcp tool '%s' failed: %s", ref.Tool, res.Text())
+	}
+	return res.Text(), nil
+}
+
+// Replace disconnects the servers with the IDs in remove, then moves the servers of other
+// into the pool, disconnecting those they replace. It applies a reload once the new
+// configuration has been accepted.
+func (p *Pool) Replace(remove []string, other *Pool) {
+	other.mu.Lock()
+	clients := other.clients
+	other.clients = make(map[string]*Client)
+	other.mu.Unlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, id := range remove {
+		if c, ok := p.clients[id]; ok {
+			c.Close()
+			delete(p.clients, id)
+		}
+	}
+	for id, c := range clients {
+		if old, ok := p.clients[id]; ok {
+			old.Close()
+		}
+		p.clients[id] = c
+	}
+}
+
+// Close disconnects every server in the pool.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id, c := range p.clients {
+		c.Close()
+		delete(p.clients, id)
+	}
+}
@@ -0,0 +1,186 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// Server exposes a set of tools to MCP clients over stdio or streamable HTTP.
+type Server struct {
+	// Info identifies the server in the initialize handshake.
+	Info Implementation
+	// Tools returns the tools to advertise to the caller identified by ctx. It is called for
+	// every request so the catalogue can change while the server runs.
+	Tools func(ctx context.Context) []toolmodel.ToolConfig
+	// Mask, if set, returns the tool as advertised, with its secret values hidden.
+	Mask func(tool toolmodel.ToolConfig) toolmodel.ToolConfig
+	// Call executes a tool with the arguments supplied by the client.
+	Call func(ctx context.Context, tool toolmodel.ToolConfig, args map[string]interface{}) (string, error)
+}
+
+// Handle processes one message and returns the response, or nil for notifications.
+func (s *Server) Handle(ctx context.Context, msg *Message) *Message {
+	if len(msg.ID) == 0 {
+		return nil
+	}
+	resp := &Message{JSONRPC: "2.0", ID: msg.ID}
+	var (
+		result interface{}
+		rpcErr *RPCError
+	)
+	switch msg.Method {
+	case "initialize":
+		result = InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]interface{}{"tools": map[string]interface{}{"listChanged": false}},
+			ServerInfo:      s.Info,
+		}
+	case "ping":
+		result = struct{}{}
+	case "tools/list":
+		result = s.listTools(ctx)
+	case "tools/call":
+		result, rpcErr = s.callTool(ctx, msg.Params)
+	default:
+		rpcErr = &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+	if rpcErr != nil {
+		resp.Error = rpcErr
+		return resp
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		resp.Error = &RPCError{Code: CodeInternalError, Message: err.Error()}
+		return resp
+	}
+	resp.Result = data
+	return resp
+}
+
+func (s *Server) listTools(ctx context.Context) ListToolsResult {
+	res := ListToolsResult{Tools: []Tool{}}
+	for _, tool := range s.Tools(ctx) {
+		if s.Mask != nil {
+			tool = s.Mask(tool)
+		}
+		res.Tools = append(res.Tools, Tool{
+			Name:        tool.ID,
+			Description: tool.Description,
+			InputSchema: tool.ArgumentSchema(),
+		})
+	}
+	return res
+}
+
+func (s *Server) callTool(ctx context.Context, raw json.RawMessage) (interface{}, *RPCError) {
+	var params CallToolParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: "invalid tools/call params: " + err.Error()}
+	}
+	for _, tool := range s.Tools(ctx) {
+		if tool.ID != params.Name {
+			continue
+		}
+		output, err := s.Call(ctx, tool, params.Arguments)
+		if err != nil {
+			// Tool failures are reported in the result so the calling model can see them.
+			return CallToolResult{Content: []Content{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+		}
+		return CallToolResult{Content: []Content{{Type: "text", Text: output}}}, nil
+	}
+	return nil, &RPCError{Code: CodeInvalidParams, Message: "unknown tool: " + params.Name}
+}
+
+// ServeStdio reads newline-delimited messages from in and writes responses to out until in
+// is closed or ctx is cancelled. Requests are handled concurrently.
+func (s *Server) ServeStdio(ctx context.Context, in io.Reader, out io.Writer) error {
+	var (
+		writeMu sync.Mutex
+		wg      sync.WaitGroup
+	)
+	write := func(msg *Message) {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return
+		}
+		writeMu.Lock()
+		out.Write(append(data, '\n'))
+		writeMu.Unlock()
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			break
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			write(&Message{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &RPCError{Code: CodeParseError, Message: err.Error()}})
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if resp := s.Handle(ctx, &msg); resp != nil {
+				write(resp)
+			}
+		}()
+	}
+	wg.Wait()
+	return scanner.Err()
+}
+
+// ServeHTTP implements the streamable HTTP transport. Each POSTed message is answered with a
+// JSON response; the server does not open server-initiated event streams.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		// Sessions hold no state, so terminating one is a no-op.
+		w.WriteHeader(http.StatusOK)
+		return
+	default:
+		w.Header().Set("Allow", "POST, DELETE")
+		problem.Error(w, r, http.StatusMethodNotAllowed, "only POST and DELETE requests are allowed")
+		return
+	}
+
+	var msg Message
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&Message{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &RPCError{Code: CodeParseError, Message: err.Error()}})
+		return
+	}
+
+	if msg.Method == "initialize" {
+		w.Header().Set(sessionHeader, newSessionID())
+	}
+	resp := s.Handle(r.Context(), &msg)
+	if resp == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
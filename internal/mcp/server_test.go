@@ -0,0 +1,124 @@
+package mcp_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/mcp"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// newTestServer advertises a binary-style tool with command args and a failing tool.
+func newTestServer() *mcp.Server {
+	return &mcp.Server{
+		Info: mcp.Implementation{Name: "agentAI", Version: "test"},
+		Tools: func(context.Context) []toolmodel.ToolConfig {
+			return []toolmodel.ToolConfig{
+				{ID: "fstool", Description: "List files", CommandArgs: map[string]interface{}{"path": "."}},
+				{ID: "broken", Description: "Always fails"},
+			}
+		},
+		Call: func(ctx context.Context, tool toolmodel.ToolConfig, args map[string]interface{}) (string, error) {
+			if tool.ID == "broken" {
+				return "", errors.New("exit status 1")
+			}
+			return fmt.Sprintf("listing %v", args["path"]), nil
+		},
+	}
+}
+
+// TestServer_HTTPRoundTrip connects agentAI's own MCP client to the server's HTTP transport.
+func TestServer_HTTPRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(newTestServer())
+	defer srv.Close()
+	pool := mcp.NewPool()
+	defer pool.Close()
+
+	tools, err := pool.Connect(context.Background(), []toolmodel.MCPServerConfig{{ID: "agent", Transport: "http", URL: srv.URL}})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(tools) != 2 || tools[0].MCP.Tool != "fstool" {
+		t.Fatalf("unexpected tools %+v", tools)
+	}
+	props, _ := tools[0].InputSchema["properties"].(map[string]interface{})
+	if path, _ := props["path"].(map[string]interface{}); path["type"] != "string" || path["default"] != "." {
+		t.Errorf("expected schema derived from command args, got %v", tools[0].InputSchema)
+	}
+
+	out, err := pool.CallTool(context.Background(), tools[0].MCP, map[string]interface{}{"path": "/tmp"})
+	if err != nil || out != "listing /tmp" {
+		t.Errorf("expected tool output, got %q (err %v)", out, err)
+	}
+	if _, err := pool.CallTool(context.Background(), tools[1].MCP, nil); err == nil || !strings.Contains(err.Error(), "exit status 1") {
+		t.Errorf("expected tool failure to be reported, got %v", err)
+	}
+	if _, err := pool.CallTool(context.Background(), &toolmodel.MCPToolRef{Server: "agent", Tool: "missing"}, nil); err == nil {
+		t.Error("expected error for unknown tool")
+	}
+}
+
+// TestServer_Stdio exchanges raw newline-delimited messages with ServeStdio.
+func TestServer_Stdio(t *testing.T) {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- newTestServer().ServeStdio(context.Background(), inR, outW)
+		outW.Close()
+	}()
+
+	responses := bufio.NewScanner(outR)
+	roundTrip := func(line string) mcp.Message {
+		t.Helper()
+		if _, err := io.WriteString(inW, line+"\n"); err != nil {
+			t.Fatalf("write failed: %v", err)
+		}
+		if !responses.Scan() {
+			t.Fatalf("no response to %s", line)
+		}
+		var msg mcp.Message
+		if err := json.Unmarshal(responses.Bytes(), &msg); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		return msg
+	}
+
+	init := roundTrip(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"t","version":"1"}}}`)
+	if init.Error != nil || !strings.Contains(string(init.Result), `"agentAI"`) {
+		t.Errorf("unexpected initialize response %s", init.Result)
+	}
+	// Notifications get no response; the next line read belongs to the following request.
+	io.WriteString(inW, `{"jsonrpc":"2.0","method":"notifications/initialized"}`+"\n")
+
+	list := roundTrip(`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	var tools mcp.ListToolsResult
+	json.Unmarshal(list.Result, &tools)
+	if len(tools.Tools) != 2 {
+		t.Errorf("expected 2 tools, got %d", len(tools.Tools))
+	}
+
+	call := roundTrip(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"fstool","arguments":{"path":"."}}}`)
+	var res mcp.CallToolResult
+	json.Unmarshal(call.Result, &res)
+	if res.IsError || res.Text() != "listing ." {
+		t.Errorf("unexpected call result %+v", res)
+	}
+
+	unknown := roundTrip(`{"jsonrpc":"2.0","id":4,"method":"resources/list"}`)
+	if unknown.Error == nil || unknown.Error.Code != mcp.CodeMethodNotFound {
+		t.Errorf("expected method not found, got %+v", unknown)
+	}
+
+	inW.Close()
+	if err := <-done; err != nil {
+		t.Errorf("expected clean shutdown, got %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+const (
+	// maxMessageSize bounds a single newline-delimited JSON-RPC message on stdio.
+	maxMessageSize = 16 * 1024 * 1024
+	// stdioCloseTimeout is how long a server may take to exit after its stdin is closed.
+	stdioCloseTimeout = 2 * time.Second
+)
+
+// stdioTransport talks to an MCP server running as a subprocess, exchanging
+// newline-delimited JSON-RPC messages over its stdin and stdout.
+type stdioTransport struct {
+	id    string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[string]chan *Message
+	done    chan struct{}
+	err     error
+}
+
+func newStdioTransport(cfg toolmodel.MCPServerConfig) (*stdioTransport, error) {
+	if cfg.Command == "" {
+		return nil, fmt.Errorf("mcp server '%s' uses stdio transport but has no command", cfg.ID)
+	}
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("mcp server '%s': %w", cfg.ID, err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("mcp server '%s': %w", cfg.ID, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting mcp server '%s': %w", cfg.ID, err)
+	}
+
+	t := &stdioTransport{
+		id:      cfg.ID,
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: make(map[string]chan *Message),
+		done:    make(chan struct{}),
+	}
+	go t.readLoop(stdout)
+	return t, nil
+}
+
+// readLoop dispatches responses to their waiting requests until stdout closes.
+func (t *stdioTransport) readLoop(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			slog.Warn("Ignoring malformed message from MCP server", "server", t.id, "error", err)
+			continue
+		}
+		switch {
+		case msg.IsResponse():
+			t.mu.Lock()
+			ch, ok := t.pending[string(msg.ID)]
+			delete(t.pending, string(msg.ID))
+			t.mu.Unlock()
+			if ok {
+				ch <- &msg
+			}
+		case len(msg.ID) > 0:
+			// Server-initiated request. Answer pings; agentAI offers no other client features.
+			reply := &Message{JSONRPC: "2.0", ID: msg.ID}
+			if msg.Method == "ping" {
+				reply.Result = json.RawMessage("{}")
+			} else {
+				reply.Error = &RPCError{Code: CodeMethodNotFound, Message: "method not supported: " + msg.Method}
+			}
+			t.write(reply)
+		}
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	t.mu.Lock()
+	t.err = fmt.Errorf("mcp server '%s' closed its output: %w", t.id, err)
+	t.pending = nil
+	t.mu.Unlock()
+	close(t.done)
+}
+
+func (t *stdioTransport) write(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) send(ctx context.Context, msg *Message) (*Message, error) {
+	if len(msg.ID) == 0 {
+		return nil, t.write(msg)
+	}
+
+	ch := make(chan *Message, 1)
+	key := string(msg.ID)
+	t.mu.Lock()
+	if t.pending == nil {
+		err := t.err
+		t.mu.Unlock()
+		return nil, err
+	}
+	t.pending[key] = ch
+	t.mu.Unlock()
+
+	if err := t.write(msg); err != nil {
+		t.forget(key)
+		return nil, fmt.Errorf("error writing to mcp server '%s': %w", t.id, err)
+	}
+
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-t.done:
+		return nil, t.err
+	case <-ctx.Done():
+		t.forget(key)
+		return nil, fmt.Errorf("mcp server '%s': %s: %w", t.id, msg.Method, ctx.Err())
+	}
+}
+
+func (t *stdioTransport) forget(key string) {
+	t.mu.Lock()
+	if t.pending != nil {
+		delete(t.pending, key)
+	}
+	t.mu.Unlock()
+}
+
+// close ends the session by closing stdin, then kills the process if it does not exit.
+func (t *stdioTransport) close() error {
+	t.stdin.Close()
+	waitErr := make(chan error, 1)
+	go func() { waitErr <- t.cmd.Wait() }()
+	select {
+	case err := <-waitErr:
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil
+		}
+		return err
+	case <-time.After(stdioCloseTimeout):
+		t.cmd.Process.Kill()
+		<-waitErr
+		return nil
+	}
+}
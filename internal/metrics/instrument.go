@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The metrics of the server.
+var (
+	HTTPRequests = Default.NewCounterVec("agentai_http_requests_total",
+		"HTTP requests by method, route pattern and status code.", "method", "route", "code")
+	HTTPDuration = Default.NewHistogramVec("agentai_http_request_duration_seconds",
+		"Latency of HTTP requests by method and route pattern.", DefBuckets, "method", "route")
+
+	LLMCalls = Default.NewCounterVec("agentai_llm_calls_total",
+		"Calls to language models by model, vendor and outcome (ok or error).", "model", "vendor", "outcome")
+	LLMDuration = Default.NewHistogramVec("agentai_llm_call_duration_seconds",
+		"Latency of calls to language models.", DefBuckets, "model", "vendor")
+	LLMTokens = Default.NewCounterVec("agentai_llm_tokens_total",
+		"Tokens used with language models by type (prompt or completion).", "model", "vendor", "type")
+
+	ToolExecutions = Default.NewCounterVec("agentai_tool_executions_total",
+		"Tool executions by tool ID and exit code (0 on success, error when the tool could not be run or returned no exit code).", "tool", "exit_code")
+	ToolDuration = Default.NewHistogramVec("agentai_tool_execution_duration_seconds",
+		"Duration of tool executions.", DefBuckets, "tool")
+
+	AgentIterations = Default.NewHistogramVec("agentai_agent_loop_iterations",
+		"Model calls per agent run.", []float64{1, 2, 3, 5, 8, 13, 21}, "model")
+	RunsInFlight = Default.NewGaugeVec("agentai_runs_in_flight",
+		"Agent runs in progress.")
+)
+
+// Since returns the seconds elapsed since start.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+// StatusRecorder captures the status code written by a handler. The logging, tracing and
+// metrics middlewares share the recorder of a request (see RecordStatus), so that it is
+// only wrapped once.
+type StatusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+// RecordStatus returns w if it already records the status, and otherwise wraps it.
+func RecordStatus(w http.ResponseWriter) *StatusRecorder {
+	if rec, ok := w.(*StatusRecorder); ok {
+		return rec
+	}
+	return &StatusRecorder{ResponseWriter: w}
+}
+
+// Status returns the status code written so far, 200 if the handler wrote none.
+func (r *StatusRecorder) Status() int {
+	if r.code == 0 {
+		return http.StatusOK
+	}
+	return r.code
+}
+
+func (r *StatusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *StatusRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush lets streaming handlers flush through the recorder.
+func (r *StatusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (r *StatusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Instrument counts the requests to next and their latency under the route label. Route is
+// the path pattern it is registered under, so that path values do not create new series.
+func Instrument(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := RecordStatus(w)
+		next(rec, r)
+		HTTPRequests.Inc(r.Method, route, strconv.Itoa(rec.Status()))
+		HTTPDuration.Observe(Since(start), r.Method, route)
+	}
+}
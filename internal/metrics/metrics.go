@@ -0,0 +1,223 @@
+// Package metrics implements the counters, gauges and histograms of the server and serves
+// them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default is the registry served on /metrics.
+var Default = NewRegistry()
+
+// DefBuckets are the default histogram buckets, in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// Registry holds a set of metrics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*vec
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// series is the state of one combination of label values.
+type series struct {
+	labels []string
+	value  float64
+	// counts holds the cumulative count of each bucket of a histogram, sum the sum of observations.
+	counts []uint64
+	sum    float64
+}
+
+// vec is a metric family with a value per combination of label values.
+type vec struct {
+	name, help, kind string
+	labels           []string
+	buckets          []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+func (r *Registry) register(name, help, kind string, labels []string, buckets []float64) *vec {
+	v := &vec{name: name, help: help, kind: kind, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.metrics {
+		if m.name == name {
+			panic("metrics: duplicate metric " + name)
+		}
+	}
+	r.metrics = append(r.metrics, v)
+	return v
+}
+
+// with calls f with the series of the label values, creating it if needed.
+func (v *vec) with(values []string, f func(s *series)) {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labels: append([]string(nil), values...)}
+		if v.kind == "histogram" {
+			s.counts = make([]uint64, len(v.buckets))
+		}
+		v.series[key] = s
+	}
+	f(s)
+}
+
+// CounterVec is a counter with labels.
+type CounterVec struct{ v *vec }
+
+// NewCounterVec registers a counter. Counter names should end in _total.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, "counter", labels, nil)}
+}
+
+// Add adds delta, which must not be negative, to the counter of the label values.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	c.v.with(values, func(s *series) { s.value += delta })
+}
+
+// Inc adds one to the counter of the label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// GaugeVec is a gauge with labels.
+type GaugeVec struct{ v *vec }
+
+// NewGaugeVec registers a gauge.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(name, help, "gauge", labels, nil)}
+}
+
+// Add adds delta to the gauge of the label values.
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.v.with(values, func(s *series) { s.value += delta })
+}
+
+// Set sets the gauge of the label values.
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.v.with(values, func(s *series) { s.value = value })
+}
+
+// HistogramVec is a histogram with labels.
+type HistogramVec struct{ v *vec }
+
+// NewHistogramVec registers a histogram with the given upper bounds, in increasing order.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{r.register(name, help, "histogram", labels, buckets)}
+}
+
+// Observe adds an observation to the histogram of the label values.
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.v.with(values, func(s *series) {
+		for i, upper := range h.v.buckets {
+			if value <= upper {
+				s.counts[i]++
+			}
+		}
+		s.value++
+		s.sum += value
+	})
+}
+
+// WriteText writes every metric in the Prometheus text exposition format (version 0.0.4).
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]*vec(nil), r.metrics...)
+	r.mu.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (v *vec) write(w *bufio.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n", v.name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.name, v.kind)
+
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := v.series[k]
+		if v.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", v.name, labelSet(v.labels, s.labels, "", ""), formatFloat(s.value))
+			continue
+		}
+		for i, upper := range v.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", v.name, labelSet(v.labels, s.labels, "le", formatFloat(upper)), s.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %s\n", v.name, labelSet(v.labels, s.labels, "le", "+Inf"), formatFloat(s.value))
+		fmt.Fprintf(w, "%s_sum%s %s\n", v.name, labelSet(v.labels, s.labels, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %s\n", v.name, labelSet(v.labels, s.labels, "", ""), formatFloat(s.value))
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelSet formats {name="value",...}, with an extra label if extraName is set.
+func labelSet(names, values []string, extraName, extraValue string) string {
+	if len(names) == 0 && extraName == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `%s="%s"`, name, labelEscaper.Replace(values[i]))
+	}
+	if extraName != "" {
+		if len(names) > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, `%s="%s"`, extraName, extraValue)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Handler serves the metrics of the default registry.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.WriteText(w)
+	})
+}
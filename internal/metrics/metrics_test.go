@@ -0,0 +1,86 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/metrics"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := metrics.NewRegistry()
+	calls := r.NewCounterVec("test_calls_total", "Calls.", "model")
+	inFlight := r.NewGaugeVec("test_in_flight", "In flight.")
+	latency := r.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "model")
+
+	calls.Inc(`say "hi"`)
+	calls.Add(2, "local")
+	inFlight.Add(3)
+	inFlight.Add(-1)
+	latency.Observe(0.05, "local")
+	latency.Observe(0.5, "local")
+	latency.Observe(5, "local")
+
+	var sb strings.Builder
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_calls_total Calls.
+# TYPE test_calls_total counter
+test_calls_total{model="local"} 2
+test_calls_total{model="say \"hi\""} 1
+# HELP test_in_flight In flight.
+# TYPE test_in_flight gauge
+test_in_flight 2
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{model="local",le="0.1"} 1
+test_latency_seconds_bucket{model="local",le="1"} 2
+test_latency_seconds_bucket{model="local",le="+Inf"} 3
+test_latency_seconds_sum{model="local"} 5.55
+test_latency_seconds_count{model="local"} 3
+`
+	if sb.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", sb.String(), want)
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	h := metrics.Instrument("/api/v1/test/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/test/1", nil))
+
+	rr := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	for _, line := range []string{
+		`agentai_http_requests_total{method="GET",route="/api/v1/test/{id}",code="418"} 1`,
+		`agentai_http_request_duration_seconds_count{method="GET",route="/api/v1/test/{id}"} 1`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("expected %q in:\n%s", line, body)
+		}
+	}
+	if !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", rr.Header().Get("Content-Type"))
+	}
+}
+
+func TestRecordStatus(t *testing.T) {
+	rec := metrics.RecordStatus(httptest.NewRecorder())
+	if rec.Status() != http.StatusOK {
+		t.Errorf("expected 200 before anything is written, got %d", rec.Status())
+	}
+	// Nested middlewares share the recorder of the request.
+	if metrics.RecordStatus(rec) != rec {
+		t.Error("expected a recorder not to be wrapped again")
+	}
+	rec.WriteHeader(http.StatusNotFound)
+	rec.WriteHeader(http.StatusInternalServerError)
+	if rec.Status() != http.StatusNotFound {
+		t.Errorf("expected the first status written, got %d", rec.Status())
+	}
+}
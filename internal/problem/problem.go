@@ -0,0 +1,143 @@
+// Package problem writes API errors as RFC 9457 problem details (application/problem+json)
+// and maps the typed errors of models, tools and configuration to HTTP statuses.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/logging"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// Problem types beyond the plain HTTP status ("about:blank").
+const (
+	TypeUpstreamModel   = "urn:agentai:problem:upstream-model"
+	TypeTimeout         = "urn:agentai:problem:timeout"
+	TypeInvalidToolArgs = "urn:agentai:problem:invalid-tool-args"
+	TypeToolFailed      = "urn:agentai:problem:tool-failed"
+	TypeInvalidConfig   = "urn:agentai:problem:invalid-config"
+)
+
+// Problem is the body of every API error.
+// swagger:model Problem
+type Problem struct {
+	// Type identifies the kind of problem; about:blank means the status says it all.
+	Type   string `json:"type" example:"about:blank"`
+	Title  string `json:"title" example:"Not Found"`
+	Status int    `json:"status" example:"404"`
+	Detail string `json:"detail,omitempty" example:"model \"gpt\" not found"`
+	// Instance is the path of the request.
+	Instance  string `json:"instance,omitempty" example:"/api/v1/models/gpt"`
+	RequestID string `json:"request_id,omitempty" example:"6f1c0e7d9a2b4c4f8e3d2a1b0c9d8e7f"`
+	// Errors lists the invalid fields of a request or configuration change.
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is one invalid field.
+type FieldError struct {
+	// Field locates the value, e.g. "models[1].endpoint" or a tool argument.
+	Field   string `json:"field" example:"models[0].endpoint"`
+	Message string `json:"message" example:"endpoint is required"`
+	// File and Line locate configuration problems, when known.
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+func (p *Problem) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+	return p.Title
+}
+
+// New returns a problem of the plain HTTP status.
+func New(status int, detail string) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// Write writes p, adding the path and request ID of r.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	p.describe(r)
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// describe adds the path and request ID of r.
+func (p *Problem) describe(r *http.Request) {
+	if r != nil {
+		p.Instance = r.URL.Path
+		p.RequestID = logging.RequestIDFromContext(r.Context())
+	}
+}
+
+// ForRequest returns the problem err maps to for the request r, for responses that report
+// errors in their body, such as event streams, instead of through their status.
+func ForRequest(r *http.Request, err error) *Problem {
+	p := FromError(err)
+	p.describe(r)
+	return p
+}
+
+// Error writes a problem of the plain HTTP status.
+func Error(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	Write(w, r, New(status, detail))
+}
+
+// WriteError writes the problem err maps to (see FromError).
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	Write(w, r, FromError(err))
+}
+
+// FromError maps err to a problem: timeouts to 504, model failures and failed tools to 502,
+// invalid tool arguments and configuration changes to 422 and anything else to 500.
+func FromError(err error) *Problem {
+	var (
+		p        *Problem
+		upstream *llm.UpstreamError
+		args     *toolmodel.ArgsError
+		exec     *toolmodel.ExecError
+		invalid  config.ValidationErrors
+	)
+	switch {
+	case errors.As(err, &p):
+		return p
+	case errors.As(err, &args):
+		p = &Problem{Type: TypeInvalidToolArgs, Title: "Invalid tool arguments", Status: http.StatusUnprocessableEntity, Detail: err.Error()}
+		for _, a := range args.Errors {
+			p.Errors = append(p.Errors, FieldError{Field: a.Arg, Message: a.Message})
+		}
+		return p
+	case errors.As(err, &invalid):
+		return Invalid(err.Error(), invalid)
+	case llm.IsTimeout(err):
+		return &Problem{Type: TypeTimeout, Title: "Upstream timeout", Status: http.StatusGatewayTimeout, Detail: err.Error()}
+	case errors.As(err, &upstream):
+		return &Problem{Type: TypeUpstreamModel, Title: "Model request failed", Status: http.StatusBadGateway, Detail: err.Error()}
+	case errors.As(err, &exec):
+		return &Problem{Type: TypeToolFailed, Title: "Tool execution failed", Status: http.StatusBadGateway, Detail: err.Error()}
+	}
+	return New(http.StatusInternalServerError, err.Error())
+}
+
+// Invalid returns a 422 problem listing the configuration problems.
+func Invalid(detail string, problems config.ValidationErrors) *Problem {
+	p := &Problem{Type: TypeInvalidConfig, Title: "Invalid configuration", Status: http.StatusUnprocessableEntity, Detail: detail}
+	for _, v := range problems {
+		p.Errors = append(p.Errors, FieldError{Field: v.Path, Message: v.Message, File: v.File, Line: v.Line})
+	}
+	return p
+}
@@ -0,0 +1,60 @@
+package problem_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/logging"
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+func TestFromError(t *testing.T) {
+	for _, tc := range []struct {
+		err    error
+		status int
+		typ    string
+	}{
+		{&llm.UpstreamError{Model: "gpt", StatusCode: 500, Err: errors.New("boom")}, http.StatusBadGateway, problem.TypeUpstreamModel},
+		{&llm.UpstreamError{Model: "gpt", Err: context.DeadlineExceeded}, http.StatusGatewayTimeout, problem.TypeTimeout},
+		{&toolmodel.ExecError{Tool: "fstool", Err: errors.New("exit status 1")}, http.StatusBadGateway, problem.TypeToolFailed},
+		{&toolmodel.ExecError{Tool: "hook", Err: fmt.Errorf("call: %w", context.DeadlineExceeded)}, http.StatusGatewayTimeout, problem.TypeTimeout},
+		{&toolmodel.ArgsError{Tool: "fstool", Errors: []toolmodel.ArgError{{Arg: "path", Message: "is required"}}}, http.StatusUnprocessableEntity, problem.TypeInvalidToolArgs},
+		{config.ValidationErrors{{Path: "models[0].endpoint", Message: "is required"}}, http.StatusUnprocessableEntity, problem.TypeInvalidConfig},
+		{problem.New(http.StatusNotFound, "gone"), http.StatusNotFound, "about:blank"},
+		{errors.New("unexpected"), http.StatusInternalServerError, "about:blank"},
+	} {
+		p := problem.FromError(tc.err)
+		if p.Status != tc.status || p.Type != tc.typ || p.Detail == "" {
+			t.Errorf("%v: expected %d %s, got %+v", tc.err, tc.status, tc.typ, p)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/models/gpt", nil)
+	r = r.WithContext(logging.WithRequestID(r.Context(), "req-1"))
+	rr := httptest.NewRecorder()
+	problem.WriteError(rr, r, &toolmodel.ArgsError{Tool: "fstool", Errors: []toolmodel.ArgError{{Arg: "path", Message: "is required"}}})
+
+	if rr.Code != http.StatusUnprocessableEntity || rr.Header().Get("Content-Type") != problem.ContentType {
+		t.Fatalf("expected a 422 problem, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var p problem.Problem
+	if err := json.NewDecoder(rr.Body).Decode(&p); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if p.Title == "" || p.Instance != "/api/v1/models/gpt" || p.RequestID != "req-1" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Field != "path" || p.Errors[0].Message != "is required" {
+		t.Errorf("expected the field error, got %+v", p.Errors)
+	}
+}
@@ -0,0 +1,257 @@
+// Package ratelimit limits the request rate and the runs in progress of each client, and
+// the concurrent calls to each model.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"krackenservices.com/agentAI/internal/auth"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/problem"
+)
+
+// defaultQueueTimeout is how long a call waits for a model when queue_timeout is not set.
+const defaultQueueTimeout = 30 * time.Second
+
+var (
+	// ErrQueueFull is returned when a model has no free slot and its wait queue is full.
+	ErrQueueFull = errors.New("model is busy and its queue is full")
+	// ErrQueueTimeout is returned when a call waited queue_timeout without getting a slot.
+	ErrQueueTimeout = errors.New("timed out waiting for the model")
+)
+
+// Default is the limiter of the server. Its state outlives configuration reloads, while the
+// limits are taken from the configuration of each request.
+var Default = New()
+
+// Limiter holds the token buckets, runs in progress and model slots of every client.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	runs    map[string]int
+	models  map[string]*slots
+	swept   time.Time
+}
+
+// bucket is a token bucket refilled at the configured rate.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// slots tracks the calls to one model: those holding a slot and those queued for one.
+type slots struct {
+	max     int
+	active  int
+	waiters []chan struct{}
+}
+
+// New returns an empty limiter.
+func New() *Limiter {
+	return &Limiter{
+		buckets: make(map[string]*bucket),
+		runs:    make(map[string]int),
+		models:  make(map[string]*slots),
+	}
+}
+
+// ClientKey identifies the client of r for rate limiting: the authenticated principal, or
+// the remote IP address for anonymous requests.
+func ClientKey(r *http.Request) string {
+	if p := auth.FromContext(r.Context()); p != nil && p.Method != auth.MethodAnonymous {
+		return p.Key()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// burst returns the bucket size of cfg.
+func burst(cfg *config.RateLimitConfig) float64 {
+	if cfg.Burst > 0 {
+		return float64(cfg.Burst)
+	}
+	return math.Max(1, math.Ceil(cfg.RequestsPerMinute))
+}
+
+// allow takes a token from the bucket of key. It returns whether the request may proceed,
+// the whole tokens left, how long until the next token and how long until the bucket is full.
+func (l *Limiter) allow(cfg *config.RateLimitConfig, key string) (ok bool, remaining int, retry, reset time.Duration) {
+	size, perSecond := burst(cfg), cfg.RequestsPerMinute/60
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(cfg, now)
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: size, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(size, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		ok = true
+	} else {
+		retry = seconds((1 - b.tokens) / perSecond)
+	}
+	return ok, int(b.tokens), retry, seconds((size - b.tokens) / perSecond)
+}
+
+// sweep forgets buckets that have refilled completely, at most once a minute, so that
+// clients seen once do not accumulate.
+func (l *Limiter) sweep(cfg *config.RateLimitConfig, now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	full := seconds(burst(cfg) / (cfg.RequestsPerMinute / 60))
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Limit applies the request rate of cfg to each client of next. It sets the X-RateLimit-Limit
+// (bucket size), X-RateLimit-Remaining and X-RateLimit-Reset (seconds until the bucket is
+// full) headers, and rejects requests over the limit with 429 and Retry-After.
+func (l *Limiter) Limit(cfg *config.RateLimitConfig, next http.HandlerFunc) http.HandlerFunc {
+	if cfg.RequestsPerMinute <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ok, remaining, retry, reset := l.allow(cfg, ClientKey(r))
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(int(burst(cfg))))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(reset.Seconds()))))
+		if !ok {
+			TooManyRequests(w, r, retry, "rate limit exceeded")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// LimitRuns applies the request rate of cfg like Limit, and also limits each client to
+// cfg.MaxConcurrentRuns requests to next in progress.
+func (l *Limiter) LimitRuns(cfg *config.RateLimitConfig, next http.HandlerFunc) http.HandlerFunc {
+	if cfg.MaxConcurrentRuns <= 0 {
+		return l.Limit(cfg, next)
+	}
+	return l.Limit(cfg, func(w http.ResponseWriter, r *http.Request) {
+		key := ClientKey(r)
+		l.mu.Lock()
+		if l.runs[key] >= cfg.MaxConcurrentRuns {
+			l.mu.Unlock()
+			TooManyRequests(w, r, time.Second, fmt.Sprintf("too many runs in progress (limit %d)", cfg.MaxConcurrentRuns))
+			return
+		}
+		l.runs[key]++
+		l.mu.Unlock()
+		defer func() {
+			l.mu.Lock()
+			if l.runs[key]--; l.runs[key] <= 0 {
+				delete(l.runs, key)
+			}
+			l.mu.Unlock()
+		}()
+		next(w, r)
+	})
+}
+
+// AcquireModel waits for a free slot of the model, as limited by cfg, and returns the function
+// that releases it. Calls to models without a limit return at once. It fails with
+// ErrQueueFull, ErrQueueTimeout or the error of ctx.
+func (l *Limiter) AcquireModel(ctx context.Context, cfg *config.RateLimitConfig, model string) (release func(), err error) {
+	limit := cfg.ModelLimit(model)
+	if limit == nil {
+		return func() {}, nil
+	}
+	timeout := defaultQueueTimeout
+	if d, err := time.ParseDuration(limit.QueueTimeout); err == nil {
+		timeout = d
+	}
+
+	l.mu.Lock()
+	s, ok := l.models[model]
+	if !ok {
+		s = &slots{}
+		l.models[model] = s
+	}
+	s.max = limit.MaxConcurrent
+	release = func() { l.releaseModel(s) }
+	if s.active < s.max {
+		s.active++
+		l.mu.Unlock()
+		return release, nil
+	}
+	if len(s.waiters) >= limit.MaxQueue {
+		l.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	ready := make(chan struct{})
+	s.waiters = append(s.waiters, ready)
+	l.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-ready:
+		return release, nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, w := range s.waiters {
+		if w == ready {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return nil, err
+		}
+	}
+	// The slot was handed over while giving up; pass it on.
+	s.active--
+	l.wake(s)
+	return nil, err
+}
+
+func (l *Limiter) releaseModel(s *slots) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s.active--
+	l.wake(s)
+}
+
+// wake hands free slots to queued calls in arrival order. l.mu must be held.
+func (l *Limiter) wake(s *slots) {
+	for s.active < s.max && len(s.waiters) > 0 {
+		s.active++
+		close(s.waiters[0])
+		s.waiters = s.waiters[1:]
+	}
+}
+
+// TooManyRequests writes a 429 problem asking the client to retry after d (at least a second).
+func TooManyRequests(w http.ResponseWriter, r *http.Request, d time.Duration, msg string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Max(1, math.Ceil(d.Seconds())))))
+	problem.Error(w, r, http.StatusTooManyRequests, msg)
+}
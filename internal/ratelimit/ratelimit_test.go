@@ -0,0 +1,128 @@
+package ratelimit_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"krackenservices.com/agentAI/internal/auth"
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/ratelimit"
+)
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func serve(h http.HandlerFunc, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+	req.RemoteAddr = remoteAddr
+	rr := httptest.NewRecorder()
+	h(rr, req)
+	return rr
+}
+
+func TestLimit_TokenBucket(t *testing.T) {
+	cfg := &config.RateLimitConfig{RequestsPerMinute: 6, Burst: 2}
+	h := ratelimit.New().Limit(cfg, ok)
+
+	for i := 0; i < 2; i++ {
+		rr := serve(h, "10.0.0.1:1234")
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("request %d: expected to pass the burst, got %d", i, rr.Code)
+		}
+		if rr.Header().Get("X-RateLimit-Limit") != "2" || rr.Header().Get("X-RateLimit-Remaining") != []string{"1", "0"}[i] {
+			t.Errorf("request %d: unexpected headers %v", i, rr.Header())
+		}
+	}
+	rr := serve(h, "10.0.0.1:5678")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 over the burst, got %d", rr.Code)
+	}
+	// One request per 10s refills the bucket.
+	if got := rr.Header().Get("Retry-After"); got != "10" {
+		t.Errorf("expected Retry-After 10, got %q", got)
+	}
+	if got := rr.Header().Get("X-RateLimit-Reset"); got != "20" {
+		t.Errorf("expected X-RateLimit-Reset 20, got %q", got)
+	}
+
+	// Clients have their own buckets.
+	if rr := serve(h, "10.0.0.2:1234"); rr.Code != http.StatusNoContent {
+		t.Errorf("expected another client to pass, got %d", rr.Code)
+	}
+}
+
+func TestLimitRuns(t *testing.T) {
+	cfg := &config.RateLimitConfig{MaxConcurrentRuns: 1}
+	started, finish := make(chan struct{}), make(chan struct{})
+	h := ratelimit.New().LimitRuns(cfg, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+	})
+
+	// Requests of the same API key share a limit regardless of their address.
+	request := func(addr string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+		req.RemoteAddr = addr
+		return req.WithContext(auth.NewContext(req.Context(), &auth.Principal{ID: "ci", Method: auth.MethodAPIKey}))
+	}
+	done := make(chan struct{})
+	go func() {
+		h(httptest.NewRecorder(), request("10.0.0.1:1"))
+		close(done)
+	}()
+	<-started
+
+	rr := httptest.NewRecorder()
+	h(rr, request("10.0.0.2:1"))
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("expected 429 with Retry-After for a second run, got %d", rr.Code)
+	}
+	close(finish)
+	<-done
+}
+
+func TestAcquireModel(t *testing.T) {
+	cfg := &config.RateLimitConfig{Models: []config.ModelLimitConfig{
+		{ID: "gpu", MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: "50ms"},
+	}}
+	l := ratelimit.New()
+	ctx := context.Background()
+
+	release, err := l.AcquireModel(ctx, cfg, "gpu")
+	if err != nil {
+		t.Fatalf("expected a free slot, got %v", err)
+	}
+	if _, err := l.AcquireModel(ctx, cfg, "other"); err != nil {
+		t.Errorf("expected unlimited models not to wait, got %v", err)
+	}
+
+	// The second call queues, the third finds the queue full.
+	acquired := make(chan error)
+	go func() {
+		r, err := l.AcquireModel(ctx, cfg, "gpu")
+		if err == nil {
+			defer r()
+		}
+		acquired <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := l.AcquireModel(ctx, cfg, "gpu"); !errors.Is(err, ratelimit.ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+	release()
+	if err := <-acquired; err != nil {
+		t.Errorf("expected the queued call to get the released slot, got %v", err)
+	}
+
+	// A queued call gives up after queue_timeout.
+	release, _ = l.AcquireModel(ctx, cfg, "gpu")
+	defer release()
+	if _, err := l.AcquireModel(ctx, cfg, "gpu"); !errors.Is(err, ratelimit.ErrQueueTimeout) {
+		t.Errorf("expected ErrQueueTimeout, got %v", err)
+	}
+}
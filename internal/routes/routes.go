@@ -1,65 +1,203 @@
 package routes
 
 import (
-	httpSwagger "github.com/swaggo/http-swagger"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
+
+	httpSwagger "github.com/swaggo/http-swagger"
 
+	"krackenservices.com/agentAI/internal/auth"
 	"krackenservices.com/agentAI/internal/config"
 	"krackenservices.com/agentAI/internal/handlers"
-	"krackenservices.com/agentAI/internal/toolregistry"
+	"krackenservices.com/agentAI/internal/metrics"
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/ratelimit"
+	"krackenservices.com/agentAI/internal/tracing"
 )
 
 var apiv1 = "/api/v1"
 
-// NewRouter returns an HTTP handler with routes for the API.
-func NewRouter(cfg *config.Config) http.Handler {
-	mux := http.NewServeMux()
+// handle registers h for pattern, counting its requests in the HTTP metrics and tracing them
+// under the path of the pattern.
+func handle(mux *http.ServeMux, pattern string, h http.HandlerFunc) {
+	route := pattern
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		route = path
+	}
+	mux.HandleFunc(pattern, tracing.Middleware(route, metrics.Instrument(route, h)))
+}
 
-	// Serve Swagger docs at /swagger/index.html
-	mux.Handle("/swagger/", httpSwagger.WrapHandler)
+// deprecatedSince is when the singular routes were deprecated, in the Deprecation header format.
+const deprecatedSince = "@1792368000" // 2026-10-19
 
-	// Register static endpoints.
-	mux.HandleFunc(apiv1+"/hello", handlers.HelloHandler)
-
-	// Register dynamic tool endpoints.
-	for id, tool := range toolregistry.InternalTools {
-		disabled := false
-		for _, cfgTool := range cfg.Tools {
-			if cfgTool.ID == id {
-				if cfgTool.Enabled != nil && !*cfgTool.Enabled {
-					disabled = true
-				}
-				break
-			}
-		}
-		if !disabled {
-			route := apiv1 + "/tool/" + id
-			mux.HandleFunc(route, handlers.DynamicToolHandler(tool))
+// deprecated serves an old route, marking its responses as deprecated (RFC 9745) and linking
+// the route that replaces it. An {id} in successor is filled in from the request.
+func deprecated(successor string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", deprecatedSince)
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", strings.ReplaceAll(successor, "{id}", r.PathValue("id"))))
+		slog.DebugContext(r.Context(), "Deprecated route used", "path", r.URL.Path)
+		h(w, r)
+	}
+}
+
+// allowKey carries the methods NewAdminRouter serves at the path of a request it passes on
+// to the app router.
+type allowKey struct{}
+
+// methods are the methods reported in Allow headers.
+var methods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// allowedMethods returns the methods mux has a route for at the path of r.
+func allowedMethods(mux *http.ServeMux, r *http.Request) []string {
+	var allow []string
+	for _, method := range methods {
+		probe := *r
+		probe.Method = method
+		if _, pattern := mux.Handler(&probe); pattern != "" {
+			allow = append(allow, method)
 		}
 	}
-	for _, tool := range cfg.Tools {
-		if _, exists := toolregistry.InternalTools[tool.ID]; exists {
-			continue
+	return allow
+}
+
+// unmatched serves mux, answering requests that match no route with a 404 problem, or with a
+// 405 problem and the Allow header when the path has routes for other methods.
+func unmatched(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
 		}
-		if tool.Enabled != nil && !*tool.Enabled {
-			continue
+		allow, _ := r.Context().Value(allowKey{}).([]string)
+		allow = append(allow, allowedMethods(mux, r)...)
+		if len(allow) == 0 {
+			problem.Error(w, r, http.StatusNotFound, fmt.Sprintf("no route for %s", r.URL.Path))
+			return
 		}
-		route := apiv1 + "/tool/" + tool.ID
-		mux.HandleFunc(route, handlers.DynamicToolHandler(tool))
+		var list []string
+		for _, method := range methods {
+			if slices.Contains(allow, method) {
+				list = append(list, method)
+			}
+		}
+		w.Header().Set("Allow", strings.Join(list, ", "))
+		problem.Error(w, r, http.StatusMethodNotAllowed, fmt.Sprintf("%s is not allowed for %s", r.Method, r.URL.Path))
+	})
+}
+
+// NewRouter returns an HTTP handler with routes for the API. Every request is authenticated
+// (see auth.Authenticator); the documentation, metrics, hello and schema endpoints are public.
+// Authenticated endpoints are rate limited per client (see ratelimit.Limiter). Requests that
+// match no route get a 404 problem, or a 405 problem with the Allow header when the path
+// exists for other methods.
+// It fails if the JWKS file of the configuration cannot be loaded.
+func NewRouter(cfg *config.Config) (http.Handler, error) {
+	authn, err := auth.ForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	limits := &cfg.Server.RateLimit
+	limit := func(next http.HandlerFunc) http.HandlerFunc { return ratelimit.Default.Limit(limits, next) }
+	limitRuns := func(next http.HandlerFunc) http.HandlerFunc { return ratelimit.Default.LimitRuns(limits, next) }
+	mux := http.NewServeMux()
+
+	// Serve Swagger docs at /swagger/index.html
+	mux.Handle("GET /swagger/", httpSwagger.WrapHandler)
+
+	// Prometheus metrics.
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	// Register static endpoints.
+	handle(mux, "GET "+apiv1+"/hello", handlers.HelloHandler)
+	handle(mux, "GET "+apiv1+"/config/schema", handlers.ConfigSchemaHandler)
+	handle(mux, "GET "+apiv1+"/config/effective", limit(auth.Require(config.ScopeAdmin, handlers.EffectiveConfigHandler(cfg))))
+
+	// Register run endpoints for every enabled tool, and the deprecated singular ones.
+	for _, tool := range handlers.EnabledTools(cfg) {
+		run := limitRuns(auth.Require(config.ScopeToolsExecute, handlers.DynamicToolHandler(tool)))
+		route := apiv1 + "/tools/" + tool.ID + "/run"
+		handle(mux, "POST "+route, run)
+		handle(mux, "POST "+apiv1+"/tool/"+tool.ID, deprecated(route, run))
 	}
 
 	// Register info endpoints for tools.
-	mux.HandleFunc(apiv1+"/tools", handlers.ListTools(cfg))
-	mux.HandleFunc(apiv1+"/tools/internal", handlers.ListInternalTools(cfg))
-	mux.HandleFunc(apiv1+"/tools/external", handlers.ListExternalTools(cfg))
+	handle(mux, "GET "+apiv1+"/tools", limit(auth.Authenticated(handlers.ListTools(cfg))))
+	handle(mux, "GET "+apiv1+"/tools/internal", limit(auth.Authenticated(handlers.ListInternalTools(cfg))))
+	handle(mux, "GET "+apiv1+"/tools/external", limit(auth.Authenticated(handlers.ListExternalTools(cfg))))
+	handle(mux, "GET "+apiv1+"/tools/{id}", limit(auth.Authenticated(handlers.GetTool(cfg))))
+
+	// Expose the enabled tools to other agents over MCP.
+	mcpServer := limitRuns(auth.Require(config.ScopeToolsExecute, handlers.NewMCPServer(cfg).ServeHTTP))
+	handle(mux, "POST "+apiv1+"/mcp", mcpServer)
+	handle(mux, "DELETE "+apiv1+"/mcp", mcpServer)
 
 	// Register endpoints for models.
-	mux.HandleFunc(apiv1+"/models", handlers.ListModels(cfg))
-	mux.HandleFunc(apiv1+"/model/", handlers.GetModel(cfg)) // expects /model/<modelID>
+	handle(mux, "GET "+apiv1+"/models", limit(auth.Authenticated(handlers.ListModels(cfg))))
+	getModel := limit(auth.Authenticated(handlers.GetModel(cfg)))
+	handle(mux, "GET "+apiv1+"/models/{id}", getModel)
+	handle(mux, "GET "+apiv1+"/model/{id}", deprecated(apiv1+"/models/{id}", getModel))
+
+	// Token usage of chats; callers see their own unless they have the admin scope.
+	handle(mux, "GET "+apiv1+"/usage", limit(auth.Authenticated(handlers.UsageHandler)))
+
+	// Version and dependency status.
+	handle(mux, "GET "+apiv1+"/status", limit(auth.Authenticated(handlers.StatusHandler(cfg))))
 
 	// Register endpoint for chat
 	// TODO: Create endpoints for ollama/openai to help ux
-	mux.HandleFunc(apiv1+"/chat", handlers.ChatHandler(cfg))
+	handle(mux, "POST "+apiv1+"/chat", limitRuns(auth.Require(config.ScopeChat, handlers.ChatHandler(cfg))))
+
+	// Conversations that clients can resume; callers see their own unless they have the admin scope.
+	handle(mux, "POST "+apiv1+"/sessions", limit(auth.Require(config.ScopeChat, handlers.CreateSession(cfg))))
+	handle(mux, "GET "+apiv1+"/sessions", limit(auth.Require(config.ScopeChat, handlers.ListSessions)))
+	handle(mux, "GET "+apiv1+"/sessions/{id}", limit(auth.Require(config.ScopeChat, handlers.GetSession)))
+	handle(mux, "DELETE "+apiv1+"/sessions/{id}", limit(auth.Require(config.ScopeChat, handlers.DeleteSession)))
+	handle(mux, "POST "+apiv1+"/sessions/{id}/messages", limitRuns(auth.Require(config.ScopeChat, handlers.SessionMessage(cfg))))
 
-	return mux
+	// Chats submitted in bulk and run in the background; callers see their own unless they have the admin scope.
+	handle(mux, "POST "+apiv1+"/batches", limit(auth.Require(config.ScopeChat, handlers.CreateBatch(cfg))))
+	handle(mux, "GET "+apiv1+"/batches", limit(auth.Require(config.ScopeChat, handlers.ListBatches)))
+	handle(mux, "GET "+apiv1+"/batches/{id}", limit(auth.Require(config.ScopeChat, handlers.GetBatch)))
+	handle(mux, "DELETE "+apiv1+"/batches/{id}", limit(auth.Require(config.ScopeChat, handlers.DeleteBatch)))
+	handle(mux, "GET "+apiv1+"/batches/{id}/results", limit(auth.Require(config.ScopeChat, handlers.BatchResults)))
+
+	return authn.Middleware(unmatched(mux)), nil
+}
+
+// NewAdminRouter wraps the router of the live configuration with endpoints that manage
+// the server itself and therefore live outside any single configuration, and with the
+// liveness and readiness probes.
+func NewAdminRouter(app http.Handler, store handlers.ConfigStore) http.Handler {
+	mux := http.NewServeMux()
+
+	// Kubernetes probes, which need no credentials.
+	handle(mux, "GET /healthz", handlers.HealthzHandler)
+	handle(mux, "GET /readyz", handlers.ReadyzHandler(store))
+
+	reload := handlers.RequireAdminIfSecured(store, handlers.ReloadHandler(store))
+	handle(mux, "GET "+apiv1+"/admin/reload", reload)
+	handle(mux, "POST "+apiv1+"/admin/reload", reload)
+
+	// Changes to models and tools; reads are served by the app router.
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete} {
+		handle(mux, method+" "+apiv1+"/models/{id}", handlers.AdminModelHandler(store))
+		handle(mux, method+" "+apiv1+"/tools/{id}", handlers.AdminToolHandler(store))
+	}
+	// Everything else is served by the app router, which also answers 405 for the paths
+	// above when called with a method neither router serves.
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		if allow := allowedMethods(mux, r); len(allow) > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), allowKey{}, allow))
+		}
+		app.ServeHTTP(w, r)
+	})
 }
@@ -1,11 +1,14 @@
 package routes_test
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 
 	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
 	"krackenservices.com/agentAI/internal/routes"
 	"krackenservices.com/agentAI/internal/toolmodel"
 )
@@ -53,7 +56,10 @@ func TestRouter_ToolEndpoints(t *testing.T) {
 		},
 	}
 
-	router := routes.NewRouter(cfg)
+	router, err := routes.NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Check that the /hello endpoint is registered.
 	reqHello := httptest.NewRequest(http.MethodGet, apiv1+"/hello", nil)
@@ -63,6 +69,13 @@ func TestRouter_ToolEndpoints(t *testing.T) {
 		t.Errorf("expected %s/hello endpoint, got 404", apiv1)
 	}
 
+	// Check that the config schema is published.
+	rrSchema := httptest.NewRecorder()
+	router.ServeHTTP(rrSchema, httptest.NewRequest(http.MethodGet, apiv1+"/config/schema", nil))
+	if rrSchema.Code != http.StatusOK || rrSchema.Header().Get("Content-Type") != "application/schema+json" {
+		t.Errorf("expected %s/config/schema to return the schema, got %d", apiv1, rrSchema.Code)
+	}
+
 	// Check that the internal tool "fstool" is disabled, so /tool/fstool should not be registered.
 	reqFstool := httptest.NewRequest(http.MethodPost, apiv1+"/tool/fstool", nil)
 	rrFstool := httptest.NewRecorder()
@@ -79,3 +92,178 @@ func TestRouter_ToolEndpoints(t *testing.T) {
 		t.Errorf("expected %s/tool/externaltool to be registered, got 404", apiv1)
 	}
 }
+
+func TestRouter_ToolRunEndpoints(t *testing.T) {
+	cfg := &config.Config{
+		Version: "1.0",
+		Models:  []config.ModelConfig{{ID: "local", Name: "mymodel", Endpoint: "http://127.0.0.1:8080/"}},
+		Tools: []toolmodel.ToolConfig{
+			{ID: "fstool", Enabled: boolPtr(false)},
+			{ID: "externaltool", Name: "External Tool", CommandKey: "externaltool", Enabled: boolPtr(true)},
+		},
+	}
+	router, err := routes.NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, path, nil))
+		return rr
+	}
+
+	if rr := serve(apiv1 + "/tools/fstool/run"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected %s/tools/fstool/run to be unregistered (disabled), got %d", apiv1, rr.Code)
+	}
+	if rr := serve(apiv1 + "/tools/externaltool/run"); rr.Code == http.StatusNotFound || rr.Header().Get("Deprecation") != "" {
+		t.Errorf("expected %s/tools/externaltool/run to be registered, got %d %v", apiv1, rr.Code, rr.Header())
+	}
+}
+
+func TestRouter_InvalidJWKS(t *testing.T) {
+	cfg := &config.Config{
+		Version: "1.0",
+		Auth:    config.AuthConfig{JWT: &config.JWTConfig{JWKSFile: filepath.Join(t.TempDir(), "missing.json")}},
+	}
+	if _, err := routes.NewRouter(cfg); err == nil {
+		t.Error("expected an error for a missing JWKS file")
+	}
+}
+
+func TestRouter_Auth(t *testing.T) {
+	cfg := &config.Config{
+		Version: "1.0",
+		Models: []config.ModelConfig{
+			{ID: "local", Name: "mymodel", Endpoint: "http://127.0.0.1:8080/"},
+			{ID: "premium", Name: "bigmodel", Endpoint: "http://127.0.0.1:8080/"},
+		},
+		Tools: []toolmodel.ToolConfig{
+			{ID: "externaltool", Name: "External Tool", CommandKey: "externaltool", Enabled: boolPtr(true)},
+		},
+		Auth: config.AuthConfig{APIKeys: []config.APIKeyConfig{
+			{ID: "ci", Key: "ci-key", Scopes: []string{config.ScopeChat}, Models: []string{"local"}},
+		}},
+	}
+	router, err := routes.NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Public endpoints need no credentials.
+	if rr := serve(http.MethodGet, apiv1+"/hello", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected hello to be public, got %d", rr.Code)
+	}
+	if rr := serve(http.MethodGet, apiv1+"/models", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without credentials, got %d", rr.Code)
+	}
+	if rr := serve(http.MethodGet, apiv1+"/models", "nope"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with an unknown key, got %d", rr.Code)
+	}
+
+	// The model allow-list filters listings.
+	rr := serve(http.MethodGet, apiv1+"/models", "ci-key")
+	var models []config.ModelConfig
+	json.NewDecoder(rr.Body).Decode(&models)
+	if rr.Code != http.StatusOK || len(models) != 1 || models[0].ID != "local" {
+		t.Errorf("expected only the allowed model, got %d %v", rr.Code, models)
+	}
+	if rr := serve(http.MethodGet, apiv1+"/models/premium", "ci-key"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected a model outside the allow-list to be hidden, got %d", rr.Code)
+	}
+
+	// Scopes are enforced.
+	if rr := serve(http.MethodPost, apiv1+"/tools/externaltool/run", "ci-key"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without the tools:execute scope, got %d", rr.Code)
+	}
+	if rr := serve(http.MethodGet, apiv1+"/config/effective", "ci-key"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without the admin scope, got %d", rr.Code)
+	}
+}
+
+func TestRouter_Methods(t *testing.T) {
+	cfg := &config.Config{
+		Version: "1.0",
+		Models:  []config.ModelConfig{{ID: "local", Name: "mymodel", Endpoint: "http://127.0.0.1:8080/"}},
+		Tools:   []toolmodel.ToolConfig{{ID: "externaltool", Name: "External Tool", CommandKey: "externaltool", Enabled: boolPtr(true)}},
+	}
+	router, err := routes.NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(method, path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest(method, path, nil))
+		return rr
+	}
+
+	// Unknown paths and methods get problems.
+	rr := serve(http.MethodGet, apiv1+"/nothing")
+	if rr.Code != http.StatusNotFound || rr.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("expected a 404 problem, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	rr = serve(http.MethodDelete, apiv1+"/chat")
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "POST" || rr.Header().Get("Content-Type") != "application/problem+json" {
+		t.Errorf("expected a 405 problem allowing POST, got %d %q", rr.Code, rr.Header().Get("Allow"))
+	}
+	if rr := serve(http.MethodPost, apiv1+"/models"); rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("expected 405 allowing GET and HEAD, got %d %q", rr.Code, rr.Header().Get("Allow"))
+	}
+
+	// The singular routes still work, marked as deprecated.
+	rr = serve(http.MethodGet, apiv1+"/model/local")
+	if rr.Code != http.StatusOK || rr.Header().Get("Deprecation") == "" || rr.Header().Get("Link") != `<`+apiv1+`/models/local>; rel="successor-version"` {
+		t.Errorf("expected the deprecated model route, got %d %v", rr.Code, rr.Header())
+	}
+	if rr := serve(http.MethodGet, apiv1+"/models/local"); rr.Code != http.StatusOK || rr.Header().Get("Deprecation") != "" {
+		t.Errorf("expected the model route, got %d %v", rr.Code, rr.Header())
+	}
+	rr = serve(http.MethodPost, apiv1+"/tool/externaltool")
+	if rr.Code == http.StatusNotFound || rr.Header().Get("Link") != `<`+apiv1+`/tools/externaltool/run>; rel="successor-version"` {
+		t.Errorf("expected the deprecated tool route, got %d %v", rr.Code, rr.Header())
+	}
+}
+
+// staticStore serves a fixed configuration.
+type staticStore struct{ cfg *config.Config }
+
+func (s staticStore) Config() *config.Config        { return s.cfg }
+func (s staticStore) Reload(string) error           { return nil }
+func (s staticStore) Status() handlers.ReloadStatus { return handlers.ReloadStatus{Generation: 1} }
+
+func TestAdminRouter_Allow(t *testing.T) {
+	cfg := &config.Config{Models: []config.ModelConfig{{ID: "local", Endpoint: "http://127.0.0.1:8080/"}}}
+	app, err := routes.NewRouter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := routes.NewAdminRouter(app, staticStore{cfg})
+
+	// The methods of both routers are allowed.
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodOptions, apiv1+"/models/local", nil))
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET, HEAD, POST, PUT, PATCH, DELETE" {
+		t.Errorf("expected 405 allowing the read and admin methods, got %d %q", rr.Code, rr.Header().Get("Allow"))
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/healthz", nil))
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("expected 405 allowing GET, got %d %q", rr.Code, rr.Header().Get("Allow"))
+	}
+
+	// A model that does not exist is still a 404.
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, apiv1+"/models/missing", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rr.Code)
+	}
+}
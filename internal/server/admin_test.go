@@ -0,0 +1,233 @@
+package server_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/routes"
+	"krackenservices.com/agentAI/internal/server"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// adminRequest sends a request with the admin token through the router.
+func adminRequest(t *testing.T, h http.Handler, method, url, body string, headers map[string]string) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, url, r)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestAdminAPI_Models(t *testing.T) {
+	t.Setenv("AGENTAI_TEST_ADMIN_KEY", "sk-live")
+	path := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(path, []byte(`server:
+  admin_token: s3cret
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+    api_key: ${AGENTAI_TEST_ADMIN_KEY}
+`), 0644)
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+	reloader, err := server.NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	router := routes.NewAdminRouter(reloader, reloader)
+
+	// The admin token is required.
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodDelete, "/api/v1/models/local", nil))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", rr.Code)
+	}
+
+	// Create.
+	rr = adminRequest(t, router, http.MethodPost, "/api/v1/models/remote", `{"name": "remote", "endpoint": "http://llm.internal/", "api_key": "sk-remote", "tools_supported": true, "tool_tag_start": "<tool>", "tool_tag_end": "</tool>"}`, nil)
+	if rr.Code != http.StatusCreated || rr.Header().Get("ETag") == "" {
+		t.Fatalf("expected 201 with an ETag, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ids := modelIDs(t, router); len(ids) != 2 || ids[1] != "remote" {
+		t.Fatalf("expected the new model to be live, got %v", ids)
+	}
+	if remote := reloader.Config().Models[1]; remote.APIKey != "sk-remote" || remote.ToolTagStart != "<tool>" || !remote.ToolsSupported {
+		t.Errorf("expected the snake_case fields of the config file to be set, got %+v", remote)
+	}
+	rr = adminRequest(t, router, http.MethodPost, "/api/v1/models/other", `{"endpoint": "http://llm.internal/", "APIKey": "sk-other"}`, nil)
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "APIKey") {
+		t.Errorf("expected 400 for a field that is not in the config file, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = adminRequest(t, router, http.MethodPost, "/api/v1/models/remote", `{"endpoint": "http://llm.internal/"}`, nil)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 when creating an existing model, got %d", rr.Code)
+	}
+
+	// Updates need the current ETag.
+	rr = adminRequest(t, router, http.MethodGet, "/api/v1/models/local", "", nil)
+	etag := rr.Header().Get("ETag")
+	rr = adminRequest(t, router, http.MethodPatch, "/api/v1/models/local", `{"name": "renamed"}`, nil)
+	if rr.Code != http.StatusPreconditionRequired {
+		t.Errorf("expected 428 without If-Match, got %d", rr.Code)
+	}
+	rr = adminRequest(t, router, http.MethodPatch, "/api/v1/models/local", `{"name": "renamed"}`, map[string]string{"If-Match": `"stale"`})
+	if rr.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected 412 with a stale ETag, got %d", rr.Code)
+	}
+	rr = adminRequest(t, router, http.MethodPatch, "/api/v1/models/local", `{"name": "renamed", "additional_system_prompt": "Be brief."}`, map[string]string{"If-Match": etag})
+	if rr.Code != http.StatusOK || rr.Header().Get("ETag") == etag {
+		t.Fatalf("expected 200 with a new ETag, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var model config.ModelConfig
+	json.NewDecoder(rr.Body).Decode(&model)
+	if model.Name != "renamed" || model.AdditionalSystemPrompt != "Be brief." || model.Endpoint != "http://127.0.0.1:8080/" || reloader.Config().Models[0].APIKey != "sk-live" {
+		t.Errorf("expected only the name to change, got %+v", model)
+	}
+
+	// Invalid changes are rejected with every problem listed.
+	rr = adminRequest(t, router, http.MethodPut, "/api/v1/models/remote", `{"endpoint": "llm.internal", "api_vendor": "acme"}`, map[string]string{"If-Match": "*"})
+	if rr.Code != http.StatusUnprocessableEntity || !strings.Contains(rr.Body.String(), "models[1].endpoint") || !strings.Contains(rr.Body.String(), "models[1].api_vendor") {
+		t.Fatalf("expected 422 listing the problems, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Delete.
+	rr = adminRequest(t, router, http.MethodDelete, "/api/v1/models/remote", "", map[string]string{"If-Match": "*"})
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Changes are persisted in the state file, not the config file, and survive a reload.
+	data, _ := os.ReadFile(cfg.StatePath())
+	if !strings.Contains(string(data), "renamed") || !strings.Contains(string(data), "${AGENTAI_TEST_ADMIN_KEY}") {
+		t.Errorf("expected the state file to hold the change with the unresolved api key, got:\n%s", data)
+	}
+	if err := reloader.Reload("api"); err != nil {
+		t.Fatalf("expected reload to succeed, got %v", err)
+	}
+	if ids := modelIDs(t, router); len(ids) != 1 || reloader.Config().Models[0].Name != "renamed" {
+		t.Errorf("expected persisted changes after reload, got %v", ids)
+	}
+}
+
+func TestAdminAPI_Tools(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(path, []byte(`server:
+  admin_token: s3cret
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+`), 0644)
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+	reloader, err := server.NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	router := routes.NewAdminRouter(reloader, reloader)
+
+	// Entries use the field names of the config file.
+	body := `{"name": "Tickets", "description": "Look up a ticket", "type": "http",
+		"command_args": {"ticket": "1"}, "arg_order": ["ticket"],
+		"http": {"url": "http://tickets.internal/{{.ticket}}", "max_response_bytes": 4096}}`
+	rr := adminRequest(t, router, http.MethodPost, "/api/v1/tools/tickets", body, nil)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	etag := rr.Header().Get("ETag")
+	rr = adminRequest(t, router, http.MethodPatch, "/api/v1/tools/tickets", `{"command_args": {"ticket": "2"}}`, map[string]string{"If-Match": etag})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var tool toolmodel.ToolConfig
+	for _, t := range reloader.Config().Tools {
+		if t.ID == "tickets" {
+			tool = t
+		}
+	}
+	if tool.CommandArgs["ticket"] != "2" || len(tool.ArgOrder) != 1 || tool.HTTP == nil || tool.HTTP.MaxResponseBytes != 4096 {
+		t.Errorf("expected the tool with its patched arguments, got %+v", tool)
+	}
+}
+
+func TestAdminAPI_ToolsMaskedValues(t *testing.T) {
+	t.Setenv("AGENTAI_TEST_TICKETS_URL", "https://tickets.internal/hook")
+	t.Setenv("AGENTAI_TEST_TICKETS_TOKEN", "tok-1")
+	path := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(path, []byte(`server:
+  admin_token: s3cret
+models:
+  - id: local
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+tools:
+  - id: tickets
+    name: Tickets
+    description: Look up a ticket
+    type: http
+    command_args:
+      token: ${AGENTAI_TEST_TICKETS_TOKEN}
+    http:
+      url: ${AGENTAI_TEST_TICKETS_URL}
+`), 0644)
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+	reloader, err := server.NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	router := routes.NewAdminRouter(reloader, reloader)
+
+	// A masked entry sent back keeps its current values, with PATCH and with PUT.
+	rr := adminRequest(t, router, http.MethodGet, "/api/v1/tools/tickets", "", nil)
+	etag := rr.Header().Get("ETag")
+	rr = adminRequest(t, router, http.MethodPatch, "/api/v1/tools/tickets", `{"description": "Find a ticket"}`, map[string]string{"If-Match": etag})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.String()
+	var masked toolmodel.ToolConfig
+	json.Unmarshal([]byte(body), &masked)
+	if masked.HTTP == nil || masked.HTTP.URL != config.Masked || masked.CommandArgs["token"] != config.Masked {
+		t.Fatalf("expected masked values in the response, got %s", body)
+	}
+	rr = adminRequest(t, router, http.MethodPut, "/api/v1/tools/tickets", body, map[string]string{"If-Match": rr.Header().Get("ETag")})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	raw, _ := reloader.Config().RawTool("tickets")
+	if raw.HTTP == nil || raw.HTTP.URL != "${AGENTAI_TEST_TICKETS_URL}" || raw.CommandArgs["token"] != "${AGENTAI_TEST_TICKETS_TOKEN}" || raw.Description != "Find a ticket" {
+		t.Errorf("expected the current secrets to be kept, got %+v", raw)
+	}
+}
+
+func TestAdminAPI_DisabledWithoutToken(t *testing.T) {
+	reloader, _ := newReloader(t)
+	router := routes.NewAdminRouter(reloader, reloader)
+	rr := adminRequest(t, router, http.MethodDelete, "/api/v1/tools/fstool", "", nil)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 when no admin token is configured, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+)
+
+// killGrace is how long requests get to finish after their tool processes were killed.
+const killGrace = 5 * time.Second
+
+// durationOr parses a validated duration, returning def if it is empty.
+func durationOr(s string, def time.Duration) time.Duration {
+	if d, err := time.ParseDuration(s); err == nil {
+		return d
+	}
+	return def
+}
+
+// Listen opens the listener of cfg: the Unix domain socket if one is configured, otherwise
+// the TCP port on the configured interface.
+func Listen(cfg *config.Config) (net.Listener, error) {
+	if cfg.Server.Socket != "" {
+		path := cfg.ResolvePath(cfg.Server.Socket)
+		// Remove a socket left behind by a server that did not stop cleanly.
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", net.JoinHostPort(cfg.Server.Interface, cfg.Server.Port))
+}
+
+// NewHTTPServer returns a server for h with the timeouts of cfg.
+func NewHTTPServer(cfg *config.Config, h http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: durationOr(cfg.Server.ReadHeaderTimeout, 10*time.Second),
+		ReadTimeout:       durationOr(cfg.Server.ReadTimeout, time.Minute),
+		WriteTimeout:      durationOr(cfg.Server.WriteTimeout, 10*time.Minute),
+		IdleTimeout:       durationOr(cfg.Server.IdleTimeout, 2*time.Minute),
+		ErrorLog:          slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// Serve serves h as configured by cfg until ctx is done, then drains: it stops accepting
+// connections and waits up to the shutdown timeout for requests in progress. Requests still
+// running after that have their tool processes killed and a short grace period to respond.
+func Serve(ctx context.Context, cfg *config.Config, h http.Handler) error {
+	srv := NewHTTPServer(cfg, h)
+	var certs *tlsLoader
+	if cfg.Server.TLS != nil {
+		var err error
+		if certs, err = newTLSLoader(cfg); err != nil {
+			return err
+		}
+		srv.TLSConfig = certs.Config()
+	}
+	ln, err := Listen(cfg)
+	if err != nil {
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		if certs != nil {
+			errc <- srv.ServeTLS(ln, "", "")
+		} else {
+			errc <- srv.Serve(ln)
+		}
+	}()
+	slog.Info("Server listening", "address", ln.Addr().String(), "tls", certs != nil,
+		"mtls", cfg.Server.TLS != nil && cfg.Server.TLS.ClientCAFile != "")
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	timeout := durationOr(cfg.Server.ShutdownTimeout, 30*time.Second)
+	slog.Info("Shutting down: waiting for requests in progress", "timeout", timeout)
+	drainCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(drainCtx); err != nil {
+		killed := handlers.KillTools()
+		slog.Warn("Requests still in progress after the shutdown timeout: killed their tool processes", "tools", killed)
+		graceCtx, cancel := context.WithTimeout(context.Background(), killGrace)
+		defer cancel()
+		if err := srv.Shutdown(graceCtx); err != nil {
+			srv.Close()
+		}
+	}
+	if err := <-errc; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info("Server stopped")
+	return nil
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+	"krackenservices.com/agentAI/internal/logging"
+	"krackenservices.com/agentAI/internal/mcp"
+	"krackenservices.com/agentAI/internal/routes"
+	"krackenservices.com/agentAI/internal/toolmodel"
+	"krackenservices.com/agentAI/internal/toolregistry"
+)
+
+// live is a configuration together with the router built from it.
+type live struct {
+	cfg    *config.Config
+	router http.Handler
+}
+
+// Reloader owns the live configuration. It serves every request with the router built from
+// the current configuration and swaps in a new one when the config file is reloaded, so
+// in-flight requests finish with the configuration they started with.
+type Reloader struct {
+	current atomic.Pointer[live]
+
+	reloadMu sync.Mutex // serialises reloads
+	lastHash [sha256.Size]byte
+
+	statusMu sync.Mutex
+	status   handlers.ReloadStatus
+}
+
+// NewReloader builds the initial router from cfg.
+func NewReloader(cfg *config.Config) (*Reloader, error) {
+	router, err := buildRouter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reloader{}
+	r.current.Store(&live{cfg: cfg, router: router})
+	logging.SetRedaction(cfg)
+	handlers.SetLiveConfig(cfg)
+	r.lastHash = cfg.Fingerprint()
+	now := time.Now()
+	r.status = handlers.ReloadStatus{
+		Generation:  1,
+		Success:     true,
+		Trigger:     "startup",
+		LastAttempt: now,
+		LastSuccess: now,
+		ConfigPath:  cfg.Path,
+	}
+	return r, nil
+}
+
+// Config returns the live configuration.
+func (r *Reloader) Config() *config.Config {
+	return r.current.Load().cfg
+}
+
+// ServeHTTP dispatches the request to the router of the live configuration.
+func (r *Reloader) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.current.Load().router.ServeHTTP(w, req)
+}
+
+// Status returns the outcome of the last reload.
+func (r *Reloader) Status() handlers.ReloadStatus {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	return r.status
+}
+
+// Reload re-reads the config file, validates it, rediscovers tools and swaps in the new
+// configuration. On failure the current configuration stays active.
+func (r *Reloader) Reload(trigger string) error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	old := r.current.Load().cfg
+	err := r.reload(old)
+
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	r.status.Trigger = trigger
+	r.status.LastAttempt = time.Now()
+	if err != nil {
+		r.status.Success = false
+		r.status.Error = err.Error()
+		slog.Error("Config reload failed, keeping the current configuration", "trigger", trigger, "generation", r.status.Generation, "error", err)
+		return err
+	}
+	r.status.Generation++
+	r.status.Success = true
+	r.status.Error = ""
+	r.status.LastSuccess = r.status.LastAttempt
+	slog.Info("Config reload succeeded", "trigger", trigger, "generation", r.status.Generation)
+	return nil
+}
+
+func (r *Reloader) reload(old *config.Config) error {
+	// Remember this content even if it is rejected, so the watcher waits for the next edit.
+	r.lastHash = old.Fingerprint()
+
+	// The tools and MCP connections of the new configuration are only installed once it has
+	// been accepted, so that a rejected reload leaves the running one untouched.
+	registry, err := scanTools()
+	if err != nil {
+		slog.Error("Error discovering tools", "error", err)
+	}
+	if registry == nil {
+		registry = old.Registry()
+	}
+	cfg, err := config.LoadConfigWithTools(old.Path, registry)
+	if err != nil {
+		return err
+	}
+
+	pending := mcp.NewPool()
+	stale := reconnectMCPServers(pending, cfg, old)
+	if !reflect.DeepEqual(cfg.Server, old.Server) {
+		slog.Warn("Config reload: changes to the server section take effect after a restart")
+	}
+
+	router, err := buildRouter(cfg)
+	if err != nil {
+		pending.Close()
+		return err
+	}
+	r.current.Store(&live{cfg: cfg, router: router})
+	toolregistry.Install(registry)
+	mcp.DefaultPool.Replace(stale, pending)
+	logging.SetRedaction(cfg)
+	handlers.SetLiveConfig(cfg)
+	r.lastHash = cfg.Fingerprint()
+	return nil
+}
+
+// reconnectMCPServers connects the MCP servers of cfg that are new or changed since old into
+// pending and adds their tools to cfg, with those of the unchanged servers, whose existing
+// connections are kept. It returns the IDs of the servers of old that were removed or
+// changed, whose connections are to be closed.
+func reconnectMCPServers(pending *mcp.Pool, cfg, old *config.Config) []string {
+	previous := make(map[string]toolmodel.MCPServerConfig, len(old.MCPServers))
+	for _, srv := range old.MCPServers {
+		previous[srv.ID] = srv
+	}
+	kept := make(map[string]bool)
+	var changed []toolmodel.MCPServerConfig
+	for _, srv := range cfg.MCPServers {
+		if p, ok := previous[srv.ID]; ok && reflect.DeepEqual(p, srv) {
+			kept[srv.ID] = true
+		} else {
+			changed = append(changed, srv)
+		}
+	}
+	var stale []string
+	for id := range previous {
+		if !kept[id] {
+			stale = append(stale, id)
+		}
+	}
+
+	var tools []toolmodel.ToolConfig
+	for _, tool := range mcpTools(old) {
+		if kept[tool.MCP.Server] {
+			tools = append(tools, tool)
+		}
+	}
+	if len(changed) > 0 {
+		connected, err := pending.Connect(context.Background(), changed)
+		if err != nil {
+			slog.Error("Error connecting to MCP servers", "error", err)
+		}
+		tools = append(tools, connected...)
+	}
+	cfg.MergeTools(tools)
+	return stale
+}
+
+// mcpTools returns the tools of cfg that were discovered from MCP servers.
+func mcpTools(cfg *config.Config) []toolmodel.ToolConfig {
+	var tools []toolmodel.ToolConfig
+	for _, tool := range cfg.Tools {
+		if tool.IsMCP() && tool.MCP != nil {
+			tools = append(tools, tool)
+		}
+	}
+	return tools
+}
+
+// buildRouter builds the router for cfg, turning registration panics (e.g. two tools
+// sharing a route) into errors so a bad reload cannot take the server down.
+func buildRouter(cfg *config.Config) (router http.Handler, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("invalid routes: %v", p)
+		}
+	}()
+	return routes.NewRouter(cfg)
+}
+
+// Watch polls the config files (base file, includes, conf.d fragments and environment
+// overlay) and reloads them whenever their content changes, until ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		sum := r.Config().Fingerprint()
+		r.reloadMu.Lock()
+		changed := sum != r.lastHash
+		r.reloadMu.Unlock()
+		if changed {
+			r.Reload("file")
+		}
+	}
+}
+
+// ReloadOnSignal reloads the configuration whenever the process receives SIGHUP, until ctx is done.
+func (r *Reloader) ReloadOnSignal(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	defer signal.Stop(sig)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sig:
+			r.Reload("signal")
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+	"krackenservices.com/agentAI/internal/mcp"
+	"krackenservices.com/agentAI/internal/problem"
+	"krackenservices.com/agentAI/internal/routes"
+	"krackenservices.com/agentAI/internal/server"
+	"krackenservices.com/agentAI/internal/toolmodel"
+	"krackenservices.com/agentAI/internal/toolregistry"
+)
+
+const configTemplate = `
+version: "1.0"
+models:
+  - id: %s
+    name: mymodel
+    endpoint: http://127.0.0.1:8080/
+`
+
+func writeConfig(t *testing.T, path, modelID string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(fmt.Sprintf(configTemplate, modelID)), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+}
+
+// modelIDs fetches /api/v1/models through the handler and returns the model IDs.
+func modelIDs(t *testing.T, h http.Handler) []string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/models", nil))
+	var models []config.ModelConfig
+	if err := json.NewDecoder(rr.Body).Decode(&models); err != nil {
+		t.Fatalf("error decoding models: %v", err)
+	}
+	var ids []string
+	for _, m := range models {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func newReloader(t *testing.T) (*server.Reloader, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeConfig(t, path, "first")
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("expected valid config, got %v", err)
+	}
+	reloader, err := server.NewReloader(cfg)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	return reloader, path
+}
+
+func TestReloader_SwapsConfigAndKeepsOldOnFailure(t *testing.T) {
+	reloader, path := newReloader(t)
+	router := routes.NewAdminRouter(reloader, reloader)
+
+	if ids := modelIDs(t, router); len(ids) != 1 || ids[0] != "first" {
+		t.Fatalf("expected initial model, got %v", ids)
+	}
+
+	writeConfig(t, path, "second")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/admin/reload", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected reload to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if ids := modelIDs(t, router); len(ids) != 1 || ids[0] != "second" {
+		t.Fatalf("expected reloaded model, got %v", ids)
+	}
+
+	// A config without models is invalid and must not replace the live one.
+	os.WriteFile(path, []byte("version: \"1.0\"\n"), 0644)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/v1/admin/reload", nil))
+	if rr.Code != http.StatusUnprocessableEntity || rr.Header().Get("Content-Type") != problem.ContentType {
+		t.Fatalf("expected a 422 problem for invalid config, got %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var p problem.Problem
+	json.NewDecoder(rr.Body).Decode(&p)
+	if p.Type != problem.TypeInvalidConfig || len(p.Errors) == 0 || p.Errors[0].Field != "models" {
+		t.Errorf("expected the validation errors of the config, got %+v", p)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/admin/reload", nil))
+	var status handlers.ReloadStatus
+	json.NewDecoder(rr.Body).Decode(&status)
+	if status.Success || status.Error == "" || status.Generation != 2 || status.Trigger != "api" {
+		t.Errorf("unexpected status after failed reload: %+v", status)
+	}
+	if ids := modelIDs(t, router); len(ids) != 1 || ids[0] != "second" {
+		t.Fatalf("expected previous config to stay live, got %v", ids)
+	}
+}
+
+func TestReloader_InstallsToolsOnlyOnSuccess(t *testing.T) {
+	reloader, path := newReloader(t)
+	defer toolregistry.Install(toolregistry.Installed())
+	toolregistry.Register(toolmodel.ToolConfig{ID: "discovered", Name: "discovered"})
+
+	// The tools directory next to the test binary is empty: a rejected reload must not
+	// install its empty registry.
+	os.WriteFile(path, []byte("version: \"1.0\"\n"), 0644)
+	if err := reloader.Reload("api"); err == nil {
+		t.Fatal("expected the reload to fail")
+	}
+	if _, ok := toolregistry.Lookup("discovered"); !ok {
+		t.Fatal("expected a rejected reload to keep the installed tools")
+	}
+
+	writeConfig(t, path, "second")
+	if err := reloader.Reload("api"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := toolregistry.Lookup("discovered"); ok {
+		t.Error("expected an accepted reload to install the rediscovered tools")
+	}
+	if reloader.Config().Registry() != toolregistry.Installed() {
+		t.Error("expected the live configuration to use the installed tools")
+	}
+}
+
+func TestReloader_ClosesRemovedMCPServers(t *testing.T) {
+	fixture := &mcp.Server{
+		Tools: func(ctx context.Context) []toolmodel.ToolConfig {
+			return []toolmodel.ToolConfig{{ID: "echo", Description: "Echo"}}
+		},
+		Call: func(ctx context.Context, tool toolmodel.ToolConfig, args map[string]interface{}) (string, error) {
+			return "echoed", nil
+		},
+	}
+	srv := httptest.NewServer(fixture)
+	defer srv.Close()
+	defer mcp.DefaultPool.Close()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	writeWithServer := func(modelID string) {
+		mcpServers := "mcp_servers:\n  - id: fx\n    transport: http\n    url: " + srv.URL + "\n"
+		os.WriteFile(path, []byte(fmt.Sprintf(configTemplate, modelID)+mcpServers), 0644)
+	}
+	writeWithServer("first")
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.ConnectMCPServers(cfg)
+	reloader, err := server.NewReloader(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	echo := &toolmodel.MCPToolRef{Server: "fx", Tool: "echo"}
+	if out, err := mcp.DefaultPool.CallTool(context.Background(), echo, nil); err != nil || out != "echoed" {
+		t.Fatalf("expected the fixture server to be connected, got %q, %v", out, err)
+	}
+
+	// An unchanged server keeps its connection and its tools.
+	writeWithServer("second")
+	if err := reloader.Reload("api"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mcp.DefaultPool.CallTool(context.Background(), echo, nil); err != nil || !hasTool(reloader.Config(), "fx.echo") {
+		t.Fatalf("expected the unchanged server to stay connected with its tools, got %v", err)
+	}
+
+	// A removed server is disconnected once the reload is accepted.
+	writeConfig(t, path, "third")
+	if err := reloader.Reload("api"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mcp.DefaultPool.CallTool(context.Background(), echo, nil); err == nil {
+		t.Error("expected the removed server to be disconnected")
+	}
+}
+
+// hasTool reports whether cfg has the tool with the ID.
+func hasTool(cfg *config.Config, id string) bool {
+	for _, tool := range cfg.Tools {
+		if tool.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReloader_Watch(t *testing.T) {
+	reloader, path := newReloader(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 10*time.Millisecond)
+
+	writeConfig(t, path, "watched")
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if reloader.Config().Models[0].ID == "watched" {
+			if status := reloader.Status(); status.Trigger != "file" || !status.Success {
+				t.Errorf("unexpected status %+v", status)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("expected the watcher to reload the changed config")
+}
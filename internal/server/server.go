@@ -1,17 +1,116 @@
 package server
 
 import (
-	"log"
-	"net/http"
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"krackenservices.com/agentAI/internal/batch"
 	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/handlers"
+	"krackenservices.com/agentAI/internal/logging"
+	"krackenservices.com/agentAI/internal/mcp"
 	"krackenservices.com/agentAI/internal/routes"
+	"krackenservices.com/agentAI/internal/session"
+	"krackenservices.com/agentAI/internal/toolregistry"
+	"krackenservices.com/agentAI/internal/tracing"
+	"krackenservices.com/agentAI/internal/usage"
 )
 
-// StartServer initializes and starts the HTTP server.
+// StartServer initializes and runs the HTTP server until it receives SIGTERM or SIGINT.
 func StartServer(cfg *config.Config) error {
-	router := routes.NewRouter(cfg)
-	address := ":" + cfg.Server.Port
-	log.Printf("Server starting on port %s", cfg.Server.Port)
-	return http.ListenAndServe(address, router)
+	logging.Configure(cfg)
+	ConnectMCPServers(cfg)
+	defer mcp.DefaultPool.Close()
+
+	if cfg.Usage.File != "" {
+		if err := usage.Default.Open(cfg.ResolvePath(cfg.Usage.File)); err != nil {
+			return err
+		}
+		defer usage.Default.Close()
+	}
+	if cfg.Sessions.Dir != "" {
+		if err := session.Default.Open(cfg.ResolvePath(cfg.Sessions.Dir)); err != nil {
+			return err
+		}
+	}
+	if cfg.Batches.Dir != "" {
+		if err := batch.Default.Open(cfg.ResolvePath(cfg.Batches.Dir)); err != nil {
+			return err
+		}
+		handlers.ResumeBatches(cfg)
+	}
+
+	shutdownTracing, err := tracing.Configure(cfg)
+	if err != nil {
+		return err
+	}
+	if shutdownTracing != nil {
+		slog.Info("Exporting traces", "exporter", cfg.Server.Tracing.Exporter)
+		defer shutdownTracing()
+	}
+
+	reloader, err := NewReloader(cfg)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.ReloadOnSignal(ctx)
+	if cfg.Server.WatchConfig {
+		interval, _ := time.ParseDuration(cfg.Server.WatchInterval)
+		slog.Info("Watching the config file for changes", "path", cfg.Path, "interval", interval)
+		go reloader.Watch(ctx, interval)
+	}
+
+	if !cfg.Auth.Enabled() {
+		slog.Warn("Authentication is disabled; anyone who can reach the server may chat and execute tools")
+	}
+	router := logging.RequestID(routes.NewAdminRouter(reloader, reloader))
+
+	// Drain on SIGTERM (e.g. from Docker or Kubernetes) and Ctrl-C.
+	stop, stopped := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stopped()
+	return Serve(stop, cfg, router)
+}
+
+// DiscoverTools builds the internal tool registry from the tools directory next to the
+// executable. Tools that fail to describe themselves are reported but do not stop startup.
+func DiscoverTools() error {
+	registry, err := scanTools()
+	if registry != nil {
+		toolregistry.Install(registry)
+	}
+	return err
+}
+
+// scanTools discovers the tools of the tools directory next to the executable into a
+// registry that is not installed yet. The registry is nil if the directory cannot be read.
+func scanTools() (*toolregistry.Registry, error) {
+	dir, err := toolregistry.Dir()
+	if err != nil {
+		return nil, err
+	}
+	registry, err := toolregistry.Scan(dir)
+	if registry != nil {
+		slog.Info("Discovered tools", "count", len(registry.All()), "dir", dir)
+	}
+	return registry, err
+}
+
+// ConnectMCPServers discovers the tools of the configured MCP servers and adds them to cfg.
+// Servers that cannot be reached are logged and skipped so the API still starts.
+func ConnectMCPServers(cfg *config.Config) {
+	if len(cfg.MCPServers) == 0 {
+		return
+	}
+	tools, err := mcp.DefaultPool.Connect(context.Background(), cfg.MCPServers)
+	if err != nil {
+		slog.Error("Error connecting to MCP servers", "error", err)
+	}
+	cfg.MergeTools(tools)
+	slog.Info("Discovered tools from MCP servers", "count", len(tools))
 }
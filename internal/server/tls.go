@@ -0,0 +1,122 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"krackenservices.com/agentAI/internal/config"
+)
+
+// tlsCheckInterval is how often the certificate files are checked for changes.
+const tlsCheckInterval = 5 * time.Second
+
+// tlsLoader serves the TLS configuration of the certificate files, reloading it when one
+// of the files changes. A renewed certificate that cannot be loaded is reported and the
+// previous one stays in use.
+type tlsLoader struct {
+	certFile, keyFile, clientCAFile string
+
+	mu      sync.Mutex
+	checked time.Time
+	stamp   string
+	current *tls.Config
+}
+
+// newTLSLoader loads the certificate files named by cfg, relative to the config file.
+func newTLSLoader(cfg *config.Config) (*tlsLoader, error) {
+	t := cfg.Server.TLS
+	l := &tlsLoader{certFile: cfg.ResolvePath(t.CertFile), keyFile: cfg.ResolvePath(t.KeyFile)}
+	if t.ClientCAFile != "" {
+		l.clientCAFile = cfg.ResolvePath(t.ClientCAFile)
+	}
+	stamp, err := l.modStamp()
+	if err != nil {
+		return nil, err
+	}
+	if l.current, err = l.load(); err != nil {
+		return nil, err
+	}
+	l.stamp, l.checked = stamp, time.Now()
+	return l, nil
+}
+
+// modStamp summarises the modification times of the files.
+func (l *tlsLoader) modStamp() (string, error) {
+	var stamp string
+	for _, path := range []string{l.certFile, l.keyFile, l.clientCAFile} {
+		if path == "" {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%d/%d;", fi.ModTime().UnixNano(), fi.Size())
+	}
+	return stamp, nil
+}
+
+func (l *tlsLoader) load() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	c := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if l.clientCAFile != "" {
+		pem, err := os.ReadFile(l.clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", l.clientCAFile)
+		}
+		c.ClientCAs, c.ClientAuth = pool, tls.RequireAndVerifyClientCert
+	}
+	return c, nil
+}
+
+// get returns the current configuration, reloading the files if they changed.
+func (l *tlsLoader) get() *tls.Config {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Since(l.checked) < tlsCheckInterval {
+		return l.current
+	}
+	l.checked = time.Now()
+	stamp, err := l.modStamp()
+	if err != nil || stamp == l.stamp {
+		return l.current
+	}
+	c, err := l.load()
+	if err != nil {
+		slog.Error("Error reloading TLS certificate, keeping the previous one", "error", err)
+		return l.current
+	}
+	l.current, l.stamp = c, stamp
+	slog.Info("Reloaded TLS certificate", "cert_file", l.certFile)
+	return c
+}
+
+// Config returns the TLS configuration of the server, which consults the loader on every
+// handshake.
+func (l *tlsLoader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return l.get(), nil
+		},
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return &l.get().Certificates[0], nil
+		},
+	}
+}
@@ -0,0 +1,218 @@
+// Package session keeps the conversations of the sessions API, in memory and optionally as
+// one JSON file per session in a directory, so that clients can resume them.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"krackenservices.com/agentAI/internal/llm"
+)
+
+// Default is the session store of the server.
+var Default = NewStore()
+
+// ErrNotFound is returned for a session that does not exist.
+var ErrNotFound = errors.New("session not found")
+
+// ErrBusy is returned by Begin for a session that is answering another message.
+var ErrBusy = errors.New("the session is answering another message")
+
+// Session is a conversation with the agent.
+// swagger:model Session
+type Session struct {
+	ID string `json:"id" example:"9b2f6c1e0d4a7f3e5c8b1a2d3e4f5a6b"`
+	// Principal is the API key id or JWT subject that owns the session.
+	Principal string `json:"principal" example:"ci"`
+	// Model is the model of the next message unless the message names another.
+	Model    string        `json:"model" example:"local"`
+	Messages []llm.Message `json:"messages,omitempty"`
+	Created  time.Time     `json:"created"`
+	Updated  time.Time     `json:"updated"`
+}
+
+// clone returns a copy of s that does not share its messages.
+func (s *Session) clone() Session {
+	c := *s
+	c.Messages = append([]llm.Message(nil), s.Messages...)
+	return c
+}
+
+// Store holds sessions by ID.
+type Store struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+	// busy holds the sessions answering a message.
+	busy map[string]bool
+	dir  string
+}
+
+// NewStore returns a store that keeps sessions in memory.
+func NewStore() *Store {
+	return &Store{sessions: make(map[string]*Session), busy: make(map[string]bool)}
+}
+
+// Open loads the sessions saved in dir and saves every change to it. A missing directory is
+// created.
+func (s *Store) Open(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var sess Session
+		if err := json.Unmarshal(data, &sess); err != nil {
+			return &os.PathError{Op: "load session", Path: file, Err: err}
+		}
+		s.sessions[sess.ID] = &sess
+	}
+	s.dir = dir
+	return nil
+}
+
+// save writes sess to the directory of the store, if it has one. The caller holds s.mu.
+func (s *Store) save(sess *Session) error {
+	if s.dir == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(sess, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, sess.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Create starts a session of principal with the model and, to continue a saved
+// conversation, its messages.
+func (s *Store) Create(principal, model string, messages []llm.Message) (Session, error) {
+	id := make([]byte, 16)
+	rand.Read(id)
+	now := time.Now().UTC()
+	sess := &Session{
+		ID:        hex.EncodeToString(id),
+		Principal: principal,
+		Model:     model,
+		Messages:  append([]llm.Message(nil), messages...),
+		Created:   now,
+		Updated:   now,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.save(sess); err != nil {
+		return Session{}, err
+	}
+	s.sessions[sess.ID] = sess
+	return sess.clone(), nil
+}
+
+// Get returns the session with the ID.
+func (s *Store) Get(id string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return Session{}, false
+	}
+	return sess.clone(), true
+}
+
+// Begin marks the session with the ID as answering a message until done is called, and
+// returns the session as it is then. A session answers one message at a time, so that every
+// message sees the replies to the previous ones: Begin fails with ErrBusy while another
+// message is answered.
+func (s *Store) Begin(id string) (sess Session, done func(), err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.sessions[id]
+	if !ok {
+		return Session{}, nil, ErrNotFound
+	}
+	if s.busy[id] {
+		return Session{}, nil, ErrBusy
+	}
+	s.busy[id] = true
+	done = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.busy, id)
+	}
+	return current.clone(), done, nil
+}
+
+// List returns the sessions of principal, or of everyone if principal is empty, most
+// recently updated first and without their messages.
+func (s *Store) List(principal string) []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []Session{}
+	for _, sess := range s.sessions {
+		if principal == "" || sess.Principal == principal {
+			c := *sess
+			c.Messages = nil
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].Updated.Equal(list[j].Updated) {
+			return list[i].Updated.After(list[j].Updated)
+		}
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Append adds messages to the session and sets the model of its next message.
+func (s *Store) Append(id, model string, messages ...llm.Message) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, ok := s.sessions[id]
+	if !ok {
+		return Session{}, ErrNotFound
+	}
+	updated := sess.clone()
+	updated.Model = model
+	updated.Messages = append(updated.Messages, messages...)
+	updated.Updated = time.Now().UTC()
+	if err := s.save(&updated); err != nil {
+		return Session{}, err
+	}
+	s.sessions[id] = &updated
+	return updated.clone(), nil
+}
+
+// Delete removes the session and reports whether it existed.
+func (s *Store) Delete(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sessions[id]; !ok {
+		return false, nil
+	}
+	delete(s.sessions, id)
+	if s.dir != "" {
+		if err := os.Remove(filepath.Join(s.dir, id+".json")); err != nil && !os.IsNotExist(err) {
+			return true, err
+		}
+	}
+	return true, nil
+}
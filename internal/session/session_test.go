@@ -0,0 +1,76 @@
+package session_test
+
+import (
+	"testing"
+
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/session"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	store := session.NewStore()
+	if err := store.Open(dir); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	s, err := store.Create("ci", "local", []llm.Message{{Role: "user", Content: "hi"}})
+	if err != nil || s.ID == "" || len(s.Messages) != 1 {
+		t.Fatalf("unexpected session %+v, %v", s, err)
+	}
+	other, _ := store.Create("ops", "local", nil)
+	if _, err := store.Append(s.ID, "big", llm.Message{Role: "assistant", Content: "hello"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if _, err := store.Append("missing", "big"); err != session.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	// A session answers one message at a time.
+	got, done, err := store.Begin(s.ID)
+	if err != nil || len(got.Messages) != 2 {
+		t.Fatalf("expected the session with its reply, got %+v, %v", got, err)
+	}
+	if _, _, err := store.Begin(s.ID); err != session.ErrBusy {
+		t.Errorf("expected ErrBusy, got %v", err)
+	}
+	done()
+	if _, done, err := store.Begin(s.ID); err != nil {
+		t.Errorf("expected the session to be free again, got %v", err)
+	} else {
+		done()
+	}
+	if _, _, err := store.Begin("missing"); err != session.ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	if list := store.List("ci"); len(list) != 1 || list[0].ID != s.ID || list[0].Messages != nil {
+		t.Errorf("expected the session of ci without messages, got %+v", list)
+	}
+	if list := store.List(""); len(list) != 2 || list[0].ID != s.ID {
+		t.Errorf("expected both sessions, most recently updated first, got %+v", list)
+	}
+
+	// Sessions survive a restart.
+	reopened := session.NewStore()
+	if err := reopened.Open(dir); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	got, ok := reopened.Get(s.ID)
+	if !ok || got.Model != "big" || len(got.Messages) != 2 || got.Messages[1].Content != "hello" {
+		t.Errorf("expected the saved session, got %+v", got)
+	}
+
+	if deleted, err := reopened.Delete(other.ID); !deleted || err != nil {
+		t.Errorf("expected the session to be deleted, got %v, %v", deleted, err)
+	}
+	if deleted, _ := reopened.Delete(other.ID); deleted {
+		t.Error("expected a second delete to find nothing")
+	}
+	again := session.NewStore()
+	if err := again.Open(dir); err != nil {
+		t.Fatal(err)
+	}
+	if list := again.List(""); len(list) != 1 || list[0].ID != s.ID {
+		t.Errorf("expected the deleted session to be gone from the directory, got %+v", list)
+	}
+}
@@ -1,14 +1,248 @@
 package toolmodel
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Tool types supported by ToolConfig.Type. An empty type is treated as TypeBinary.
+const (
+	TypeBinary = "binary"
+	TypeHTTP   = "http"
+	TypeMCP    = "mcp"
+)
+
 // ToolConfig represents the configuration for a tool.
 // swagger:model ToolConfig
 type ToolConfig struct {
-	ID              string                 `yaml:"id"`
-	Name            string                 `yaml:"name"`
-	Description     string                 `yaml:"description"`
-	CommandKey      string                 `yaml:"command_key"`
-	CommandArgs     map[string]interface{} `yaml:"command_args"`
-	Example         map[string]interface{} `yaml:"example"`
-	ExampleResponse map[string]interface{} `yaml:"example_response"`
-	Enabled         *bool                  `yaml:"enabled,omitempty"`
+	ID              string                 `yaml:"id" json:"id"`
+	Name            string                 `yaml:"name,omitempty" json:"name,omitempty"`
+	Description     string                 `yaml:"description,omitempty" json:"description,omitempty"`
+	Type            string                 `yaml:"type,omitempty" json:"type,omitempty"`
+	CommandKey      string                 `yaml:"command_key,omitempty" json:"command_key,omitempty"`
+	CommandArgs     map[string]interface{} `yaml:"command_args,omitempty" json:"command_args,omitempty"`
+	ArgOrder        []string               `yaml:"arg_order,omitempty" json:"arg_order,omitempty"`
+	HTTP            *HTTPConfig            `yaml:"http,omitempty" json:"http,omitempty"`
+	MCP             *MCPToolRef            `yaml:"mcp,omitempty" json:"mcp,omitempty"`
+	InputSchema     map[string]interface{} `yaml:"input_schema,omitempty" json:"input_schema,omitempty"`
+	Example         map[string]interface{} `yaml:"example,omitempty" json:"example,omitempty"`
+	ExampleResponse map[string]interface{} `yaml:"example_response,omitempty" json:"example_response,omitempty"`
+	Enabled         *bool                  `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+}
+
+// HTTPConfig describes how a webhook tool calls its HTTP endpoint.
+// URL, header values and string body values are Go templates rendered with the tool args.
+// Values in the URL are path-escaped, or query-escaped after its "?", unless the action ends
+// in pathEscape or queryEscape itself; an argument the templates use but the call lacks is an error.
+type HTTPConfig struct {
+	Method   string                 `yaml:"method,omitempty" json:"method,omitempty" example:"POST"`
+	URL      string                 `yaml:"url" json:"url" example:"http://tickets.internal/api/issues/{{.id}}"`
+	Headers  map[string]string      `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Auth     *HTTPAuth              `yaml:"auth,omitempty" json:"auth,omitempty"`
+	Body     map[string]interface{} `yaml:"body,omitempty" json:"body,omitempty"`
+	Response string                 `yaml:"response,omitempty" json:"response,omitempty" example:"data.summary"`
+	Timeout  string                 `yaml:"timeout,omitempty" json:"timeout,omitempty" example:"30s"`
+	// MaxResponseBytes bounds the response body; larger responses fail the call (default 1 MiB).
+	MaxResponseBytes int64 `yaml:"max_response_bytes,omitempty" json:"max_response_bytes,omitempty" example:"1048576"`
+}
+
+// HTTPAuth holds the credentials sent with a webhook tool request.
+// Type is one of "basic", "bearer" or "header".
+type HTTPAuth struct {
+	Type     string `yaml:"type" json:"type" example:"bearer"`
+	Username string `yaml:"username,omitempty" json:"username,omitempty"`
+	Password string `yaml:"password,omitempty" json:"password,omitempty"`
+	Token    string `yaml:"token,omitempty" json:"token,omitempty"`
+	Header   string `yaml:"header,omitempty" json:"header,omitempty" example:"X-API-Key"`
+}
+
+// MCPToolRef identifies a tool provided by an external MCP server.
+type MCPToolRef struct {
+	Server string `yaml:"server" json:"server" example:"github"`
+	Tool   string `yaml:"tool" json:"tool" example:"create_issue"`
+}
+
+// MCPServerConfig declares an external Model Context Protocol server whose tools are offered to models.
+// Transport is "stdio" (Command/Args/Env launch a subprocess) or "http" (streamable HTTP at URL).
+type MCPServerConfig struct {
+	ID        string            `yaml:"id" json:"id" example:"github"`
+	Transport string            `yaml:"transport" json:"transport" example:"stdio"`
+	Command   string            `yaml:"command,omitempty" json:"command,omitempty" example:"github-mcp-server"`
+	Args      []string          `yaml:"args,omitempty" json:"args,omitempty"`
+	Env       map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	URL       string            `yaml:"url,omitempty" json:"url,omitempty" example:"http://127.0.0.1:9000/mcp"`
+	Headers   map[string]string `yaml:"headers,omitempty" json:"headers,omitempty"`
+	Timeout   string            `yaml:"timeout,omitempty" json:"timeout,omitempty" example:"30s"`
+	Enabled   *bool             `yaml:"enabled,omitempty" json:"enabled,omitempty"`
+}
+
+// WithOverride returns the tool with every field set in o applied on top of it.
+// This is how config entries customise tools described by their manifests.
+func (t ToolConfig) WithOverride(o ToolConfig) ToolConfig {
+	if o.Name != "" {
+		t.Name = o.Name
+	}
+	if o.Description != "" {
+		t.Description = o.Description
+	}
+	if o.CommandKey != "" {
+		t.CommandKey = o.CommandKey
+	}
+	if o.CommandArgs != nil {
+		t.CommandArgs = o.CommandArgs
+	}
+	if o.ArgOrder != nil {
+		t.ArgOrder = o.ArgOrder
+	}
+	if o.Example != nil {
+		t.Example = o.Example
+	}
+	if o.ExampleResponse != nil {
+		t.ExampleResponse = o.ExampleResponse
+	}
+	if o.Enabled != nil {
+		t.Enabled = o.Enabled
+	}
+	return t
+}
+
+// IsHTTP reports whether the tool is invoked over HTTP rather than as a local binary.
+func (t ToolConfig) IsHTTP() bool {
+	return t.Type == TypeHTTP
+}
+
+// IsMCP reports whether the tool is dispatched to an external MCP server.
+func (t ToolConfig) IsMCP() bool {
+	return t.Type == TypeMCP
+}
+
+// ArgumentSchema returns a JSON Schema describing the tool's arguments. Tools that carry their
+// own schema (e.g. those discovered over MCP) return it; otherwise one is derived from CommandArgs,
+// with each default value determining the argument's type.
+func (t ToolConfig) ArgumentSchema() map[string]interface{} {
+	if t.InputSchema != nil {
+		return t.InputSchema
+	}
+	properties := make(map[string]interface{}, len(t.CommandArgs))
+	for name, def := range t.CommandArgs {
+		prop := map[string]interface{}{"type": jsonType(def)}
+		if def != nil {
+			prop["default"] = def
+		}
+		properties[name] = prop
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+}
+
+// jsonType maps a YAML-decoded value to its JSON Schema type name.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case bool:
+		return "boolean"
+	case int, int64, uint64:
+		return "integer"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}, map[interface{}]interface{}:
+		return "object"
+	default:
+		return "string"
+	}
+}
+
+// ArgError describes one invalid argument of a tool call.
+type ArgError struct {
+	Arg     string `json:"arg"`
+	Message string `json:"message"`
+}
+
+// ArgsError reports that the arguments of a tool call do not match the tool's schema.
+type ArgsError struct {
+	Tool   string
+	Errors []ArgError
+}
+
+func (e *ArgsError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, a := range e.Errors {
+		msgs[i] = a.Arg + ": " + a.Message
+	}
+	return fmt.Sprintf("invalid arguments for tool %q: %s", e.Tool, strings.Join(msgs, "; "))
+}
+
+// ExecError reports that a tool was called but failed: its process exited with an error or
+// its webhook or MCP server returned one.
+type ExecError struct {
+	Tool string
+	Err  error
+}
+
+func (e *ExecError) Error() string {
+	return fmt.Sprintf("tool %q failed: %v", e.Tool, e.Err)
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateArgs checks args before the tool is called. Against an InputSchema, required
+// arguments must be present and known arguments must have the declared type. Arguments of
+// tools configured with CommandArgs defaults are passed as text, so they only have to be
+// scalars unless their default is a list or an object. Unknown arguments are not reported;
+// such tools ignore them.
+func (t ToolConfig) ValidateArgs(args map[string]interface{}) error {
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []ArgError
+	if t.InputSchema != nil {
+		required, _ := t.InputSchema["required"].([]interface{})
+		for _, r := range required {
+			if name, ok := r.(string); ok {
+				if _, present := args[name]; !present {
+					errs = append(errs, ArgError{Arg: name, Message: "is required"})
+				}
+			}
+		}
+		props, _ := t.InputSchema["properties"].(map[string]interface{})
+		for _, name := range names {
+			prop, _ := props[name].(map[string]interface{})
+			if want, _ := prop["type"].(string); want != "" && !hasJSONType(args[name], want) {
+				errs = append(errs, ArgError{Arg: name, Message: "must be of type " + want})
+			}
+		}
+	} else {
+		for _, name := range names {
+			def, known := t.CommandArgs[name]
+			got := jsonType(args[name])
+			if known && (got == "array" || got == "object") && jsonType(def) != got {
+				errs = append(errs, ArgError{Arg: name, Message: "must be a string, number or boolean"})
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return &ArgsError{Tool: t.ID, Errors: errs}
+	}
+	return nil
+}
+
+// hasJSONType reports whether a JSON-decoded value has the JSON Schema type want.
+func hasJSONType(v interface{}, want string) bool {
+	switch want {
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == float64(int64(f))
+	case "null":
+		return v == nil
+	}
+	return jsonType(v) == want || (want == "number" && jsonType(v) == "integer")
 }
@@ -1,16 +1,200 @@
 package toolregistry
 
-import "krackenservices.com/agentAI/internal/toolmodel"
-
-// InternalTools holds the built‑in tools that are enabled by default.
-var InternalTools = map[string]toolmodel.ToolConfig{
-	"fstool": {
-		ID:          "fstool",
-		Name:        "fstool",
-		Description: "Internal tool to list files on the local filesystem",
-		CommandKey:  "fstool",
-		CommandArgs: map[string]interface{}{"path": "."},
-		Example:     map[string]interface{}{"tool": "fstool", "args": map[string]string{"path": "."}},
-	},
-	// Add other internal tools as needed.
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	"krackenservices.com/agentAI/internal/toolmodel"
+)
+
+// BinaryPrefix is the file name prefix of tool binaries in the tools directory.
+const BinaryPrefix = "agentAI-"
+
+// DescribeFlag asks a tool binary to print its manifest and exit.
+const DescribeFlag = "--describe"
+
+// describeTimeout bounds how long a tool may take to print its manifest.
+const describeTimeout = 10 * time.Second
+
+// DescribeCommand allows overriding exec.CommandContext in tests.
+var DescribeCommand = exec.CommandContext
+
+// Registry holds the tools discovered in a directory.
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]toolmodel.ToolConfig
+	// dir is the directory the tools were discovered in, empty if they were not.
+	dir string
+}
+
+// New returns an empty registry.
+func New() *Registry {
+	return &Registry{tools: make(map[string]toolmodel.ToolConfig)}
+}
+
+// installed is the registry of the package functions.
+var installed atomic.Pointer[Registry]
+
+func init() {
+	installed.Store(New())
+}
+
+// Installed returns the registry of the package functions, as set by Discover or Install.
+func Installed() *Registry {
+	return installed.Load()
+}
+
+// Install makes r the registry of the package functions.
+func Install(r *Registry) {
+	installed.Store(r)
+}
+
+// Dir returns the tools directory, "tools" next to the running executable.
+func Dir() (string, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("error determining executable path: %w", err)
+	}
+	return filepath.Join(filepath.Dir(exePath), "tools"), nil
+}
+
+// BinaryPath returns the path of the binary implementing the tool with the given ID in the
+// installed registry.
+func BinaryPath(id string) (string, error) {
+	return Installed().BinaryPath(id)
+}
+
+// BinaryPath returns the path of the binary implementing the tool with the given ID, in the
+// directory the tools were discovered in (by default Dir).
+func (r *Registry) BinaryPath(id string) (string, error) {
+	toolsDir, err := r.Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(toolsDir, BinaryPrefix+id), nil
+}
+
+// Dir returns the directory the tools were discovered in, by default Dir.
+func (r *Registry) Dir() (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.dir == "" {
+		return Dir()
+	}
+	return r.dir, nil
+}
+
+// Discover scans dir for tool binaries, asks each for its manifest and installs a registry
+// of the tools found. Tools that fail to describe themselves are skipped and reported in
+// the returned error. A missing directory yields an empty registry.
+func Discover(dir string) error {
+	r, err := Scan(dir)
+	if r != nil {
+		Install(r)
+	}
+	return err
+}
+
+// Scan discovers the tools in dir like Discover, into a new registry that is not installed.
+// The registry is nil if dir cannot be read.
+func Scan(dir string) (*Registry, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading tools directory %s: %w", dir, err)
+	}
+
+	r := New()
+	r.dir = dir
+	var errs []error
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, BinaryPrefix) {
+			continue
+		}
+		id := strings.TrimPrefix(name, BinaryPrefix)
+		tool, err := describe(filepath.Join(dir, name), id)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		r.tools[tool.ID] = tool
+	}
+	return r, errors.Join(errs...)
+}
+
+// describe runs a tool binary with DescribeFlag and parses the manifest it prints.
+func describe(path, id string) (toolmodel.ToolConfig, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+
+	output, err := DescribeCommand(ctx, path, DescribeFlag).Output()
+	if err != nil {
+		return toolmodel.ToolConfig{}, fmt.Errorf("tool '%s' did not describe itself: %w", id, err)
+	}
+	var tool toolmodel.ToolConfig
+	if err := yaml.Unmarshal(output, &tool); err != nil {
+		return toolmodel.ToolConfig{}, fmt.Errorf("tool '%s' printed an invalid manifest: %w", id, err)
+	}
+	if tool.ID == "" {
+		tool.ID = id
+	}
+	if tool.ID != id {
+		return toolmodel.ToolConfig{}, fmt.Errorf("tool binary %s describes tool '%s'; the id must match the file name", path, tool.ID)
+	}
+	if tool.Name == "" {
+		tool.Name = id
+	}
+	return tool, nil
+}
+
+// Register adds or replaces a single tool in the installed registry.
+func Register(tool toolmodel.ToolConfig) {
+	Installed().Register(tool)
+}
+
+// Register adds or replaces a single tool.
+func (r *Registry) Register(tool toolmodel.ToolConfig) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tools[tool.ID] = tool
+}
+
+// Lookup returns the tool with the given ID in the installed registry.
+func Lookup(id string) (toolmodel.ToolConfig, bool) {
+	return Installed().Lookup(id)
+}
+
+// Lookup returns the registered (internal) tool with the given ID.
+func (r *Registry) Lookup(id string) (toolmodel.ToolConfig, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tool, ok := r.tools[id]
+	return tool, ok
+}
+
+// All returns every tool of the installed registry, sorted by ID.
+func All() []toolmodel.ToolConfig {
+	return Installed().All()
+}
+
+// All returns every registered tool, sorted by ID.
+func (r *Registry) All() []toolmodel.ToolConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	all := make([]toolmodel.ToolConfig, 0, len(r.tools))
+	for _, tool := range r.tools {
+		all = append(all, tool)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].ID < all[j].ID })
+	return all
 }
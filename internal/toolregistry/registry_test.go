@@ -0,0 +1,80 @@
+package toolregistry_test
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/toolregistry"
+)
+
+// fakeDescribeCommand runs the test binary as the tool, passing the tool's file name along.
+func fakeDescribeCommand(ctx context.Context, command string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=TestHelperProcess")
+	cmd.Env = []string{"GO_WANT_HELPER_PROCESS=1", "TOOL_NAME=" + filepath.Base(command)}
+	return cmd
+}
+
+// TestHelperProcess prints a manifest for the tool named in TOOL_NAME.
+// It is not a real test.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("GO_WANT_HELPER_PROCESS") != "1" {
+		return
+	}
+	switch os.Getenv("TOOL_NAME") {
+	case "agentAI-greeter":
+		os.Stdout.WriteString("description: Says hello\ncommand_args:\n  name: world\narg_order: [name]\n")
+	case "agentAI-liar":
+		os.Stdout.WriteString("id: somethingelse\n")
+	default:
+		os.Exit(2)
+	}
+	os.Exit(0)
+}
+
+func TestDiscover(t *testing.T) {
+	orig := toolregistry.DescribeCommand
+	toolregistry.DescribeCommand = fakeDescribeCommand
+	defer func() { toolregistry.DescribeCommand = orig }()
+
+	dir := t.TempDir()
+	for _, name := range []string{"agentAI-greeter", "agentAI-liar", "agentAI-crashes", "README.md"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := toolregistry.Discover(dir)
+	if err == nil {
+		t.Error("expected errors for tools that fail to describe themselves")
+	}
+
+	all := toolregistry.All()
+	if len(all) != 1 {
+		t.Fatalf("expected only the valid tool to be registered, got %+v", all)
+	}
+	greeter, ok := toolregistry.Lookup("greeter")
+	if !ok {
+		t.Fatal("expected greeter to be registered")
+	}
+	if greeter.Name != "greeter" || greeter.Description != "Says hello" {
+		t.Errorf("expected id and name to default to the file name, got %+v", greeter)
+	}
+	if len(greeter.ArgOrder) != 1 || greeter.ArgOrder[0] != "name" || greeter.CommandArgs["name"] != "world" {
+		t.Errorf("expected manifest fields to be loaded, got %+v", greeter)
+	}
+	if path, err := toolregistry.BinaryPath("greeter"); err != nil || path != filepath.Join(dir, "agentAI-greeter") {
+		t.Errorf("expected the binary in the discovered directory, got %q, %v", path, err)
+	}
+}
+
+func TestDiscover_MissingDirectory(t *testing.T) {
+	if err := toolregistry.Discover(filepath.Join(t.TempDir(), "tools")); err != nil {
+		t.Fatalf("expected a missing directory to yield an empty registry, got %v", err)
+	}
+	if len(toolregistry.All()) != 0 {
+		t.Error("expected empty registry")
+	}
+}
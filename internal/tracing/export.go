@@ -0,0 +1,197 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Exporter sends an OTLP/JSON ExportTraceServiceRequest.
+type Exporter interface {
+	Export(request []byte) error
+}
+
+// DefaultEndpoint is the traces URL of a local OpenTelemetry collector.
+const DefaultEndpoint = "http://localhost:4318/v1/traces"
+
+// OTLPExporter posts export requests to the traces endpoint of an OTLP/HTTP collector.
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	client   *http.Client
+}
+
+// NewOTLPExporter returns an exporter posting to endpoint (DefaultEndpoint if empty) with the
+// given extra headers.
+func NewOTLPExporter(endpoint string, headers map[string]string) *OTLPExporter {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return &OTLPExporter{endpoint: endpoint, headers: headers, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Export posts request to the collector.
+func (e *OTLPExporter) Export(request []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, bytes.NewReader(request))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("collector returned %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// FileExporter appends each export request to a file as one JSON line, the format of the
+// collector's file exporter.
+type FileExporter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFileExporter opens path for appending, creating it if needed.
+func NewFileExporter(path string) (*FileExporter, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return &FileExporter{f: f}, nil
+}
+
+// Export writes request as a line.
+func (e *FileExporter) Export(request []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.f.Write(append(request, '\n'))
+	return err
+}
+
+// Close closes the file.
+func (e *FileExporter) Close() error {
+	return e.f.Close()
+}
+
+// The OTLP/JSON encoding of an ExportTraceServiceRequest. IDs are hex strings and 64-bit
+// integers are decimal strings, as the protobuf JSON mapping requires.
+type (
+	exportRequest struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}
+	resourceSpans struct {
+		Resource   resource     `json:"resource"`
+		ScopeSpans []scopeSpans `json:"scopeSpans"`
+	}
+	resource struct {
+		Attributes []keyValue `json:"attributes"`
+	}
+	scopeSpans struct {
+		Scope scope      `json:"scope"`
+		Spans []spanJSON `json:"spans"`
+	}
+	scope struct {
+		Name string `json:"name"`
+	}
+	spanJSON struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		Name              string     `json:"name"`
+		Kind              int        `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes,omitempty"`
+		Status            status     `json:"status"`
+	}
+	status struct {
+		// Code is 0 (unset) or 2 (error).
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+	anyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// scopeName is the instrumentation scope of every span.
+const scopeName = "krackenservices.com/agentAI"
+
+// encode builds the export request of spans.
+func encode(serviceName string, spans []*Span) []byte {
+	out := make([]spanJSON, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		j := spanJSON{
+			TraceID:           hex.EncodeToString(s.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.SpanID[:]),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.Finish.UnixNano(), 10),
+			Attributes:        attributes(s.attrs),
+		}
+		if s.ParentID != [8]byte{} {
+			j.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+		}
+		if s.isError {
+			j.Status = status{Code: 2, Message: s.errMsg}
+		}
+		s.mu.Unlock()
+		out = append(out, j)
+	}
+	req := exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: attributes([]Attribute{String("service.name", serviceName)})},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: scopeName}, Spans: out}},
+	}}}
+	b, _ := json.Marshal(req)
+	return b
+}
+
+func attributes(attrs []Attribute) []keyValue {
+	kvs := make([]keyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var v anyValue
+		switch x := a.Value.(type) {
+		case string:
+			v.StringValue = &x
+		case bool:
+			v.BoolValue = &x
+		case int64:
+			s := strconv.FormatInt(x, 10)
+			v.IntValue = &s
+		case int:
+			s := strconv.Itoa(x)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &x
+		default:
+			s := fmt.Sprint(x)
+			v.StringValue = &s
+		}
+		kvs = append(kvs, keyValue{Key: a.Key, Value: v})
+	}
+	return kvs
+}
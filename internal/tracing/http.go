@@ -0,0 +1,33 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	"krackenservices.com/agentAI/internal/metrics"
+)
+
+// Middleware records a server span for each request to next, named after the route pattern
+// it is registered under. The span continues the trace of the caller's traceparent header.
+func Middleware(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := current()
+		if t == nil {
+			next(w, r)
+			return
+		}
+		ctx, span := t.start(r.Context(), Extract(r), r.Method+" "+route, KindServer, []Attribute{
+			String("http.request.method", r.Method),
+			String("http.route", route),
+			String("url.path", r.URL.Path),
+		})
+		defer span.End()
+		rec := metrics.RecordStatus(w)
+		next(rec, r.WithContext(ctx))
+		code := rec.Status()
+		span.SetAttributes(Int("http.response.status_code", code))
+		if code >= 500 {
+			span.RecordError(fmt.Errorf("%d %s", code, http.StatusText(code)))
+		}
+	}
+}
@@ -0,0 +1,325 @@
+// Package tracing records spans of requests, model calls, tool executions and agent loop
+// iterations, propagates W3C trace context and exports spans in the OTLP/JSON encoding.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"krackenservices.com/agentAI/internal/config"
+)
+
+// Span kinds, as defined by OTLP.
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+// Span is one timed operation of a trace. A nil *Span is valid and records nothing, so
+// instrumented code does not need to check whether tracing is enabled.
+type Span struct {
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte
+	Name     string
+	Kind     int
+	Start    time.Time
+	// Finish is set by End.
+	Finish time.Time
+	// Sampled spans are exported; the others only carry the trace context.
+	Sampled bool
+
+	mu      sync.Mutex
+	attrs   []Attribute
+	errMsg  string
+	isError bool
+	tracer  *Tracer
+	ended   bool
+}
+
+// Attribute is a key/value pair of a span. Value is a string, bool, int, int64 or float64.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String, Int and Float build attributes.
+func String(key, value string) Attribute    { return Attribute{key, value} }
+func Int(key string, value int) Attribute   { return Attribute{key, int64(value)} }
+func Float(key string, v float64) Attribute { return Attribute{key, v} }
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil || !s.Sampled {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// RecordError marks the span as failed with err, if err is not nil.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.isError, s.errMsg = true, err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended, s.Finish = true, time.Now()
+	s.mu.Unlock()
+	if s.Sampled && s.tracer != nil {
+		s.tracer.queue(s)
+	}
+}
+
+// TraceParent formats the span as a W3C traceparent header value.
+func (s *Span) TraceParent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", hex.EncodeToString(s.TraceID[:]), hex.EncodeToString(s.SpanID[:]), flags)
+}
+
+type spanKey struct{}
+
+// FromContext returns the current span of ctx, or nil.
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start begins a span as a child of the span of ctx (or a new trace) on the default tracer,
+// and returns a context carrying it. It returns a nil span when tracing is disabled.
+func Start(ctx context.Context, name string, kind int, attrs ...Attribute) (context.Context, *Span) {
+	t := current()
+	if t == nil {
+		return ctx, nil
+	}
+	return t.start(ctx, FromContext(ctx), name, kind, attrs)
+}
+
+// Inject adds the traceparent header of the span of ctx to h, so that the receiver can
+// continue the trace.
+func Inject(ctx context.Context, h http.Header) {
+	if s := FromContext(ctx); s != nil {
+		h.Set("traceparent", s.TraceParent())
+	}
+}
+
+// Extract returns the remote parent of r from its traceparent header, or nil.
+func Extract(r *http.Request) *Span {
+	return parseTraceParent(r.Header.Get("traceparent"))
+}
+
+// parseTraceParent reads a W3C traceparent header into a remote parent span.
+func parseTraceParent(value string) *Span {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return nil
+	}
+	s := &Span{}
+	if _, err := hex.Decode(s.TraceID[:], []byte(parts[1])); err != nil || s.TraceID == [16]byte{} {
+		return nil
+	}
+	if _, err := hex.Decode(s.SpanID[:], []byte(parts[2])); err != nil || s.SpanID == [8]byte{} {
+		return nil
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return nil
+	}
+	s.Sampled = flags[0]&1 == 1
+	return s
+}
+
+// Tracer creates spans and exports the sampled ones in batches.
+type Tracer struct {
+	exporter    Exporter
+	serviceName string
+	// sampleRatio is the fraction of new traces that are sampled.
+	sampleRatio float64
+
+	mu      sync.Mutex
+	pending []*Span
+	flush   chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// batchSize and batchInterval bound how long spans wait for export.
+const (
+	batchSize     = 512
+	batchInterval = 5 * time.Second
+	// maxPending caps the spans kept while the exporter is slow; newer spans are dropped.
+	maxPending = 8192
+)
+
+// NewTracer returns a tracer exporting to e. Call Shutdown to export the remaining spans.
+func NewTracer(e Exporter, serviceName string, sampleRatio float64) *Tracer {
+	t := &Tracer{
+		exporter:    e,
+		serviceName: serviceName,
+		sampleRatio: sampleRatio,
+		flush:       make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+func (t *Tracer) start(ctx context.Context, parent *Span, name string, kind int, attrs []Attribute) (context.Context, *Span) {
+	s := &Span{Name: name, Kind: kind, Start: time.Now(), tracer: t}
+	if parent != nil {
+		s.TraceID, s.ParentID, s.Sampled = parent.TraceID, parent.SpanID, parent.Sampled
+	} else {
+		rand.Read(s.TraceID[:])
+		s.Sampled = t.sample()
+	}
+	rand.Read(s.SpanID[:])
+	s.SetAttributes(attrs...)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (t *Tracer) sample() bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	if t.sampleRatio <= 0 {
+		return false
+	}
+	n, _ := rand.Int(rand.Reader, big.NewInt(1<<30))
+	return float64(n.Int64()) < t.sampleRatio*(1<<30)
+}
+
+func (t *Tracer) queue(s *Span) {
+	t.mu.Lock()
+	if len(t.pending) < maxPending {
+		t.pending = append(t.pending, s)
+	}
+	full := len(t.pending) >= batchSize
+	t.mu.Unlock()
+	if full {
+		t.Flush()
+	}
+}
+
+// Flush asks for the pending spans to be exported without waiting for the batch interval.
+func (t *Tracer) Flush() {
+	select {
+	case t.flush <- struct{}{}:
+	default:
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(batchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.flush:
+		case <-t.done:
+			t.export()
+			return
+		}
+		t.export()
+	}
+}
+
+func (t *Tracer) export() {
+	t.mu.Lock()
+	spans := t.pending
+	t.pending = nil
+	t.mu.Unlock()
+	if len(spans) == 0 {
+		return
+	}
+	if err := t.exporter.Export(encode(t.serviceName, spans)); err != nil {
+		slog.Error("Error exporting spans", "spans", len(spans), "error", err)
+	}
+}
+
+// Shutdown exports the pending spans, waits for the export and stops the tracer.
+func (t *Tracer) Shutdown() {
+	close(t.done)
+	<-t.stopped
+}
+
+var (
+	defaultMu sync.RWMutex
+	tracer    *Tracer
+)
+
+func current() *Tracer {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return tracer
+}
+
+// SetDefault makes t the tracer used by Start; nil disables tracing.
+func SetDefault(t *Tracer) {
+	defaultMu.Lock()
+	tracer = t
+	defaultMu.Unlock()
+}
+
+// Configure builds the tracer described by cfg and makes it the default. It returns a function
+// that exports the remaining spans, or nil if tracing is disabled.
+func Configure(cfg *config.Config) (shutdown func(), err error) {
+	tc := cfg.Server.Tracing
+	var e Exporter
+	switch tc.Exporter {
+	case "":
+		return nil, nil
+	case config.TraceExporterFile:
+		if e, err = NewFileExporter(cfg.ResolvePath(tc.File)); err != nil {
+			return nil, err
+		}
+	case config.TraceExporterOTLP:
+		e = NewOTLPExporter(tc.Endpoint, tc.Headers)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", tc.Exporter)
+	}
+	name := tc.ServiceName
+	if name == "" {
+		name = "agentAI"
+	}
+	ratio := 1.0
+	if tc.SampleRatio != nil {
+		ratio = *tc.SampleRatio
+	}
+	t := NewTracer(e, name, ratio)
+	SetDefault(t)
+	return func() {
+		SetDefault(nil)
+		t.Shutdown()
+		if c, ok := e.(interface{ Close() error }); ok {
+			c.Close()
+		}
+	}, nil
+}
@@ -0,0 +1,141 @@
+package tracing_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"krackenservices.com/agentAI/internal/tracing"
+)
+
+// exportedSpan is the part of an OTLP/JSON span checked by the tests.
+type exportedSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Kind         int    `json:"kind"`
+	Status       struct {
+		Code int `json:"code"`
+	} `json:"status"`
+}
+
+func readSpans(t *testing.T, path string) []exportedSpan {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer f.Close()
+	var spans []exportedSpan
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			t.Fatalf("invalid export line %q: %v", scanner.Text(), err)
+		}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+func TestMiddleware_ContinuesTrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	e, err := tracing.NewFileExporter(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	tr := tracing.NewTracer(e, "test", 1)
+	tracing.SetDefault(tr)
+
+	var outgoing http.Header
+	h := tracing.Middleware("/api/v1/chat", func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(r.Context(), "tool fstool", tracing.KindInternal)
+		outgoing = http.Header{}
+		tracing.Inject(ctx, outgoing)
+		span.End()
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/chat", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	h(httptest.NewRecorder(), req)
+
+	tracing.SetDefault(nil)
+	tr.Shutdown()
+	e.Close()
+
+	spans := readSpans(t, path)
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %+v", spans)
+	}
+	tool, server := spans[0], spans[1]
+	if server.Name != "POST /api/v1/chat" || server.Kind != tracing.KindServer || server.Status.Code != 2 {
+		t.Errorf("unexpected server span %+v", server)
+	}
+	if server.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || server.ParentSpanID != "00f067aa0ba902b7" {
+		t.Errorf("expected the server span to continue the caller's trace, got %+v", server)
+	}
+	if tool.TraceID != server.TraceID || tool.ParentSpanID != server.SpanID {
+		t.Errorf("expected the tool span to be a child of the server span, got %+v", tool)
+	}
+	want := "00-" + tool.TraceID + "-" + tool.SpanID + "-01"
+	if got := outgoing.Get("traceparent"); got != want {
+		t.Errorf("expected traceparent %q, got %q", want, got)
+	}
+}
+
+func TestStart_Disabled(t *testing.T) {
+	ctx, span := tracing.Start(context.Background(), "noop", tracing.KindInternal)
+	span.SetAttributes(tracing.String("k", "v"))
+	span.End()
+	h := http.Header{}
+	tracing.Inject(ctx, h)
+	if span != nil || h.Get("traceparent") != "" {
+		t.Errorf("expected no span without a tracer, got %+v", span)
+	}
+}
+
+func TestMiddleware_UnsampledCaller(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	e, err := tracing.NewFileExporter(path)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	tr := tracing.NewTracer(e, "test", 1)
+	tracing.SetDefault(tr)
+
+	var outgoing string
+	h := tracing.Middleware("/api/v1/hello", func(w http.ResponseWriter, r *http.Request) {
+		outgoing = tracing.FromContext(r.Context()).TraceParent()
+	})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/hello", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	h(httptest.NewRecorder(), req)
+
+	tracing.SetDefault(nil)
+	tr.Shutdown()
+	e.Close()
+
+	if spans := readSpans(t, path); len(spans) != 0 {
+		t.Errorf("expected the caller's decision not to sample to be followed, got %+v", spans)
+	}
+	if !strings.HasPrefix(outgoing, "00-4bf92f3577b34da6a3ce929d0e0e4736-") || !strings.HasSuffix(outgoing, "-00") {
+		t.Errorf("expected the trace to be propagated unsampled, got %q", outgoing)
+	}
+}
@@ -0,0 +1,320 @@
+// Package usage records the tokens used by each chat, prices them per model and enforces
+// the budgets of the configuration.
+package usage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/llm"
+)
+
+// DayFormat is the format of days in records and reports (UTC).
+const DayFormat = "2006-01-02"
+
+// Default is the tracker of the server.
+var Default = NewTracker()
+
+// Record is the usage of one model call. Principal is the key of the caller, e.g. api_key:ci
+// (see auth.Principal.Key).
+type Record struct {
+	Time             time.Time `json:"time"`
+	Principal        string    `json:"principal"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Estimated        bool      `json:"estimated,omitempty"`
+	Cost             float64   `json:"cost"`
+}
+
+// Totals sums the usage of a group of records.
+type Totals struct {
+	Requests int `json:"requests"`
+	// EstimatedRequests counts the requests whose backend did not report usage: their tokens
+	// are approximated from the text with llm.EstimateTokens, and so is their cost.
+	EstimatedRequests int     `json:"estimated_requests"`
+	PromptTokens      int     `json:"prompt_tokens"`
+	CompletionTokens  int     `json:"completion_tokens"`
+	TotalTokens       int     `json:"total_tokens"`
+	Cost              float64 `json:"cost"`
+}
+
+func (t *Totals) add(o Totals) {
+	t.Requests += o.Requests
+	t.EstimatedRequests += o.EstimatedRequests
+	t.PromptTokens += o.PromptTokens
+	t.CompletionTokens += o.CompletionTokens
+	t.TotalTokens += o.TotalTokens
+	t.Cost += o.Cost
+}
+
+// Row is the usage of one group of a report. Day, Principal and Model are empty when the
+// report is not grouped by them.
+type Row struct {
+	Day       string `json:"day,omitempty"`
+	Principal string `json:"principal,omitempty"`
+	Model     string `json:"model,omitempty"`
+	Totals
+}
+
+type key struct {
+	day, principal, model string
+}
+
+// Tracker aggregates usage by day, principal and model, optionally appending every record to a file.
+type Tracker struct {
+	mu   sync.Mutex
+	rows map[key]*Totals
+	file *os.File
+}
+
+// NewTracker returns a tracker that keeps usage in memory.
+func NewTracker() *Tracker {
+	return &Tracker{rows: make(map[key]*Totals)}
+}
+
+// Open loads the records of path, a JSON-lines file, and appends new records to it. A missing
+// file is created.
+func (t *Tracker) Open(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("error opening usage file: %w", err)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			f.Close()
+			return fmt.Errorf("usage file %s: line %d: %w", path, line, err)
+		}
+		t.add(r)
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return fmt.Errorf("error reading usage file: %w", err)
+	}
+	if t.file != nil {
+		t.file.Close()
+	}
+	t.file = f
+	return nil
+}
+
+// Close closes the usage file.
+func (t *Tracker) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+func (t *Tracker) add(r Record) {
+	k := key{r.Time.UTC().Format(DayFormat), r.Principal, r.Model}
+	totals, ok := t.rows[k]
+	if !ok {
+		totals = &Totals{}
+		t.rows[k] = totals
+	}
+	estimated := 0
+	if r.Estimated {
+		estimated = 1
+	}
+	totals.add(Totals{
+		Requests:          1,
+		EstimatedRequests: estimated,
+		PromptTokens:      r.PromptTokens,
+		CompletionTokens:  r.CompletionTokens,
+		TotalTokens:       r.PromptTokens + r.CompletionTokens,
+		Cost:              r.Cost,
+	})
+}
+
+// Record adds the usage of a call to model by principal, priced with the pricing of the model.
+// Failing to append to the usage file is returned, but the usage is counted regardless.
+func (t *Tracker) Record(principal string, model config.ModelConfig, u llm.Usage) (Record, error) {
+	r := Record{
+		Time:             time.Now().UTC(),
+		Principal:        principal,
+		Model:            model.ID,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		Estimated:        u.Estimated,
+		Cost:             Cost(model.Pricing, u),
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(r)
+	if t.file == nil {
+		return r, nil
+	}
+	data, _ := json.Marshal(r)
+	if _, err := t.file.Write(append(data, '\n')); err != nil {
+		return r, fmt.Errorf("error writing usage file: %w", err)
+	}
+	return r, nil
+}
+
+// Cost prices u; models without pricing are free.
+func Cost(p *config.ModelPricing, u llm.Usage) float64 {
+	if p == nil {
+		return 0
+	}
+	return (float64(u.PromptTokens)*p.InputPerMillion + float64(u.CompletionTokens)*p.OutputPerMillion) / 1e6
+}
+
+// Filter selects the usage of a report. Empty fields match everything; From and To are
+// inclusive days. Principal is a principal key, or an ID that matches the principals with it
+// of every method.
+type Filter struct {
+	From, To  string
+	Principal string
+	Model     string
+}
+
+func (f Filter) matches(k key) bool {
+	return (f.From == "" || k.day >= f.From) && (f.To == "" || k.day <= f.To) &&
+		(f.Principal == "" || matchesPrincipal(f.Principal, k.principal)) && (f.Model == "" || k.model == f.Model)
+}
+
+// matchesPrincipal reports whether want, a principal key or a bare ID, names the principal
+// with the key.
+func matchesPrincipal(want, key string) bool {
+	if want == key {
+		return true
+	}
+	_, id, _ := strings.Cut(key, ":")
+	return !strings.Contains(want, ":") && want == id
+}
+
+// Report returns the usage matching f, summed over the fields not listed in groupBy ("day",
+// "principal", "model"), ordered by day, principal and model, and its total.
+func (t *Tracker) Report(f Filter, groupBy []string) ([]Row, Totals) {
+	group := make(map[string]bool)
+	for _, g := range groupBy {
+		group[g] = true
+	}
+	t.mu.Lock()
+	grouped := make(map[key]*Totals)
+	var total Totals
+	for k, totals := range t.rows {
+		if !f.matches(k) {
+			continue
+		}
+		var g key
+		if group["day"] {
+			g.day = k.day
+		}
+		if group["principal"] {
+			g.principal = k.principal
+		}
+		if group["model"] {
+			g.model = k.model
+		}
+		if grouped[g] == nil {
+			grouped[g] = &Totals{}
+		}
+		grouped[g].add(*totals)
+		total.add(*totals)
+	}
+	t.mu.Unlock()
+
+	rows := make([]Row, 0, len(grouped))
+	for k, totals := range grouped {
+		rows = append(rows, Row{Day: k.day, Principal: k.principal, Model: k.model, Totals: *totals})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.Day != b.Day {
+			return a.Day < b.Day
+		}
+		if a.Principal != b.Principal {
+			return a.Principal < b.Principal
+		}
+		return a.Model < b.Model
+	})
+	return rows, total
+}
+
+// BudgetError is returned when a request is rejected because a budget is spent.
+type BudgetError struct {
+	Budget string
+	// Reset is when the spent period of the budget ends.
+	Reset time.Time
+}
+
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("budget %q is exhausted until %s", e.Budget, e.Reset.Format(time.RFC3339))
+}
+
+// Check applies the budgets of cfg to a request by principal for model. It returns the model
+// the request should use, which differs from model when a budget downgrades it, or a
+// *BudgetError when a budget rejects it, or when every model it could be downgraded to is
+// over budget too.
+func (t *Tracker) Check(cfg *config.Config, principal, model string) (string, error) {
+	now := time.Now().UTC()
+	tried := map[string]bool{model: true}
+	for {
+		b, reset := t.exhausted(cfg.Usage.Budgets, principal, model, now)
+		if b == nil {
+			return model, nil
+		}
+		if b.Action != config.BudgetDowngrade || tried[b.DowngradeTo] {
+			return "", &BudgetError{Budget: b.ID, Reset: reset}
+		}
+		model = b.DowngradeTo
+		tried[model] = true
+	}
+}
+
+// exhausted returns the first budget that applies to the request and is spent, and the end of
+// its period.
+func (t *Tracker) exhausted(budgets []config.BudgetConfig, principal, model string, now time.Time) (*config.BudgetConfig, time.Time) {
+	today := now.Format(DayFormat)
+	month := now.Format("2006-01")
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	nextMonth := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range budgets {
+		b := &budgets[i]
+		if b.Model != "" && b.Model != model {
+			continue
+		}
+		if b.Principal != "" && b.Principal != "*" && !matchesPrincipal(b.Principal, principal) {
+			continue
+		}
+		var day, monthly Totals
+		for k, totals := range t.rows {
+			if (b.Model != "" && k.model != b.Model) || (b.Principal != "" && k.principal != principal) {
+				continue
+			}
+			if k.day == today {
+				day.add(*totals)
+			}
+			if k.day[:7] == month {
+				monthly.add(*totals)
+			}
+		}
+		if (b.MonthlyCost > 0 && monthly.Cost >= b.MonthlyCost) || (b.MonthlyTokens > 0 && monthly.TotalTokens >= b.MonthlyTokens) {
+			return b, nextMonth
+		}
+		if (b.DailyCost > 0 && day.Cost >= b.DailyCost) || (b.DailyTokens > 0 && day.TotalTokens >= b.DailyTokens) {
+			return b, tomorrow
+		}
+	}
+	return nil, time.Time{}
+}
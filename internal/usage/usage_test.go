@@ -0,0 +1,132 @@
+package usage_test
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"krackenservices.com/agentAI/internal/config"
+	"krackenservices.com/agentAI/internal/llm"
+	"krackenservices.com/agentAI/internal/usage"
+)
+
+var (
+	cheap   = config.ModelConfig{ID: "cheap", Pricing: &config.ModelPricing{InputPerMillion: 0.1, OutputPerMillion: 0.2}}
+	premium = config.ModelConfig{ID: "premium", Pricing: &config.ModelPricing{InputPerMillion: 10, OutputPerMillion: 30}}
+)
+
+func TestTracker_Report(t *testing.T) {
+	tr := usage.NewTracker()
+	tr.Record("ci", premium, llm.Usage{PromptTokens: 1000, CompletionTokens: 500})
+	tr.Record("ci", cheap, llm.Usage{PromptTokens: 2000, CompletionTokens: 1000, Estimated: true})
+	tr.Record("ops", premium, llm.Usage{PromptTokens: 100})
+
+	rows, total := tr.Report(usage.Filter{}, []string{"principal"})
+	if len(rows) != 2 || rows[0].Principal != "ci" || rows[0].Model != "" || rows[0].Requests != 2 || rows[0].TotalTokens != 4500 {
+		t.Fatalf("unexpected rows %+v", rows)
+	}
+	// 1000*10 + 500*30 + 2000*0.1 + 1000*0.2 = 25400 per million.
+	if math.Abs(rows[0].Cost-0.0254) > 1e-9 {
+		t.Errorf("expected cost 0.0254, got %v", rows[0].Cost)
+	}
+	if total.Requests != 3 || total.EstimatedRequests != 1 || total.PromptTokens != 3100 {
+		t.Errorf("unexpected total %+v", total)
+	}
+
+	today := time.Now().UTC().Format(usage.DayFormat)
+	rows, _ = tr.Report(usage.Filter{Model: "premium", From: today, To: today}, []string{"day", "principal", "model"})
+	if len(rows) != 2 || rows[0].Day != today || rows[1].Principal != "ops" {
+		t.Errorf("expected premium usage by principal, got %+v", rows)
+	}
+	if rows, _ := tr.Report(usage.Filter{To: "2000-01-01"}, nil); len(rows) != 0 {
+		t.Errorf("expected no usage before the range, got %+v", rows)
+	}
+}
+
+func TestTracker_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.jsonl")
+	tr := usage.NewTracker()
+	if err := tr.Open(path); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	tr.Record("ci", cheap, llm.Usage{PromptTokens: 10, CompletionTokens: 5})
+	tr.Close()
+
+	reopened := usage.NewTracker()
+	if err := reopened.Open(path); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer reopened.Close()
+	if _, total := reopened.Report(usage.Filter{}, nil); total.Requests != 1 || total.TotalTokens != 15 {
+		t.Errorf("expected the recorded usage to be loaded, got %+v", total)
+	}
+}
+
+func TestTracker_Check(t *testing.T) {
+	cfg := &config.Config{
+		Models: []config.ModelConfig{cheap, premium},
+		Usage: config.UsageConfig{Budgets: []config.BudgetConfig{
+			{ID: "premium-per-key", Principal: "*", Model: "premium", DailyCost: 0.01, Action: config.BudgetDowngrade, DowngradeTo: "cheap"},
+			{ID: "everyone", MonthlyTokens: 10000},
+		}},
+	}
+	tr := usage.NewTracker()
+
+	if model, err := tr.Check(cfg, "ci", "premium"); err != nil || model != "premium" {
+		t.Fatalf("expected premium within budget, got %q, %v", model, err)
+	}
+	tr.Record("ci", premium, llm.Usage{PromptTokens: 1000}) // 0.01
+	if model, err := tr.Check(cfg, "ci", "premium"); err != nil || model != "cheap" {
+		t.Errorf("expected a downgrade to cheap, got %q, %v", model, err)
+	}
+	// The per-key budget applies to each caller separately.
+	if model, _ := tr.Check(cfg, "ops", "premium"); model != "premium" {
+		t.Errorf("expected another key to keep premium, got %q", model)
+	}
+
+	// The shared monthly budget rejects everyone once spent.
+	tr.Record("ops", cheap, llm.Usage{PromptTokens: 9000})
+	_, err := tr.Check(cfg, "ops", "cheap")
+	var budgetErr *usage.BudgetError
+	if !errors.As(err, &budgetErr) || budgetErr.Budget != "everyone" || !budgetErr.Reset.After(time.Now()) {
+		t.Errorf("expected the monthly budget to reject, got %v", err)
+	}
+}
+
+func TestTracker_PrincipalKeys(t *testing.T) {
+	cfg := &config.Config{
+		Models: []config.ModelConfig{cheap},
+		Usage: config.UsageConfig{Budgets: []config.BudgetConfig{
+			{ID: "ci-key", Principal: "api_key:ci", DailyTokens: 100},
+			{ID: "ci", Principal: "ci", DailyTokens: 1000},
+		}},
+	}
+	tr := usage.NewTracker()
+	tr.Record("api_key:ci", cheap, llm.Usage{PromptTokens: 100})
+	tr.Record("jwt:ci", cheap, llm.Usage{PromptTokens: 10})
+
+	// An API key and a JWT subject with the same ID are different principals.
+	if rows, _ := tr.Report(usage.Filter{Principal: "jwt:ci"}, []string{"principal"}); len(rows) != 1 || rows[0].TotalTokens != 10 {
+		t.Errorf("expected only the usage of the JWT subject, got %+v", rows)
+	}
+	if rows, _ := tr.Report(usage.Filter{Principal: "ci"}, []string{"principal"}); len(rows) != 2 {
+		t.Errorf("expected the usage of both principals with the ID, got %+v", rows)
+	}
+	if rows, _ := tr.Report(usage.Filter{Principal: "key:ci"}, nil); len(rows) != 0 {
+		t.Errorf("expected no usage for another key, got %+v", rows)
+	}
+
+	var budgetErr *usage.BudgetError
+	if _, err := tr.Check(cfg, "api_key:ci", "cheap"); !errors.As(err, &budgetErr) || budgetErr.Budget != "ci-key" {
+		t.Errorf("expected the budget of the key to reject, got %v", err)
+	}
+	if _, err := tr.Check(cfg, "jwt:ci", "cheap"); err != nil {
+		t.Errorf("expected the JWT subject to keep its own budget, got %v", err)
+	}
+	tr.Record("jwt:ci", cheap, llm.Usage{PromptTokens: 990})
+	if _, err := tr.Check(cfg, "jwt:ci", "cheap"); !errors.As(err, &budgetErr) || budgetErr.Budget != "ci" {
+		t.Errorf("expected the budget of the ID to apply to the JWT subject, got %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+// Package version reports the version the binaries were built from.
+package version
+
+import "runtime/debug"
+
+// Version is set at build time with -ldflags "-X krackenservices.com/agentAI/internal/version.Version=v1.2.3".
+var Version = "dev"
+
+// Commit returns the VCS revision embedded by the Go toolchain, or "".
+func Commit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return ""
+}
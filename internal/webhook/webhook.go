@@ -0,0 +1,345 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"krackenservices.com/agentAI/internal/toolmodel"
+	"krackenservices.com/agentAI/internal/tracing"
+)
+
+// DefaultTimeout is used when a webhook tool does not configure its own timeout.
+const DefaultTimeout = 30 * time.Second
+
+// DefaultMaxResponse bounds the response body read from a webhook that does not configure
+// its own limit.
+const DefaultMaxResponse = 1 << 20
+
+// maxErrorBody limits how much of an error response is included in the returned error.
+const maxErrorBody = 512
+
+// Client is the HTTP client used for webhook calls. Tests may replace it.
+var Client = &http.Client{}
+
+// wholeArg matches a body value that is exactly one argument reference, e.g. "{{.count}}".
+// Such values are replaced with the raw argument so numbers, booleans and objects keep their type.
+var wholeArg = regexp.MustCompile(`^\{\{\s*\.(\w+)\s*\}\}$`)
+
+// urlFuncs escape the values rendered into a webhook URL. Actions that do not end in one of
+// them are escaped with pathEscape, or with queryEscape after the "?" of the URL, so that
+// arguments cannot change the path or query the URL was configured with.
+var urlFuncs = template.FuncMap{
+	"pathEscape":  func(v interface{}) string { return url.PathEscape(fmt.Sprint(v)) },
+	"queryEscape": func(v interface{}) string { return url.QueryEscape(fmt.Sprint(v)) },
+}
+
+// Call invokes the webhook described by cfg with the given arguments and returns
+// the (optionally extracted) response body.
+func Call(ctx context.Context, cfg *toolmodel.HTTPConfig, args map[string]interface{}) (string, error) {
+	if cfg == nil || cfg.URL == "" {
+		return "", fmt.Errorf("webhook tool has no url configured")
+	}
+
+	timeout := DefaultTimeout
+	if cfg.Timeout != "" {
+		d, err := time.ParseDuration(cfg.Timeout)
+		if err != nil {
+			return "", fmt.Errorf("invalid webhook timeout %q: %w", cfg.Timeout, err)
+		}
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	method := strings.ToUpper(cfg.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	target, err := renderURL(cfg.URL, args)
+	if err != nil {
+		return "", err
+	}
+
+	var body io.Reader
+	if method == http.MethodGet || method == http.MethodDelete || method == http.MethodHead {
+		// Without a body mapping, arguments become query parameters.
+		if cfg.Body == nil {
+			target, err = withQuery(target, args)
+			if err != nil {
+				return "", err
+			}
+		}
+	} else {
+		payload := interface{}(args)
+		if cfg.Body != nil {
+			payload, err = mapBody(cfg.Body, args)
+			if err != nil {
+				return "", err
+			}
+		}
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal webhook body: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return "", fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range cfg.Headers {
+		rendered, err := render("header "+k, v, args)
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set(k, rendered)
+	}
+	if err := applyAuth(req, cfg.Auth); err != nil {
+		return "", err
+	}
+	tracing.Inject(ctx, req.Header)
+
+	resp, err := Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	limit := cfg.MaxResponseBytes
+	if limit <= 0 {
+		limit = DefaultMaxResponse
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return "", fmt.Errorf("error reading webhook response: %w", err)
+	}
+	if int64(len(respBody)) > limit {
+		return "", fmt.Errorf("webhook response exceeds %d bytes", limit)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		snippet := string(respBody)
+		if len(snippet) > maxErrorBody {
+			snippet = snippet[:maxErrorBody] + "..."
+		}
+		return "", fmt.Errorf("webhook returned status %d: %s", resp.StatusCode, snippet)
+	}
+
+	if cfg.Response == "" {
+		return string(respBody), nil
+	}
+	return extract(respBody, cfg.Response)
+}
+
+// render executes a Go template against the tool arguments. An argument the template
+// refers to but the call does not provide is an error.
+func render(name, text string, args map[string]interface{}) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook %s template: %w", name, err)
+	}
+	return execute(tmpl, args)
+}
+
+// renderURL renders the URL template, escaping every value as urlFuncs describes.
+func renderURL(text string, args map[string]interface{}) (string, error) {
+	tmpl, err := template.New("url").Funcs(urlFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook url template: %w", err)
+	}
+	query := false
+	escapeActions(tmpl.Tree.Root, &query)
+	return execute(tmpl, args)
+}
+
+func execute(tmpl *template.Template, args map[string]interface{}) (string, error) {
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, args); err != nil {
+		return "", fmt.Errorf("error rendering webhook %s template: %w", tmpl.Name(), err)
+	}
+	return sb.String(), nil
+}
+
+// escapeActions ends every action of list that prints a value and is not already escaped
+// with pathEscape, or with queryEscape once query is set by a "?" in the text before it.
+func escapeActions(list *parse.ListNode, query *bool) {
+	if list == nil {
+		return
+	}
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.TextNode:
+			if bytes.ContainsRune(n.Text, '?') {
+				*query = true
+			}
+		case *parse.ActionNode:
+			if len(n.Pipe.Decl) > 0 {
+				continue
+			}
+			last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+			if id, ok := last.Args[0].(*parse.IdentifierNode); ok && urlFuncs[id.Ident] != nil {
+				continue
+			}
+			fn := "pathEscape"
+			if *query {
+				fn = "queryEscape"
+			}
+			n.Pipe.Cmds = append(n.Pipe.Cmds, escapeCommands[fn])
+		case *parse.IfNode:
+			escapeActions(n.List, query)
+			escapeActions(n.ElseList, query)
+		case *parse.RangeNode:
+			escapeActions(n.List, query)
+			escapeActions(n.ElseList, query)
+		case *parse.WithNode:
+			escapeActions(n.List, query)
+			escapeActions(n.ElseList, query)
+		}
+	}
+}
+
+// escapeCommands holds the "| pathEscape" and "| queryEscape" commands that escapeActions
+// appends, parsed once.
+var escapeCommands = func() map[string]*parse.CommandNode {
+	cmds := make(map[string]*parse.CommandNode)
+	for fn := range urlFuncs {
+		t := template.Must(template.New(fn).Funcs(urlFuncs).Parse("{{. | " + fn + "}}"))
+		pipe := t.Tree.Root.Nodes[0].(*parse.ActionNode).Pipe
+		cmds[fn] = pipe.Cmds[len(pipe.Cmds)-1]
+	}
+	return cmds
+}()
+
+// mapBody builds the request body from the configured mapping, rendering every string value.
+func mapBody(mapping map[string]interface{}, args map[string]interface{}) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(mapping))
+	for k, v := range mapping {
+		mapped, err := mapValue(k, v, args)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = mapped
+	}
+	return out, nil
+}
+
+func mapValue(key string, v interface{}, args map[string]interface{}) (interface{}, error) {
+	switch val := v.(type) {
+	case string:
+		if m := wholeArg.FindStringSubmatch(val); m != nil {
+			arg, ok := args[m[1]]
+			if !ok {
+				return nil, fmt.Errorf("error rendering webhook body %s: missing argument %q", key, m[1])
+			}
+			return arg, nil
+		}
+		return render("body "+key, val, args)
+	case map[string]interface{}:
+		return mapBody(val, args)
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(val))
+		for mk, mv := range val {
+			converted[fmt.Sprintf("%v", mk)] = mv
+		}
+		return mapBody(converted, args)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			mapped, err := mapValue(key, item, args)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = mapped
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// withQuery appends the arguments to the URL as query parameters.
+func withQuery(target string, args map[string]interface{}) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid webhook url %q: %w", target, err)
+	}
+	q := u.Query()
+	for k, v := range args {
+		q.Set(k, fmt.Sprintf("%v", v))
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// applyAuth adds the configured credentials to the request.
+func applyAuth(req *http.Request, auth *toolmodel.HTTPAuth) error {
+	if auth == nil {
+		return nil
+	}
+	switch strings.ToLower(auth.Type) {
+	case "basic":
+		req.SetBasicAuth(auth.Username, auth.Password)
+	case "bearer":
+		req.Header.Set("Authorization", "Bearer "+auth.Token)
+	case "header":
+		if auth.Header == "" {
+			return fmt.Errorf("webhook auth type 'header' requires a header name")
+		}
+		req.Header.Set(auth.Header, auth.Token)
+	default:
+		return fmt.Errorf("unsupported webhook auth type %q", auth.Type)
+	}
+	return nil
+}
+
+// extract walks a dotted path (e.g. "data.items.0.name") through a JSON document.
+// Strings are returned as-is; any other value is returned as JSON.
+func extract(body []byte, path string) (string, error) {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return "", fmt.Errorf("webhook response is not JSON, cannot extract %q: %w", path, err)
+	}
+	cur := doc
+	for _, part := range strings.Split(path, ".") {
+		switch node := cur.(type) {
+		case map[string]interface{}:
+			next, ok := node[part]
+			if !ok {
+				return "", fmt.Errorf("webhook response has no field %q (path %q)", part, path)
+			}
+			cur = next
+		case []interface{}:
+			idx, err := strconv.Atoi(part)
+			if err != nil || idx < 0 || idx >= len(node) {
+				return "", fmt.Errorf("webhook response has no index %q (path %q)", part, path)
+			}
+			cur = node[idx]
+		default:
+			return "", fmt.Errorf("webhook response cannot descend into %q (path %q)", part, path)
+		}
+	}
+	if s, ok := cur.(string); ok {
+		return s, nil
+	}
+	out, err := json.Marshal(cur)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal extracted value: %w", err)
+	}
+	return string(out), nil
+}
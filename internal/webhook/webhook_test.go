@@ -0,0 +1,186 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"krackenservices.com/agentAI/internal/toolmodel"
+	"krackenservices.com/agentAI/internal/webhook"
+)
+
+// TestCall_PostWithBodyMappingAndExtraction verifies templating, auth, body mapping and response extraction.
+func TestCall_PostWithBodyMappingAndExtraction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("expected POST, got %s", r.Method)
+		}
+		if r.URL.Path != "/issues/42/comments" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("expected bearer auth, got %q", got)
+		}
+		if got := r.Header.Get("X-Project"); got != "agent-42" {
+			t.Errorf("expected templated header, got %q", got)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("error decoding body: %v", err)
+		}
+		if body["text"] != "Comment: hello" {
+			t.Errorf("expected rendered text, got %v", body["text"])
+		}
+		// Whole-argument references keep the argument's type.
+		if body["count"] != float64(3) {
+			t.Errorf("expected numeric count, got %#v", body["count"])
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": {"comment": {"id": "c-1"}, "items": [{"name": "first"}]}}`))
+	}))
+	defer srv.Close()
+
+	cfg := &toolmodel.HTTPConfig{
+		URL:      srv.URL + "/issues/{{.issue}}/comments",
+		Headers:  map[string]string{"X-Project": "agent-{{.issue}}"},
+		Auth:     &toolmodel.HTTPAuth{Type: "bearer", Token: "secret"},
+		Body:     map[string]interface{}{"text": "Comment: {{.text}}", "count": "{{ .count }}"},
+		Response: "data.items.0.name",
+	}
+	args := map[string]interface{}{"issue": "42", "text": "hello", "count": 3}
+
+	out, err := webhook.Call(context.Background(), cfg, args)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if out != "first" {
+		t.Errorf("expected extracted value %q, got %q", "first", out)
+	}
+
+	cfg.Response = "data.comment"
+	out, err = webhook.Call(context.Background(), cfg, args)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if out != `{"id":"c-1"}` {
+		t.Errorf("expected extracted object as JSON, got %q", out)
+	}
+
+	// A missing argument fails the call rather than sending null.
+	delete(args, "count")
+	if _, err := webhook.Call(context.Background(), cfg, args); err == nil || !strings.Contains(err.Error(), `"count"`) {
+		t.Errorf("expected an error for the missing argument, got %v", err)
+	}
+}
+
+// TestCall_GetUsesQueryParameters verifies that GET requests without a body mapping send args as query parameters.
+func TestCall_GetUsesQueryParameters(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") != "disk full" {
+			t.Errorf("expected query parameter q, got %q", r.URL.RawQuery)
+		}
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "bot" || pass != "pw" {
+			t.Errorf("expected basic auth, got %q/%q", user, pass)
+		}
+		w.Write([]byte("plain result"))
+	}))
+	defer srv.Close()
+
+	cfg := &toolmodel.HTTPConfig{
+		Method: "get",
+		URL:    srv.URL + "/search",
+		Auth:   &toolmodel.HTTPAuth{Type: "basic", Username: "bot", Password: "pw"},
+	}
+	out, err := webhook.Call(context.Background(), cfg, map[string]interface{}{"q": "disk full"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if out != "plain result" {
+		t.Errorf("expected raw body, got %q", out)
+	}
+}
+
+// TestCall_ErrorStatus verifies that non-2xx responses are returned as errors.
+func TestCall_ErrorStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := webhook.Call(context.Background(), &toolmodel.HTTPConfig{URL: srv.URL}, nil)
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("expected status 403 error, got %v", err)
+	}
+}
+
+// TestCall_Timeout verifies that the configured timeout aborts slow endpoints.
+func TestCall_Timeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(500 * time.Millisecond):
+		}
+	}))
+	defer srv.Close()
+
+	start := time.Now()
+	_, err := webhook.Call(context.Background(), &toolmodel.HTTPConfig{URL: srv.URL, Timeout: "50ms"}, nil)
+	if err == nil {
+		t.Fatal("expected timeout error, got nil")
+	}
+	if time.Since(start) > 400*time.Millisecond {
+		t.Errorf("expected call to abort after timeout, took %v", time.Since(start))
+	}
+}
+
+// TestCall_EscapesURLValues verifies that arguments cannot change the path or query of the URL.
+func TestCall_EscapesURLValues(t *testing.T) {
+	var paths, queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath())
+		queries = append(queries, r.URL.RawQuery)
+	}))
+	defer srv.Close()
+
+	cfg := &toolmodel.HTTPConfig{Method: "get", URL: srv.URL + "/issues/{{.id}}?project={{.project}}", Body: map[string]interface{}{}}
+	args := map[string]interface{}{"id": "../admin?x=", "project": "a&admin=1"}
+	if _, err := webhook.Call(context.Background(), cfg, args); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if paths[0] != "/issues/..%2Fadmin%3Fx=" || queries[0] != "project=a%26admin%3D1" {
+		t.Errorf("expected escaped values, got path %q query %q", paths[0], queries[0])
+	}
+
+	// An explicit escape function is not applied twice.
+	cfg.URL = srv.URL + "/search?q={{queryEscape .q}}"
+	if _, err := webhook.Call(context.Background(), cfg, map[string]interface{}{"q": "disk full"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if queries[1] != "q=disk+full" {
+		t.Errorf("expected the query escaped once, got %q", queries[1])
+	}
+
+	if _, err := webhook.Call(context.Background(), cfg, nil); err == nil || !strings.Contains(err.Error(), "q") {
+		t.Errorf("expected an error for a missing argument, got %v", err)
+	}
+}
+
+// TestCall_ResponseLimit verifies that responses larger than the configured limit fail the call.
+func TestCall_ResponseLimit(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer srv.Close()
+
+	if out, err := webhook.Call(context.Background(), &toolmodel.HTTPConfig{URL: srv.URL, MaxResponseBytes: 100}, nil); err != nil || len(out) != 100 {
+		t.Errorf("expected the whole response within the limit, got %d bytes, %v", len(out), err)
+	}
+	if _, err := webhook.Call(context.Background(), &toolmodel.HTTPConfig{URL: srv.URL, MaxResponseBytes: 99}, nil); err == nil || !strings.Contains(err.Error(), "exceeds 99 bytes") {
+		t.Errorf("expected an error for a response over the limit, got %v", err)
+	}
+}
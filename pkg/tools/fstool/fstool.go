@@ -9,7 +9,7 @@ import (
 	"os"
 )
 
-// Embed the default configuration for fstool.
+// Embed the manifest describing fstool to the agentAI server.
 //
 //go:embed fstool.yml
 var defaultFstoolConfig string
@@ -17,8 +17,14 @@ var defaultFstoolConfig string
 func main() {
 	// Define a flag for the path parameter.
 	path := flag.String("path", "", "Path to read from (file or directory)")
+	describe := flag.Bool("describe", false, "Print the tool manifest and exit")
 	flag.Parse()
 
+	if *describe {
+		fmt.Print(defaultFstoolConfig)
+		return
+	}
+
 	// Ensure a path was provided.
 	if *path == "" {
 		log.Fatal("Please provide a path using the -path flag")